@@ -0,0 +1,94 @@
+package objectql
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/aundis/graphql/language/ast"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 任意类型
+// AnyType 的值直接保存为 BSON, 查询时转换为 map[string]interface{}/[]interface{} 方便 graphql 输出和公式读取
+
+func formatAnyValueToDatabase(v interface{}) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+	return v, nil
+}
+
+// 递归转换驱动返回的 bson 类型
+func formatAnyValueFromDatabase(v interface{}) interface{} {
+	switch n := v.(type) {
+	case bson.M:
+		return formatAnyValueFromDatabase(map[string]interface{}(n))
+	case map[string]interface{}:
+		result := M{}
+		for k, item := range n {
+			result[k] = formatAnyValueFromDatabase(item)
+		}
+		return result
+	case bson.D:
+		return formatAnyValueFromDatabase(n.Map())
+	case bson.A:
+		return formatAnyValueFromDatabase([]interface{}(n))
+	case []interface{}:
+		result := make([]interface{}, 0, len(n))
+		for _, item := range n {
+			result = append(result, formatAnyValueFromDatabase(item))
+		}
+		return result
+	case primitive.ObjectID:
+		return n.Hex()
+	case primitive.DateTime:
+		return n.Time()
+	case primitive.Decimal128:
+		return n.String()
+	}
+	return v
+}
+
+// 数字类型可能不同(int32/int64/float64), 转成 json 后比较
+func isAnyValueEqual(v1, v2 interface{}) (bool, error) {
+	b1, err := json.Marshal(formatAnyValueFromDatabase(v1))
+	if err != nil {
+		return false, err
+	}
+	b2, err := json.Marshal(formatAnyValueFromDatabase(v2))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b1, b2), nil
+}
+
+// graphql 中直接书写的对象和数组
+func parseGraphqlAnyLiteral(valueAST ast.Value) interface{} {
+	switch n := valueAST.(type) {
+	case *ast.ObjectValue:
+		result := M{}
+		for _, field := range n.Fields {
+			result[field.Name.Value] = parseGraphqlAnyLiteral(field.Value)
+		}
+		return result
+	case *ast.ListValue:
+		result := make([]interface{}, 0, len(n.Values))
+		for _, item := range n.Values {
+			result = append(result, parseGraphqlAnyLiteral(item))
+		}
+		return result
+	case *ast.IntValue:
+		return gconv.Int(n.Value)
+	case *ast.FloatValue:
+		return gconv.Float64(n.Value)
+	case *ast.StringValue:
+		return n.Value
+	case *ast.BooleanValue:
+		return n.Value
+	case *ast.EnumValue:
+		return n.Value
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAnyField(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "配置",
+		Api:  "setting",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "内容",
+				Api:  "config",
+				Type: Any,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	changes := 0
+	oql.ListenChange("setting", &ListenChangeHandler{
+		Listen: []string{"config"},
+		Handle: func(ctx context.Context, change map[string]bool, cur, before *Var) error {
+			changes++
+			return nil
+		},
+	})
+	setting, err := oql.Insert(ctx, "setting", InsertOptions{
+		Doc:    M{"name": "界面", "config": M{"theme": "dark", "size": 12, "tags": []string{"a", "b"}}},
+		Fields: []string{"_id", "config"},
+	})
+	if err != nil {
+		t.Error("插入配置失败", err)
+		return
+	}
+	config := setting.Var("config")
+	if config.String("theme") != "dark" || config.Int("size") != 12 || len(config.Strings("tags")) != 2 {
+		t.Error("任意类型的值错误", setting)
+		return
+	}
+	if _, ok := setting.Any("config").(map[string]any); !ok {
+		t.Errorf("任意类型应该返回 map, 实际为 %T", setting.Any("config"))
+		return
+	}
+	list, err := oql.FindList(ctx, "setting", FindListOptions{
+		Filter: M{"config.theme": "dark"},
+		Fields: []string{"name"},
+	})
+	if err != nil || len(list) != 1 {
+		t.Error("按任意类型的子路径过滤失败", err, list)
+		return
+	}
+	id := setting.String("_id")
+	changes = 0
+	// 相同的值不算修改
+	_, err = oql.UpdateById(ctx, "setting", UpdateByIdOptions{ID: id, Doc: M{"config": M{"theme": "dark", "size": 12.0, "tags": []any{"a", "b"}}}})
+	if err != nil || changes != 0 {
+		t.Error("相同的值不应该触发修改", err, changes)
+		return
+	}
+	_, err = oql.UpdateById(ctx, "setting", UpdateByIdOptions{ID: id, Doc: M{"config": M{"theme": "light"}}})
+	if err != nil || changes != 1 {
+		t.Error("修改任意类型应该触发修改", err, changes)
+		return
+	}
+	// graphql 输入输出
+	res := oql.Do(ctx, `mutation {
+		setting__insert(doc: { name: "通知", config: { email: true, hours: [9, 18] } }) { config }
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 插入失败", res.Errors)
+		return
+	}
+	config = NewVar(res.Data).Var("setting__insert").Var("config")
+	if !config.Bool("email") || len(config.Ints("hours")) != 2 {
+		t.Error("graphql 返回的任意类型错误", res.Data)
+	}
+}
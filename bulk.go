@@ -0,0 +1,490 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 批量写入
+// 每条记录单独做默认值、校验和权限处理, 然后一次写入数据库
+// 公式和聚合字段在整批写入后统一计算, 同一条记录的同一个字段只计算一次
+// skipInvalid 只跳过写入数据库之前失败的行, 写入之后的校验失败会让整批回滚
+
+var graphqlBulkRowError = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlBulkRowError",
+	Fields: graphql.Fields{
+		"index":   &graphql.Field{Type: graphql.Int},
+		"message": &graphql.Field{Type: graphql.String},
+	},
+})
+
+// InsertMany 批量新增, 返回的列表和 Docs 一一对应, 失败的行为 nil
+func (o *Objectql) InsertMany(ctx context.Context, objectApi string, options InsertManyOptions) ([]*Var, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := o.insertManyHandle(ctx, object.Api, options.Docs, options.SkipInvalid)
+	var bulkErr *BulkError
+	if err != nil && !errors.As(err, &bulkErr) {
+		return nil, err
+	}
+	list, qerr := o.findVarsByIds(ctx, object, ids, options.Fields)
+	if qerr != nil {
+		return nil, qerr
+	}
+	return list, err
+}
+
+// UpdateMany 按id批量修改, 返回的列表和 IDs 一一对应, 失败或者不存在的行为 nil
+func (o *Objectql) UpdateMany(ctx context.Context, objectApi string, options UpdateManyOptions) ([]*Var, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	docs := options.Docs
+	if len(docs) == 0 {
+		for range options.IDs {
+			docs = append(docs, options.Doc)
+		}
+	}
+	if len(docs) != len(options.IDs) {
+		return nil, errors.New("docs length not equal to ids")
+	}
+	ids, err := o.updateManyByIdsHandle(ctx, object.Api, options.IDs, docs, options.SkipInvalid)
+	var bulkErr *BulkError
+	if err != nil && !errors.As(err, &bulkErr) {
+		return nil, err
+	}
+	list, qerr := o.findVarsByIds(ctx, object, ids, options.Fields)
+	if qerr != nil {
+		return nil, qerr
+	}
+	return list, err
+}
+
+// 按id查询并保持顺序, 空的id结果为 nil
+func (o *Objectql) findVarsByIds(ctx context.Context, object *Object, ids []string, fields []string) ([]*Var, error) {
+	list, err := o.findManyByIds(ctx, object, ids, append(queryFieldsOrDefault(fields), "_id"))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Var, len(ids))
+	for i, item := range list {
+		result[i], err = o.queryResultToVar(ctx, object, item, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (o *Objectql) findManyByIds(ctx context.Context, object *Object, ids []string, fields []string) ([]M, error) {
+	var objectIds []primitive.ObjectID
+	for _, id := range ids {
+		if len(id) > 0 {
+			objectIds = append(objectIds, ObjectIdFromHex(id))
+		}
+	}
+	result := make([]M, len(ids))
+	if len(objectIds) == 0 {
+		return result, nil
+	}
+	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
+		Fields: fields,
+		Filter: M{"_id": M{"$in": objectIds}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]M{}
+	for _, item := range list {
+		index[gconv.String(item["_id"])] = item
+	}
+	for i, id := range ids {
+		if len(id) > 0 {
+			result[i] = index[id]
+		}
+	}
+	return result, nil
+}
+
+// 返回的id和docs一一对应, 失败的行为空字符串, 跳过的行通过 *BulkError 返回
+func (o *Objectql) insertManyHandle(ctx context.Context, api string, docs []map[string]interface{}, skipInvalid bool) ([]string, error) {
+	var bulkErr *BulkError
+	res, err := o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		ids, rowErr, err := o.insertManyHandleRaw(ctx, api, docs, skipInvalid)
+		bulkErr = rowErr
+		return ids, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bulkErr != nil {
+		return res.([]string), bulkErr
+	}
+	return res.([]string), nil
+}
+
+func (o *Objectql) insertManyHandleRaw(ctx context.Context, api string, docs []map[string]interface{}, skipInvalid bool) ([]string, *BulkError, error) {
+	object := FindObjectFromList(o.list, api)
+	if object == nil {
+		return nil, nil, ErrNotFoundObject
+	}
+	docs = copyStrAnyMaps(docs)
+	// insertManyBefore 事件触发 (可以修改表单内容)
+	if ctx.Value(blockEventsKey) != true {
+		err := o.triggerInsertManyBefore(ctx, api, newVars(docs))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	bulkErr := &BulkError{}
+	prepared := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		err := o.checkInputDocument(object, doc)
+		if err == nil {
+			prepared[i], err = o.insertPrepare(ctx, object, doc)
+		}
+		if err != nil {
+			prepared[i] = nil
+			bulkErr.add(i, err)
+		}
+	}
+	if len(bulkErr.Rows) > 0 && !skipInvalid {
+		return nil, nil, bulkErr
+	}
+	var rows []int
+	var rowDocs []bson.M
+	for i, doc := range prepared {
+		if doc != nil {
+			rows = append(rows, i)
+			rowDocs = append(rowDocs, doc)
+		}
+	}
+	// 写索引位置
+	if object.Index {
+		err := o.initInsertManyRowIndex(ctx, object, rowDocs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// 写入到数据库
+	var ids []string
+	if len(rowDocs) > 0 {
+		var err error
+		ids, err = o.mongoInsertMany(ctx, api, rowDocs)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// 数据联动, 计算延迟到最后
+	batchCtx, batch := withComputeBatch(ctx)
+	for j, id := range ids {
+		err := o.insertLink(batchCtx, object, id, rowDocs[j])
+		if err != nil {
+			return nil, nil, &BulkError{Rows: []*BulkRowError{{Index: rows[j], Err: err}}}
+		}
+	}
+	err := o.flushComputeBatch(ctx, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	for j, id := range ids {
+		err := o.insertFinish(ctx, object, id, rowDocs[j])
+		if err != nil {
+			return nil, nil, &BulkError{Rows: []*BulkRowError{{Index: rows[j], Err: err}}}
+		}
+	}
+	// insertManyAfter 事件触发
+	if ctx.Value(blockEventsKey) != true && len(ids) > 0 {
+		var vars []*Var
+		for _, doc := range rowDocs {
+			vars = append(vars, NewVar(map[string]interface{}(doc)))
+		}
+		err = o.triggerInsertManyAfter(ctx, api, ids, vars)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	result := make([]string, len(docs))
+	for j, id := range ids {
+		result[rows[j]] = id
+	}
+	if len(bulkErr.Rows) > 0 {
+		return result, bulkErr, nil
+	}
+	return result, nil, nil
+}
+
+// 批量新增的记录依次追加到所在分组的末尾
+func (o *Objectql) initInsertManyRowIndex(ctx context.Context, object *Object, docs []bson.M) error {
+	next := map[string]int{}
+	for _, doc := range docs {
+		group, err := o.documentToGroupFilter(object, doc)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprint(group)
+		index, ok := next[key]
+		if !ok {
+			index, err = o.getMaxIndex(ctx, object, group)
+			if err != nil {
+				return err
+			}
+		}
+		index++
+		next[key] = index
+		doc["__index"] = index
+	}
+	return nil
+}
+
+// 返回的id和ids一一对应, 失败或者不存在的行为空字符串, 跳过的行通过 *BulkError 返回
+func (o *Objectql) updateManyByIdsHandle(ctx context.Context, api string, ids []string, docs []map[string]interface{}, skipInvalid bool) ([]string, error) {
+	var bulkErr *BulkError
+	res, err := o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		ids, rowErr, err := o.updateManyByIdsHandleRaw(ctx, api, ids, docs, skipInvalid)
+		bulkErr = rowErr
+		return ids, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bulkErr != nil {
+		return res.([]string), bulkErr
+	}
+	return res.([]string), nil
+}
+
+func (o *Objectql) updateManyByIdsHandleRaw(ctx context.Context, api string, ids []string, docs []map[string]interface{}, skipInvalid bool) ([]string, *BulkError, error) {
+	object := FindObjectFromList(o.list, api)
+	if object == nil {
+		return nil, nil, ErrNotFoundObject
+	}
+	docs = copyStrAnyMaps(docs)
+	bulkErr := &BulkError{}
+	// 不存在的记录忽略掉, 和 updateById 一致
+	exists, err := o.findManyByIds(ctx, object, o.validObjectIds(ids, bulkErr), []string{"_id"})
+	if err != nil {
+		return nil, nil, err
+	}
+	// updateManyBefore 事件触发 (可以修改表单内容)
+	if ctx.Value(blockEventsKey) != true {
+		err = o.triggerUpdateManyBefore(ctx, api, ids, newVars(docs))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	rows := make([]*updateRow, len(ids))
+	for i, id := range ids {
+		if exists[i] == nil {
+			continue
+		}
+		err := o.checkInputDocument(object, docs[i])
+		if err == nil {
+			rows[i], err = o.updatePrepare(ctx, object, id, docs[i], false)
+		}
+		if err != nil {
+			rows[i] = nil
+			bulkErr.add(i, err)
+		}
+	}
+	if len(bulkErr.Rows) > 0 && !skipInvalid {
+		return nil, nil, bulkErr
+	}
+	// 写入到数据库
+	var written []int
+	if object.Versioned {
+		// 带版本的记录需要逐条比较版本号
+		for i, row := range rows {
+			if row == nil {
+				continue
+			}
+			count, err := o.mongoUpdateByIdWithVersion(ctx, object, row.id, row.doc, row.expectVersion, true)
+			if errors.Is(err, ErrVersionConflict) && skipInvalid {
+				bulkErr.add(i, err)
+				continue
+			}
+			if err != nil {
+				return nil, nil, &BulkError{Rows: []*BulkRowError{{Index: i, Err: err}}}
+			}
+			if count > 0 {
+				written = append(written, i)
+			}
+		}
+	} else {
+		var writeIds []string
+		var writeDocs []bson.M
+		for i, row := range rows {
+			if row == nil {
+				continue
+			}
+			written = append(written, i)
+			writeIds = append(writeIds, row.id)
+			writeDocs = append(writeDocs, row.doc)
+		}
+		if len(writeIds) > 0 {
+			_, err = o.mongoBulkUpdateById(ctx, api, writeIds, writeDocs)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	// 数据联动, 计算延迟到最后
+	batchCtx, batch := withComputeBatch(ctx)
+	for _, i := range written {
+		err := o.updateLink(batchCtx, object, rows[i])
+		if err != nil {
+			return nil, nil, &BulkError{Rows: []*BulkRowError{{Index: i, Err: err}}}
+		}
+	}
+	err = o.flushComputeBatch(ctx, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, i := range written {
+		err := o.updateFinish(ctx, object, rows[i])
+		if err != nil {
+			return nil, nil, &BulkError{Rows: []*BulkRowError{{Index: i, Err: err}}}
+		}
+	}
+	result := make([]string, len(ids))
+	var writtenIds []string
+	var vars []*Var
+	for _, i := range written {
+		result[i] = ids[i]
+		writtenIds = append(writtenIds, ids[i])
+		vars = append(vars, NewVar(rows[i].doc))
+	}
+	// updateManyAfter 事件触发
+	if ctx.Value(blockEventsKey) != true && len(written) > 0 {
+		err = o.triggerUpdateManyAfter(ctx, api, writtenIds, vars)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(bulkErr.Rows) > 0 {
+		return result, bulkErr, nil
+	}
+	return result, nil, nil
+}
+
+// 格式错误的id记为失败的行, 返回的数组中对应位置为空字符串
+func (o *Objectql) validObjectIds(ids []string, bulkErr *BulkError) []string {
+	result := make([]string, len(ids))
+	for i, id := range ids {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			bulkErr.add(i, fmt.Errorf("invalid id %s", id))
+			continue
+		}
+		result[i] = id
+	}
+	return result
+}
+
+func copyStrAnyMaps(list []map[string]interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, item := range list {
+		result = append(result, copyStrAnyMap(item))
+	}
+	return result
+}
+
+func newVars(list []map[string]interface{}) []*Var {
+	var result []*Var
+	for _, item := range list {
+		result = append(result, NewVar(item))
+	}
+	return result
+}
+
+func (o *Objectql) getGraphqlObjectBulkResult(object *Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: object.Api + "__bulkResult",
+		Fields: graphql.Fields{
+			"list":   &graphql.Field{Type: graphql.NewList(o.getGraphqlObject(object.Api))},
+			"errors": &graphql.Field{Type: graphql.NewList(graphqlBulkRowError)},
+		},
+	})
+}
+
+func (o *Objectql) graphqlMutationInsertManyResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	var docs []map[string]interface{}
+	for _, item := range gconv.SliceAny(p.Args["docs"]) {
+		doc, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(`mutation %s__insertMany method arg "docs" can't contain null`, object.Api)
+		}
+		docs = append(docs, formatNullValue(doc))
+	}
+	ids, err := o.insertManyHandle(ctx, object.Api, docs, gconv.Bool(p.Args["skipInvalid"]))
+	return o.graphqlBulkResult(ctx, p, object, ids, err)
+}
+
+func (o *Objectql) graphqlMutationUpdateManyResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	ids := gconv.Strings(p.Args["_ids"])
+	var docs []map[string]interface{}
+	for _, item := range gconv.SliceAny(p.Args["docs"]) {
+		doc, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(`mutation %s__updateMany method arg "docs" can't contain null`, object.Api)
+		}
+		docs = append(docs, formatNullValue(doc))
+	}
+	if doc, ok := p.Args["doc"].(map[string]interface{}); ok && len(docs) == 0 {
+		for range ids {
+			docs = append(docs, formatNullValue(doc))
+		}
+	}
+	if len(docs) != len(ids) {
+		return nil, fmt.Errorf(`mutation %s__updateMany method arg "docs" length not equal to "_ids"`, object.Api)
+	}
+	ids, err := o.updateManyByIdsHandle(ctx, object.Api, ids, docs, gconv.Bool(p.Args["skipInvalid"]))
+	return o.graphqlBulkResult(ctx, p, object, ids, err)
+}
+
+func (o *Objectql) graphqlBulkResult(ctx context.Context, p graphql.ResolveParams, object *Object, ids []string, err error) (interface{}, error) {
+	var bulkErr *BulkError
+	if err != nil && !errors.As(err, &bulkErr) {
+		return nil, err
+	}
+	// 只查询 list 中的字段
+	project := convertFieldASTsToMongoProject(p)
+	var fields []string
+	if list, ok := project["list"].(map[string]interface{}); ok {
+		convProjectToQueryFields("", list, &fields)
+	}
+	found, err := o.findManyByIds(ctx, object, ids, append(fields, "_id"))
+	if err != nil {
+		return nil, err
+	}
+	// 失败的行返回 null
+	list := make([]interface{}, len(found))
+	for i, item := range found {
+		if item != nil {
+			list[i] = item
+		}
+	}
+	rowErrors := []M{}
+	if bulkErr != nil {
+		for _, row := range bulkErr.Rows {
+			rowErrors = append(rowErrors, M{
+				"index":   row.Index,
+				"message": row.Err.Error(),
+			})
+		}
+	}
+	return M{
+		"list":   list,
+		"errors": rowErrors,
+	}, nil
+}
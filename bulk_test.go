@@ -0,0 +1,254 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInsertMany(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "总分",
+				Api:  "sumScore",
+				Type: &AggregationType{
+					Object: "student",
+					Relate: "class",
+					Field:  "score",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:       "学生",
+		Api:        "student",
+		Index:      true,
+		IndexGroup: []string{"class"},
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "分数",
+				Api:  "score",
+				Type: Int,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	class, err := oql.Insert(ctx, "class", InsertOptions{
+		Doc:    M{"name": "一班"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	classId := class.String("_id")
+	// 统计聚合字段的计算次数
+	computeCount := 0
+	oql.ListenUpdateAfter("class", func(ctx context.Context, id string, doc *Var) error {
+		computeCount++
+		return nil
+	})
+	batchCount := 0
+	oql.ListenInsertManyAfter("student", func(ctx context.Context, ids []string, docs []*Var) error {
+		batchCount++
+		if len(ids) != len(docs) {
+			t.Error("批量事件参数错误", ids)
+		}
+		return nil
+	})
+
+	// 任意一行失败全部不写入
+	_, err = oql.InsertMany(ctx, "student", InsertManyOptions{
+		Docs: []map[string]any{
+			{"name": "张三", "score": 1, "class": classId},
+			{"name": "李四", "age": 10},
+		},
+	})
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Rows) != 1 || bulkErr.Rows[0].Index != 1 {
+		t.Error("期望第二行校验失败", err)
+		return
+	}
+	count, err := oql.Count(ctx, "student", CountOptions{})
+	if err != nil || count != 0 {
+		t.Error("校验失败时不应该写入", err, count)
+		return
+	}
+
+	list, err := oql.InsertMany(ctx, "student", InsertManyOptions{
+		Docs: []map[string]any{
+			{"name": "张三", "score": 1, "class": classId},
+			{"name": "李四", "score": 2, "class": classId},
+			{"name": "王五", "score": 3, "class": classId},
+		},
+		Fields: []string{"name", "__index"},
+	})
+	if err != nil {
+		t.Error("批量插入失败", err)
+		return
+	}
+	for i, item := range list {
+		if item.Int("__index") != i+1 {
+			t.Error("索引位置错误", item.ToStrAnyMap())
+			return
+		}
+	}
+	if computeCount != 1 || batchCount != 1 {
+		t.Error("聚合字段应该只计算一次", computeCount, batchCount)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "class", FindOneByIdOptions{ID: classId, Fields: []string{"sumScore"}})
+	if err != nil || one.Int("sumScore") != 6 {
+		t.Error("聚合结果错误", err, one)
+		return
+	}
+
+	// 跳过校验失败的行
+	list, err = oql.InsertMany(ctx, "student", InsertManyOptions{
+		Docs: []map[string]any{
+			{"name": "赵六", "age": 10},
+			{"name": "钱七", "score": 4, "class": classId},
+		},
+		Fields:      []string{"name"},
+		SkipInvalid: true,
+	})
+	if !errors.As(err, &bulkErr) || len(bulkErr.Rows) != 1 || bulkErr.Rows[0].Index != 0 {
+		t.Error("期望第一行校验失败", err)
+		return
+	}
+	if len(list) != 2 || list[0] != nil || list[1].String("name") != "钱七" {
+		t.Error("跳过失败行的结果错误", list)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "class", FindOneByIdOptions{ID: classId, Fields: []string{"sumScore"}})
+	if err != nil || one.Int("sumScore") != 10 {
+		t.Error("聚合结果错误", err, one)
+		return
+	}
+}
+
+func TestUpdateMany(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "人数",
+				Api:  "count",
+				Type: &AggregationType{
+					Object: "student",
+					Relate: "class",
+					Field:  "name",
+					Type:   Int,
+					Kind:   Count,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	var classIds []string
+	for i := 0; i < 2; i++ {
+		class, err := oql.Insert(ctx, "class", InsertOptions{Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入班级失败", err)
+			return
+		}
+		classIds = append(classIds, class.String("_id"))
+	}
+	students, err := oql.InsertMany(ctx, "student", InsertManyOptions{
+		Docs: []map[string]any{
+			{"name": "张三", "class": classIds[0]},
+			{"name": "李四", "class": classIds[0]},
+		},
+	})
+	if err != nil {
+		t.Error("批量插入失败", err)
+		return
+	}
+	var ids []string
+	for _, item := range students {
+		ids = append(ids, item.String("_id"))
+	}
+	// 所有记录使用同一个文档
+	list, err := oql.UpdateMany(ctx, "student", UpdateManyOptions{
+		IDs:    ids,
+		Doc:    M{"class": classIds[1]},
+		Fields: []string{"class"},
+	})
+	if err != nil {
+		t.Error("批量修改失败", err)
+		return
+	}
+	if list[0].String("class") != classIds[1] || list[1].String("class") != classIds[1] {
+		t.Error("批量修改结果错误", list)
+		return
+	}
+	classes, err := oql.FindList(ctx, "class", FindListOptions{Fields: []string{"count"}})
+	if err != nil || classes[0].Int("count") != 0 || classes[1].Int("count") != 2 {
+		t.Error("修改前后的关联记录都需要重新计算", err, classes)
+		return
+	}
+	// 每条记录使用不同的文档, 不存在的记录忽略
+	list, err = oql.UpdateMany(ctx, "student", UpdateManyOptions{
+		IDs:    append(ids, "000000000000000000000000"),
+		Docs:   []map[string]any{{"name": "张三丰"}, {"name": "李四光"}, {"name": "无名"}},
+		Fields: []string{"name"},
+	})
+	if err != nil {
+		t.Error("批量修改失败", err)
+		return
+	}
+	if list[0].String("name") != "张三丰" || list[1].String("name") != "李四光" || list[2] != nil {
+		t.Error("批量修改结果错误", list)
+	}
+}
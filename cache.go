@@ -0,0 +1,449 @@
+package objectql
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cache 记录缓存, 开启了 Object.Cache 的对象按 _id 缓存数据库中的原始文档
+// value 为 bson 编码的文档, 可以使用 redis 等外部缓存实现
+// FindOneById, 事件查询和 __expand 会优先读取缓存, 写入在事务结束后删除对应的缓存
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// LRUCache 进程内的 LRU 缓存
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:  size,
+		list:  list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	c.list.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		element.Value.(*lruEntry).value = value
+		c.list.MoveToFront(element)
+		return nil
+	}
+	c.items[key] = c.list.PushFront(&lruEntry{key: key, value: value})
+	for c.size > 0 && c.list.Len() > c.size {
+		last := c.list.Back()
+		c.list.Remove(last)
+		delete(c.items, last.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *LRUCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := c.items[key]; ok {
+			c.list.Remove(element)
+			delete(c.items, key)
+		}
+	}
+	return nil
+}
+
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list.Len()
+}
+
+func (o *Objectql) SetCache(cache Cache) {
+	o.cache = cache
+}
+
+func (o *Objectql) isCacheObject(object *Object) bool {
+	return o.cache != nil && object != nil && object.Cache
+}
+
+// 每个租户使用单独的数据库时 key 需要带上租户
+func (o *Objectql) getCacheKey(ctx context.Context, api string, id string) (string, error) {
+	if o.tenantMode == TenantDatabase {
+		tenant, err := o.getTenant(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(tenant) > 0 {
+			return tenant + ":" + api + ":" + id, nil
+		}
+	}
+	return api + ":" + id, nil
+}
+
+var cacheTxKey = "objectql_cacheTxKey"
+
+// 事务中修改过的记录, 事务结束后统一删除
+// 事务中不会写入缓存, 修改过的记录也不会读取缓存, 回滚的数据不会进入缓存
+type cacheTx struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func getCacheTx(ctx context.Context) *cacheTx {
+	tx, _ := ctx.Value(cacheTxKey).(*cacheTx)
+	return tx
+}
+
+func (tx *cacheTx) add(keys []string) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, key := range keys {
+		tx.keys[key] = true
+	}
+}
+
+func (tx *cacheTx) has(key string) bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.keys[key]
+}
+
+func (o *Objectql) withCacheContext(ctx context.Context) context.Context {
+	if o.cache == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, cacheTxKey, &cacheTx{keys: map[string]bool{}})
+}
+
+// 事务结束后删除修改过的记录, 提交和回滚都需要删除(不使用事务时期间可能读到了中间状态)
+func (o *Objectql) flushCacheContext(ctx context.Context) {
+	tx := getCacheTx(ctx)
+	if tx == nil {
+		return
+	}
+	tx.mu.Lock()
+	var keys []string
+	for key := range tx.keys {
+		keys = append(keys, key)
+	}
+	tx.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	atomic.AddInt64(&o.cacheVersion, 1)
+	err := o.cache.Delete(ctx, keys...)
+	if err != nil {
+		g.Log().Error(ctx, "delete cache error:", err)
+	}
+}
+
+// 记录修改后调用, 新增的记录不会有缓存不需要调用
+func (o *Objectql) invalidateCache(ctx context.Context, api string, ids ...string) error {
+	if !o.isCacheObject(o.GetObject(api)) || len(ids) == 0 {
+		return nil
+	}
+	var keys []string
+	for _, id := range ids {
+		key, err := o.getCacheKey(ctx, api, id)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	atomic.AddInt64(&o.cacheVersion, 1)
+	if tx := getCacheTx(ctx); tx != nil {
+		tx.add(keys)
+		return nil
+	}
+	return o.cache.Delete(ctx, keys...)
+}
+
+// 按条件修改前查询受影响的记录
+func (o *Objectql) getCacheIdsByFilter(ctx context.Context, api string, filter M) ([]string, error) {
+	if !o.isCacheObject(o.GetObject(api)) {
+		return nil, nil
+	}
+	list, err := o.driver.Find(ctx, api, filter, M{"_id": 1})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, item := range list {
+		if id, ok := item["_id"].(primitive.ObjectID); ok {
+			ids = append(ids, id.Hex())
+		}
+	}
+	return ids, nil
+}
+
+// 按 _id 读取原始文档, 缺失的从数据库读取后写入缓存
+func (o *Objectql) loadCacheDocs(ctx context.Context, object *Object, ids []primitive.ObjectID) (map[primitive.ObjectID]bson.M, error) {
+	tx := getCacheTx(ctx)
+	inTx := o.driver.InTransaction(ctx)
+	// 读取期间有记录被修改时不写入缓存, 避免写入旧数据
+	version := atomic.LoadInt64(&o.cacheVersion)
+	result := map[primitive.ObjectID]bson.M{}
+	keys := map[primitive.ObjectID]string{}
+	var misses []primitive.ObjectID
+	for _, id := range ids {
+		if _, ok := keys[id]; ok {
+			continue
+		}
+		key, err := o.getCacheKey(ctx, object.Api, id.Hex())
+		if err != nil {
+			return nil, err
+		}
+		keys[id] = key
+		if tx != nil && tx.has(key) {
+			misses = append(misses, id)
+			continue
+		}
+		data, ok, err := o.cache.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			misses = append(misses, id)
+			continue
+		}
+		var doc bson.M
+		err = bson.Unmarshal(data, &doc)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = doc
+	}
+	if len(misses) > 0 {
+		list, err := o.driver.Find(ctx, object.Api, M{"_id": M{"$in": misses}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range list {
+			id, ok := doc["_id"].(primitive.ObjectID)
+			if !ok {
+				continue
+			}
+			result[id] = doc
+			if inTx || atomic.LoadInt64(&o.cacheVersion) != version {
+				continue
+			}
+			data, err := bson.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			err = o.cache.Set(ctx, keys[id], data)
+			if err != nil {
+				return nil, err
+			}
+			// 查询和写入缓存之间有修改时, 写入的可能是旧数据
+			if atomic.LoadInt64(&o.cacheVersion) != version {
+				err = o.cache.Delete(ctx, keys[id])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	// 只返回当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		for id, doc := range result {
+			if doc[tenantFieldApi] != tenant[tenantFieldApi] {
+				delete(result, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// 可以从缓存读取的 expand: 关联的对象开启了缓存, 嵌套的 expand 也都可以从缓存读取
+func (o *Objectql) isCacheExpand(object *Object, key string, sub map[string]interface{}) bool {
+	field := FindFieldFromObject(object, key)
+	if field == nil {
+		return false
+	}
+	n, ok := field.Type.(*ExpandType)
+	if !ok {
+		return false
+	}
+	target := o.GetObject(n.ObjectApi)
+	if !o.isCacheObject(target) {
+		return false
+	}
+	for k, v := range sub {
+		if m, ok := v.(map[string]interface{}); ok && !o.isCacheExpand(target, k, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// 拆分出可以从缓存读取的 expand, 过滤和排序中用到的 expand 仍然使用 $lookup
+func (o *Objectql) splitCacheExpands(object *Object, options findAllExOptions) (findAllExOptions, map[string]interface{}) {
+	if o.cache == nil {
+		return options, nil
+	}
+	var refFields []string
+	getMatchReferenceFields(&refFields, options.Filter)
+	refFields = append(refFields, getSortReferenceFields(options.Sort)...)
+	refFields = append(refFields, getReoslveDependencyFields(object, options.Fields)...)
+	refs := mergeFields(refFields)
+	cached := map[string]interface{}{}
+	for key, value := range mergeFields(options.Fields) {
+		sub, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := refs[key]; ok {
+			continue
+		}
+		if o.isCacheExpand(object, key, sub) {
+			cached[key] = sub
+		}
+	}
+	if len(cached) == 0 {
+		return options, nil
+	}
+	var fields []string
+	for _, field := range options.Fields {
+		if _, ok := cached[strings.Split(field, ".")[0]]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	for key := range cached {
+		fields = append(fields, removeFieldSuffix(key))
+	}
+	options.Fields = fields
+	return options, cached
+}
+
+// 从缓存填充 expand 字段, 和 $lookup 一样关联不到记录时不设置
+func (o *Objectql) fillCacheExpands(ctx context.Context, object *Object, rows []M, cached map[string]interface{}) error {
+	for key, value := range cached {
+		sub, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := FindFieldFromObject(object, key)
+		target := o.GetObject(field.Type.(*ExpandType).ObjectApi)
+		local := removeFieldSuffix(key)
+		var ids []primitive.ObjectID
+		for _, row := range rows {
+			if id, ok := row[local].(primitive.ObjectID); ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		docs, err := o.loadCacheDocs(ctx, target, ids)
+		if err != nil {
+			return err
+		}
+		var subRows []M
+		for _, row := range rows {
+			id, _ := row[local].(primitive.ObjectID)
+			doc := docs[id]
+			if doc == nil {
+				continue
+			}
+			item := projectCacheDoc(doc, sub)
+			row[key] = item
+			subRows = append(subRows, M(item))
+		}
+		err = o.fillCacheExpands(ctx, target, subRows, sub)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按 _id 查询并且所有字段都可以从缓存读取时使用缓存, 返回 false 表示需要查询数据库
+func (o *Objectql) findByIdFromCache(ctx context.Context, object *Object, options findAllExOptions) ([]M, bool, error) {
+	if len(options.Filter) != 1 || len(options.Sort) > 0 || options.Skip > 0 || len(options.Search) > 0 {
+		return nil, false, nil
+	}
+	id, ok := options.Filter["_id"].(primitive.ObjectID)
+	if !ok {
+		return nil, false, nil
+	}
+	var fields []string
+	fields = append(fields, options.Fields...)
+	fields = append(fields, getReoslveDependencyFields(object, options.Fields)...)
+	fieldsMap := mergeFields(fields)
+	for key, value := range fieldsMap {
+		if sub, ok := value.(map[string]interface{}); ok && !o.isCacheExpand(object, key, sub) {
+			return nil, false, nil
+		}
+	}
+	docs, err := o.loadCacheDocs(ctx, object, []primitive.ObjectID{id})
+	if err != nil {
+		return nil, false, err
+	}
+	doc := docs[id]
+	if doc == nil {
+		return []M{}, true, nil
+	}
+	rows := []M{M(projectCacheDoc(doc, fieldsMap))}
+	err = o.fillCacheExpands(ctx, object, rows, fieldsMap)
+	if err != nil {
+		return nil, false, err
+	}
+	return rows, true, nil
+}
+
+// 和 $project 一样只保留需要的字段, 没有指定字段时返回全部
+// expand 字段只保留关联的 id, 由 fillCacheExpands 填充
+func projectCacheDoc(doc bson.M, fieldsMap map[string]interface{}) bson.M {
+	result := bson.M{}
+	if len(fieldsMap) == 0 {
+		for k, v := range doc {
+			result[k] = v
+		}
+		return result
+	}
+	result["_id"] = doc["_id"]
+	for key, value := range fieldsMap {
+		if _, ok := value.(map[string]interface{}); ok {
+			key = removeFieldSuffix(key)
+		}
+		if v, ok := doc[key]; ok {
+			result[key] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,234 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(100)
+	oql := New(ObjectqlOptiosn{
+		Cache: cache,
+	})
+	driver := NewMemoryDriver()
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name:  "部门",
+		Api:   "dept",
+		Cache: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "员工",
+		Api:  "user",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "部门",
+				Api:  "dept",
+				Type: NewRelate("dept"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	dept, err := oql.Insert(ctx, "dept", InsertOptions{Doc: M{"name": "研发"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入部门失败", err)
+		return
+	}
+	deptId := dept.String("_id")
+	user, err := oql.Insert(ctx, "user", InsertOptions{Doc: M{"name": "张三", "dept": deptId}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	userId := user.String("_id")
+	expandName := func(ctx context.Context) string {
+		one, err := oql.FindOneById(ctx, "user", FindOneByIdOptions{ID: userId, Fields: []string{"name", "dept__expand.name"}})
+		if err != nil {
+			t.Error("查询员工失败", err)
+			return ""
+		}
+		return one.Var("dept__expand").String("name")
+	}
+	if name := expandName(ctx); name != "研发" || cache.Len() != 1 {
+		t.Error("expand 应该写入缓存", name, cache.Len())
+		return
+	}
+	// 绕过 objectql 直接修改数据库, 读取到的是缓存
+	_, err = driver.UpdateById(ctx, "dept", ObjectIdFromHex(deptId), M{"$set": M{"name": "直接修改"}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "dept", FindOneByIdOptions{ID: deptId, Fields: []string{"name"}})
+	if err != nil || one.String("name") != "研发" || expandName(ctx) != "研发" {
+		t.Error("应该读取缓存", err, one)
+		return
+	}
+	// 修改后缓存失效
+	_, err = oql.UpdateById(ctx, "dept", UpdateByIdOptions{ID: deptId, Doc: M{"name": "测试"}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	if name := expandName(ctx); name != "测试" {
+		t.Error("修改后缓存应该失效", name)
+		return
+	}
+	// 事务中读取到自己的修改, 回滚后缓存中不会有回滚的数据
+	_, err = oql.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		_, err := oql.UpdateById(ctx, "dept", UpdateByIdOptions{ID: deptId, Doc: M{"name": "回滚"}})
+		if err != nil {
+			return nil, err
+		}
+		if name := expandName(ctx); name != "回滚" {
+			t.Error("事务中应该读取到修改后的数据", name)
+		}
+		return nil, errors.New("回滚")
+	})
+	if err == nil {
+		t.Error("期望事务失败")
+		return
+	}
+	if name := expandName(ctx); name != "测试" {
+		t.Error("回滚的数据不应该进入缓存", name)
+		return
+	}
+	// 过滤条件中用到的 expand 仍然查询数据库
+	list, err := oql.FindList(ctx, "user", FindListOptions{
+		Filter: M{"dept__expand.name": "测试"},
+		Fields: []string{"dept__expand.name"},
+	})
+	if err != nil || len(list) != 1 || list[0].Var("dept__expand").String("name") != "测试" {
+		t.Error("按 expand 过滤的结果错误", err, list)
+		return
+	}
+	// 删除后缓存失效
+	err = oql.DeleteById(ctx, "dept", DeleteByIdOptions{ID: deptId})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "dept", FindOneByIdOptions{ID: deptId})
+	if err != nil || one != nil {
+		t.Error("删除后不应该查询到", err, one)
+		return
+	}
+	if name := expandName(ctx); name != "" {
+		t.Error("删除后不应该查询到", name)
+	}
+}
+
+// 写入缓存前执行 onSet, 模拟查询和写入缓存之间有其他修改
+type racyCache struct {
+	*LRUCache
+	onSet func()
+}
+
+func (c *racyCache) Set(ctx context.Context, key string, value []byte) error {
+	if fn := c.onSet; fn != nil {
+		c.onSet = nil
+		fn()
+	}
+	return c.LRUCache.Set(ctx, key, value)
+}
+
+func TestCacheStale(t *testing.T) {
+	ctx := context.Background()
+	cache := &racyCache{LRUCache: NewLRUCache(100)}
+	oql := New(ObjectqlOptiosn{
+		Cache: cache,
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:  "部门",
+		Api:   "dept",
+		Cache: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "编号",
+				Api:  "code",
+				Type: String,
+			},
+			{
+				Name: "等级",
+				Api:  "level",
+				Type: Int,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	dept, err := oql.Insert(ctx, "dept", InsertOptions{Doc: M{"name": "研发", "code": "RD"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入部门失败", err)
+		return
+	}
+	deptId := dept.String("_id")
+	// 插入后的查询写入了缓存
+	err = cache.Delete(ctx, "dept:"+deptId)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 查询之后, 写入缓存之前部门被修改
+	cache.onSet = func() {
+		_, err := oql.UpdateById(ctx, "dept", UpdateByIdOptions{ID: deptId, Doc: M{"name": "测试"}})
+		if err != nil {
+			t.Error("修改部门失败", err)
+		}
+	}
+	_, err = oql.FindOneById(ctx, "dept", FindOneByIdOptions{ID: deptId, Fields: []string{"name"}})
+	if err != nil {
+		t.Error("查询部门失败", err)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "dept", FindOneByIdOptions{ID: deptId, Fields: []string{"name"}})
+	if err != nil || one.String("name") != "测试" {
+		t.Error("缓存中不应该保留修改前的数据", err, one)
+		return
+	}
+	// 迁移修改数据后删除缓存
+	oql.AddMigration(&Migration{
+		Version: 1,
+		Name:    "部门调整",
+		Steps: []*MigrationStep{
+			MigrateBackfillDefault("dept", "level", 1),
+			MigrateDropField("dept", "code"),
+		},
+	})
+	_, err = oql.Migrate(ctx)
+	if err != nil {
+		t.Error("迁移失败", err)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "dept", FindOneByIdOptions{ID: deptId, Fields: []string{"code", "level"}})
+	if err != nil || one.Int("level") != 1 || one.String("code") != "" {
+		t.Error("迁移后缓存没有删除", err, one)
+	}
+}
@@ -0,0 +1,178 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TransactionMode 写入时的事务模式
+type TransactionMode int
+
+const (
+	// 使用数据库事务, mongodb 需要副本集
+	TransactionSession TransactionMode = iota
+	// 不使用事务, 适用于单机的 mongod
+	// 工作单元中每次写入前记录原来的数据, 失败时倒序恢复 (尽力补偿):
+	//  - 没有隔离, 其他请求可以看到还没有完成的修改
+	//  - 补偿会覆盖期间其他请求对相同记录的修改
+	//  - 补偿本身失败时只记录日志, 返回原始的错误
+	//  - Next 队列在工作单元的最后执行, 返回错误时同样会触发补偿, AsyncNext 在成功之后执行
+	TransactionNone
+)
+
+// TransactionModeDriver 可以切换事务模式的驱动
+type TransactionModeDriver interface {
+	SetTransactionMode(mode TransactionMode)
+}
+
+// 只在设置了非默认的模式时覆盖驱动自己的设置
+func (o *Objectql) bindTransactionMode() {
+	driver, ok := o.driver.(TransactionModeDriver)
+	if !ok || o.transactionMode == TransactionSession {
+		return
+	}
+	driver.SetTransactionMode(o.transactionMode)
+}
+
+var undoLogKey = "objectql_undoLogKey"
+
+// 补偿日志
+type undoLog struct {
+	mu      sync.Mutex
+	keys    map[string]bool
+	entries []*undoEntry
+}
+
+// before 为 nil 表示这条记录是新插入的
+type undoEntry struct {
+	table  string
+	id     interface{}
+	before bson.M
+}
+
+func getUndoLog(ctx context.Context) *undoLog {
+	log, _ := ctx.Value(undoLogKey).(*undoLog)
+	return log
+}
+
+// 不使用事务执行工作单元, 失败时进行补偿
+func runWithCompensation(ctx context.Context, driver Driver, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if getUndoLog(ctx) != nil {
+		return fn(ctx)
+	}
+	log := &undoLog{keys: map[string]bool{}}
+	result, err := fn(context.WithValue(ctx, undoLogKey, log))
+	if err != nil {
+		cerr := log.compensate(ctx, driver)
+		if cerr != nil {
+			g.Log().Error(ctx, "compensate error:", cerr)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// 同一条记录只需要保存第一次写入前的状态
+func (l *undoLog) add(table string, id interface{}, before bson.M) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := table + "." + fmt.Sprint(id)
+	if l.keys[key] {
+		return
+	}
+	l.keys[key] = true
+	l.entries = append(l.entries, &undoEntry{table: table, id: id, before: before})
+}
+
+// 插入成功之后记录
+func recordUndoInsert(ctx context.Context, table string, id interface{}) {
+	if log := getUndoLog(ctx); log != nil {
+		log.add(table, id, nil)
+	}
+}
+
+// 写入前生成 _id 并记录, 批量插入部分失败时也能删除已经写入的记录
+// 指定了 _id 的文档可能和已有记录冲突, 写入成功后再通过 recordUndoInsert 记录
+func prepareUndoInsert(ctx context.Context, table string, doc M) M {
+	log := getUndoLog(ctx)
+	if log == nil {
+		return doc
+	}
+	if _, ok := doc["_id"]; ok {
+		return doc
+	}
+	next := M{"_id": primitive.NewObjectID()}
+	for k, v := range doc {
+		next[k] = v
+	}
+	log.add(table, next["_id"], nil)
+	return next
+}
+
+// 修改和删除之前保存受影响的记录
+func recordUndoWrite(ctx context.Context, driver Driver, table string, filter M) error {
+	log := getUndoLog(ctx)
+	if log == nil {
+		return nil
+	}
+	list, err := driver.Find(ctx, table, filter, nil)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		log.add(table, item["_id"], item)
+	}
+	return nil
+}
+
+func (l *undoLog) compensate(ctx context.Context, driver Driver) error {
+	l.mu.Lock()
+	entries := l.entries
+	l.mu.Unlock()
+	var first error
+	for i := len(entries) - 1; i >= 0; i-- {
+		err := entries[i].undo(ctx, driver)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (e *undoEntry) undo(ctx context.Context, driver Driver) error {
+	if e.before == nil {
+		_, err := driver.DeleteById(ctx, e.table, e.id)
+		return err
+	}
+	current, err := driver.FindOne(ctx, e.table, M{"_id": e.id}, nil)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		_, err = driver.Insert(ctx, e.table, e.before)
+		return err
+	}
+	set := bson.M{}
+	unset := bson.M{}
+	for k, v := range e.before {
+		if k != "_id" {
+			set[k] = v
+		}
+	}
+	for k := range current {
+		if _, ok := e.before[k]; !ok {
+			unset[k] = 1
+		}
+	}
+	update := M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	_, err = driver.UpdateById(ctx, e.table, e.id, update)
+	return err
+}
@@ -0,0 +1,160 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTransactionNone(t *testing.T) {
+	ctx := context.Background()
+	oql := New(ObjectqlOptiosn{
+		TransactionMode: TransactionNone,
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "总分",
+				Api:  "sumScore",
+				Type: &AggregationType{
+					Object: "student",
+					Relate: "class",
+					Field:  "score",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "分数",
+				Api:  "score",
+				Type: Int,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	// 在 Next 队列中返回错误, 这时数据已经写入
+	fail := false
+	nextCount := 0
+	failNext := func(ctx context.Context) {
+		oql.Next(ctx, func(ctx context.Context) error {
+			nextCount++
+			if fail {
+				return errors.New("禁止修改")
+			}
+			return nil
+		})
+	}
+	oql.ListenInsertAfter("student", func(ctx context.Context, id string, doc *Var) error {
+		failNext(ctx)
+		return nil
+	})
+	oql.ListenUpdateAfter("student", func(ctx context.Context, id string, doc *Var) error {
+		failNext(ctx)
+		return nil
+	})
+	oql.ListenDeleteAfter("student", func(ctx context.Context, id string) error {
+		failNext(ctx)
+		return nil
+	})
+	checkState := func(message string, count int64, sum int) bool {
+		n, err := oql.Count(ctx, "student", CountOptions{})
+		if err != nil || n != count {
+			t.Error(message, "学生数量错误", err, n)
+			return false
+		}
+		list, err := oql.FindList(ctx, "class", FindListOptions{Fields: []string{"sumScore"}})
+		if err != nil || len(list) != 1 || list[0].Int("sumScore") != sum {
+			t.Error(message, "聚合结果错误", err, list)
+			return false
+		}
+		return true
+	}
+
+	class, err := oql.Insert(ctx, "class", InsertOptions{Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	student, err := oql.Insert(ctx, "student", InsertOptions{
+		Doc:    M{"name": "张三", "score": 1, "class": class.String("_id")},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入学生失败", err)
+		return
+	}
+	if nextCount != 1 || !checkState("插入", 1, 1) {
+		t.Error("Next 队列没有执行", nextCount)
+		return
+	}
+
+	fail = true
+	_, err = oql.Insert(ctx, "student", InsertOptions{
+		Doc: M{"name": "李四", "score": 5, "class": class.String("_id")},
+	})
+	if err == nil {
+		t.Error("期望插入失败")
+		return
+	}
+	if !checkState("插入失败后", 1, 1) {
+		return
+	}
+	_, err = oql.UpdateById(ctx, "student", UpdateByIdOptions{
+		ID:  student.String("_id"),
+		Doc: M{"score": 3, "class": nil},
+	})
+	if err == nil {
+		t.Error("期望修改失败")
+		return
+	}
+	one, err := oql.FindOneById(ctx, "student", FindOneByIdOptions{
+		ID:     student.String("_id"),
+		Fields: []string{"score", "class"},
+	})
+	if err != nil || one.Int("score") != 1 || one.String("class") != class.String("_id") {
+		t.Error("修改失败后应该恢复原来的数据", err, one)
+		return
+	}
+	if !checkState("修改失败后", 1, 1) {
+		return
+	}
+	err = oql.DeleteById(ctx, "student", DeleteByIdOptions{ID: student.String("_id")})
+	if err == nil {
+		t.Error("期望删除失败")
+		return
+	}
+	if !checkState("删除失败后", 1, 1) {
+		return
+	}
+
+	fail = false
+	err = oql.DeleteById(ctx, "student", DeleteByIdOptions{ID: student.String("_id")})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	checkState("删除", 0, 0)
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/aundis/formula"
 	"github.com/gogf/gf/v2/util/gconv"
 	"github.com/samber/lo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (o *Objectql) onFieldChange(ctx context.Context, object *Object, id string, field *Field, beforeValues bson.M) error {
@@ -37,7 +37,7 @@ func (o *Objectql) formulaHandler(ctx context.Context, object *Object, id string
 	var objectIds []string
 	if info.TargetField.Parent == object {
 		// 计算字段在自身
-		count, err := o.getCollection(object.Api).CountDocuments(ctx, bson.M{"_id": ObjectIdFromHex(id)})
+		count, err := o.mongoCount(ctx, object.Api, bson.M{"_id": ObjectIdFromHex(id)})
 		if err != nil {
 			return err
 		}
@@ -64,6 +64,13 @@ func (o *Objectql) formulaHandler(ctx context.Context, object *Object, id string
 			objectIds = append(objectIds, item["_id"].(primitive.ObjectID).Hex())
 		}
 	}
+	// 批量写入时延迟到最后统一计算
+	if batch := getComputeBatch(ctx); batch != nil {
+		for _, objectId := range objectIds {
+			batch.add(info.TargetField.Parent, objectId, info.TargetField)
+		}
+		return nil
+	}
 	if len(objectIds) > 0 {
 		// 查询相关数据
 		target := info.TargetField.Parent
@@ -82,6 +89,24 @@ func (o *Objectql) formulaHandler(ctx context.Context, object *Object, id string
 			return err
 		}
 		for _, item := range list {
+			// 小数类型的四则运算公式直接精确计算, 有字段为空或者不是数值时交给公式引擎
+			if formulaData.decimalExpr != nil {
+				value, ok := formulaData.decimalExpr.eval(func(path []string) (*big.Rat, bool) {
+					return o.getDecimalOperand(target, item, path)
+				})
+				if ok {
+					err = o.updateComputedValue(ctx, target, info.TargetField, item, value)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			// 小数字段查询出来是字符串
+			err = o.formatDecimalFieldsToCompute(target, item)
+			if err != nil {
+				return err
+			}
 			runner := formula.NewRunner()
 			// 添加自定义的方法
 			for name, fun := range o.formulaCustomerFunction {
@@ -95,13 +120,7 @@ func (o *Objectql) formulaHandler(ctx context.Context, object *Object, id string
 			if err != nil {
 				return err
 			}
-			input, err := formatComputedValue(info.TargetField.Type, value)
-			if err != nil {
-				return err
-			}
-			err = o.updateHandle(ctx, target.Api, gconv.String(item["_id"]), bson.M{
-				info.TargetField.Api: input,
-			}, true)
+			err = o.updateComputedValue(ctx, target, info.TargetField, item, value)
 			if err != nil {
 				return err
 			}
@@ -110,7 +129,57 @@ func (o *Objectql) formulaHandler(ctx context.Context, object *Object, id string
 	return nil
 }
 
+func (o *Objectql) updateComputedValue(ctx context.Context, object *Object, field *Field, item M, value any) error {
+	input, err := formatComputedValue(field.Type, value)
+	if err != nil {
+		return err
+	}
+	return o.updateHandle(ctx, object.Api, gconv.String(item["_id"]), bson.M{
+		field.Api: input,
+	}, true)
+}
+
+// 公式中引用的字段值, 支持 expand 的子字段, 只有数值和小数字段可以参与精确计算
+func (o *Objectql) getDecimalOperand(object *Object, doc M, path []string) (*big.Rat, bool) {
+	for i, name := range path {
+		field := FindFieldFromObject(object, name)
+		if field == nil {
+			return nil, false
+		}
+		value := doc[name]
+		if i == len(path)-1 {
+			if isNull(value) {
+				return nil, false
+			}
+			switch value.(type) {
+			case int, int32, int64, float32, float64, primitive.Decimal128:
+			case string:
+				if decimalTypeOf(field.Type) == nil {
+					return nil, false
+				}
+			default:
+				return nil, false
+			}
+			r, err := parseDecimal(value)
+			return r, err == nil
+		}
+		expand, ok := field.Type.(*ExpandType)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = value.(M); !ok {
+			return nil, false
+		}
+		object = o.GetObject(expand.ObjectApi)
+	}
+	return nil, false
+}
+
 func (o *Objectql) aggregationHandler(ctx context.Context, object *Object, id string, info *relationFiledInfo, beforeValues bson.M) error {
+	// 多对多统计中被统计的记录发生了修改
+	if adata := info.TargetField.Type.(*AggregationType); adata.link != nil && info.ThroughField == adata.link.target {
+		return o.manyToManyAggregationHandler(ctx, id, info)
+	}
 	// 聚合2次, 修改前和修改后
 	// 修改前，这里没有做变更优化，只有relate字段发生了变更这里才需要再计算一次
 	if beforeValues != nil && beforeValues[info.ThroughField.Api] != nil {
@@ -151,6 +220,11 @@ func (o *Objectql) aggregateField(ctx context.Context, object *Object, id string
 	if count == 0 {
 		return nil
 	}
+	// 批量写入时延迟到最后统一计算
+	if batch := getComputeBatch(ctx); batch != nil {
+		batch.add(object, id, field)
+		return nil
+	}
 
 	adata := field.Type.(*AggregationType)
 
@@ -175,11 +249,18 @@ func (o *Objectql) aggregateField(ctx context.Context, object *Object, id string
 			adata.Relate: ObjectIdFromHex(id),
 		},
 	}
+	if adata.link != nil {
+		match, err := o.getManyToManyAggregationMatch(ctx, adata, objectId)
+		if err != nil {
+			return err
+		}
+		ands[0] = match
+	}
 	if adata.Filter != nil {
 		ands = append(ands, adata.Filter)
 	}
 	// 聚合查询
-	cursor, err := o.getCollection(adata.Object).Aggregate(ctx, []bson.M{
+	list, err := o.mongoAggregate(ctx, adata.Object, []M{
 		{
 			"$match": bson.M{
 				"$and": ands,
@@ -195,16 +276,16 @@ func (o *Objectql) aggregateField(ctx context.Context, object *Object, id string
 	if err != nil {
 		return err
 	}
-	result, err := readOneFromCuresor(ctx, cursor)
+	result := readOneFromList(list)
+	// 应用修改, 按聚合字段的类型存储, 小数的 $sum/$avg 在数据库中精确计算
+	var value interface{} = 0
+	if result != nil && !isNull(result["result"]) {
+		value = result["result"]
+	}
+	value, err = formatValueToDatabase(adata.Type, value)
 	if err != nil {
 		return err
 	}
-	// 应用修改
-	// TODO: 需要根据聚合字段的类型来存储
-	var value float64 = 0
-	if result != nil {
-		value = gconv.Float64(result["result"])
-	}
 	err = o.updateHandle(ctx, object.Api, id, bson.M{
 		field.Api: value,
 	}, true)
@@ -214,14 +295,62 @@ func (o *Objectql) aggregateField(ctx context.Context, object *Object, id string
 	return nil
 }
 
-func readOneFromCuresor(ctx context.Context, cursor *mongo.Cursor) (bson.M, error) {
-	var result bson.M
-	if cursor.Next(ctx) {
-		err := cursor.Decode(&result)
+func readOneFromList(list []M) M {
+	if len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+var computeBatchKey = "objectql_computeBatchKey"
+
+// 批量写入期间需要重新计算的字段, 同一条记录的同一个字段只计算一次
+type computeBatch struct {
+	keys  map[string]bool
+	items []*computeBatchItem
+}
+
+type computeBatchItem struct {
+	object *Object
+	id     string
+	field  *Field
+}
+
+func withComputeBatch(ctx context.Context) (context.Context, *computeBatch) {
+	batch := &computeBatch{keys: map[string]bool{}}
+	return context.WithValue(ctx, computeBatchKey, batch), batch
+}
+
+func getComputeBatch(ctx context.Context) *computeBatch {
+	batch, _ := ctx.Value(computeBatchKey).(*computeBatch)
+	return batch
+}
+
+func (b *computeBatch) add(object *Object, id string, field *Field) {
+	key := object.Api + "." + id + "." + field.Api
+	if b.keys[key] {
+		return
+	}
+	b.keys[key] = true
+	b.items = append(b.items, &computeBatchItem{object: object, id: id, field: field})
+}
+
+// 执行延迟的计算, 计算引起的联动不再延迟
+func (o *Objectql) flushComputeBatch(ctx context.Context, batch *computeBatch) error {
+	ctx = context.WithValue(ctx, computeBatchKey, (*computeBatch)(nil))
+	for _, item := range batch.items {
+		var err error
+		switch item.field.Type.(type) {
+		case *FormulaType:
+			err = o.formulaHandler(ctx, item.object, item.id, &relationFiledInfo{
+				TargetField: item.field,
+			})
+		case *AggregationType:
+			err = o.aggregateField(ctx, item.object, item.id, item.field)
+		}
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return result, nil
 	}
-	return nil, nil
+	return nil
 }
@@ -2,6 +2,7 @@ package objectql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -11,40 +12,30 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 const MogSessionKey = "mgo_session"
 
 func (o *Objectql) InitMongodb(ctx context.Context, uri, datebase string) (err error) {
-	o.mongoDatebase = datebase
-	o.mongoClientOpts = options.Client().ApplyURI(uri)
-	o.mongoClient, err = mongo.Connect(ctx, o.mongoClientOpts)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		return
 	}
-	o.mongoCollectionOptions = options.Collection().SetWriteConcern(writeconcern.Majority())
+	o.SetDriver(NewMongoDriver(client, datebase))
 	return
 }
 
-func (o *Objectql) getCollection(api string) *mongo.Collection {
-	return o.mongoClient.Database(o.mongoDatebase).Collection(api)
-}
-
 func (o *Objectql) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
-	if mongo.SessionFromContext(ctx) != nil {
+	if o.driver.InTransaction(ctx) {
 		return fn(ctx)
 	} else {
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 		// SUPPORT NEXT
 		ctx = o.withNextContext(ctx)
-		session, err := o.mongoClient.StartSession()
-		if err != nil {
-			return nil, err
-		}
-		defer session.EndSession(ctx)
-		return session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		// SUPPORT CACHE
+		ctx = o.withCacheContext(ctx)
+		result, err := o.driver.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
 			result, err := fn(ctx)
 			if err != nil {
 				return nil, err
@@ -55,24 +46,21 @@ func (o *Objectql) WithTransaction(ctx context.Context, fn func(ctx context.Cont
 			}
 			return result, nil
 		})
+		o.flushCacheContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		o.runAsyncNext(ctx)
+		return result, nil
 	}
 }
 
 func (o *Objectql) mongoFindAll(ctx context.Context, table string, filter bson.M, selects string) ([]bson.M, error) {
-	findOptions := options.Find()
+	var projection M
 	if len(selects) > 0 {
-		findOptions.SetProjection(StringArrayToProjection(strings.Split(selects, ",")))
-	}
-	cursor, err := o.getCollection(table).Find(ctx, filter, findOptions)
-	if err != nil {
-		return nil, err
+		projection = StringArrayToProjection(strings.Split(selects, ","))
 	}
-	var result []bson.M
-	err = cursor.All(ctx, &result)
-	if err != nil {
-		return nil, err
-	}
-	return result, nil
+	return o.driver.Find(ctx, table, filter, projection)
 }
 
 func (o *Objectql) mongoFindOneById(ctx context.Context, table string, id, selects string) (bson.M, error) {
@@ -86,20 +74,15 @@ func (o *Objectql) mongoFindOneById(ctx context.Context, table string, id, selec
 }
 
 func (o *Objectql) mongoFindOne(ctx context.Context, table string, filter bson.M, selects string) (bson.M, error) {
-	findOneOptions := options.FindOne()
+	var projection M
 	if len(selects) > 0 {
-		findOneOptions.SetProjection(StringArrayToProjection(strings.Split(selects, ",")))
-	}
-	var result bson.M
-	err := o.getCollection(table).FindOne(ctx, filter, findOneOptions).Decode(&result)
-	if err != nil && err != mongo.ErrNoDocuments {
-		return nil, err
+		projection = StringArrayToProjection(strings.Split(selects, ","))
 	}
-	return result, nil
+	return o.driver.FindOne(ctx, table, filter, projection)
 }
 
 func (o *Objectql) mongoCount(ctx context.Context, table string, filter bson.M) (int64, error) {
-	count, err := o.getCollection(table).CountDocuments(ctx, filter)
+	count, err := o.driver.Count(ctx, table, filter)
 	if err != nil {
 		return 0, err
 	}
@@ -115,11 +98,95 @@ func (o *Objectql) mongoInsert(ctx context.Context, table string, doc bson.M) (s
 		}
 	}
 
-	insertResult, err := o.getCollection(table).InsertOne(ctx, set)
+	insertedID, err := o.driver.Insert(ctx, table, set)
 	if err != nil {
-		return "", err
+		return "", convDuplicateKeyError(table, err)
 	}
-	return insertResult.InsertedID.(primitive.ObjectID).Hex(), nil
+	return insertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// 批量写入, 驱动不支持时逐条写入
+func (o *Objectql) mongoInsertMany(ctx context.Context, table string, docs []bson.M) ([]string, error) {
+	driver, ok := o.driver.(BulkDriver)
+	if !ok {
+		var result []string
+		for _, doc := range docs {
+			id, err := o.mongoInsert(ctx, table, doc)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, id)
+		}
+		return result, nil
+	}
+	var sets []M
+	for _, doc := range docs {
+		// nil 值不设置 $set
+		set := bson.M{}
+		for k, v := range doc {
+			if !isNull(v) {
+				set[k] = v
+			}
+		}
+		sets = append(sets, set)
+	}
+	insertedIDs, err := driver.InsertMany(ctx, table, sets)
+	if err != nil {
+		return nil, convDuplicateKeyError(table, err)
+	}
+	var result []string
+	for _, id := range insertedIDs {
+		result = append(result, id.(primitive.ObjectID).Hex())
+	}
+	return result, nil
+}
+
+// 批量修改, ids 和 docs 一一对应, 驱动不支持时逐条修改
+func (o *Objectql) mongoBulkUpdateById(ctx context.Context, table string, ids []string, docs []bson.M) (int64, error) {
+	driver, ok := o.driver.(BulkDriver)
+	if !ok {
+		var result int64
+		for i, id := range ids {
+			modified, err := o.mongoUpdateById(ctx, table, id, docs[i])
+			if err != nil {
+				return 0, err
+			}
+			result += modified
+		}
+		return result, nil
+	}
+	var objectIds []interface{}
+	var updates []M
+	for i, id := range ids {
+		objectId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return 0, err
+		}
+		// 分离出$set 和 $unset 不修改原有map
+		set := bson.M{}
+		unset := bson.M{}
+		for k, v := range docs[i] {
+			if isNull(v) {
+				unset[k] = 1
+			} else {
+				set[k] = v
+			}
+		}
+		objectIds = append(objectIds, objectId)
+		updates = append(updates, bson.M{
+			"$set":   set,
+			"$unset": unset,
+		})
+	}
+	modified, err := driver.BulkUpdateById(ctx, table, objectIds, updates)
+	if err != nil {
+		return 0, convDuplicateKeyError(table, err)
+	}
+	err = o.invalidateCache(ctx, table, ids...)
+	if err != nil {
+		return 0, err
+	}
+	return modified, nil
 }
 
 // 如果是NULL则会执行 $unset
@@ -139,22 +206,42 @@ func (o *Objectql) mongoUpdateById(ctx context.Context, table string, id string,
 	if err != nil {
 		return 0, err
 	}
-	result, err := o.getCollection(table).UpdateByID(ctx, objectId, bson.M{
+	modified, err := o.driver.UpdateById(ctx, table, objectId, bson.M{
 		"$set":   set,
 		"$unset": unset,
 	})
+	if err != nil {
+		return 0, convDuplicateKeyError(table, err)
+	}
+	err = o.invalidateCache(ctx, table, id)
 	if err != nil {
 		return 0, err
 	}
-	return result.ModifiedCount, nil
+	return modified, nil
+}
+
+// 唯一索引冲突时返回和 checkPrimaryDuplicate 一致的错误
+func convDuplicateKeyError(table string, err error) error {
+	if errors.Is(err, ErrDuplicateKey) {
+		return fmt.Errorf("object %s primary duplicate", table)
+	}
+	return err
 }
 
 func (o *Objectql) mongoUpdateMany(ctx context.Context, table string, filter M, update M) (int64, error) {
-	result, err := o.getCollection(table).UpdateMany(ctx, filter, update)
+	ids, err := o.getCacheIdsByFilter(ctx, table, filter)
+	if err != nil {
+		return 0, err
+	}
+	modified, err := o.driver.UpdateMany(ctx, table, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	err = o.invalidateCache(ctx, table, ids...)
 	if err != nil {
 		return 0, err
 	}
-	return result.ModifiedCount, nil
+	return modified, nil
 }
 
 func (o *Objectql) mongoDeleteById(ctx context.Context, table string, id string) (int64, error) {
@@ -162,12 +249,19 @@ func (o *Objectql) mongoDeleteById(ctx context.Context, table string, id string)
 	if err != nil {
 		return 0, err
 	}
-	result, err := o.getCollection(table).DeleteOne(ctx, bson.M{"_id": objectId})
+	count, err := o.driver.DeleteById(ctx, table, objectId)
 	if err != nil {
 		return 0, err
 	}
+	err = o.invalidateCache(ctx, table, id)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
 
-	return result.DeletedCount, nil
+func (o *Objectql) mongoAggregate(ctx context.Context, table string, pipeline []M) ([]M, error) {
+	return o.driver.Aggregate(ctx, table, pipeline)
 }
 
 func ObjectIdFromHex(id string) primitive.ObjectID {
@@ -201,23 +295,42 @@ func (o *Objectql) mongoCountEx(ctx context.Context, table string, options count
 	fields = append(fields, options.Fields...)
 
 	// merge fields into a nested map
-	fieldsMap := mergeFields(fields)
+	fieldsMap := mergeFields(o.trimValueFieldPaths(object, fields))
+	attachRelatedListArgs(ctx, object, fieldsMap)
 
 	// convert nested map to MongoDB $project stage
 	// projectStage := convertToProjectStage(fieldsMap)
 
 	// generate $lookup stages
 	var lookupStages []map[string]interface{}
-	err := o.generateLookupStages(fieldsMap, table, "", &lookupStages)
+	err := o.generateLookupStages(ctx, fieldsMap, table, "", &lookupStages)
 	if err != nil {
 		return 0, err
 	}
 
 	var pipeline []map[string]any
+	// 只统计当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return 0, err
+	}
+	// $near 需要转换为第一个阶段 $geoNear
+	geoNear, filter, err := getGeoNearStage(object, options.Filter)
+	if err != nil {
+		return 0, err
+	}
+	if geoNear != nil {
+		if tenant != nil {
+			geoNear["query"] = tenant
+		}
+		pipeline = append(pipeline, M{"$geoNear": geoNear})
+	} else if tenant != nil {
+		pipeline = append(pipeline, M{"$match": tenant})
+	}
 	pipeline = append(pipeline, lookupStages...)
-	if len(options.Filter) > 0 {
+	if len(filter) > 0 {
 		pipeline = append(pipeline, map[string]interface{}{
-			"$match": options.Filter,
+			"$match": filter,
 		})
 	}
 	// if options.Skip > 0 {
@@ -239,20 +352,11 @@ func (o *Objectql) mongoCountEx(ctx context.Context, table string, options count
 		},
 	})
 
-	// writeJSONToFile("count_pipeline.json", pipeline)
-
 	// execute the query
-	cursor, err := o.getCollection(table).Aggregate(ctx, pipeline)
+	results, err := o.mongoAggregate(ctx, table, pipeline)
 	if err != nil {
 		return 0, err
 	}
-	defer cursor.Close(ctx)
-
-	// convert cursor results to a slice
-	var results []M
-	if err := cursor.All(ctx, &results); err != nil {
-		return 0, err
-	}
 	if len(results) == 0 {
 		return 0, nil
 	}
@@ -282,7 +386,34 @@ func (o *Objectql) mongoFindAllEx(ctx context.Context, table string, options fin
 	if object == nil {
 		return nil, fmt.Errorf("not found object %s", table)
 	}
+	// 开启了缓存的对象
+	if o.isCacheObject(object) {
+		results, ok, err := o.findByIdFromCache(ctx, object, options)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return o.formatFindAllResult(object, results)
+		}
+	}
+	options, cached := o.splitCacheExpands(object, options)
+	pipeline, err := o.getFindAllPipeline(ctx, object, options)
+	if err != nil {
+		return nil, err
+	}
+	// execute the query
+	results, err := o.mongoAggregate(ctx, table, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	err = o.fillCacheExpands(ctx, object, results, cached)
+	if err != nil {
+		return nil, err
+	}
+	return o.formatFindAllResult(object, results)
+}
 
+func (o *Objectql) getFindAllPipeline(ctx context.Context, object *Object, options findAllExOptions) ([]M, error) {
 	// 提取过滤条件里面的字段
 	var filterFields []string
 	getMatchReferenceFields(&filterFields, options.Filter)
@@ -301,26 +432,56 @@ func (o *Objectql) mongoFindAllEx(ctx context.Context, table string, options fin
 	fields = append(fields, deptFields...)
 
 	// merge fields into a nested map
-	fieldsMap := mergeFields(fields)
+	fieldsMap := mergeFields(o.trimValueFieldPaths(object, fields))
+	attachRelatedListArgs(ctx, object, fieldsMap)
 
 	// convert nested map to MongoDB $project stage
 	projectStage := convertToProjectStage(fieldsMap)
 
 	// generate $lookup stages
 	var lookupStages []map[string]interface{}
-	err := o.generateLookupStages(fieldsMap, table, "", &lookupStages)
+	err := o.generateLookupStages(ctx, fieldsMap, object.Api, "", &lookupStages)
 	if err != nil {
 		return nil, err
 	}
 
 	var pipeline []map[string]any
+	// 只查询当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	// $near 需要转换为第一个阶段 $geoNear, 结果已经按距离排序
+	geoNear, filter, err := getGeoNearStage(object, options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	// $text 必须在第一个 $match 中
+	switch {
+	case geoNear != nil:
+		if len(options.Search) > 0 {
+			return nil, errors.New("$near can't be used with search")
+		}
+		if tenant != nil {
+			geoNear["query"] = tenant
+		}
+		pipeline = append(pipeline, M{"$geoNear": geoNear})
+	case len(options.Search) > 0:
+		pipeline = append(pipeline, getSearchStages(options.Search, tenant)...)
+	case tenant != nil:
+		pipeline = append(pipeline, M{"$match": tenant})
+	}
 	pipeline = append(pipeline, lookupStages...)
-	if len(options.Filter) > 0 {
+	if len(filter) > 0 {
 		pipeline = append(pipeline, map[string]interface{}{
-			"$match": options.Filter,
+			"$match": filter,
 		})
 	}
-	if len(options.Sort) > 0 {
+	if len(options.Search) > 0 {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$sort": getSearchSort(options.Sort),
+		})
+	} else if len(options.Sort) > 0 {
 		pipeline = append(pipeline, map[string]interface{}{
 			"$sort": convStrings2MongoSort(options.Sort),
 		})
@@ -340,25 +501,16 @@ func (o *Objectql) mongoFindAllEx(ctx context.Context, table string, options fin
 			"$project": projectStage,
 		})
 	}
-	// writeJSONToFile("findall_pipeline.json", pipeline)
-	// execute the query
-	cursor, err := o.getCollection(table).Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
+	return pipeline, nil
+}
 
-	// convert cursor results to a slice
-	var results []M
-	if err := cursor.All(ctx, &results); err != nil {
-		return nil, err
-	}
+func (o *Objectql) formatFindAllResult(object *Object, results []M) ([]M, error) {
 	// remove primitive types
 	clear := removePrimitiveTypes(results)
 	// remove empty expand map
 	clear = removeEmptyExpandMap(clear)
 	// format raw database values
-	err = o.formatListWithObject(object, clear.([]M))
+	err := o.formatListWithObject(object, clear.([]M))
 	if err != nil {
 		return nil, err
 	}
@@ -368,7 +520,8 @@ func (o *Objectql) mongoFindAllEx(ctx context.Context, table string, options fin
 func getReoslveDependencyFields(object *Object, fields []string) []string {
 	var result []string
 	for _, fapi := range fields {
-		depts := object.getReoslveDependencyFields(fapi)
+		// a__expand.b 依赖 a__expand 的字段
+		depts := object.getReoslveDependencyFields(strings.SplitN(fapi, ".", 2)[0])
 		if len(depts) > 0 {
 			result = append(result, depts...)
 		}
@@ -399,6 +552,10 @@ func (o *Objectql) formatValueWithObject(object *Object, m primitive.M) error {
 		case *ExpandsType:
 			list := o.convPrimitiveArrayToMapArray(v.(A))
 			o.formatListWithObject(o.GetObject(n.ObjectApi), list)
+		case *ManyToManyType, *RelatedListType:
+			arr := toLookupList(v)
+			m[k] = arr
+			o.formatListWithObject(o.GetObject(getExpandObjectApi(n)), o.convPrimitiveArrayToMapArray(arr))
 		case *ExpandType:
 			o.formatValueWithObject(o.GetObject(n.ObjectApi), v.(M))
 		default:
@@ -412,6 +569,27 @@ func (o *Objectql) formatValueWithObject(object *Object, m primitive.M) error {
 	return nil
 }
 
+// $lookup 子管道中嵌套展开的结果是 primitive.A 和 primitive.M
+func toLookupList(v any) A {
+	var arr []any
+	switch n := v.(type) {
+	case primitive.A:
+		arr = n
+	case A:
+		arr = n
+	}
+	result := A{}
+	for _, item := range arr {
+		switch n := item.(type) {
+		case primitive.M:
+			result = append(result, M(n))
+		case M:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
 func (o *Objectql) convPrimitiveArrayToMapArray(arr A) []M {
 	var result []M
 	for _, item := range arr {
@@ -433,10 +611,20 @@ func (o *Objectql) formatValueWithFieldType(tpe Type, v interface{}) (interface{
 		return gconv.Int(v), nil
 	case *FloatType:
 		return gconv.Float64(v), nil
+	case *DecimalType:
+		return formatDecimalValueFromDatabase(n, v)
 	case *StringType:
 		return gconv.String(v), nil
 	case *DateTimeType, *DateType, *TimeType:
 		return gconv.Time(v), nil
+	case *GeoPointType:
+		return formatGeoPointValueFromDatabase(v)
+	case *FileType:
+		return formatFileValueFromDatabase(v)
+	case *EmbeddedType:
+		return o.formatEmbeddedValueWithFieldType(n, v)
+	case *AnyType:
+		return formatAnyValueFromDatabase(v), nil
 	case *RelateType:
 		return v.(primitive.ObjectID).Hex(), nil
 	case *FormulaType:
@@ -537,6 +725,36 @@ func getSortReferenceFields(arr []string) []string {
 	return result
 }
 
+// 地理位置, 文件, 内嵌文档和任意类型的字段
+func isValueFieldType(tpe Type) bool {
+	return IsGeoPointType(tpe) || isFileFieldType(tpe) || isEmbeddedFieldType(tpe) || IsAnyType(tpe)
+}
+
+// 值类型字段的子字段不需要 $lookup, 只查询整个字段
+func (o *Objectql) trimValueFieldPaths(object *Object, fields []string) []string {
+	var result []string
+	for _, item := range fields {
+		parts := strings.Split(item, ".")
+		current := object
+		for i, part := range parts[:len(parts)-1] {
+			if current == nil {
+				break
+			}
+			field := FindFieldFromObject(current, part)
+			if field != nil && isValueFieldType(field.Type) {
+				item = strings.Join(parts[:i+1], ".")
+				break
+			}
+			current = nil
+			if field != nil {
+				current = o.GetObject(getExpandObjectApi(field.Type))
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
 // MergeFields merges an array of fields into a nested map
 func mergeFields(fields []string) map[string]interface{} {
 	result := make(map[string]interface{})
@@ -597,14 +815,29 @@ func convertToProjectStage(fieldsMap map[string]interface{}) map[string]interfac
 }
 
 // Generate $lookup stages based on the nested map
-func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from string, parentKey string, lookupStages *[]map[string]interface{}) error {
+func (o *Objectql) generateLookupStages(ctx context.Context, fieldsMap map[string]interface{}, from string, parentKey string, lookupStages *[]map[string]interface{}) error {
 	if len(parentKey) > 0 {
 		parentKey += "."
 	}
 	for key, value := range fieldsMap {
 		switch v := value.(type) {
 		case int:
-			// If the value is an integer, do nothing
+			// 多对多字段没有子字段时查询关联记录的全部字段
+			if n, ok := o.getManyToManyFieldType(from, key); ok {
+				stages, err := o.getManyToManyLookupStages(ctx, n, map[string]interface{}{}, parentKey, key)
+				if err != nil {
+					return err
+				}
+				*lookupStages = append(*lookupStages, stages...)
+			}
+			// 反向列表字段没有子字段时同样查询子记录的全部字段
+			if n, ok := o.getRelatedListFieldType(from, key); ok {
+				stages, err := o.getRelatedListLookupStages(ctx, n, map[string]interface{}{}, parentKey, key)
+				if err != nil {
+					return err
+				}
+				*lookupStages = append(*lookupStages, stages...)
+			}
 		case map[string]interface{}:
 			// If the value is a nested map, set up $lookup stage
 			object := o.GetObject(from)
@@ -615,18 +848,32 @@ func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from s
 			if field == nil {
 				return fmt.Errorf("generateLookupStages error: not found field %s in object %s", key, from)
 			}
+			// 关联字段自定义了 resolve 时数据库中没有值, 由 graphql 的 loader 批量查询
+			if relate := object.getField(removeFieldSuffix(key)); relate != nil && relate.Resolve != nil {
+				continue
+			}
+			// 关联的对象只查询当前租户的数据
+			tenant, err := o.getTenantFilter(ctx, o.GetObject(getExpandObjectApi(field.Type)))
+			if err != nil {
+				return err
+			}
 			switch n := field.Type.(type) {
 			case *ExpandType:
 				table := n.ObjectApi
-				lookupStage := map[string]interface{}{
-					"$lookup": map[string]interface{}{
-						"from":         table,
-						"localField":   parentKey + removeFieldSuffix(key),
-						"foreignField": "_id",
-						"as":           parentKey + key,
-					},
+				lookup := map[string]interface{}{
+					"from":         table,
+					"localField":   parentKey + removeFieldSuffix(key),
+					"foreignField": "_id",
+					"as":           parentKey + key,
 				}
-				*lookupStages = append(*lookupStages, lookupStage)
+				if tenant != nil {
+					lookup["pipeline"] = []map[string]interface{}{
+						{"$match": tenant},
+					}
+				}
+				*lookupStages = append(*lookupStages, map[string]interface{}{
+					"$lookup": lookup,
+				})
 				*lookupStages = append(*lookupStages, map[string]interface{}{
 					"$unwind": M{
 						"path":                       "$" + parentKey + key,
@@ -634,7 +881,7 @@ func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from s
 					},
 				})
 				// Recursively generate lookup stages for the nested map
-				if err := o.generateLookupStages(v, table, parentKey+key, lookupStages); err != nil {
+				if err := o.generateLookupStages(ctx, v, table, parentKey+key, lookupStages); err != nil {
 					return err
 				}
 			case *ExpandsType:
@@ -650,7 +897,12 @@ func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from s
 						},
 					},
 				}
-				if err := o.generateLookupStages(v, table, "", &pipeline); err != nil {
+				if tenant != nil {
+					pipeline = append(pipeline, map[string]interface{}{
+						"$match": tenant,
+					})
+				}
+				if err := o.generateLookupStages(ctx, v, table, "", &pipeline); err != nil {
 					return err
 				}
 				// Append $lookup
@@ -668,6 +920,18 @@ func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from s
 					},
 				}
 				*lookupStages = append(*lookupStages, lookupStage)
+			case *ManyToManyType:
+				stages, err := o.getManyToManyLookupStages(ctx, n, v, parentKey, key)
+				if err != nil {
+					return err
+				}
+				*lookupStages = append(*lookupStages, stages...)
+			case *RelatedListType:
+				stages, err := o.getRelatedListLookupStages(ctx, n, v, parentKey, key)
+				if err != nil {
+					return err
+				}
+				*lookupStages = append(*lookupStages, stages...)
 			default:
 				return fmt.Errorf("generateLookupStages error: field %s not expand or expands in object %s", key, from)
 			}
@@ -676,6 +940,20 @@ func (o *Objectql) generateLookupStages(fieldsMap map[string]interface{}, from s
 	return nil
 }
 
+func getExpandObjectApi(tpe Type) string {
+	switch n := tpe.(type) {
+	case *ExpandType:
+		return n.ObjectApi
+	case *ExpandsType:
+		return n.ObjectApi
+	case *ManyToManyType:
+		return n.ObjectApi
+	case *RelatedListType:
+		return n.Object
+	}
+	return ""
+}
+
 // 在多重嵌套的expand查询中，即使expand没有数据顶层的expand也会有一个空的Map对象
 func removeEmptyExpandMap(v interface{}) interface{} {
 	switch n := v.(type) {
@@ -766,4 +1044,6 @@ type findAllExOptions struct {
 	Top    int
 	Skip   int
 	Sort   []string
+	// 全文搜索, 结果按相关度排序
+	Search string
 }
@@ -0,0 +1,379 @@
+package objectql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/aundis/graphql"
+	"github.com/aundis/graphql/language/ast"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 精确小数
+// DecimalType 在数据库中保存为 Decimal128, 写入时按 Scale 四舍五入, 整数部分超过 Precision-Scale 位时报错
+// 输入输出使用字符串避免 float64 的精度误差, graphql 中为 Decimal 标量
+// 小数类型的公式只包含四则运算时使用 big.Rat 精确计算, 其他公式交给公式引擎按 float64 计算
+
+// Decimal128 最多 34 位有效数字
+const decimalMaxPrecision = 34
+
+var graphqlDecimal = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Decimal",
+	Description: "精确小数, 使用字符串表示",
+	Serialize: func(value interface{}) interface{} {
+		if isNull(value) {
+			return nil
+		}
+		if d, ok := value.(primitive.Decimal128); ok {
+			return d.String()
+		}
+		return gconv.String(value)
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if _, err := parseDecimal(value); err != nil {
+			return nil
+		}
+		return value
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		switch n := valueAST.(type) {
+		case *ast.StringValue:
+			if _, err := parseDecimal(n.Value); err == nil {
+				return n.Value
+			}
+		case *ast.IntValue:
+			return n.Value
+		case *ast.FloatValue:
+			return n.Value
+		}
+		return nil
+	},
+})
+
+// 公式和聚合字段的结果类型也可以是小数
+func decimalTypeOf(tpe Type) *DecimalType {
+	switch n := tpe.(type) {
+	case *DecimalType:
+		return n
+	case *FormulaType:
+		return decimalTypeOf(n.Type)
+	case *AggregationType:
+		return decimalTypeOf(n.Type)
+	}
+	return nil
+}
+
+func (t *DecimalType) precision() int {
+	if t.Precision <= 0 || t.Precision > decimalMaxPrecision {
+		return decimalMaxPrecision
+	}
+	return t.Precision
+}
+
+func (t *DecimalType) scale() int {
+	if t.Scale < 0 {
+		return 0
+	}
+	if t.Scale > t.precision() {
+		return t.precision()
+	}
+	return t.Scale
+}
+
+// 浮点数按最短表示转换, 0.1 不会变成 0.1000000000000000055511151231257827
+func parseDecimal(v interface{}) (*big.Rat, error) {
+	var s string
+	switch n := v.(type) {
+	case *big.Rat:
+		return n, nil
+	case primitive.Decimal128:
+		s = n.String()
+	case float32:
+		s = strconv.FormatFloat(float64(n), 'f', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(n, 'f', -1, 64)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s = gconv.String(n)
+	case string:
+		s = strings.TrimSpace(n)
+	case json.Number:
+		s = n.String()
+	case fmt.Stringer:
+		s = n.String()
+	default:
+		return nil, fmt.Errorf("can't conv type %T to decimal", v)
+	}
+	// big.Rat 支持 1/3 这种分数, 小数字段不允许
+	if strings.Contains(s, "/") {
+		return nil, fmt.Errorf("invalid decimal %s", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %s", s)
+	}
+	return r, nil
+}
+
+func isDecimalLike(v interface{}) bool {
+	_, err := parseDecimal(v)
+	return err == nil
+}
+
+// 按 Scale 四舍五入后的字符串, 例如 Scale 为 2 时 1.005 => "1.01"
+func formatDecimalString(t *DecimalType, v interface{}) (string, error) {
+	r, err := parseDecimal(v)
+	if err != nil {
+		return "", err
+	}
+	s := r.FloatString(t.scale())
+	digits := strings.TrimLeft(strings.SplitN(strings.TrimPrefix(s, "-"), ".", 2)[0], "0")
+	if len(digits) > t.precision()-t.scale() {
+		return "", fmt.Errorf("decimal %s out of range decimal(%d, %d)", s, t.precision(), t.scale())
+	}
+	return s, nil
+}
+
+func formatDecimalValueToDatabase(t *DecimalType, v interface{}) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+	s, err := formatDecimalString(t, v)
+	if err != nil {
+		return nil, err
+	}
+	return primitive.ParseDecimal128(s)
+}
+
+func formatDecimalValueFromDatabase(t *DecimalType, v interface{}) (interface{}, error) {
+	return formatDecimalString(t, v)
+}
+
+// 除法等运算的结果可能是无限小数, 保留 Decimal128 能表示的最多位数
+func decimalFromRat(r *big.Rat) (primitive.Decimal128, error) {
+	digits := len(new(big.Int).Quo(new(big.Int).Abs(r.Num()), r.Denom()).String())
+	scale := decimalMaxPrecision - digits
+	if scale < 0 {
+		scale = 0
+	}
+	return primitive.ParseDecimal128(r.FloatString(scale))
+}
+
+// 公式引擎只支持 float64, 交给公式引擎计算的小数会丢失精度
+func formatDecimalValueToCompute(v interface{}) (interface{}, error) {
+	r, err := parseDecimal(v)
+	if err != nil {
+		return nil, err
+	}
+	f, _ := r.Float64()
+	return f, nil
+}
+
+// 把数据中的小数字段(包括 expand 中的)转换为公式可以计算的数值
+func (o *Objectql) formatDecimalFieldsToCompute(object *Object, doc M) error {
+	for key, value := range doc {
+		field := FindFieldFromObject(object, key)
+		if field == nil || isNull(value) {
+			continue
+		}
+		var err error
+		switch n := field.Type.(type) {
+		case *ExpandType:
+			if m, ok := value.(M); ok {
+				err = o.formatDecimalFieldsToCompute(o.GetObject(n.ObjectApi), m)
+			}
+		case *ExpandsType, *ManyToManyType, *RelatedListType:
+			list, _ := value.(A)
+			for _, item := range list {
+				if m, ok := item.(M); ok {
+					if err = o.formatDecimalFieldsToCompute(o.GetObject(getExpandObjectApi(n)), m); err != nil {
+						break
+					}
+				}
+			}
+		default:
+			if decimalTypeOf(field.Type) != nil {
+				doc[key], err = formatDecimalValueToCompute(value)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isDecimalValueEqual(v1, v2 interface{}) (bool, error) {
+	r1, err := parseDecimal(v1)
+	if err != nil {
+		return false, err
+	}
+	r2, err := parseDecimal(v2)
+	if err != nil {
+		return false, err
+	}
+	return r1.Cmp(r2) == 0, nil
+}
+
+// 小数公式的表达式树, 只支持数字, 字段, 括号和 + - * /
+type decimalExpr struct {
+	op    byte // 0 数字, '.' 字段, 'n' 取负, '+' '-' '*' '/'
+	value *big.Rat
+	path  []string
+	x, y  *decimalExpr
+}
+
+// 解析公式, 包含函数调用, 条件等其他语法时返回 nil
+func parseDecimalExpr(s string) *decimalExpr {
+	p := &decimalExprParser{s: s}
+	e := p.parseSum()
+	if e == nil || p.peek() != 0 {
+		return nil
+	}
+	return e
+}
+
+// 计算表达式, operand 返回字段的值, 字段不是数值或者除数为 0 时返回 false
+func (e *decimalExpr) eval(operand func(path []string) (*big.Rat, bool)) (*big.Rat, bool) {
+	switch e.op {
+	case 0:
+		return e.value, true
+	case '.':
+		return operand(e.path)
+	case 'n':
+		x, ok := e.x.eval(operand)
+		if !ok {
+			return nil, false
+		}
+		return new(big.Rat).Neg(x), true
+	}
+	x, ok := e.x.eval(operand)
+	if !ok {
+		return nil, false
+	}
+	y, ok := e.y.eval(operand)
+	if !ok {
+		return nil, false
+	}
+	switch e.op {
+	case '+':
+		return new(big.Rat).Add(x, y), true
+	case '-':
+		return new(big.Rat).Sub(x, y), true
+	case '*':
+		return new(big.Rat).Mul(x, y), true
+	default:
+		if y.Sign() == 0 {
+			return nil, false
+		}
+		return new(big.Rat).Quo(x, y), true
+	}
+}
+
+type decimalExprParser struct {
+	s   string
+	pos int
+}
+
+func (p *decimalExprParser) peek() byte {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *decimalExprParser) parseSum() *decimalExpr {
+	x := p.parseProduct()
+	for x != nil {
+		c := p.peek()
+		if c != '+' && c != '-' {
+			break
+		}
+		p.pos++
+		y := p.parseProduct()
+		if y == nil {
+			return nil
+		}
+		x = &decimalExpr{op: c, x: x, y: y}
+	}
+	return x
+}
+
+func (p *decimalExprParser) parseProduct() *decimalExpr {
+	x := p.parseUnary()
+	for x != nil {
+		c := p.peek()
+		if c != '*' && c != '/' {
+			break
+		}
+		p.pos++
+		y := p.parseUnary()
+		if y == nil {
+			return nil
+		}
+		x = &decimalExpr{op: c, x: x, y: y}
+	}
+	return x
+}
+
+func (p *decimalExprParser) parseUnary() *decimalExpr {
+	switch c := p.peek(); {
+	case c == '-' || c == '+':
+		p.pos++
+		x := p.parseUnary()
+		if x == nil || c == '+' {
+			return x
+		}
+		return &decimalExpr{op: 'n', x: x}
+	case c == '(':
+		p.pos++
+		x := p.parseSum()
+		if x == nil || p.peek() != ')' {
+			return nil
+		}
+		p.pos++
+		return x
+	case c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] >= '0' && p.s[p.pos] <= '9' || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		r, ok := new(big.Rat).SetString(p.s[start:p.pos])
+		if !ok {
+			return nil
+		}
+		return &decimalExpr{value: r}
+	case isDecimalExprIdent(c, false):
+		start := p.pos
+		for p.pos < len(p.s) && isDecimalExprIdent(p.s[p.pos], true) {
+			p.pos++
+		}
+		path := strings.Split(p.s[start:p.pos], ".")
+		for _, name := range path {
+			if len(name) == 0 || !isDecimalExprIdent(name[0], false) {
+				return nil
+			}
+		}
+		// 关键字和函数调用交给公式引擎
+		switch path[0] {
+		case "this", "true", "false", "null", "nil", "undefined":
+			return nil
+		}
+		if p.peek() == '(' {
+			return nil
+		}
+		return &decimalExpr{op: '.', path: path}
+	}
+	return nil
+}
+
+func isDecimalExprIdent(c byte, rest bool) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		rest && (c >= '0' && c <= '9' || c == '.')
+}
@@ -0,0 +1,232 @@
+package objectql
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "订单",
+		Api:  "order",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "总金额",
+				Api:  "total",
+				Type: &AggregationType{
+					Object: "item",
+					Relate: "order",
+					Field:  "price",
+					Type:   NewDecimal(12, 2),
+					Kind:   Sum,
+				},
+			},
+			{
+				Name: "平均金额",
+				Api:  "avg",
+				Type: &AggregationType{
+					Object: "item",
+					Relate: "order",
+					Field:  "price",
+					Type:   NewDecimal(12, 2),
+					Kind:   Avg,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "明细",
+		Api:  "item",
+		Fields: []*Field{
+			{
+				Name: "价格",
+				Api:  "price",
+				Type: NewDecimal(5, 2),
+			},
+			{
+				Name: "订单",
+				Api:  "order",
+				Type: NewRelate("order"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	order, err := oql.Insert(ctx, "order", InsertOptions{Doc: M{"name": "测试"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入订单失败", err)
+		return
+	}
+	orderId := order.String("_id")
+	// float64 的 0.1 + 0.2 != 0.3
+	for _, price := range []any{"0.1", 0.2, "1.005"} {
+		_, err := oql.Insert(ctx, "item", InsertOptions{Doc: M{"price": price, "order": orderId}})
+		if err != nil {
+			t.Error("插入明细失败", err)
+			return
+		}
+	}
+	_, err = oql.Insert(ctx, "item", InsertOptions{Doc: M{"price": 1000, "order": orderId}})
+	if err == nil {
+		t.Error("超出精度的值不能保存")
+		return
+	}
+	_, err = oql.Insert(ctx, "item", InsertOptions{Doc: M{"price": "abc", "order": orderId}})
+	if err == nil {
+		t.Error("非数字不能保存")
+		return
+	}
+	list, err := oql.FindList(ctx, "item", FindListOptions{
+		Filter: M{"price": M{"$gt": 0.15}},
+		Fields: []string{"price"},
+		Sort:   []string{"price"},
+	})
+	if err != nil || len(list) != 2 || list[0].String("price") != "0.20" || list[1].String("price") != "1.01" {
+		t.Error("小数按精度四舍五入后保存", err, list)
+		return
+	}
+	order, err = oql.FindOneById(ctx, "order", FindOneByIdOptions{ID: orderId, Fields: []string{"total", "avg"}})
+	if err != nil {
+		t.Error("查询订单失败", err)
+		return
+	}
+	if order.String("total") != "1.31" || order.String("avg") != "0.44" {
+		t.Error("小数聚合结果错误", order)
+		return
+	}
+	// graphql 中使用字符串
+	res := oql.Do(ctx, `mutation {
+		item__insert(doc: { price: "2.5", order: "`+orderId+`" }) { price }
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 插入失败", res.Errors)
+		return
+	}
+	if NewVar(res.Data).Var("item__insert").Any("price") != "2.50" {
+		t.Error("graphql 返回的小数错误", res.Data)
+		return
+	}
+	res = oql.Do(ctx, `{ order__findList { total } }`)
+	items, _ := NewVar(res.Data).Any("order__findList").([]any)
+	if res.HasErrors() || len(items) != 1 || NewVar(items[0]).Any("total") != "3.81" {
+		t.Error("graphql 查询的小数错误", res.Errors, res.Data)
+	}
+}
+
+// 小数类型的四则运算公式使用 big.Rat 精确计算
+func TestDecimalCompute(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "客户",
+		Api:  "customer",
+		Fields: []*Field{
+			{
+				Name: "折扣",
+				Api:  "discount",
+				Type: NewDecimal(5, 2),
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "订单",
+		Api:  "order",
+		Fields: []*Field{
+			{
+				Name: "单价",
+				Api:  "price",
+				Type: NewDecimal(10, 2),
+			},
+			{
+				Name: "数量",
+				Api:  "qty",
+				Type: Int,
+			},
+			{
+				Name: "客户",
+				Api:  "customer",
+				Type: NewRelate("customer"),
+			},
+			{
+				Name: "总价",
+				Api:  "total",
+				Type: &FormulaType{
+					Formula: "price * qty",
+					Type:    NewDecimal(10, 1),
+				},
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	object := oql.GetObject("order")
+	compute := func(formula string, tpe *DecimalType, doc M) (string, bool) {
+		expr := parseDecimalExpr(formula)
+		if expr == nil {
+			return "", false
+		}
+		r, ok := expr.eval(func(path []string) (*big.Rat, bool) {
+			return oql.getDecimalOperand(object, doc, path)
+		})
+		if !ok {
+			return "", false
+		}
+		s, err := formatDecimalString(tpe, r)
+		return s, err == nil
+	}
+	if FindFieldFromObject(object, "total").Type.(*FormulaType).decimalExpr == nil {
+		t.Error("小数类型的四则运算公式应该精确计算")
+		return
+	}
+	// float64 中 1.15 * 3 = 3.4499999999999997
+	for _, item := range []struct {
+		formula string
+		tpe     *DecimalType
+		doc     M
+		expect  string
+	}{
+		{"price * qty", NewDecimal(10, 1), M{"price": "1.15", "qty": 3}, "3.5"},
+		{"0.1 + 0.2", NewDecimal(20, 20), M{}, "0.30000000000000000000"},
+		{"price * (1 - customer__expand.discount)", NewDecimal(10, 2), M{"price": "100.05", "customer__expand": M{"discount": "0.15"}}, "85.04"},
+		{"-price / 3", NewDecimal(34, 2), M{"price": "123456789012345678.91"}, "-41152263004115226.30"},
+	} {
+		s, ok := compute(item.formula, item.tpe, item.doc)
+		if !ok || s != item.expect {
+			t.Error("小数公式计算错误", item.formula, s)
+			return
+		}
+	}
+	// 函数调用等其他语法, 空值, 非数值字段, 除数为 0 交给公式引擎
+	for _, item := range []struct {
+		formula string
+		doc     M
+	}{
+		{"round(price)", M{"price": "1.15"}},
+		{"price > 1 ? price : 1", M{"price": "1.15"}},
+		{"price * qty", M{"price": "1.15"}},
+		{"price * unknown", M{"price": "1.15", "unknown": 3}},
+		{"price / qty", M{"price": "1.15", "qty": 0}},
+		{"customer * 2", M{"customer": "1"}},
+	} {
+		if _, ok := compute(item.formula, NewDecimal(10, 2), item.doc); ok {
+			t.Error("公式应该交给公式引擎计算", item.formula)
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package objectql
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Driver 存储驱动, objectql 的所有数据读写都经过它
+// filter/pipeline/update 使用 mongodb 的语法
+type Driver interface {
+	Find(ctx context.Context, table string, filter M, projection M) ([]bson.M, error)
+	FindOne(ctx context.Context, table string, filter M, projection M) (bson.M, error)
+	Count(ctx context.Context, table string, filter M) (int64, error)
+	Insert(ctx context.Context, table string, doc M) (interface{}, error)
+	UpdateById(ctx context.Context, table string, id interface{}, update M) (int64, error)
+	UpdateMany(ctx context.Context, table string, filter M, update M) (int64, error)
+	DeleteById(ctx context.Context, table string, id interface{}) (int64, error)
+	Aggregate(ctx context.Context, table string, pipeline []M) ([]M, error)
+	// 在事务中执行fn, 已经处于事务中时不会再开启新的事务
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error)
+	InTransaction(ctx context.Context) bool
+}
+
+func (o *Objectql) SetDriver(driver Driver) {
+	o.driver = driver
+	o.bindTenantDatabase()
+	o.bindTransactionMode()
+	o.bindProfileHandler()
+}
+
+func (o *Objectql) GetDriver() Driver {
+	return o.driver
+}
+
+// Cursor 查询结果的游标, 用于逐条读取, *mongo.Cursor 实现了这个接口
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Decode(v interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// CursorDriver 支持流式读取的驱动, 不支持时会一次读取全部结果
+type CursorDriver interface {
+	AggregateCursor(ctx context.Context, table string, pipeline []M, batchSize int) (Cursor, error)
+}
+
+// BulkDriver 支持批量写入的驱动, 不支持时会逐条写入
+type BulkDriver interface {
+	InsertMany(ctx context.Context, table string, docs []M) ([]interface{}, error)
+	// updates 和 ids 一一对应
+	BulkUpdateById(ctx context.Context, table string, ids []interface{}, updates []M) (int64, error)
+}
@@ -0,0 +1,487 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryDriver 纯内存的存储驱动, 用于单元测试和本地开发
+// 只实现了 objectql 生成的 filter/$text/$geoWithin/$geoNear/$lookup/$unwind/$sort/$skip/$limit/$project/$group 子集
+// 同一时间只允许一个事务执行, 事务外的读取可以读到未提交的数据
+// 索引只用于唯一性约束和全文搜索, 不会加速查询, 地理位置按球面距离直接计算
+type MemoryDriver struct {
+	mu          sync.RWMutex
+	txMu        sync.Mutex
+	collections map[string][]bson.Raw
+	indexes     map[string][]IndexSpec
+	txMode      TransactionMode
+	// 只记录外部的调用, 内部复用的 find/updateMany 不重复记录
+	profileHandler QueryProfileHandler
+}
+
+type memoryTxKeyType struct{}
+
+var memoryTxKey memoryTxKeyType
+
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{
+		collections: map[string][]bson.Raw{},
+		indexes:     map[string][]IndexSpec{},
+	}
+}
+
+// 读取集合的全部文档(解码后的副本)
+func (d *MemoryDriver) load(table string) ([]bson.M, error) {
+	d.mu.RLock()
+	raws := d.collections[table]
+	d.mu.RUnlock()
+	result := make([]bson.M, 0, len(raws))
+	for _, raw := range raws {
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		result = append(result, doc)
+	}
+	return result, nil
+}
+
+func (d *MemoryDriver) Find(ctx context.Context, table string, filter M, projection M) (result []bson.M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "find", Table: table, Filter: filter, Count: int64(len(result)), Err: err}, start)
+	}(time.Now())
+	return d.find(table, filter, projection)
+}
+
+func (d *MemoryDriver) find(table string, filter M, projection M) ([]bson.M, error) {
+	pipeline := []M{}
+	if len(filter) > 0 {
+		pipeline = append(pipeline, M{"$match": filter})
+	}
+	if len(projection) > 0 {
+		pipeline = append(pipeline, M{"$project": projection})
+	}
+	docs, err := d.aggregate(table, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var result []bson.M
+	for _, doc := range docs {
+		var item bson.M
+		if err := memoryRedecode(doc, &item); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func (d *MemoryDriver) FindOne(ctx context.Context, table string, filter M, projection M) (result bson.M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "findOne", Table: table, Filter: filter, Count: profileCount(result), Err: err}, start)
+	}(time.Now())
+	list, err := d.find(table, filter, projection)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (d *MemoryDriver) Count(ctx context.Context, table string, filter M) (count int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "count", Table: table, Filter: filter, Count: count, Err: err}, start)
+	}(time.Now())
+	list, err := d.find(table, filter, M{"_id": 1})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(list)), nil
+}
+
+func (d *MemoryDriver) Insert(ctx context.Context, table string, doc M) (insertedId interface{}, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "insert", Table: table, Update: doc, Count: profileCount(insertedId), Err: err}, start)
+	}(time.Now())
+	set := M{}
+	for k, v := range doc {
+		set[k] = v
+	}
+	if _, ok := set["_id"]; !ok {
+		set["_id"] = primitive.NewObjectID()
+	}
+	raw, err := bson.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	id, err := memoryRawId(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, item := range d.collections[table] {
+		exist, err := memoryRawId(item)
+		if err != nil {
+			return nil, err
+		}
+		if memoryCompare(exist, id) == 0 {
+			return nil, fmt.Errorf("%w: _id %v in collection %s", ErrDuplicateKey, id, table)
+		}
+	}
+	raws := append(d.collections[table][:len(d.collections[table]):len(d.collections[table])], raw)
+	err = d.checkUnique(table, raws)
+	if err != nil {
+		return nil, err
+	}
+	d.collections[table] = raws
+	recordUndoInsert(ctx, table, id)
+	return id, nil
+}
+
+func (d *MemoryDriver) UpdateById(ctx context.Context, table string, id interface{}, update M) (modified int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "updateById", Table: table, Filter: M{"_id": id}, Update: update, Count: modified, Err: err}, start)
+	}(time.Now())
+	return d.updateMany(ctx, table, M{"_id": id}, update)
+}
+
+func (d *MemoryDriver) UpdateMany(ctx context.Context, table string, filter M, update M) (modified int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "updateMany", Table: table, Filter: filter, Update: update, Count: modified, Err: err}, start)
+	}(time.Now())
+	return d.updateMany(ctx, table, filter, update)
+}
+
+func (d *MemoryDriver) updateMany(ctx context.Context, table string, filter M, update M) (int64, error) {
+	spec, err := memorySpec(filter)
+	if err != nil {
+		return 0, err
+	}
+	err = recordUndoWrite(ctx, d, table, filter)
+	if err != nil {
+		return 0, err
+	}
+	updateSpec, err := memorySpec(update)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var modified int64
+	raws := append([]bson.Raw(nil), d.collections[table]...)
+	for i, raw := range raws {
+		var doc bson.M
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return 0, err
+		}
+		ok, err := memoryMatch(doc, spec, nil)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+		err = memoryApplyUpdate(doc, updateSpec)
+		if err != nil {
+			return 0, err
+		}
+		next, err := bson.Marshal(doc)
+		if err != nil {
+			return 0, err
+		}
+		// 数值类型改变(int32 -> double)也算修改
+		if !reflect.DeepEqual(memoryMustDecode(raw), memoryMustDecode(next)) {
+			raws[i] = next
+			modified++
+		}
+	}
+	if modified > 0 {
+		err = d.checkUnique(table, raws)
+		if err != nil {
+			return 0, err
+		}
+		d.collections[table] = raws
+	}
+	return modified, nil
+}
+
+func (d *MemoryDriver) DeleteById(ctx context.Context, table string, id interface{}) (deleted int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "deleteById", Table: table, Filter: M{"_id": id}, Count: deleted, Err: err}, start)
+	}(time.Now())
+	spec, err := memorySpec(M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	target := spec[0].Value
+	err = recordUndoWrite(ctx, d, table, M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	raws := d.collections[table]
+	for i, raw := range raws {
+		exist, err := memoryRawId(raw)
+		if err != nil {
+			return 0, err
+		}
+		if memoryCompare(exist, target) == 0 {
+			d.collections[table] = append(raws[:i:i], raws[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (d *MemoryDriver) Aggregate(ctx context.Context, table string, pipeline []M) (results []M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "aggregate", Table: table, Pipeline: pipeline, Count: int64(len(results)), Err: err}, start)
+	}(time.Now())
+	docs, err := d.aggregate(table, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var item M
+		if err := memoryRedecode(doc, &item); err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+func (d *MemoryDriver) aggregate(table string, pipeline []M) ([]bson.M, error) {
+	stages, err := memoryPipelineSpec(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := d.load(table)
+	if err != nil {
+		return nil, err
+	}
+	vars := d.textIndexVars(table)
+	docs, err = d.runPipeline(docs, stages, vars)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		delete(doc, memoryTextScoreKey)
+	}
+	return docs, nil
+}
+
+// 集合的全文索引, 用于 $text 查询
+func (d *MemoryDriver) textIndexVars(table string) bson.M {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, index := range d.indexes[table] {
+		if len(index.Weights) > 0 {
+			return bson.M{memoryTextIndexVar: index.Weights}
+		}
+	}
+	return nil
+}
+
+func (d *MemoryDriver) InTransaction(ctx context.Context) bool {
+	if d.txMode == TransactionNone {
+		return getUndoLog(ctx) != nil
+	}
+	return ctx.Value(memoryTxKey) != nil
+}
+
+// TransactionNone 时不保存快照, 和 MongoDriver 一样使用补偿日志, 用于测试单机模式
+func (d *MemoryDriver) SetTransactionMode(mode TransactionMode) {
+	d.txMode = mode
+}
+
+func (d *MemoryDriver) SetProfileHandler(handler QueryProfileHandler) {
+	d.profileHandler = handler
+}
+
+// 事务开始时保存集合快照, fn 返回错误时恢复快照
+func (d *MemoryDriver) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if d.txMode == TransactionNone {
+		return runWithCompensation(ctx, d, fn)
+	}
+	if d.InTransaction(ctx) {
+		return fn(ctx)
+	}
+	d.txMu.Lock()
+	defer d.txMu.Unlock()
+
+	d.mu.RLock()
+	snapshot := map[string][]bson.Raw{}
+	for k, v := range d.collections {
+		snapshot[k] = append([]bson.Raw(nil), v...)
+	}
+	d.mu.RUnlock()
+
+	result, err := fn(context.WithValue(ctx, memoryTxKey, true))
+	if err != nil {
+		d.mu.Lock()
+		d.collections = snapshot
+		d.mu.Unlock()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *MemoryDriver) ListIndexes(ctx context.Context, table string) ([]IndexSpec, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exist := d.collections[table]
+	if !exist && len(d.indexes[table]) == 0 {
+		return nil, nil
+	}
+	result := []IndexSpec{{Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}}}
+	return append(result, d.indexes[table]...), nil
+}
+
+func (d *MemoryDriver) CreateIndex(ctx context.Context, table string, index IndexSpec) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, item := range d.indexes[table] {
+		if item.Name == index.Name {
+			return fmt.Errorf("memory driver: index %s already exists", index.Name)
+		}
+	}
+	indexes := append(d.indexes[table][:len(d.indexes[table]):len(d.indexes[table])], index)
+	if index.Unique {
+		err := memoryCheckUnique(index, d.collections[table])
+		if err != nil {
+			return err
+		}
+	}
+	d.indexes[table] = indexes
+	return nil
+}
+
+func (d *MemoryDriver) DropIndex(ctx context.Context, table string, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	indexes := d.indexes[table]
+	for i, item := range indexes {
+		if item.Name == name {
+			d.indexes[table] = append(indexes[:i:i], indexes[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("memory driver: index %s not found", name)
+}
+
+// 调用时需要持有写锁
+func (d *MemoryDriver) checkUnique(table string, raws []bson.Raw) error {
+	for _, index := range d.indexes[table] {
+		if !index.Unique {
+			continue
+		}
+		err := memoryCheckUnique(index, raws)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func memoryCheckUnique(index IndexSpec, raws []bson.Raw) error {
+	var keys []bson.A
+	for _, raw := range raws {
+		doc := memoryMustDecode(raw)
+		key := bson.A{}
+		for _, e := range index.Keys {
+			v, _ := memoryGetPath(doc, strings.Split(e.Key, "."))
+			key = append(key, v)
+		}
+		for _, exist := range keys {
+			if memoryCompare(exist, key) == 0 {
+				return fmt.Errorf("%w: index %s value %v", ErrDuplicateKey, index.Name, key)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return nil
+}
+
+// Drop 删除指定集合及其索引, 不传参数则删除全部
+func (d *MemoryDriver) Drop(tables ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(tables) == 0 {
+		d.collections = map[string][]bson.Raw{}
+		d.indexes = map[string][]IndexSpec{}
+		return
+	}
+	for _, table := range tables {
+		delete(d.collections, table)
+		delete(d.indexes, table)
+	}
+}
+
+func memoryRawId(raw bson.Raw) (interface{}, error) {
+	value, err := raw.LookupErr("_id")
+	if err != nil {
+		return nil, err
+	}
+	var id interface{}
+	err = value.Unmarshal(&id)
+	return id, err
+}
+
+func memoryMustDecode(raw bson.Raw) bson.M {
+	var doc bson.M
+	_ = bson.Unmarshal(raw, &doc)
+	return doc
+}
+
+// 通过 bson 编解码得到和 mongodb 驱动一致的值类型
+func memoryRedecode(v interface{}, out interface{}) error {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// 将 filter/update 转为有序的 bson.D, 值类型与存储的文档一致
+func memorySpec(v M) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	var result bson.D
+	if err := memoryRedecode(v, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func memoryPipelineSpec(pipeline []M) ([]bson.D, error) {
+	var wrap bson.D
+	if err := memoryRedecode(bson.D{{Key: "pipeline", Value: pipeline}}, &wrap); err != nil {
+		return nil, err
+	}
+	arr, _ := wrap[0].Value.(bson.A)
+	var result []bson.D
+	for _, item := range arr {
+		stage, ok := item.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("memory driver: pipeline stage must be a document")
+		}
+		result = append(result, stage)
+	}
+	return result, nil
+}
@@ -0,0 +1,1725 @@
+package objectql
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (d *MemoryDriver) runPipeline(docs []bson.M, stages []bson.D, vars bson.M) ([]bson.M, error) {
+	var err error
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("memory driver: pipeline stage must have exactly one field")
+		}
+		name, spec := stage[0].Key, stage[0].Value
+		switch name {
+		case "$match":
+			docs, err = memoryStageMatch(docs, spec, vars)
+		case "$sort":
+			docs, err = memoryStageSort(docs, spec)
+		case "$skip":
+			docs = memoryStageSkip(docs, memoryInt(spec))
+		case "$limit":
+			docs = memoryStageLimit(docs, memoryInt(spec))
+		case "$project":
+			docs, err = memoryStageProject(docs, spec, vars)
+		case "$unwind":
+			docs, err = memoryStageUnwind(docs, spec)
+		case "$lookup":
+			docs, err = d.stageLookup(docs, spec, vars)
+		case "$group":
+			docs, err = memoryStageGroup(docs, spec, vars)
+		case "$count":
+			docs = memoryStageCount(docs, spec)
+		case "$addFields", "$set":
+			docs, err = memoryStageAddFields(docs, spec, vars)
+		case "$geoNear":
+			docs, err = memoryStageGeoNear(docs, spec, vars)
+		default:
+			return nil, fmt.Errorf("memory driver: pipeline stage %s not support", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// STAGES
+
+func memoryStageMatch(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	filter, ok := memorySpecDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $match must be a document")
+	}
+	var result []bson.M
+	for _, doc := range docs {
+		ok, err := memoryMatch(doc, filter, vars)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+func memoryStageSort(docs []bson.M, spec interface{}) ([]bson.M, error) {
+	keys, ok := memorySpecDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $sort must be a document")
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			dir := memoryInt(key.Value)
+			parts := strings.Split(key.Key, ".")
+			vi := memorySortValue(docs[i], parts, dir)
+			vj := memorySortValue(docs[j], parts, dir)
+			c := memoryCompare(vi, vj)
+			if c == 0 {
+				continue
+			}
+			if dir < 0 {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return docs, nil
+}
+
+// 数组字段升序时取最小的元素, 降序时取最大的元素
+func memorySortValue(doc bson.M, parts []string, dir int) interface{} {
+	v, _ := memoryGetPath(doc, parts)
+	arr, ok := memoryArray(v)
+	if !ok {
+		return v
+	}
+	if len(arr) == 0 {
+		return nil
+	}
+	result := arr[0]
+	for _, item := range arr[1:] {
+		c := memoryCompare(item, result)
+		if (dir >= 0 && c < 0) || (dir < 0 && c > 0) {
+			result = item
+		}
+	}
+	return result
+}
+
+func memoryStageSkip(docs []bson.M, n int) []bson.M {
+	if n <= 0 {
+		return docs
+	}
+	if n >= len(docs) {
+		return nil
+	}
+	return docs[n:]
+}
+
+func memoryStageLimit(docs []bson.M, n int) []bson.M {
+	if n > 0 && n < len(docs) {
+		return docs[:n]
+	}
+	return docs
+}
+
+func memoryStageProject(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	fields, ok := memorySpecDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $project must be a document")
+	}
+	fields = memoryFlattenProject("", fields)
+	var result []bson.M
+	for _, doc := range docs {
+		item, err := memoryProject(doc, fields, vars)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// {a: {b: 1}} => {"a.b": 1}
+func memoryFlattenProject(prefix string, fields bson.D) bson.D {
+	var result bson.D
+	for _, e := range fields {
+		key := e.Key
+		if len(prefix) > 0 {
+			key = prefix + "." + e.Key
+		}
+		if sub, ok := memorySpecDoc(e.Value); ok && !memoryIsOperatorDoc(sub) && len(sub) > 0 {
+			result = append(result, memoryFlattenProject(key, sub)...)
+			continue
+		}
+		result = append(result, bson.E{Key: key, Value: e.Value})
+	}
+	return result
+}
+
+func memoryProject(doc bson.M, fields bson.D, vars bson.M) (bson.M, error) {
+	exclusion := false
+	includeId := true
+	for _, e := range fields {
+		if !memoryIsProjectFlag(e.Value) {
+			continue
+		}
+		if e.Key == "_id" {
+			includeId = memoryTruthy(e.Value)
+			continue
+		}
+		if !memoryTruthy(e.Value) {
+			exclusion = true
+		}
+	}
+	if exclusion {
+		result := memoryClone(doc).(bson.M)
+		for _, e := range fields {
+			if memoryIsProjectFlag(e.Value) && !memoryTruthy(e.Value) {
+				memoryUnsetPath(result, strings.Split(e.Key, "."))
+			}
+		}
+		return result, nil
+	}
+	result := bson.M{}
+	if includeId {
+		if v, ok := doc["_id"]; ok {
+			result["_id"] = v
+		}
+	}
+	for _, e := range fields {
+		parts := strings.Split(e.Key, ".")
+		if memoryIsProjectFlag(e.Value) {
+			if e.Key != "_id" {
+				memoryProjectInclude(doc, result, parts)
+			}
+			continue
+		}
+		v, err := memoryEval(e.Value, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		memorySetPath(result, parts, v)
+	}
+	return result, nil
+}
+
+func memoryProjectInclude(src bson.M, dst bson.M, parts []string) {
+	v, ok := src[parts[0]]
+	if !ok {
+		return
+	}
+	if len(parts) == 1 {
+		dst[parts[0]] = memoryClone(v)
+		return
+	}
+	if doc, ok := memoryDoc(v); ok {
+		sub, ok := dst[parts[0]].(bson.M)
+		if !ok {
+			sub = bson.M{}
+			dst[parts[0]] = sub
+		}
+		memoryProjectInclude(doc, sub, parts[1:])
+		return
+	}
+	if arr, ok := memoryArray(v); ok {
+		existing, _ := dst[parts[0]].(bson.A)
+		out := bson.A{}
+		j := 0
+		for _, item := range arr {
+			doc, ok := memoryDoc(item)
+			if !ok {
+				continue
+			}
+			var target bson.M
+			if j < len(existing) {
+				target, _ = existing[j].(bson.M)
+			}
+			if target == nil {
+				target = bson.M{}
+			}
+			memoryProjectInclude(doc, target, parts[1:])
+			out = append(out, target)
+			j++
+		}
+		dst[parts[0]] = out
+	}
+}
+
+func memoryStageUnwind(docs []bson.M, spec interface{}) ([]bson.M, error) {
+	var path, indexField string
+	var preserve bool
+	switch n := spec.(type) {
+	case string:
+		path = n
+	default:
+		opts, ok := memoryDoc(spec)
+		if !ok {
+			return nil, fmt.Errorf("memory driver: $unwind spec error")
+		}
+		path, _ = opts["path"].(string)
+		indexField, _ = opts["includeArrayIndex"].(string)
+		preserve = memoryTruthy(opts["preserveNullAndEmptyArrays"])
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("memory driver: $unwind path must start with $")
+	}
+	parts := strings.Split(path[1:], ".")
+	var result []bson.M
+	for _, doc := range docs {
+		v, ok := memoryGetPath(doc, parts)
+		arr, isArr := memoryArray(v)
+		if !ok || v == nil || (isArr && len(arr) == 0) {
+			if preserve {
+				if isArr {
+					memoryUnsetPath(doc, parts)
+				}
+				if len(indexField) > 0 {
+					doc[indexField] = nil
+				}
+				result = append(result, doc)
+			}
+			continue
+		}
+		if !isArr {
+			if len(indexField) > 0 {
+				doc[indexField] = nil
+			}
+			result = append(result, doc)
+			continue
+		}
+		for i, item := range arr {
+			c := memoryClone(doc).(bson.M)
+			memorySetPath(c, parts, item)
+			if len(indexField) > 0 {
+				c[indexField] = int64(i)
+			}
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (d *MemoryDriver) stageLookup(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	opts, ok := memoryDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $lookup must be a document")
+	}
+	from, _ := opts["from"].(string)
+	as, _ := opts["as"].(string)
+	if len(from) == 0 || len(as) == 0 {
+		return nil, fmt.Errorf("memory driver: $lookup from and as can't be empty")
+	}
+	foreign, err := d.load(from)
+	if err != nil {
+		return nil, err
+	}
+	var stages []bson.D
+	if arr, ok := memoryArray(opts["pipeline"]); ok {
+		for _, item := range arr {
+			stage, ok := memorySpecDoc(item)
+			if !ok {
+				return nil, fmt.Errorf("memory driver: $lookup pipeline stage must be a document")
+			}
+			stages = append(stages, stage)
+		}
+	}
+	letSpec, _ := memorySpecDoc(opts["let"])
+	localField, _ := opts["localField"].(string)
+	foreignField, _ := opts["foreignField"].(string)
+	asParts := strings.Split(as, ".")
+
+	for _, doc := range docs {
+		candidates := memoryCloneDocs(foreign)
+		if len(localField) > 0 {
+			local, _ := memoryGetPath(doc, strings.Split(localField, "."))
+			targets := bson.A{local}
+			if arr, ok := memoryArray(local); ok {
+				targets = arr
+			}
+			var matched []bson.M
+			for _, f := range candidates {
+				values := memoryQueryValues(f, strings.Split(foreignField, "."))
+				for _, target := range targets {
+					if memoryMatchEq(values, target) {
+						matched = append(matched, f)
+						break
+					}
+				}
+			}
+			candidates = matched
+		}
+		if len(stages) > 0 {
+			subVars := bson.M{}
+			for k, v := range vars {
+				subVars[k] = v
+			}
+			for _, e := range letSpec {
+				v, err := memoryEval(e.Value, doc, vars)
+				if err != nil {
+					return nil, err
+				}
+				subVars[e.Key] = v
+			}
+			candidates, err = d.runPipeline(candidates, stages, subVars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		list := bson.A{}
+		for _, item := range candidates {
+			list = append(list, item)
+		}
+		memorySetPath(doc, asParts, list)
+	}
+	return docs, nil
+}
+
+func memoryStageGroup(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	fields, ok := memorySpecDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $group must be a document")
+	}
+	var idExpr interface{}
+	hasId := false
+	for _, e := range fields {
+		if e.Key == "_id" {
+			idExpr = e.Value
+			hasId = true
+		}
+	}
+	if !hasId {
+		return nil, fmt.Errorf("memory driver: $group must specify _id")
+	}
+	type group struct {
+		id   interface{}
+		docs []bson.M
+	}
+	var groups []*group
+	for _, doc := range docs {
+		id, err := memoryEval(idExpr, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		var cur *group
+		for _, g := range groups {
+			if memoryCompare(g.id, id) == 0 {
+				cur = g
+				break
+			}
+		}
+		if cur == nil {
+			cur = &group{id: id}
+			groups = append(groups, cur)
+		}
+		cur.docs = append(cur.docs, doc)
+	}
+	var result []bson.M
+	for _, g := range groups {
+		out := bson.M{"_id": g.id}
+		for _, e := range fields {
+			if e.Key == "_id" {
+				continue
+			}
+			acc, ok := memorySpecDoc(e.Value)
+			if !ok || len(acc) != 1 {
+				return nil, fmt.Errorf("memory driver: $group field %s must be an accumulator", e.Key)
+			}
+			v, err := memoryAccumulate(acc[0].Key, acc[0].Value, g.docs, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[e.Key] = v
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+func memoryAccumulate(op string, expr interface{}, docs []bson.M, vars bson.M) (interface{}, error) {
+	var values []interface{}
+	for _, doc := range docs {
+		v, err := memoryEval(expr, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	switch op {
+	case "$sum":
+		return memorySum(values), nil
+	case "$avg":
+		var total float64
+		count := 0
+		hasDecimal := false
+		for _, v := range values {
+			if memoryRank(v) == memoryRankNumber {
+				total += memoryFloat(v)
+				count++
+				_, ok := v.(primitive.Decimal128)
+				hasDecimal = hasDecimal || ok
+			}
+		}
+		if count == 0 {
+			return nil, nil
+		}
+		// 和 mongodb 一样, 有 Decimal128 时结果也是 Decimal128
+		if hasDecimal {
+			sum, _ := parseDecimal(memorySum(values))
+			return decimalFromRat(new(big.Rat).Quo(sum, big.NewRat(int64(count), 1)))
+		}
+		return total / float64(count), nil
+	case "$min", "$max":
+		var result interface{}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			c := memoryCompare(v, result)
+			if result == nil || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+				result = v
+			}
+		}
+		return result, nil
+	case "$first":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[0], nil
+	case "$last":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[len(values)-1], nil
+	case "$push":
+		return bson.A(values), nil
+	case "$addToSet":
+		result := bson.A{}
+		for _, v := range values {
+			exist := false
+			for _, item := range result {
+				if memoryCompare(item, v) == 0 {
+					exist = true
+					break
+				}
+			}
+			if !exist {
+				result = append(result, v)
+			}
+		}
+		return result, nil
+	case "$count":
+		return int32(len(values)), nil
+	default:
+		return nil, fmt.Errorf("memory driver: accumulator %s not support", op)
+	}
+}
+
+func memoryStageCount(docs []bson.M, spec interface{}) []bson.M {
+	if len(docs) == 0 {
+		return nil
+	}
+	name, _ := spec.(string)
+	return []bson.M{{name: int32(len(docs))}}
+}
+
+func memoryStageAddFields(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	fields, ok := memorySpecDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $addFields must be a document")
+	}
+	for _, doc := range docs {
+		for _, e := range fields {
+			v, err := memoryEval(e.Value, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			memorySetPath(doc, strings.Split(e.Key, "."), v)
+		}
+	}
+	return docs, nil
+}
+
+// MATCH
+
+func memoryMatch(doc bson.M, filter bson.D, vars bson.M) (bool, error) {
+	for _, e := range filter {
+		ok, err := memoryMatchElement(doc, e.Key, e.Value, vars)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func memoryMatchElement(doc bson.M, key string, value interface{}, vars bson.M) (bool, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		list, ok := memoryArray(value)
+		if !ok {
+			return false, fmt.Errorf("memory driver: %s must be an array", key)
+		}
+		for _, item := range list {
+			filter, ok := memorySpecDoc(item)
+			if !ok {
+				return false, fmt.Errorf("memory driver: %s item must be a document", key)
+			}
+			ok, err := memoryMatch(doc, filter, vars)
+			if err != nil {
+				return false, err
+			}
+			if key == "$and" && !ok {
+				return false, nil
+			}
+			if key == "$or" && ok {
+				return true, nil
+			}
+			if key == "$nor" && ok {
+				return false, nil
+			}
+		}
+		return key != "$or", nil
+	case "$expr":
+		v, err := memoryEval(value, doc, vars)
+		if err != nil {
+			return false, err
+		}
+		return memoryTruthy(v), nil
+	case "$comment":
+		return true, nil
+	case "$text":
+		return memoryMatchText(doc, value, vars)
+	}
+	if strings.HasPrefix(key, "$") {
+		return false, fmt.Errorf("memory driver: query operator %s not support", key)
+	}
+	values := memoryQueryValues(doc, strings.Split(key, "."))
+	if ops, ok := memorySpecDoc(value); ok && memoryIsOperatorDoc(ops) {
+		return memoryMatchOperators(values, ops, vars)
+	}
+	if re, ok := value.(primitive.Regex); ok {
+		return memoryMatchRegex(values, re.Pattern, re.Options)
+	}
+	return memoryMatchEq(values, value), nil
+}
+
+// TEXT
+
+// 全文索引的字段权重通过 vars 传入, 相关度保存在文档的 memoryTextScoreKey 中, 聚合结束后删除
+const (
+	memoryTextIndexVar = "#textIndex"
+	memoryTextScoreKey = "#textScore"
+)
+
+// 简化的全文搜索: 按空白拆分搜索词, 相关度为字段中出现的次数乘以权重
+func memoryMatchText(doc bson.M, value interface{}, vars bson.M) (bool, error) {
+	weights, ok := vars[memoryTextIndexVar].(map[string]int)
+	if !ok {
+		return false, fmt.Errorf("memory driver: text index required for $text query")
+	}
+	spec, ok := memoryDoc(value)
+	if !ok {
+		return false, fmt.Errorf("memory driver: $text must be a document")
+	}
+	search, _ := spec["$search"].(string)
+	terms := strings.Fields(strings.ToLower(search))
+	score := 0
+	for field, weight := range weights {
+		for _, v := range memoryExpandValues(memoryQueryValues(doc, strings.Split(field, "."))) {
+			text, ok := v.(string)
+			if !ok {
+				continue
+			}
+			text = strings.ToLower(text)
+			for _, term := range terms {
+				score += strings.Count(text, term) * weight
+			}
+		}
+	}
+	if score == 0 {
+		return false, nil
+	}
+	doc[memoryTextScoreKey] = float64(score)
+	return true, nil
+}
+
+// GEO
+
+// 和 mongodb 的球面计算使用相同的地球半径(米)
+const memoryEarthRadius = 6378100.0
+
+// GeoJSON Point 或者 [lng, lat]
+func memoryGeoPoint(v interface{}) ([2]float64, bool) {
+	if doc, ok := memoryDoc(v); ok {
+		v = doc["coordinates"]
+	}
+	arr, ok := memoryArray(v)
+	if !ok || len(arr) != 2 {
+		return [2]float64{}, false
+	}
+	return [2]float64{memoryFloat(arr[0]), memoryFloat(arr[1])}, true
+}
+
+// 两点之间的球面距离(弧度)
+func memoryGeoAngle(a, b [2]float64) float64 {
+	lng1, lat1 := a[0]*math.Pi/180, a[1]*math.Pi/180
+	lng2, lat2 := b[0]*math.Pi/180, b[1]*math.Pi/180
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lng2-lng1)/2), 2)
+	return 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// 只支持 spherical 的 near/key/distanceField/maxDistance/minDistance/query, 距离单位为米
+func memoryStageGeoNear(docs []bson.M, spec interface{}, vars bson.M) ([]bson.M, error) {
+	options, ok := memoryDoc(spec)
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $geoNear must be a document")
+	}
+	near, ok := memoryGeoPoint(options["near"])
+	if !ok {
+		return nil, fmt.Errorf("memory driver: $geoNear near must be a point")
+	}
+	key, _ := options["key"].(string)
+	distanceField, _ := options["distanceField"].(string)
+	if len(key) == 0 || len(distanceField) == 0 {
+		return nil, fmt.Errorf("memory driver: $geoNear key and distanceField required")
+	}
+	var err error
+	if query, ok := options["query"]; ok {
+		docs, err = memoryStageMatch(docs, query, vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+	type item struct {
+		doc      bson.M
+		distance float64
+	}
+	var items []item
+	for _, doc := range docs {
+		v, _ := memoryGetPath(doc, strings.Split(key, "."))
+		point, ok := memoryGeoPoint(v)
+		if !ok {
+			continue
+		}
+		distance := memoryGeoAngle(near, point) * memoryEarthRadius
+		if max, ok := options["maxDistance"]; ok && distance > memoryFloat(max) {
+			continue
+		}
+		if min, ok := options["minDistance"]; ok && distance < memoryFloat(min) {
+			continue
+		}
+		items = append(items, item{doc: doc, distance: distance})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].distance < items[j].distance
+	})
+	result := make([]bson.M, 0, len(items))
+	for _, item := range items {
+		memorySetPath(item.doc, strings.Split(distanceField, "."), item.distance)
+		result = append(result, item.doc)
+	}
+	return result, nil
+}
+
+// 支持 $centerSphere, $box 和 $geometry Polygon(只使用外环)
+func memoryMatchGeoWithin(values []interface{}, arg interface{}) (bool, error) {
+	shape, ok := memoryDoc(arg)
+	if !ok {
+		return false, fmt.Errorf("memory driver: $geoWithin must be a document")
+	}
+	var within func(point [2]float64) bool
+	switch {
+	case shape["$centerSphere"] != nil:
+		spec, _ := memoryArray(shape["$centerSphere"])
+		if len(spec) != 2 {
+			return false, fmt.Errorf("memory driver: $centerSphere must be [[lng, lat], radius]")
+		}
+		center, ok := memoryGeoPoint(spec[0])
+		if !ok {
+			return false, fmt.Errorf("memory driver: $centerSphere center must be a point")
+		}
+		radius := memoryFloat(spec[1])
+		within = func(point [2]float64) bool {
+			return memoryGeoAngle(center, point) <= radius
+		}
+	case shape["$box"] != nil:
+		spec, _ := memoryArray(shape["$box"])
+		if len(spec) != 2 {
+			return false, fmt.Errorf("memory driver: $box must be [[lng, lat], [lng, lat]]")
+		}
+		p1, ok1 := memoryGeoPoint(spec[0])
+		p2, ok2 := memoryGeoPoint(spec[1])
+		if !ok1 || !ok2 {
+			return false, fmt.Errorf("memory driver: $box corners must be points")
+		}
+		within = func(point [2]float64) bool {
+			return point[0] >= math.Min(p1[0], p2[0]) && point[0] <= math.Max(p1[0], p2[0]) &&
+				point[1] >= math.Min(p1[1], p2[1]) && point[1] <= math.Max(p1[1], p2[1])
+		}
+	case shape["$geometry"] != nil:
+		geometry, _ := memoryDoc(shape["$geometry"])
+		if geometry["type"] != "Polygon" {
+			return false, fmt.Errorf("memory driver: $geometry only support Polygon")
+		}
+		rings, _ := memoryArray(geometry["coordinates"])
+		if len(rings) == 0 {
+			return false, fmt.Errorf("memory driver: $geometry polygon can't empty")
+		}
+		ring, _ := memoryArray(rings[0])
+		var polygon [][2]float64
+		for _, v := range ring {
+			point, ok := memoryGeoPoint(v)
+			if !ok {
+				return false, fmt.Errorf("memory driver: $geometry polygon must be points")
+			}
+			polygon = append(polygon, point)
+		}
+		within = func(point [2]float64) bool {
+			return memoryPointInPolygon(point, polygon)
+		}
+	default:
+		return false, fmt.Errorf("memory driver: $geoWithin shape not support")
+	}
+	for _, v := range values {
+		if point, ok := memoryGeoPoint(v); ok && within(point) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 射线法, 平面近似
+func memoryPointInPolygon(point [2]float64, polygon [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a[1] > point[1]) != (b[1] > point[1]) &&
+			point[0] < (b[0]-a[0])*(point[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func memoryMatchOperators(values []interface{}, ops bson.D, vars bson.M) (bool, error) {
+	for _, op := range ops {
+		ok, err := memoryMatchOperator(values, op.Key, op.Value, ops, vars)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func memoryMatchOperator(values []interface{}, op string, arg interface{}, ops bson.D, vars bson.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return memoryMatchEq(values, arg), nil
+	case "$ne":
+		return !memoryMatchEq(values, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range memoryExpandValues(values) {
+			if memoryRank(v) != memoryRank(arg) {
+				continue
+			}
+			c := memoryCompare(v, arg)
+			if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		list, ok := memoryArray(arg)
+		if !ok {
+			return false, fmt.Errorf("memory driver: %s must be an array", op)
+		}
+		in := false
+		for _, target := range list {
+			if re, ok := target.(primitive.Regex); ok {
+				matched, err := memoryMatchRegex(values, re.Pattern, re.Options)
+				if err != nil {
+					return false, err
+				}
+				in = in || matched
+			} else if memoryMatchEq(values, target) {
+				in = true
+			}
+			if in {
+				break
+			}
+		}
+		return in == (op == "$in"), nil
+	case "$exists":
+		return memoryTruthy(arg) == (len(values) > 0), nil
+	case "$regex":
+		options, _ := memoryDocValue(ops, "$options").(string)
+		switch n := arg.(type) {
+		case string:
+			return memoryMatchRegex(values, n, options)
+		case primitive.Regex:
+			return memoryMatchRegex(values, n.Pattern, n.Options+options)
+		}
+		return false, fmt.Errorf("memory driver: $regex must be a string")
+	case "$options":
+		return true, nil
+	case "$not":
+		if re, ok := arg.(primitive.Regex); ok {
+			matched, err := memoryMatchRegex(values, re.Pattern, re.Options)
+			return !matched, err
+		}
+		sub, ok := memorySpecDoc(arg)
+		if !ok {
+			return false, fmt.Errorf("memory driver: $not must be a document")
+		}
+		matched, err := memoryMatchOperators(values, sub, vars)
+		return !matched, err
+	case "$size":
+		for _, v := range values {
+			if arr, ok := memoryArray(v); ok && len(arr) == memoryInt(arg) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := memoryArray(arg)
+		if !ok {
+			return false, fmt.Errorf("memory driver: $all must be an array")
+		}
+		for _, target := range list {
+			if !memoryMatchEq(values, target) {
+				return false, nil
+			}
+		}
+		return len(list) > 0, nil
+	case "$elemMatch":
+		sub, ok := memorySpecDoc(arg)
+		if !ok {
+			return false, fmt.Errorf("memory driver: $elemMatch must be a document")
+		}
+		for _, v := range values {
+			arr, ok := memoryArray(v)
+			if !ok {
+				continue
+			}
+			for _, item := range arr {
+				var matched bool
+				var err error
+				if memoryIsOperatorDoc(sub) {
+					matched, err = memoryMatchOperators([]interface{}{item}, sub, vars)
+				} else if doc, ok := memoryDoc(item); ok {
+					matched, err = memoryMatch(doc, sub, vars)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$geoWithin":
+		return memoryMatchGeoWithin(values, arg)
+	default:
+		return false, fmt.Errorf("memory driver: query operator %s not support", op)
+	}
+}
+
+// 数组字段会同时比较数组本身和数组中的每一个元素
+func memoryMatchEq(values []interface{}, target interface{}) bool {
+	if memoryRank(target) == memoryRankNull {
+		if len(values) == 0 {
+			return true
+		}
+	}
+	for _, v := range values {
+		if memoryEqual(v, target) {
+			return true
+		}
+		if arr, ok := memoryArray(v); ok {
+			for _, item := range arr {
+				if memoryEqual(item, target) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func memoryMatchRegex(values []interface{}, pattern string, options string) (bool, error) {
+	flags := ""
+	for _, c := range options {
+		if c == 'i' || c == 'm' || c == 's' {
+			flags += string(c)
+		}
+	}
+	if len(flags) > 0 {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range memoryExpandValues(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func memoryExpandValues(values []interface{}) []interface{} {
+	var result []interface{}
+	for _, v := range values {
+		result = append(result, v)
+		if arr, ok := memoryArray(v); ok {
+			result = append(result, arr...)
+		}
+	}
+	return result
+}
+
+// 查询路径, 中间遇到数组时会展开数组中的文档
+func memoryQueryValues(v interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{v}
+	}
+	if doc, ok := memoryDoc(v); ok {
+		child, exist := doc[parts[0]]
+		if !exist {
+			return nil
+		}
+		return memoryQueryValues(child, parts[1:])
+	}
+	if arr, ok := memoryArray(v); ok {
+		var result []interface{}
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index >= 0 && index < len(arr) {
+				result = append(result, memoryQueryValues(arr[index], parts[1:])...)
+			}
+			return result
+		}
+		for _, item := range arr {
+			if _, ok := memoryDoc(item); ok {
+				result = append(result, memoryQueryValues(item, parts)...)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// EXPRESSION
+
+func memoryEval(expr interface{}, doc bson.M, vars bson.M) (interface{}, error) {
+	switch n := expr.(type) {
+	case string:
+		if strings.HasPrefix(n, "$$") {
+			parts := strings.Split(n[2:], ".")
+			var root interface{}
+			switch parts[0] {
+			case "ROOT", "CURRENT":
+				root = doc
+			default:
+				v, ok := vars[parts[0]]
+				if !ok {
+					return nil, fmt.Errorf("memory driver: undefined variable %s", parts[0])
+				}
+				root = v
+			}
+			v, _ := memoryGetPath(root, parts[1:])
+			return v, nil
+		}
+		if strings.HasPrefix(n, "$") {
+			v, _ := memoryGetPath(doc, strings.Split(n[1:], "."))
+			return v, nil
+		}
+		return n, nil
+	case bson.A:
+		result := bson.A{}
+		for _, item := range n {
+			v, err := memoryEval(item, doc, vars)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, v)
+		}
+		return result, nil
+	}
+	spec, ok := memorySpecDoc(expr)
+	if !ok {
+		return expr, nil
+	}
+	if len(spec) == 1 && strings.HasPrefix(spec[0].Key, "$") {
+		return memoryEvalOperator(spec[0].Key, spec[0].Value, doc, vars)
+	}
+	result := bson.M{}
+	for _, e := range spec {
+		v, err := memoryEval(e.Value, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		result[e.Key] = v
+	}
+	return result, nil
+}
+
+func memoryEvalArgs(arg interface{}, doc bson.M, vars bson.M) ([]interface{}, error) {
+	list, ok := memoryArray(arg)
+	if !ok {
+		list = bson.A{arg}
+	}
+	var result []interface{}
+	for _, item := range list {
+		v, err := memoryEval(item, doc, vars)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func memoryEvalOperator(op string, arg interface{}, doc bson.M, vars bson.M) (interface{}, error) {
+	if op == "$literal" {
+		return arg, nil
+	}
+	if op == "$meta" {
+		if arg != "textScore" {
+			return nil, fmt.Errorf("memory driver: $meta %v not support", arg)
+		}
+		return doc[memoryTextScoreKey], nil
+	}
+	if op == "$cond" {
+		if opts, ok := memoryDoc(arg); ok {
+			arg = bson.A{opts["if"], opts["then"], opts["else"]}
+		}
+	}
+	args, err := memoryEvalArgs(arg, doc, vars)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$cmp":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("memory driver: %s must have 2 args", op)
+		}
+		c := memoryCompare(args[0], args[1])
+		switch op {
+		case "$eq":
+			return c == 0, nil
+		case "$ne":
+			return c != 0, nil
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		case "$lte":
+			return c <= 0, nil
+		default:
+			return int32(c), nil
+		}
+	case "$in":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("memory driver: $in must have 2 args")
+		}
+		list, ok := memoryArray(args[1])
+		if !ok {
+			return nil, fmt.Errorf("memory driver: $in second arg must be an array")
+		}
+		for _, item := range list {
+			if memoryEqual(item, args[0]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$and":
+		for _, v := range args {
+			if !memoryTruthy(v) {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "$or":
+		for _, v := range args {
+			if memoryTruthy(v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$not":
+		return len(args) == 0 || !memoryTruthy(args[0]), nil
+	case "$ifNull":
+		for _, v := range args {
+			if v != nil {
+				return v, nil
+			}
+		}
+		return nil, nil
+	case "$cond":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("memory driver: $cond must have 3 args")
+		}
+		if memoryTruthy(args[0]) {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "$add", "$multiply":
+		var result interface{} = int32(0)
+		if op == "$multiply" {
+			result = int32(1)
+		}
+		for _, v := range args {
+			if v == nil {
+				return nil, nil
+			}
+			if op == "$add" {
+				result = memoryAddNumber(result, v)
+			} else {
+				result = memoryMultiplyNumber(result, v)
+			}
+		}
+		return result, nil
+	case "$subtract":
+		if len(args) != 2 || args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		return memoryAddNumber(args[0], memoryMultiplyNumber(args[1], int32(-1))), nil
+	case "$divide":
+		if len(args) != 2 || args[0] == nil || args[1] == nil {
+			return nil, nil
+		}
+		if memoryFloat(args[1]) == 0 {
+			return nil, fmt.Errorf("memory driver: can't $divide by zero")
+		}
+		return memoryFloat(args[0]) / memoryFloat(args[1]), nil
+	case "$size":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("memory driver: $size must have 1 arg")
+		}
+		arr, ok := memoryArray(args[0])
+		if !ok {
+			return nil, fmt.Errorf("memory driver: $size arg must be an array")
+		}
+		return int32(len(arr)), nil
+	case "$concat":
+		var buf strings.Builder
+		for _, v := range args {
+			if v == nil {
+				return nil, nil
+			}
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("memory driver: $concat only support strings")
+			}
+			buf.WriteString(s)
+		}
+		return buf.String(), nil
+	case "$arrayElemAt":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("memory driver: $arrayElemAt must have 2 args")
+		}
+		arr, _ := memoryArray(args[0])
+		index := memoryInt(args[1])
+		if index < 0 {
+			index += len(arr)
+		}
+		if index < 0 || index >= len(arr) {
+			return nil, nil
+		}
+		return arr[index], nil
+	case "$toString":
+		if len(args) != 1 || args[0] == nil {
+			return nil, nil
+		}
+		switch n := args[0].(type) {
+		case primitive.ObjectID:
+			return n.Hex(), nil
+		case string:
+			return n, nil
+		default:
+			return fmt.Sprint(n), nil
+		}
+	default:
+		return nil, fmt.Errorf("memory driver: expression operator %s not support", op)
+	}
+}
+
+// UPDATE
+
+func memoryApplyUpdate(doc bson.M, update bson.D) error {
+	for _, e := range update {
+		fields, ok := memorySpecDoc(e.Value)
+		if !ok {
+			return fmt.Errorf("memory driver: update operator %s must be a document", e.Key)
+		}
+		for _, f := range fields {
+			parts := strings.Split(f.Key, ".")
+			switch e.Key {
+			case "$set":
+				memorySetPath(doc, parts, f.Value)
+			case "$unset":
+				memoryUnsetPath(doc, parts)
+			case "$inc":
+				cur, _ := memoryGetPath(doc, parts)
+				if cur == nil {
+					cur = int32(0)
+				}
+				if memoryRank(cur) != memoryRankNumber || memoryRank(f.Value) != memoryRankNumber {
+					return fmt.Errorf("memory driver: $inc %s must be number", f.Key)
+				}
+				memorySetPath(doc, parts, memoryAddNumber(cur, f.Value))
+			case "$push":
+				cur, _ := memoryGetPath(doc, parts)
+				arr, _ := memoryArray(cur)
+				memorySetPath(doc, parts, append(append(bson.A{}, arr...), f.Value))
+			case "$rename":
+				to, ok := f.Value.(string)
+				if !ok {
+					return fmt.Errorf("memory driver: $rename %s target must be string", f.Key)
+				}
+				if cur, exist := memoryGetPath(doc, parts); exist {
+					memoryUnsetPath(doc, parts)
+					memorySetPath(doc, strings.Split(to, "."), cur)
+				}
+			default:
+				return fmt.Errorf("memory driver: update operator %s not support", e.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// PATH
+
+// 聚合路径, 中间遇到数组时返回每个元素对应值组成的数组
+func memoryGetPath(v interface{}, parts []string) (interface{}, bool) {
+	if len(parts) == 0 {
+		return v, true
+	}
+	if doc, ok := memoryDoc(v); ok {
+		child, ok := doc[parts[0]]
+		if !ok {
+			return nil, false
+		}
+		return memoryGetPath(child, parts[1:])
+	}
+	if arr, ok := memoryArray(v); ok {
+		result := bson.A{}
+		for _, item := range arr {
+			if _, ok := memoryDoc(item); !ok {
+				continue
+			}
+			if r, ok := memoryGetPath(item, parts); ok {
+				result = append(result, r)
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func memorySetPath(doc bson.M, parts []string, value interface{}) {
+	if len(parts) == 1 {
+		doc[parts[0]] = value
+		return
+	}
+	child, ok := doc[parts[0]].(bson.M)
+	if !ok {
+		if m, ok := doc[parts[0]].(map[string]interface{}); ok {
+			child = bson.M(m)
+		} else {
+			child = bson.M{}
+		}
+		doc[parts[0]] = child
+	}
+	memorySetPath(child, parts[1:], value)
+}
+
+func memoryUnsetPath(doc bson.M, parts []string) {
+	if len(parts) == 1 {
+		delete(doc, parts[0])
+		return
+	}
+	if child, ok := memoryDoc(doc[parts[0]]); ok {
+		memoryUnsetPath(child, parts[1:])
+	}
+}
+
+// VALUE
+
+const (
+	memoryRankNull = iota + 1
+	memoryRankNumber
+	memoryRankString
+	memoryRankObject
+	memoryRankArray
+	memoryRankBinary
+	memoryRankObjectID
+	memoryRankBool
+	memoryRankDate
+	memoryRankTimestamp
+	memoryRankRegex
+	memoryRankOther
+)
+
+func memoryRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return memoryRankNull
+	case int, int8, int16, int32, int64, float32, float64, primitive.Decimal128:
+		return memoryRankNumber
+	case string, primitive.Symbol:
+		return memoryRankString
+	case bson.M, map[string]interface{}, bson.D:
+		return memoryRankObject
+	case bson.A, []interface{}:
+		return memoryRankArray
+	case primitive.Binary, []byte:
+		return memoryRankBinary
+	case primitive.ObjectID:
+		return memoryRankObjectID
+	case bool:
+		return memoryRankBool
+	case primitive.DateTime, time.Time:
+		return memoryRankDate
+	case primitive.Timestamp:
+		return memoryRankTimestamp
+	case primitive.Regex:
+		return memoryRankRegex
+	default:
+		return memoryRankOther
+	}
+}
+
+func memoryEqual(a, b interface{}) bool {
+	return memoryRank(a) == memoryRank(b) && memoryCompare(a, b) == 0
+}
+
+// 按照 mongodb 的 BSON 类型顺序比较两个值
+func memoryCompare(a, b interface{}) int {
+	ra, rb := memoryRank(a), memoryRank(b)
+	if ra != rb {
+		return memorySign(float64(ra - rb))
+	}
+	switch ra {
+	case memoryRankNull:
+		return 0
+	case memoryRankNumber:
+		return memorySign(memoryFloat(a) - memoryFloat(b))
+	case memoryRankString:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	case memoryRankObject:
+		da, _ := memoryDoc(a)
+		db, _ := memoryDoc(b)
+		ka, kb := memorySortedKeys(da), memorySortedKeys(db)
+		for i := 0; i < len(ka) && i < len(kb); i++ {
+			if c := strings.Compare(ka[i], kb[i]); c != 0 {
+				return c
+			}
+			if c := memoryCompare(da[ka[i]], db[kb[i]]); c != 0 {
+				return c
+			}
+		}
+		return memorySign(float64(len(ka) - len(kb)))
+	case memoryRankArray:
+		aa, _ := memoryArray(a)
+		ab, _ := memoryArray(b)
+		for i := 0; i < len(aa) && i < len(ab); i++ {
+			if c := memoryCompare(aa[i], ab[i]); c != 0 {
+				return c
+			}
+		}
+		return memorySign(float64(len(aa) - len(ab)))
+	case memoryRankBinary:
+		return bytes.Compare(memoryBytes(a), memoryBytes(b))
+	case memoryRankObjectID:
+		ia, ib := a.(primitive.ObjectID), b.(primitive.ObjectID)
+		return bytes.Compare(ia[:], ib[:])
+	case memoryRankBool:
+		ba, bb := a.(bool), b.(bool)
+		if ba == bb {
+			return 0
+		}
+		if !ba {
+			return -1
+		}
+		return 1
+	case memoryRankDate:
+		return memorySign(float64(memoryDateTime(a) - memoryDateTime(b)))
+	case memoryRankTimestamp:
+		ta, tb := a.(primitive.Timestamp), b.(primitive.Timestamp)
+		return primitive.CompareTimestamp(ta, tb)
+	case memoryRankRegex:
+		return strings.Compare(a.(primitive.Regex).String(), b.(primitive.Regex).String())
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+func memorySign(v float64) int {
+	if v < 0 {
+		return -1
+	}
+	if v > 0 {
+		return 1
+	}
+	return 0
+}
+
+func memorySortedKeys(m bson.M) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func memoryBytes(v interface{}) []byte {
+	switch n := v.(type) {
+	case primitive.Binary:
+		return n.Data
+	case []byte:
+		return n
+	}
+	return nil
+}
+
+func memoryDateTime(v interface{}) int64 {
+	switch n := v.(type) {
+	case primitive.DateTime:
+		return int64(n)
+	case time.Time:
+		return int64(primitive.NewDateTimeFromTime(n))
+	}
+	return 0
+}
+
+func memoryFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		return n
+	case primitive.Decimal128:
+		f, _ := strconv.ParseFloat(n.String(), 64)
+		return f
+	}
+	return 0
+}
+
+func memoryInt(v interface{}) int {
+	return int(memoryFloat(v))
+}
+
+func memoryIsInteger(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64:
+		return true
+	}
+	return false
+}
+
+func memoryAddNumber(a, b interface{}) interface{} {
+	if result, ok := memoryDecimalOperate(a, b, (*big.Rat).Add); ok {
+		return result
+	}
+	if memoryIsInteger(a) && memoryIsInteger(b) {
+		return memoryIntResult(int64(memoryFloat(a))+int64(memoryFloat(b)), a, b)
+	}
+	return memoryFloat(a) + memoryFloat(b)
+}
+
+func memoryMultiplyNumber(a, b interface{}) interface{} {
+	if result, ok := memoryDecimalOperate(a, b, (*big.Rat).Mul); ok {
+		return result
+	}
+	if memoryIsInteger(a) && memoryIsInteger(b) {
+		return memoryIntResult(int64(memoryFloat(a))*int64(memoryFloat(b)), a, b)
+	}
+	return memoryFloat(a) * memoryFloat(b)
+}
+
+// 任意一边是 Decimal128 时精确计算, 结果也是 Decimal128
+func memoryDecimalOperate(a, b interface{}, op func(z, x, y *big.Rat) *big.Rat) (interface{}, bool) {
+	_, da := a.(primitive.Decimal128)
+	_, db := b.(primitive.Decimal128)
+	if !da && !db {
+		return nil, false
+	}
+	ra, err := parseDecimal(a)
+	if err != nil {
+		return nil, false
+	}
+	rb, err := parseDecimal(b)
+	if err != nil {
+		return nil, false
+	}
+	result, err := decimalFromRat(op(new(big.Rat), ra, rb))
+	if err != nil {
+		return nil, false
+	}
+	return result, true
+}
+
+// 两个int32运算的结果在不溢出时仍为int32
+func memoryIntResult(v int64, a, b interface{}) interface{} {
+	_, ia := a.(int32)
+	_, ib := b.(int32)
+	if ia && ib && v >= math.MinInt32 && v <= math.MaxInt32 {
+		return int32(v)
+	}
+	return v
+}
+
+func memorySum(values []interface{}) interface{} {
+	var result interface{} = int32(0)
+	for _, v := range values {
+		if memoryRank(v) == memoryRankNumber {
+			result = memoryAddNumber(result, v)
+		}
+	}
+	return result
+}
+
+func memoryTruthy(v interface{}) bool {
+	switch n := v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return false
+	case bool:
+		return n
+	}
+	if memoryRank(v) == memoryRankNumber {
+		return memoryFloat(v) != 0
+	}
+	return true
+}
+
+func memoryIsProjectFlag(v interface{}) bool {
+	switch v.(type) {
+	case bool:
+		return true
+	}
+	return memoryRank(v) == memoryRankNumber
+}
+
+func memoryIsOperatorDoc(spec bson.D) bool {
+	if len(spec) == 0 {
+		return false
+	}
+	for _, e := range spec {
+		if !strings.HasPrefix(e.Key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func memoryDocValue(spec bson.D, key string) interface{} {
+	for _, e := range spec {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func memoryDoc(v interface{}) (bson.M, bool) {
+	switch n := v.(type) {
+	case bson.M:
+		return n, true
+	case map[string]interface{}:
+		return bson.M(n), true
+	case bson.D:
+		return n.Map(), true
+	}
+	return nil, false
+}
+
+func memorySpecDoc(v interface{}) (bson.D, bool) {
+	switch n := v.(type) {
+	case bson.D:
+		return n, true
+	case bson.M:
+		return memoryMapToD(n), true
+	case map[string]interface{}:
+		return memoryMapToD(n), true
+	}
+	return nil, false
+}
+
+func memoryMapToD(m map[string]interface{}) bson.D {
+	var result bson.D
+	for _, k := range memorySortedKeys(m) {
+		result = append(result, bson.E{Key: k, Value: m[k]})
+	}
+	return result
+}
+
+func memoryArray(v interface{}) (bson.A, bool) {
+	switch n := v.(type) {
+	case bson.A:
+		return n, true
+	case []interface{}:
+		return bson.A(n), true
+	}
+	return nil, false
+}
+
+func memoryClone(v interface{}) interface{} {
+	switch n := v.(type) {
+	case bson.M:
+		result := bson.M{}
+		for k, item := range n {
+			result[k] = memoryClone(item)
+		}
+		return result
+	case map[string]interface{}:
+		return memoryClone(bson.M(n))
+	case bson.A:
+		result := make(bson.A, 0, len(n))
+		for _, item := range n {
+			result = append(result, memoryClone(item))
+		}
+		return result
+	case []interface{}:
+		return memoryClone(bson.A(n))
+	}
+	return v
+}
+
+func memoryCloneDocs(docs []bson.M) []bson.M {
+	result := make([]bson.M, 0, len(docs))
+	for _, doc := range docs {
+		result = append(result, memoryClone(doc).(bson.M))
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryDriverFind(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	for _, doc := range []M{
+		{"name": "张三", "age": 18, "tags": []any{"a", "b"}},
+		{"name": "李四", "age": 20, "tags": []any{"b"}},
+		{"name": "王五", "age": 22},
+	} {
+		_, err := driver.Insert(ctx, "student", doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	cases := []struct {
+		filter M
+		count  int64
+	}{
+		{M{"age": M{"$gte": 20}}, 2},
+		{M{"tags": "b"}, 2},
+		{M{"tags": nil}, 1},
+		{M{"tags": M{"$exists": true}}, 2},
+		{M{"name": M{"$regex": "^张"}}, 1},
+		{M{"name": M{"$in": []any{"李四", "王五"}}}, 2},
+		{M{"$or": []any{M{"age": 18}, M{"age": 22}}}, 2},
+		{M{"$expr": M{"$gt": []any{"$age", 19}}}, 2},
+	}
+	for _, c := range cases {
+		count, err := driver.Count(ctx, "student", c.filter)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if count != c.count {
+			t.Errorf("filter %v 期望 %d 条, 实际 %d 条", c.filter, c.count, count)
+		}
+	}
+	one, err := driver.FindOne(ctx, "student", M{"name": "张三"}, M{"name": 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(one) != 2 || one["name"] != "张三" {
+		t.Error("projection 结果错误", one)
+		return
+	}
+	if _, ok := one["_id"].(primitive.ObjectID); !ok {
+		t.Error("_id 类型错误", one["_id"])
+	}
+}
+
+func TestMemoryDriverAggregate(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	classId, err := driver.Insert(ctx, "class", M{"name": "一班"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, name := range []string{"张三", "李四", "王五"} {
+		doc := M{"name": name, "score": i + 1}
+		if i < 2 {
+			doc["class"] = classId
+		}
+		_, err = driver.Insert(ctx, "student", doc)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	list, err := driver.Aggregate(ctx, "student", []M{
+		{"$lookup": M{"from": "class", "localField": "class", "foreignField": "_id", "as": "class__expand"}},
+		{"$unwind": M{"path": "$class__expand", "preserveNullAndEmptyArrays": true}},
+		{"$sort": bson.D{{Key: "score", Value: -1}}},
+		{"$skip": 1},
+		{"$project": M{"name": 1, "class__expand.name": 1}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(list) != 2 || list[0]["name"] != "李四" || list[1]["name"] != "张三" {
+		t.Error("排序结果错误", list)
+		return
+	}
+	expand, ok := list[0]["class__expand"].(M)
+	if !ok || expand["name"] != "一班" {
+		t.Error("关联查询结果错误", list[0])
+		return
+	}
+
+	group, err := driver.Aggregate(ctx, "student", []M{
+		{"$match": M{"class": classId}},
+		{"$group": M{"_id": nil, "result": M{"$sum": "$score"}}},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(group) != 1 || group[0]["result"] != int32(3) {
+		t.Error("聚合结果错误", group)
+	}
+}
+
+func TestMemoryDriverTransaction(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	id, err := driver.Insert(ctx, "student", M{"name": "张三", "age": 18})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rollback := errors.New("rollback")
+	_, err = driver.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		if !driver.InTransaction(ctx) {
+			t.Error("事务上下文错误")
+		}
+		modified, err := driver.UpdateById(ctx, "student", id, M{"$inc": M{"age": 1}, "$unset": M{"name": 1}})
+		if err != nil {
+			return nil, err
+		}
+		if modified != 1 {
+			t.Error("更新数量错误", modified)
+		}
+		_, err = driver.Insert(ctx, "student", M{"name": "李四"})
+		if err != nil {
+			return nil, err
+		}
+		return nil, rollback
+	})
+	if err != rollback {
+		t.Error("事务返回错误", err)
+		return
+	}
+	list, err := driver.Find(ctx, "student", nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(list) != 1 || list[0]["name"] != "张三" || list[0]["age"] != int32(18) {
+		t.Error("事务回滚失败", list)
+	}
+}
+
+func TestMemoryDriverObjectql(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	class, err := oql.Insert(ctx, "class", InsertOptions{
+		Doc:    map[string]any{"name": "一班"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	_, err = oql.Insert(ctx, "student", InsertOptions{
+		Doc: map[string]any{
+			"name":  "张三",
+			"class": class.String("_id"),
+		},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入学生失败", err)
+		return
+	}
+	list, err := oql.FindList(ctx, "student", FindListOptions{
+		Fields: []string{"name", "class__expand.name"},
+	})
+	if err != nil {
+		t.Error("查询学生失败", err)
+		return
+	}
+	if len(list) != 1 || list[0].String("name") != "张三" {
+		t.Error("查询结果错误")
+		return
+	}
+	if list[0].ToStrAnyMap()["class__expand"].(M)["name"] != "一班" {
+		t.Error("关联查询结果错误", list[0].ToStrAnyMap())
+	}
+}
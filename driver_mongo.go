@@ -0,0 +1,436 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoDriver 基于 mongodb 的存储驱动, 事务需要副本集的支持
+type MongoDriver struct {
+	client   *mongo.Client
+	database string
+	// 根据上下文选择数据库, 返回空字符串时使用默认的数据库
+	databaseResolver func(ctx context.Context) (string, error)
+	txMode           TransactionMode
+	profileHandler   QueryProfileHandler
+}
+
+func NewMongoDriver(client *mongo.Client, database string) *MongoDriver {
+	return &MongoDriver{
+		client:   client,
+		database: database,
+	}
+}
+
+func (d *MongoDriver) Client() *mongo.Client {
+	return d.client
+}
+
+func (d *MongoDriver) Database() *mongo.Database {
+	return d.client.Database(d.database)
+}
+
+func (d *MongoDriver) SetDatabaseResolver(fn func(ctx context.Context) (string, error)) {
+	d.databaseResolver = fn
+}
+
+// 单机的 mongod 不支持事务, 需要设置为 TransactionNone
+func (d *MongoDriver) SetTransactionMode(mode TransactionMode) {
+	d.txMode = mode
+}
+
+func (d *MongoDriver) SetProfileHandler(handler QueryProfileHandler) {
+	d.profileHandler = handler
+}
+
+func (d *MongoDriver) getDatabase(ctx context.Context) (*mongo.Database, error) {
+	database := d.database
+	if d.databaseResolver != nil {
+		name, err := d.databaseResolver(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(name) > 0 {
+			database = name
+		}
+	}
+	return d.client.Database(database), nil
+}
+
+func (d *MongoDriver) getCollection(ctx context.Context, api string) (*mongo.Collection, error) {
+	database, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return database.Collection(api), nil
+}
+
+func (d *MongoDriver) Find(ctx context.Context, table string, filter M, projection M) (result []bson.M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "find", Table: table, Filter: filter, Count: int64(len(result)), Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	findOptions := options.Find()
+	if len(projection) > 0 {
+		findOptions.SetProjection(projection)
+	}
+	cursor, err := coll.Find(ctx, nilFilterToEmpty(filter), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *MongoDriver) FindOne(ctx context.Context, table string, filter M, projection M) (result bson.M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "findOne", Table: table, Filter: filter, Count: profileCount(result), Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	findOneOptions := options.FindOne()
+	if len(projection) > 0 {
+		findOneOptions.SetProjection(projection)
+	}
+	err = coll.FindOne(ctx, nilFilterToEmpty(filter), findOneOptions).Decode(&result)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *MongoDriver) Count(ctx context.Context, table string, filter M) (count int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "count", Table: table, Filter: filter, Count: count, Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	return coll.CountDocuments(ctx, nilFilterToEmpty(filter))
+}
+
+func (d *MongoDriver) Insert(ctx context.Context, table string, doc M) (id interface{}, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "insert", Table: table, Update: doc, Count: profileCount(id), Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	doc = prepareUndoInsert(ctx, table, doc)
+	insertResult, err := coll.InsertOne(ctx, doc)
+	if err != nil {
+		return nil, convMongoError(err)
+	}
+	recordUndoInsert(ctx, table, insertResult.InsertedID)
+	return insertResult.InsertedID, nil
+}
+
+func (d *MongoDriver) InsertMany(ctx context.Context, table string, docs []M) (ids []interface{}, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "insertMany", Table: table, Update: docs, Count: int64(len(ids)), Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		list[i] = prepareUndoInsert(ctx, table, doc)
+	}
+	insertResult, err := coll.InsertMany(ctx, list)
+	if err != nil {
+		return nil, convMongoError(err)
+	}
+	for _, id := range insertResult.InsertedIDs {
+		recordUndoInsert(ctx, table, id)
+	}
+	return insertResult.InsertedIDs, nil
+}
+
+func (d *MongoDriver) UpdateById(ctx context.Context, table string, id interface{}, update M) (modified int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "updateById", Table: table, Filter: M{"_id": id}, Update: update, Count: modified, Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	err = recordUndoWrite(ctx, d, table, M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	result, err := coll.UpdateByID(ctx, id, update)
+	if err != nil {
+		return 0, convMongoError(err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (d *MongoDriver) UpdateMany(ctx context.Context, table string, filter M, update M) (modified int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "updateMany", Table: table, Filter: filter, Update: update, Count: modified, Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	err = recordUndoWrite(ctx, d, table, filter)
+	if err != nil {
+		return 0, err
+	}
+	result, err := coll.UpdateMany(ctx, nilFilterToEmpty(filter), update)
+	if err != nil {
+		return 0, convMongoError(err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (d *MongoDriver) BulkUpdateById(ctx context.Context, table string, ids []interface{}, updates []M) (modified int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "bulkUpdateById", Table: table, Filter: M{"_id": M{"$in": ids}}, Update: updates, Count: modified, Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	err = recordUndoWrite(ctx, d, table, M{"_id": M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	var models []mongo.WriteModel
+	for i, id := range ids {
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(updates[i]))
+	}
+	result, err := coll.BulkWrite(ctx, models)
+	if err != nil {
+		return 0, convMongoError(err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (d *MongoDriver) DeleteById(ctx context.Context, table string, id interface{}) (deleted int64, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "deleteById", Table: table, Filter: M{"_id": id}, Count: deleted, Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	err = recordUndoWrite(ctx, d, table, M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (d *MongoDriver) Aggregate(ctx context.Context, table string, pipeline []M) (results []M, err error) {
+	defer func(start time.Time) {
+		profileQuery(ctx, d.profileHandler, &QueryProfile{Operation: "aggregate", Table: table, Pipeline: pipeline, Count: int64(len(results)), Err: err}, start)
+	}(time.Now())
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline == nil {
+		pipeline = []M{}
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (d *MongoDriver) AggregateCursor(ctx context.Context, table string, pipeline []M, batchSize int) (result Cursor, err error) {
+	start := time.Now()
+	profile := &QueryProfile{Operation: "aggregateCursor", Table: table, Pipeline: pipeline}
+	// 打开游标失败时直接记录, 成功时在游标关闭时记录
+	defer func() {
+		if err != nil {
+			profile.Err = err
+			profileQuery(ctx, d.profileHandler, profile, start)
+		}
+	}()
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline == nil {
+		pipeline = []M{}
+	}
+	aggregateOptions := options.Aggregate()
+	if batchSize > 0 {
+		aggregateOptions.SetBatchSize(int32(batchSize))
+	}
+	cursor, err := coll.Aggregate(ctx, pipeline, aggregateOptions)
+	if err != nil {
+		return nil, err
+	}
+	return newProfileCursor(ctx, d.profileHandler, profile, start, cursor), nil
+}
+
+// 返回聚合管道的执行计划(executionStats)
+func (d *MongoDriver) Explain(ctx context.Context, table string, pipeline []M) (M, error) {
+	database, err := d.getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline == nil {
+		pipeline = []M{}
+	}
+	var result M
+	err = database.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "aggregate", Value: table},
+			{Key: "pipeline", Value: pipeline},
+			{Key: "cursor", Value: bson.M{}},
+		}},
+		{Key: "verbosity", Value: "executionStats"},
+	}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *MongoDriver) InTransaction(ctx context.Context) bool {
+	if d.txMode == TransactionNone {
+		return getUndoLog(ctx) != nil
+	}
+	return mongo.SessionFromContext(ctx) != nil
+}
+
+func (d *MongoDriver) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if d.txMode == TransactionNone {
+		return runWithCompensation(ctx, d, fn)
+	}
+	if d.InTransaction(ctx) {
+		return fn(ctx)
+	}
+	session, err := d.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	return session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		return fn(ctx)
+	})
+}
+
+func (d *MongoDriver) ListIndexes(ctx context.Context, table string) ([]IndexSpec, error) {
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		// 集合不存在
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Code == 26 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []struct {
+		Name    string `bson:"name"`
+		Key     bson.D `bson:"key"`
+		Unique  bool   `bson:"unique"`
+		Weights bson.M `bson:"weights"`
+	}
+	err = cursor.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+	var result []IndexSpec
+	for _, item := range list {
+		index := IndexSpec{
+			Name:   item.Name,
+			Keys:   item.Key,
+			Unique: item.Unique,
+		}
+		// 全文索引的 key 为 {_fts: "text", _ftsx: 1}, 字段保存在 weights 中
+		if len(item.Weights) > 0 {
+			index.Keys = bson.D{}
+			index.Weights = map[string]int{}
+			for k, v := range item.Weights {
+				index.Weights[k] = gconv.Int(v)
+				index.Keys = append(index.Keys, bson.E{Key: k, Value: "text"})
+			}
+			sort.Slice(index.Keys, func(i, j int) bool {
+				return index.Keys[i].Key < index.Keys[j].Key
+			})
+		}
+		result = append(result, index)
+	}
+	return result, nil
+}
+
+func (d *MongoDriver) CreateIndex(ctx context.Context, table string, index IndexSpec) error {
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return err
+	}
+	indexOptions := options.Index().SetName(index.Name).SetUnique(index.Unique)
+	if len(index.Weights) > 0 {
+		// 不使用英文的词干和停用词
+		indexOptions.SetWeights(index.Weights).SetDefaultLanguage("none")
+	}
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    index.Keys,
+		Options: indexOptions,
+	})
+	return err
+}
+
+func (d *MongoDriver) DropIndex(ctx context.Context, table string, name string) error {
+	coll, err := d.getCollection(ctx, table)
+	if err != nil {
+		return err
+	}
+	_, err = coll.Indexes().DropOne(ctx, name)
+	return err
+}
+
+func convMongoError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, err.Error())
+	}
+	return err
+}
+
+func nilFilterToEmpty(filter M) M {
+	if filter == nil {
+		return M{}
+	}
+	return filter
+}
@@ -0,0 +1,220 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 内嵌文档
+// EmbeddedType 的值作为子文档保存在记录中, 子字段同样经过校验/默认值/格式化
+// 过滤和排序使用点路径(address.city), 查询时总是返回整个子文档
+// graphql 类型名称由对象和字段生成, 同一个 EmbeddedType 在多个字段中复用时使用第一次的名称
+
+func isEmbeddedFieldType(tpe Type) bool {
+	if n, ok := tpe.(*ArrayType); ok {
+		tpe = n.Type
+	}
+	_, ok := tpe.(*EmbeddedType)
+	return ok
+}
+
+// 为内嵌类型生成 graphql 类型名称, 在 AddObject 中调用
+func initEmbeddedTypeNames(prefix string, fields []*Field) {
+	for _, field := range fields {
+		tpe := field.Type
+		if n, ok := tpe.(*ArrayType); ok {
+			tpe = n.Type
+		}
+		n, ok := tpe.(*EmbeddedType)
+		if !ok || len(n.name) > 0 {
+			continue
+		}
+		n.name = prefix + "__" + field.Api
+		initEmbeddedTypeNames(n.name, n.Fields)
+	}
+}
+
+// 文件的引用回收和下载鉴权只查询对象的顶层字段, 内嵌文档中不能有文件字段
+func parseEmbeddedFields(field *Field) error {
+	tpe := field.Type
+	if n, ok := tpe.(*ArrayType); ok {
+		tpe = n.Type
+	}
+	n, ok := tpe.(*EmbeddedType)
+	if !ok {
+		return nil
+	}
+	for _, sub := range n.Fields {
+		if isFileFieldType(sub.Type) {
+			return fmt.Errorf("embedded field %s can't be file type", sub.Api)
+		}
+		err := parseEmbeddedFields(sub)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 支持 map 和结构体
+func toEmbeddedDoc(v interface{}) (M, bool) {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		return n, true
+	case bson.M:
+		return M(n), true
+	case bson.D:
+		return M(n.Map()), true
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Struct {
+		return gconv.Map(v), true
+	}
+	return nil, false
+}
+
+func isEmbeddedLike(v interface{}) bool {
+	_, ok := toEmbeddedDoc(v)
+	return ok
+}
+
+func (o *Objectql) validateEmbeddedValue(ctx context.Context, object *Object, field *Field, value interface{}) error {
+	if isNull(value) {
+		return nil
+	}
+	switch n := field.Type.(type) {
+	case *EmbeddedType:
+		doc, _ := toEmbeddedDoc(value)
+		return o.validateEmbeddedDocument(ctx, object, field, n, doc)
+	case *ArrayType:
+		embedded, ok := n.Type.(*EmbeddedType)
+		if !ok {
+			return nil
+		}
+		for _, item := range gconv.Interfaces(value) {
+			if isNull(item) {
+				continue
+			}
+			doc, ok := toEmbeddedDoc(item)
+			if !ok {
+				return fmt.Errorf("validateDocument %T not assign to %s.%s", item, object.Api, field.Api)
+			}
+			err := o.validateEmbeddedDocument(ctx, object, field, embedded, doc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) validateEmbeddedDocument(ctx context.Context, object *Object, field *Field, tpe *EmbeddedType, doc M) error {
+	for k := range doc {
+		if FindFieldFromFields(tpe.Fields, k) == nil {
+			return fmt.Errorf("validateDocument unknown field %s.%s.%s", object.Api, field.Api, k)
+		}
+	}
+	for _, sub := range tpe.Fields {
+		if v, ok := doc[sub.Api]; ok {
+			err := o.validateFieldValue(ctx, object, sub, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 整个子文档都会写入, 所以每次写入都补充默认值
+func formatEmbeddedValueToDatabase(tpe *EmbeddedType, v interface{}) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+	doc, ok := toEmbeddedDoc(v)
+	if !ok {
+		return nil, fmt.Errorf("formatEmbeddedValueToDatabase can't conv type %T to document", v)
+	}
+	doc = copyStrAnyMap(doc)
+	for _, field := range tpe.Fields {
+		if field.Default != nil && isNull(doc[field.Api]) {
+			doc[field.Api] = field.Default
+		}
+	}
+	err := formatDocumentToDatabase(tpe.Fields, doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (o *Objectql) formatEmbeddedValueWithFieldType(tpe *EmbeddedType, v interface{}) (interface{}, error) {
+	doc, ok := toEmbeddedDoc(v)
+	if !ok {
+		return nil, fmt.Errorf("formatEmbeddedValueWithFieldType can't conv type %T to document", v)
+	}
+	result := M{}
+	for _, field := range tpe.Fields {
+		value, ok := doc[field.Api]
+		if !ok {
+			continue
+		}
+		value, err := o.formatValueWithFieldType(field.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		result[field.Api] = value
+	}
+	return result, nil
+}
+
+func isEmbeddedValueEqual(tpe *EmbeddedType, v1, v2 *Var) (bool, error) {
+	for _, field := range tpe.Fields {
+		equal, err := isFieldValueEqual(field.Type, v1.Var(field.Api), v2.Var(field.Api))
+		if err != nil || !equal {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (o *Objectql) getGraphqlEmbeddedObject(tpe *EmbeddedType) *graphql.Object {
+	if tpe.gobject == nil {
+		fields := graphql.Fields{}
+		for _, field := range tpe.Fields {
+			fields[field.Api] = &graphql.Field{
+				Type:        o.getGraphqlFieldType(field.Type),
+				Description: field.Name + ":" + field.Comment,
+			}
+		}
+		tpe.gobject = graphql.NewObject(graphql.ObjectConfig{
+			Name:   tpe.name,
+			Fields: fields,
+		})
+	}
+	return tpe.gobject
+}
+
+func (o *Objectql) getGraphqlEmbeddedInput(tpe *EmbeddedType) *graphql.InputObject {
+	if tpe.ginput == nil {
+		fields := graphql.InputObjectConfigFieldMap{}
+		for _, field := range tpe.Fields {
+			if field.Resolve != nil {
+				continue
+			}
+			fields[field.Api] = &graphql.InputObjectFieldConfig{
+				Type:        o.fieldTypeToInputGraphqlType(field.Type),
+				Description: field.Name + ":" + field.Comment,
+			}
+		}
+		tpe.ginput = graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:   tpe.name + "__form",
+			Fields: fields,
+		})
+	}
+	return tpe.ginput
+}
@@ -0,0 +1,145 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+type embeddedTestAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+func TestEmbedded(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "客户",
+		Api:  "customer",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "地址",
+				Api:  "address",
+				Type: NewEmbedded(
+					&Field{
+						Name: "城市",
+						Api:  "city",
+						Type: String,
+					},
+					&Field{
+						Name:    "邮编",
+						Api:     "zip",
+						Type:    String,
+						Default: "000000",
+					},
+				),
+			},
+			{
+				Name: "联系人",
+				Api:  "contacts",
+				Type: NewArrayType(NewEmbedded(
+					&Field{
+						Name: "姓名",
+						Api:  "name",
+						Type: String,
+					},
+					&Field{
+						Name: "类型",
+						Api:  "kind",
+						Type: String,
+						Select: []SelectOption{
+							{Label: "电话", Value: "phone"},
+							{Label: "邮件", Value: "email"},
+						},
+					},
+				)),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	for _, doc := range []M{
+		{"address": M{"city": "上海", "street": "南京路"}},
+		{"address": "上海"},
+		{"contacts": []any{M{"name": "张三", "kind": "fax"}}},
+	} {
+		_, err := oql.Insert(ctx, "customer", InsertOptions{Doc: doc})
+		if err == nil {
+			t.Error("内嵌文档的子字段需要校验", doc)
+			return
+		}
+	}
+	for _, doc := range []M{
+		{"name": "甲", "address": M{"city": "上海"}, "contacts": []any{M{"name": "张三", "kind": "phone"}}},
+		{"name": "乙", "address": embeddedTestAddress{City: "北京", Zip: "100000"}, "contacts": []any{M{"name": "李四", "kind": "email"}}},
+	} {
+		_, err := oql.Insert(ctx, "customer", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入客户失败", err)
+			return
+		}
+	}
+	list, err := oql.FindList(ctx, "customer", FindListOptions{
+		Filter: M{"address.city": "上海"},
+		Fields: []string{"name", "address", "contacts.name"},
+	})
+	if err != nil || len(list) != 1 {
+		t.Error("按子字段过滤失败", err, list)
+		return
+	}
+	if list[0].Var("address").String("zip") != "000000" || list[0].Var("address").String("city") != "上海" {
+		t.Error("子字段的默认值错误", list[0])
+		return
+	}
+	contacts, _ := list[0].Any("contacts").([]any)
+	if len(contacts) != 1 || NewVar(contacts[0]).String("kind") != "phone" {
+		t.Error("内嵌文档数组查询错误", list[0])
+		return
+	}
+	list, err = oql.FindList(ctx, "customer", FindListOptions{
+		Filter: M{"contacts.name": "李四"},
+		Fields: []string{"name"},
+	})
+	if err != nil || len(list) != 1 || list[0].String("name") != "乙" {
+		t.Error("按数组子字段过滤失败", err, list)
+		return
+	}
+	list, err = oql.FindList(ctx, "customer", FindListOptions{
+		Fields: []string{"name"},
+		Sort:   []string{"address.zip"},
+	})
+	if err != nil || len(list) != 2 || list[0].String("name") != "甲" {
+		t.Error("按子字段排序失败", err, list)
+		return
+	}
+	// graphql 输入输出
+	res := oql.Do(ctx, `mutation {
+		customer__insert(doc: { name: "丙", address: { city: "广州" }, contacts: [{ name: "王五", kind: "phone" }] }) {
+			address { city zip }
+			contacts { name }
+		}
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 插入失败", res.Errors)
+		return
+	}
+	address := NewVar(res.Data).Var("customer__insert").Var("address")
+	if address.String("city") != "广州" || address.String("zip") != "000000" {
+		t.Error("graphql 返回的内嵌文档错误", res.Data)
+		return
+	}
+	res = oql.Do(ctx, `{ customer__findList(filter: "{\"address.city\": \"北京\"}") { name address { zip } } }`)
+	items, _ := NewVar(res.Data).Any("customer__findList").([]any)
+	if res.HasErrors() || len(items) != 1 || NewVar(items[0]).Var("address").String("zip") != "100000" {
+		t.Error("graphql 查询内嵌文档错误", res.Errors, res.Data)
+	}
+}
@@ -1,7 +1,65 @@
 package objectql
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrNotFoundObject = errors.New("not found object")
+	ErrNotFoundObject  = errors.New("not found object")
+	ErrDuplicateKey    = errors.New("duplicate key")
+	ErrVersionConflict = errors.New("version conflict")
+	ErrNotFoundFile    = errors.New("not found file")
+	// 没有权限下载文件, 其他租户的文件返回 ErrNotFoundFile
+	ErrFileAccessDenied = errors.New("file access denied")
+	// TenantDatabase 模式下租户不能作为数据库名称
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// FindEach 的回调返回这个错误时停止遍历, FindEach 本身不返回错误
+	ErrStopIteration = errors.New("stop iteration")
 )
+
+// VersionConflictError 乐观锁冲突, 可以使用 errors.Is(err, ErrVersionConflict) 判断
+type VersionConflictError struct {
+	Object   string
+	ID       string
+	Expected int
+	Actual   int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("object %s record %s version conflict: expected %d, actual %d", e.Object, e.ID, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// BulkRowError 批量写入中某一行的错误, Index 是这一行在输入中的位置
+type BulkRowError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *BulkRowError) Unwrap() error {
+	return e.Err
+}
+
+// BulkError 批量写入中失败的行
+type BulkError struct {
+	Rows []*BulkRowError
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Rows) == 1 {
+		return e.Rows[0].Error()
+	}
+	return fmt.Sprintf("%d rows failed, %s", len(e.Rows), e.Rows[0].Error())
+}
+
+func (e *BulkError) add(index int, err error) {
+	e.Rows = append(e.Rows, &BulkRowError{Index: index, Err: err})
+}
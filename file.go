@@ -0,0 +1,695 @@
+package objectql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 文件
+// FileType 的值为文件的元数据 {id, name, size, mimeType, checksum}, 文件内容保存在 BlobStore 中
+// 上传时元数据写入 __objectql_files, 字段只能引用已经上传的文件, 写入时只使用 id, 元数据从 __objectql_files 读取
+// 记录被删除(包括 DeleteSync 级联删除)或者文件字段被修改后, 没有被其他记录引用的文件在事务提交后删除,
+// 放入回收站的记录在 Purge 时才删除文件, 上传后一直没有被引用的文件由 CollectFiles 回收
+// 元数据记录上传者和租户, 下载时只能访问当前租户的文件, 并且能查询到引用文件的记录,
+// 还没有被引用的文件只有上传者可以访问
+// 引用只按对象的顶层字段查询(有索引), 内嵌文档中不能定义文件字段
+
+const fileCollection = "__objectql_files"
+
+const defaultFileMaxSize = 32 << 20
+
+// BlobStore 保存文件内容, id 为 ObjectID 的 hex 字符串
+type BlobStore interface {
+	Put(ctx context.Context, id string, name string, r io.Reader) error
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	// 文件不存在时不返回错误
+	Delete(ctx context.Context, id string) error
+}
+
+var graphqlFile = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlFile",
+	Fields: graphql.Fields{
+		"id":       &graphql.Field{Type: graphql.String},
+		"name":     &graphql.Field{Type: graphql.String},
+		"size":     &graphql.Field{Type: graphql.Int},
+		"mimeType": &graphql.Field{Type: graphql.String},
+		"checksum": &graphql.Field{Type: graphql.String},
+	},
+})
+
+var graphqlFileInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ObjectqlFileInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"id":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"name":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"size":     &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"mimeType": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"checksum": &graphql.InputObjectFieldConfig{Type: graphql.String},
+	},
+})
+
+func (o *Objectql) SetBlobStore(store BlobStore) {
+	o.blobStore = store
+}
+
+func isFileFieldType(tpe Type) bool {
+	if n, ok := tpe.(*ArrayType); ok {
+		tpe = n.Type
+	}
+	return IsFileType(tpe)
+}
+
+func hasFileField(object *Object) bool {
+	for _, field := range object.Fields {
+		if isFileFieldType(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// 支持元数据 map/结构体, 只有 id 是必须的
+func parseFileValue(v interface{}) (M, error) {
+	doc, ok := toEmbeddedDoc(v)
+	if !ok {
+		return nil, fmt.Errorf("file value %v must be document", v)
+	}
+	id := gconv.String(doc["id"])
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, fmt.Errorf("file id %q invalid", id)
+	}
+	return M{
+		"id":       id,
+		"name":     gconv.String(doc["name"]),
+		"size":     gconv.Int64(doc["size"]),
+		"mimeType": gconv.String(doc["mimeType"]),
+		"checksum": gconv.String(doc["checksum"]),
+	}, nil
+}
+
+func isFileLike(v interface{}) bool {
+	_, err := parseFileValue(v)
+	return err == nil
+}
+
+func formatFileValueToDatabase(v interface{}) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+	return parseFileValue(v)
+}
+
+func formatFileValueFromDatabase(v interface{}) (interface{}, error) {
+	return parseFileValue(v)
+}
+
+func isFileValueEqual(v1, v2 *Var) bool {
+	return v1.String("id") == v2.String("id")
+}
+
+// 字段引用的文件必须是当前租户已经上传的
+func (o *Objectql) validateFileValue(ctx context.Context, object *Object, field *Field, value interface{}) error {
+	if isNull(value) || !isFileFieldType(field.Type) {
+		return nil
+	}
+	ids := getFileIds(field.Type, value)
+	if len(ids) == 0 {
+		return nil
+	}
+	files, err := o.findFileValues(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if len(files) != len(ids) {
+		return fmt.Errorf("validateDocument %s.%s reference file not uploaded", object.Api, field.Api)
+	}
+	return nil
+}
+
+// 文件字段的元数据以上传时记录的为准, 不使用客户端传入的 name/size 等
+func (o *Objectql) fillFileValues(ctx context.Context, object *Object, doc map[string]interface{}) error {
+	for _, field := range object.Fields {
+		value, ok := doc[field.Api]
+		if !ok || isNull(value) || !isFileFieldType(field.Type) {
+			continue
+		}
+		files, err := o.findFileValues(ctx, getFileIds(field.Type, value))
+		if err != nil {
+			return err
+		}
+		fill := func(item interface{}) (interface{}, error) {
+			if isNull(item) {
+				return nil, nil
+			}
+			file, err := parseFileValue(item)
+			if err != nil {
+				return nil, err
+			}
+			id := gconv.String(file["id"])
+			if _, ok := files[id]; !ok {
+				return nil, fmt.Errorf("%s.%s reference file %s not uploaded", object.Api, field.Api, id)
+			}
+			return files[id], nil
+		}
+		if IsFileType(field.Type) {
+			doc[field.Api], err = fill(value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var list []interface{}
+		for _, item := range gconv.Interfaces(value) {
+			file, err := fill(item)
+			if err != nil {
+				return err
+			}
+			list = append(list, file)
+		}
+		doc[field.Api] = list
+	}
+	return nil
+}
+
+// 按 id 查询当前租户上传的文件的元数据
+func (o *Objectql) findFileValues(ctx context.Context, ids []string) (map[string]M, error) {
+	result := map[string]M{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	var oids []primitive.ObjectID
+	for _, id := range ids {
+		oids = append(oids, ObjectIdFromHex(id))
+	}
+	filter := M{"_id": M{"$in": oids}}
+	tenant, err := o.getFileTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant) > 0 {
+		filter[tenantFieldApi] = tenant
+	}
+	list, err := o.driver.Find(ctx, fileCollection, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range list {
+		file, err := getFileValueFromRecord(doc)
+		if err != nil {
+			return nil, err
+		}
+		result[gconv.String(file["id"])] = file
+	}
+	return result, nil
+}
+
+// __objectql_files 中的记录转换为文件字段的值
+func getFileValueFromRecord(doc bson.M) (M, error) {
+	id, _ := doc["_id"].(primitive.ObjectID)
+	return parseFileValue(M{
+		"id":       id.Hex(),
+		"name":     doc["name"],
+		"size":     doc["size"],
+		"mimeType": doc["mimeType"],
+		"checksum": doc["checksum"],
+	})
+}
+
+// 字段值中引用的文件 id, 重复的只保留一个
+func getFileIds(tpe Type, value interface{}) []string {
+	if isNull(value) {
+		return nil
+	}
+	var items []interface{}
+	switch n := tpe.(type) {
+	case *FileType:
+		items = []interface{}{value}
+	case *ArrayType:
+		if !IsFileType(n.Type) {
+			return nil
+		}
+		items = gconv.Interfaces(value)
+	default:
+		return nil
+	}
+	var result []string
+	exist := map[string]bool{}
+	for _, item := range items {
+		if isNull(item) {
+			continue
+		}
+		file, err := parseFileValue(item)
+		if err != nil {
+			continue
+		}
+		id := gconv.String(file["id"])
+		if exist[id] {
+			continue
+		}
+		exist[id] = true
+		result = append(result, id)
+	}
+	return result
+}
+
+// 数据库中的记录引用的文件
+func getDocumentFileIds(object *Object, doc M) []string {
+	var result []string
+	for _, field := range object.Fields {
+		result = append(result, getFileIds(field.Type, doc[field.Api])...)
+	}
+	return result
+}
+
+// UploadFile 保存文件内容并记录元数据, 返回的元数据可以直接作为文件字段的值
+func (o *Objectql) UploadFile(ctx context.Context, name string, mimeType string, r io.Reader) (*Var, error) {
+	if o.blobStore == nil {
+		return nil, errors.New("blob store not set")
+	}
+	// 浏览器不认识的文件类型会使用 application/octet-stream, 这时根据扩展名判断
+	if len(mimeType) == 0 || mimeType == "application/octet-stream" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if len(mimeType) == 0 {
+		mimeType = "application/octet-stream"
+	}
+	record := M{}
+	// 记录租户和上传者, 下载时校验
+	tenant, err := o.getFileTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant) > 0 {
+		record[tenantFieldApi] = tenant
+	}
+	if len(o.operatorObject) > 0 && o.getOperator != nil {
+		uploader, err := o.getOperator(ctx)
+		if err != nil {
+			return nil, err
+		}
+		record["uploader"] = uploader
+	}
+	id := primitive.NewObjectID()
+	hash := sha256.New()
+	counter := &fileSizeCounter{}
+	err = o.blobStore.Put(ctx, id.Hex(), name, io.TeeReader(io.TeeReader(r, hash), counter))
+	if err != nil {
+		return nil, err
+	}
+	file := M{
+		"id":       id.Hex(),
+		"name":     name,
+		"size":     counter.size,
+		"mimeType": mimeType,
+		"checksum": hex.EncodeToString(hash.Sum(nil)),
+	}
+	record["_id"] = id
+	record["name"] = file["name"]
+	record["size"] = file["size"]
+	record["mimeType"] = file["mimeType"]
+	record["checksum"] = file["checksum"]
+	record["createTime"] = time.Now()
+	_, err = o.driver.Insert(ctx, fileCollection, record)
+	if err != nil {
+		o.blobStore.Delete(ctx, id.Hex())
+		return nil, err
+	}
+	return NewVar(file), nil
+}
+
+// OpenFile 打开文件内容, 调用者负责关闭
+func (o *Objectql) OpenFile(ctx context.Context, id string) (io.ReadCloser, *Var, error) {
+	if o.blobStore == nil {
+		return nil, nil, errors.New("blob store not set")
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil, ErrNotFoundFile
+	}
+	doc, err := o.driver.FindOne(ctx, fileCollection, M{"_id": oid}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc == nil {
+		return nil, nil, ErrNotFoundFile
+	}
+	err = o.checkFileAccess(ctx, id, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := getFileValueFromRecord(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := o.blobStore.Open(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, NewVar(file), nil
+}
+
+// TenantDatabase 模式下元数据已经在租户自己的数据库中, 不需要再记录租户
+func (o *Objectql) getFileTenant(ctx context.Context) (string, error) {
+	if o.tenantMode != TenantField {
+		return "", nil
+	}
+	return o.getTenant(ctx)
+}
+
+func (o *Objectql) checkFileAccess(ctx context.Context, id string, doc bson.M) error {
+	// 其他租户的文件当作不存在
+	tenant, err := o.getFileTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if len(tenant) > 0 && gconv.String(doc[tenantFieldApi]) != tenant {
+		return ErrNotFoundFile
+	}
+	// 能查询到引用文件的记录
+	readable, err := o.isFileReadable(ctx, id)
+	if err != nil || readable {
+		return err
+	}
+	// 还没有被引用的文件只有上传者可以访问, 没有设置 GetOperator 时不区分上传者
+	referenced, err := o.isFileReferenced(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !referenced {
+		uploader, ok := doc["uploader"]
+		if !ok || o.getOperator == nil {
+			return nil
+		}
+		operator, err := o.getOperator(ctx)
+		if err != nil {
+			return err
+		}
+		if gconv.String(operator) == gconv.String(uploader) {
+			return nil
+		}
+	}
+	return ErrFileAccessDenied
+}
+
+// 当前用户有查询权限的记录中是否有引用这个文件的
+func (o *Objectql) isFileReadable(ctx context.Context, id string) (bool, error) {
+	for _, object := range o.list {
+		for _, field := range object.Fields {
+			if !isFileFieldType(field.Type) {
+				continue
+			}
+			if o.checkObjectPermission(ctx, object.Api, ObjectQuery) != nil {
+				break
+			}
+			has, err := o.hasObjectFieldPermission(ctx, object.Api, field.Api, FieldQuery)
+			if err != nil {
+				return false, err
+			}
+			if !has {
+				continue
+			}
+			tenant, err := o.getTenantFilter(ctx, object)
+			if err != nil {
+				return false, err
+			}
+			count, err := o.driver.Count(ctx, object.Api, andTenantFilter(M{field.Api + ".id": id}, tenant))
+			if err != nil {
+				return false, err
+			}
+			if count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+type fileSizeCounter struct {
+	size int64
+}
+
+func (c *fileSizeCounter) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	return len(p), nil
+}
+
+// FileHandler 返回上传下载文件的 handler, 可以挂载到 net/http
+// POST multipart/form-data 的 file 字段上传, 返回元数据; GET ?id= 下载
+func (o *Objectql) FileHandler(options ...FileHandlerOptions) http.Handler {
+	option := FileHandlerOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+	if option.MaxSize <= 0 {
+		option.MaxSize = defaultFileMaxSize
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if option.Context != nil {
+			var err error
+			ctx, err = option.Context(ctx, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodPost:
+			o.serveFileUpload(ctx, w, r, option)
+		case http.MethodGet, http.MethodHead:
+			o.serveFileDownload(ctx, w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (o *Objectql) serveFileUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, option FileHandlerOptions) {
+	r.Body = http.MaxBytesReader(w, r.Body, option.MaxSize)
+	reader, header, err := r.FormFile("file")
+	if err != nil {
+		// 超过 MaxSize 时也会返回错误
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer reader.Close()
+	file, err := o.UploadFile(ctx, header.Filename, header.Header.Get("Content-Type"), reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(file.ToAny())
+}
+
+func (o *Objectql) serveFileDownload(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	reader, file, err := o.OpenFile(ctx, r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, ErrNotFoundFile) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrFileAccessDenied) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+	w.Header().Set("Content-Type", file.String("mimeType"))
+	w.Header().Set("Content-Length", file.String("size"))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.String("name")}))
+	w.Header().Set("ETag", `"`+file.String("checksum")+`"`)
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, reader)
+}
+
+// 删除前查询记录引用的文件, 放入回收站的记录不回收
+func (o *Objectql) getRecordFileIds(ctx context.Context, object *Object, id string) ([]string, error) {
+	if o.blobStore == nil || !hasFileField(object) || ctx.Value(recycleBatchKey) != nil {
+		return nil, nil
+	}
+	doc, err := o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	return getDocumentFileIds(object, doc), nil
+}
+
+// 修改前文件字段引用的文件, 只查询修改了的字段
+func (o *Objectql) getUpdateFileIds(ctx context.Context, object *Object, id string, doc M) ([]string, error) {
+	if o.blobStore == nil {
+		return nil, nil
+	}
+	var fields []*Field
+	for _, field := range object.Fields {
+		if _, ok := doc[field.Api]; ok && isFileFieldType(field.Type) {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	before, err := o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+	if err != nil || before == nil {
+		return nil, err
+	}
+	var result []string
+	for _, field := range fields {
+		result = append(result, getFileIds(field.Type, before[field.Api])...)
+	}
+	return result, nil
+}
+
+// 修改后记录不再引用的文件
+func (o *Objectql) releaseUpdatedFiles(ctx context.Context, object *Object, id string, fileIds []string) error {
+	if len(fileIds) == 0 {
+		return nil
+	}
+	after, err := o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, fid := range getDocumentFileIds(object, after) {
+		current[fid] = true
+	}
+	var removed []string
+	for _, fid := range fileIds {
+		if !current[fid] {
+			removed = append(removed, fid)
+		}
+	}
+	o.releaseFiles(ctx, removed)
+	return nil
+}
+
+// CollectFiles 回收上传超过 expire 还没有被任何记录引用的文件, 返回回收的文件 id
+// 上传后没有写入记录的文件不会自动回收, 需要定期调用
+func (o *Objectql) CollectFiles(ctx context.Context, expire time.Duration) ([]string, error) {
+	if o.blobStore == nil {
+		return nil, errors.New("blob store not set")
+	}
+	var result []string
+	_, err := o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		list, err := o.driver.Find(ctx, fileCollection, M{"createTime": M{"$lte": time.Now().Add(-expire)}}, M{"_id": 1})
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range list {
+			id := doc["_id"].(primitive.ObjectID).Hex()
+			referenced, err := o.isFileReferenced(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if !referenced {
+				result = append(result, id)
+			}
+		}
+		o.releaseFiles(ctx, result)
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 事务结束前确认文件不再被引用并删除元数据, 提交后再删除文件内容
+func (o *Objectql) releaseFiles(ctx context.Context, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	o.Next(ctx, func(ctx context.Context) error {
+		var unused []string
+		exist := map[string]bool{}
+		for _, id := range ids {
+			if exist[id] {
+				continue
+			}
+			exist[id] = true
+			referenced, err := o.isFileReferenced(ctx, id)
+			if err != nil {
+				return err
+			}
+			if referenced {
+				continue
+			}
+			_, err = o.driver.DeleteById(ctx, fileCollection, ObjectIdFromHex(id))
+			if err != nil {
+				return err
+			}
+			unused = append(unused, id)
+		}
+		if len(unused) == 0 {
+			return nil
+		}
+		o.AsyncNext(ctx, func(ctx context.Context) error {
+			for _, id := range unused {
+				err := o.blobStore.Delete(ctx, id)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return nil
+	})
+}
+
+// 同一个文件可能被多条记录(包括回收站中的记录)引用
+func (o *Objectql) isFileReferenced(ctx context.Context, id string) (bool, error) {
+	for _, object := range o.list {
+		for _, field := range object.Fields {
+			if !isFileFieldType(field.Type) {
+				continue
+			}
+			count, err := o.driver.Count(ctx, object.Api, M{field.Api + ".id": id})
+			if err != nil {
+				return false, err
+			}
+			if count > 0 {
+				return true, nil
+			}
+			count, err = o.driver.Count(ctx, recycleCollection, M{"object": object.Api, "doc." + field.Api + ".id": id})
+			if err != nil {
+				return false, err
+			}
+			if count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// 从回收站彻底删除的记录引用的文件
+func (o *Objectql) getRecycleEntryFileIds(entry bson.M) []string {
+	object := FindObjectFromList(o.list, gconv.String(entry["object"]))
+	if object == nil || o.blobStore == nil {
+		return nil
+	}
+	doc, ok := entry["doc"].(bson.M)
+	if !ok {
+		return nil
+	}
+	return getDocumentFileIds(object, doc)
+}
@@ -0,0 +1,133 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LocalBlobStore 把文件保存在本地目录, 文件名为 id
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) *LocalBlobStore {
+	return &LocalBlobStore{dir: dir}
+}
+
+// id 只能是 ObjectID, 避免路径穿越
+func (s *LocalBlobStore) path(id string) (string, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return "", ErrNotFoundFile
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, id string, name string, r io.Reader) error {
+	target, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.dir, 0755)
+	if err != nil {
+		return err
+	}
+	// 先写入临时文件, 写完再改名
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *LocalBlobStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	target, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFoundFile
+	}
+	return f, err
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, id string) error {
+	target, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	err = os.Remove(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// GridFSBlobStore 把文件保存在 mongodb 的 GridFS 中
+type GridFSBlobStore struct {
+	bucket *gridfs.Bucket
+}
+
+// bucket 为空时使用默认的 fs
+func NewGridFSBlobStore(db *mongo.Database, bucket string) (*GridFSBlobStore, error) {
+	opts := options.GridFSBucket()
+	if len(bucket) > 0 {
+		opts.SetName(bucket)
+	}
+	b, err := gridfs.NewBucket(db, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSBlobStore{bucket: b}, nil
+}
+
+func (s *GridFSBlobStore) Put(ctx context.Context, id string, name string, r io.Reader) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	return s.bucket.UploadFromStreamWithID(oid, name, r)
+}
+
+func (s *GridFSBlobStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFoundFile
+	}
+	stream, err := s.bucket.OpenDownloadStream(oid)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFoundFile
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s *GridFSBlobStore) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	err = s.bucket.DeleteContext(ctx, oid)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
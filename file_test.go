@@ -0,0 +1,406 @@
+package objectql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	oql := New(ObjectqlOptiosn{BlobStore: NewLocalBlobStore(dir)})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "合同",
+		Api:  "contract",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "附件",
+				Api:  "attachment",
+				Type: File,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "批注",
+		Api:  "remark",
+		Fields: []*Field{
+			{
+				Name:       "合同",
+				Api:        "contract",
+				Type:       NewRelate("contract"),
+				DeleteSync: true,
+			},
+			{
+				Name: "图片",
+				Api:  "images",
+				Type: NewArrayType(File),
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:       "草稿",
+		Api:        "draft",
+		SoftDelete: true,
+		Fields: []*Field{
+			{
+				Name: "附件",
+				Api:  "attachment",
+				Type: File,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	server := httptest.NewServer(oql.FileHandler())
+	defer server.Close()
+	upload := func(name string, content string) *Var {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+		resp, err := http.Post(server.URL, writer.FormDataContentType(), body)
+		if err != nil {
+			t.Error("上传文件失败", err)
+			return nil
+		}
+		defer resp.Body.Close()
+		var file M
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&file) != nil {
+			t.Error("上传文件失败", resp.Status)
+			return nil
+		}
+		return NewVar(file)
+	}
+	exists := func(file *Var) bool {
+		_, err := os.Stat(filepath.Join(dir, file.String("id")))
+		return err == nil
+	}
+	// 文件在事务提交后异步删除
+	waitRemoved := func(file *Var) bool {
+		for i := 0; i < 100; i++ {
+			if !exists(file) {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+	pdf := upload("合同.pdf", "contract content")
+	png := upload("a.png", "image content")
+	shared := upload("shared.txt", "shared content")
+	if pdf == nil || png == nil || shared == nil {
+		return
+	}
+	checksum := sha256.Sum256([]byte("contract content"))
+	if pdf.Int("size") != 16 || pdf.String("checksum") != hex.EncodeToString(checksum[:]) || pdf.String("mimeType") != "application/pdf" {
+		t.Error("上传返回的元数据错误", pdf)
+		return
+	}
+	// 下载
+	resp, err := http.Get(server.URL + "?id=" + pdf.String("id"))
+	if err != nil {
+		t.Error("下载文件失败", err)
+		return
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(content) != "contract content" || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Error("下载的文件错误", string(content), resp.Header)
+		return
+	}
+	resp, err = http.Get(server.URL + "?id=" + primitive.NewObjectID().Hex())
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Error("不存在的文件应该返回 404", err)
+		return
+	}
+	resp.Body.Close()
+	// 只能引用已经上传的文件
+	_, err = oql.Insert(ctx, "contract", InsertOptions{Doc: M{"attachment": M{"id": primitive.NewObjectID().Hex()}}})
+	if err == nil {
+		t.Error("引用没有上传的文件应该失败")
+		return
+	}
+	// 元数据以上传时记录的为准
+	contract, err := oql.Insert(ctx, "contract", InsertOptions{
+		Doc:    M{"name": "采购合同", "attachment": M{"id": pdf.String("id"), "name": "fake.exe", "size": 1, "checksum": "x"}},
+		Fields: []string{"_id", "attachment"},
+	})
+	if err != nil {
+		t.Error("插入合同失败", err)
+		return
+	}
+	if contract.Var("attachment").String("name") != "合同.pdf" || contract.Var("attachment").Int("size") != 16 ||
+		contract.Var("attachment").String("checksum") != pdf.String("checksum") {
+		t.Error("文件字段的值错误", contract)
+		return
+	}
+	remark, err := oql.Insert(ctx, "remark", InsertOptions{
+		Doc:    M{"contract": contract.String("_id"), "images": []any{M{"id": png.String("id")}, shared.ToAny()}},
+		Fields: []string{"images"},
+	})
+	if err != nil {
+		t.Error("插入批注失败", err)
+		return
+	}
+	if images, _ := remark.Any("images").([]any); len(images) != 2 || NewVar(images[0]).String("mimeType") != "image/png" {
+		t.Error("文件数组字段的值错误", remark)
+		return
+	}
+	_, err = oql.Insert(ctx, "draft", InsertOptions{Doc: M{"attachment": shared.ToAny()}})
+	if err != nil {
+		t.Error("插入草稿失败", err)
+		return
+	}
+	// graphql 输出
+	res := oql.Do(ctx, `{ contract__findList { attachment { name mimeType } } }`)
+	items, _ := NewVar(res.Data).Any("contract__findList").([]any)
+	if res.HasErrors() || len(items) != 1 || NewVar(items[0]).Var("attachment").String("mimeType") != "application/pdf" {
+		t.Error("graphql 查询文件字段错误", res.Errors, res.Data)
+		return
+	}
+	// 修改文件字段后被替换的文件被回收
+	pdf2 := upload("合同2.pdf", "contract content v2")
+	if pdf2 == nil {
+		return
+	}
+	_, err = oql.UpdateById(ctx, "contract", UpdateByIdOptions{ID: contract.String("_id"), Doc: M{"attachment": pdf2.ToAny()}})
+	if err != nil {
+		t.Error("修改合同失败", err)
+		return
+	}
+	if !waitRemoved(pdf) || !exists(pdf2) {
+		t.Error("修改后被替换的文件应该被回收")
+		return
+	}
+	// 删除合同级联删除批注, 没有被引用的文件被回收
+	err = oql.DeleteById(ctx, "contract", DeleteByIdOptions{ID: contract.String("_id")})
+	if err != nil {
+		t.Error("删除合同失败", err)
+		return
+	}
+	if !waitRemoved(pdf2) || !waitRemoved(png) {
+		t.Error("删除记录后文件应该被回收")
+		return
+	}
+	if _, _, err = oql.OpenFile(ctx, png.String("id")); err != ErrNotFoundFile {
+		t.Error("回收的文件元数据应该被删除", err)
+		return
+	}
+	if !exists(shared) {
+		t.Error("被其他记录引用的文件不能回收")
+		return
+	}
+	// 回收站中的记录彻底删除后才回收
+	drafts, err := oql.FindList(ctx, "draft", FindListOptions{Fields: []string{"_id"}})
+	if err != nil || len(drafts) != 1 {
+		t.Error("查询草稿失败", err)
+		return
+	}
+	err = oql.DeleteById(ctx, "draft", DeleteByIdOptions{ID: drafts[0].String("_id")})
+	if err != nil {
+		t.Error("删除草稿失败", err)
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !exists(shared) {
+		t.Error("回收站中的记录引用的文件不能回收")
+		return
+	}
+	err = oql.Purge(ctx, "draft", PurgeOptions{ID: drafts[0].String("_id")})
+	if err != nil {
+		t.Error("彻底删除草稿失败", err)
+		return
+	}
+	if !waitRemoved(shared) {
+		t.Error("彻底删除后文件应该被回收")
+		return
+	}
+	// 上传后没有被引用的文件
+	orphan := upload("orphan.txt", "orphan content")
+	if orphan == nil {
+		return
+	}
+	ids, err := oql.CollectFiles(ctx, time.Hour)
+	if err != nil || len(ids) != 0 {
+		t.Error("没有过期的文件不应该被回收", err, ids)
+		return
+	}
+	ids, err = oql.CollectFiles(ctx, 0)
+	if err != nil || len(ids) != 1 || ids[0] != orphan.String("id") || !waitRemoved(orphan) {
+		t.Error("没有被引用的文件应该被回收", err, ids)
+	}
+}
+
+type fileUserKey struct{}
+
+type fileRoleKey struct{}
+
+func TestFileAccess(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	oql := New(ObjectqlOptiosn{
+		BlobStore:      NewLocalBlobStore(t.TempDir()),
+		IndexMode:      IndexModeApply,
+		OperatorObject: "user",
+		GetOperator: func(ctx context.Context) (any, error) {
+			user, _ := ctx.Value(fileUserKey{}).(string)
+			return user, nil
+		},
+		GetTenant: func(ctx context.Context) (string, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant, nil
+		},
+	})
+	oql.SetDriver(driver)
+	// 访客没有合同的查询权限
+	oql.SetObjectPermissionCheckHandler(func(ctx context.Context, object string, kind PermissionKind) (bool, error) {
+		return !(ctx.Value(fileRoleKey{}) == "guest" && object == "contract" && kind == ObjectQuery), nil
+	})
+	oql.AddObject(&Object{
+		Name: "用户",
+		Api:  "user",
+	})
+	oql.AddObject(&Object{
+		Name:   "合同",
+		Api:    "contract",
+		Tenant: true,
+		Fields: []*Field{
+			{
+				Name: "附件",
+				Api:  "attachment",
+				Type: File,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	// 按文件 id 查询引用的索引
+	for table, name := range map[string]string{"contract": "oql_attachment.id_1", recycleCollection: "oql_doc.attachment.id_1"} {
+		indexes, err := driver.ListIndexes(ctx, table)
+		if err != nil || !lo.ContainsBy(indexes, func(item IndexSpec) bool { return item.Name == name }) {
+			t.Error("缺少文件字段的索引", table, err, indexes)
+			return
+		}
+	}
+	ctxA1 := context.WithValue(context.WithValue(ctx, tenantKey{}, "a"), fileUserKey{}, primitive.NewObjectID().Hex())
+	ctxA2 := context.WithValue(context.WithValue(ctx, tenantKey{}, "a"), fileUserKey{}, primitive.NewObjectID().Hex())
+	ctxB := context.WithValue(context.WithValue(ctx, tenantKey{}, "b"), fileUserKey{}, primitive.NewObjectID().Hex())
+	guest := context.WithValue(ctxA2, fileRoleKey{}, "guest")
+	file, err := oql.UploadFile(ctxA1, "a.txt", "text/plain", bytes.NewBufferString("content"))
+	if err != nil {
+		t.Error("上传文件失败", err)
+		return
+	}
+	open := func(ctx context.Context) error {
+		r, _, err := oql.OpenFile(ctx, file.String("id"))
+		if err == nil {
+			r.Close()
+		}
+		return err
+	}
+	// 没有被引用的文件只有上传者可以访问
+	if err = open(ctxA1); err != nil {
+		t.Error("上传者应该可以访问文件", err)
+		return
+	}
+	if err = open(ctxA2); err != ErrFileAccessDenied {
+		t.Error("没有被引用的文件其他用户不能访问", err)
+		return
+	}
+	if err = open(ctxB); err != ErrNotFoundFile {
+		t.Error("其他租户的文件当作不存在", err)
+		return
+	}
+	_, err = oql.Insert(ctxB, "contract", InsertOptions{Doc: M{"attachment": file.ToAny()}})
+	if err == nil {
+		t.Error("不能引用其他租户的文件")
+		return
+	}
+	// 被记录引用后能查询到记录的用户可以访问
+	_, err = oql.Insert(ctxA1, "contract", InsertOptions{Doc: M{"attachment": file.ToAny()}})
+	if err != nil {
+		t.Error("插入合同失败", err)
+		return
+	}
+	if err = open(ctxA2); err != nil {
+		t.Error("能查询到引用文件的记录时应该可以访问", err)
+		return
+	}
+	if err = open(guest); err != ErrFileAccessDenied {
+		t.Error("没有记录的查询权限时不能访问", err)
+		return
+	}
+	if err = open(ctxB); err != ErrNotFoundFile {
+		t.Error("其他租户的文件当作不存在", err)
+		return
+	}
+	// 下载返回 403
+	server := httptest.NewServer(oql.FileHandler(FileHandlerOptions{
+		Context: func(ctx context.Context, r *http.Request) (context.Context, error) {
+			return guest, nil
+		},
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "?id=" + file.String("id"))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Error("没有权限下载时应该返回 403", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// 内嵌文档中的文件不会被引用计数, 不允许定义
+func TestFileEmbedded(t *testing.T) {
+	ctx := context.Background()
+	oql := New(ObjectqlOptiosn{BlobStore: NewLocalBlobStore(t.TempDir())})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "合同",
+		Api:  "contract",
+		Fields: []*Field{
+			{
+				Name: "条款",
+				Api:  "terms",
+				Type: NewArrayType(NewEmbedded(
+					&Field{
+						Name: "附件",
+						Api:  "attachment",
+						Type: File,
+					},
+				)),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err == nil || !strings.Contains(err.Error(), "can't be file type") {
+		t.Error("内嵌文档中的文件字段应该初始化失败", err)
+	}
+}
@@ -18,19 +18,23 @@ func formatDatabaseValueToCompute(field *Field, value interface{}) (interface{},
 			return gconv.Int(value), nil
 		case *FloatType:
 			return gconv.Float64(value), nil
+		case *DecimalType:
+			return formatDecimalValueToCompute(value)
 		case *BoolType:
 			return gconv.Bool(value), nil
 		case *StringType:
 			return gconv.String(value), nil
 		case *DateTimeType, *DateType, *TimeType:
 			return formatDatabaseDateTimeValueToCompute(value)
+		case *AnyType:
+			return formatAnyValueFromDatabase(value), nil
 		default:
 			return nil, fmt.Errorf("formatOutputValue simpleHandle unknown field type %v", tpe)
 		}
 	}
 
 	switch n := field.Type.(type) {
-	case *IntType, *FloatType, *BoolType, *StringType, *DateTimeType, *DateType, *TimeType:
+	case *IntType, *FloatType, *DecimalType, *BoolType, *StringType, *DateTimeType, *DateType, *TimeType, *AnyType:
 		return simpleHandle(field.Type, value)
 	case *RelateType:
 		return simpleHandle(String, value)
@@ -78,6 +82,8 @@ func formatValueToDatabase(tpe Type, value interface{}) (interface{}, error) {
 		return formatIntValueToDatebase(value)
 	case *FloatType:
 		return formatFloatValueToDatebase(value)
+	case *DecimalType:
+		return formatDecimalValueToDatabase(n, value)
 	case *StringType:
 		return formatStringValueToDatebase(value)
 	case *BoolType:
@@ -86,6 +92,14 @@ func formatValueToDatabase(tpe Type, value interface{}) (interface{}, error) {
 		return formatRelateValueToDatebase(value)
 	case *DateTimeType, *DateType, *TimeType:
 		return formatDateTimeValueToDatebase(value)
+	case *GeoPointType:
+		return formatGeoPointValueToDatabase(value)
+	case *FileType:
+		return formatFileValueToDatabase(value)
+	case *EmbeddedType:
+		return formatEmbeddedValueToDatabase(n, value)
+	case *AnyType:
+		return formatAnyValueToDatabase(value)
 	case *ArrayType:
 		return formatArrayValueToDatebase(n, value)
 	case *FormulaType:
@@ -169,10 +183,14 @@ func formatComputedValue(tpe Type, value interface{}) (interface{}, error) {
 		return gconv.Int(value), nil
 	case *FloatType:
 		return gconv.Float64(value), nil
+	case *DecimalType:
+		return formatDecimalValueToDatabase(n, value)
 	case *BoolType:
 		return gconv.Bool(value), nil
 	case *StringType:
 		return gconv.String(value), nil
+	case *AnyType:
+		return value, nil
 	case *RelateType:
 		return formatComputedValue(String, value)
 	case *FormulaType:
@@ -207,19 +225,21 @@ func getFieldComputeDefaultValue(field *Field) (interface{}, error) {
 		switch tpe.(type) {
 		case *IntType:
 			return 0, nil
-		case *FloatType:
+		case *FloatType, *DecimalType:
 			return 0, nil
 		case *BoolType:
 			return false, nil
 		case *StringType:
 			return "", nil
+		case *AnyType:
+			return nil, nil
 		default:
 			return nil, fmt.Errorf("getFieldComputeDefaultValue simpleHandle unknown field type %v", tpe)
 		}
 	}
 
 	switch n := field.Type.(type) {
-	case *IntType, *FloatType, *BoolType, *StringType:
+	case *IntType, *FloatType, *DecimalType, *BoolType, *StringType, *AnyType:
 		return simpleHandle(field.Type)
 	case *RelateType:
 		return simpleHandle(String)
@@ -0,0 +1,183 @@
+package objectql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 地理位置
+// GeoPointType 在数据库中保存为 GeoJSON {type: "Point", coordinates: [lng, lat]}, 并创建 2dsphere 索引
+// 输入输出为 {lng, lat}, 过滤条件支持 $geoWithin 和 $near,
+// $near 在聚合管道中需要转换为第一个阶段 $geoNear, 距离(米)写入 <field>__distance
+
+const geoDistanceSuffix = "__distance"
+
+var graphqlGeoPoint = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlGeoPoint",
+	Fields: graphql.Fields{
+		"lng": &graphql.Field{Type: graphql.Float},
+		"lat": &graphql.Field{Type: graphql.Float},
+	},
+})
+
+var graphqlGeoPointInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "ObjectqlGeoPointInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"lng": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		"lat": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+// 支持 {lng, lat}, GeoJSON 和 [lng, lat]
+func parseGeoPoint(v interface{}) (lng float64, lat float64, err error) {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		if coordinates, ok := n["coordinates"]; ok {
+			return parseGeoPoint(coordinates)
+		}
+		if _, ok := n["lng"]; !ok {
+			return 0, 0, fmt.Errorf("geo point %v missing lng", v)
+		}
+		if _, ok := n["lat"]; !ok {
+			return 0, 0, fmt.Errorf("geo point %v missing lat", v)
+		}
+		lng, lat = gconv.Float64(n["lng"]), gconv.Float64(n["lat"])
+	case bson.M:
+		return parseGeoPoint(map[string]interface{}(n))
+	case bson.D:
+		m := M{}
+		for _, e := range n {
+			m[e.Key] = e.Value
+		}
+		return parseGeoPoint(m)
+	default:
+		arr := gconv.Float64s(v)
+		if len(arr) != 2 {
+			return 0, 0, fmt.Errorf("geo point %v must be [lng, lat]", v)
+		}
+		lng, lat = arr[0], arr[1]
+	}
+	if lng < -180 || lng > 180 || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("geo point [%v, %v] out of range", lng, lat)
+	}
+	return lng, lat, nil
+}
+
+func isGeoPointLike(v interface{}) bool {
+	_, _, err := parseGeoPoint(v)
+	return err == nil
+}
+
+func formatGeoPointValueToDatabase(v interface{}) (interface{}, error) {
+	if isNull(v) {
+		return nil, nil
+	}
+	lng, lat, err := parseGeoPoint(v)
+	if err != nil {
+		return nil, err
+	}
+	return M{"type": "Point", "coordinates": A{lng, lat}}, nil
+}
+
+func formatGeoPointValueFromDatabase(v interface{}) (interface{}, error) {
+	lng, lat, err := parseGeoPoint(v)
+	if err != nil {
+		return nil, err
+	}
+	return M{"lng": lng, "lat": lat}, nil
+}
+
+func getGeoIndexes(object *Object) []IndexSpec {
+	var result []IndexSpec
+	for _, field := range object.Fields {
+		if IsGeoPointType(field.Type) {
+			result = append(result, IndexSpec{
+				Name: managedIndexPrefix + field.Api + "_2dsphere",
+				Keys: bson.D{{Key: field.Api, Value: "2dsphere"}},
+			})
+		}
+	}
+	return result
+}
+
+// 距离字段只在 $near 查询时有值
+func newGeoDistanceField(field *Field) *Field {
+	api := field.Api + geoDistanceSuffix
+	return &Field{
+		Api:  api,
+		Name: field.Name + "距离",
+		Type: Float,
+		Resolve: func(source map[string]any) (interface{}, error) {
+			return source[api], nil
+		},
+	}
+}
+
+// 把过滤条件中顶层的 $near/$nearSphere 转换为 $geoNear 阶段, 返回剩余的过滤条件
+func getGeoNearStage(object *Object, filter M) (M, M, error) {
+	for _, field := range object.Fields {
+		if !IsGeoPointType(field.Type) {
+			continue
+		}
+		cond, ok := filter[field.Api].(M)
+		if !ok {
+			continue
+		}
+		near, ok := cond["$near"]
+		if !ok {
+			near, ok = cond["$nearSphere"]
+		}
+		if !ok {
+			continue
+		}
+		stage := M{
+			"key":           field.Api,
+			"distanceField": field.Api + geoDistanceSuffix,
+			"spherical":     true,
+		}
+		rest := M{}
+		for k, v := range cond {
+			switch k {
+			case "$near", "$nearSphere":
+			case "$maxDistance", "$minDistance":
+				stage[k[1:]] = gconv.Float64(v)
+			default:
+				rest[k] = v
+			}
+		}
+		// {$geometry: point, $maxDistance: 1000}
+		if m, ok := near.(M); ok {
+			if geometry, ok := m["$geometry"]; ok {
+				near = geometry
+			}
+			for _, k := range []string{"$maxDistance", "$minDistance"} {
+				if v, ok := m[k]; ok {
+					stage[k[1:]] = gconv.Float64(v)
+				}
+			}
+		}
+		point, err := formatGeoPointValueToDatabase(near)
+		if err != nil {
+			return nil, nil, err
+		}
+		if point == nil {
+			return nil, nil, errors.New("$near point can't empty")
+		}
+		stage["near"] = point
+		result := M{}
+		for k, v := range filter {
+			if k != field.Api {
+				result[k] = v
+			}
+		}
+		if len(rest) > 0 {
+			result[field.Api] = rest
+		}
+		return stage, result, nil
+	}
+	return nil, filter, nil
+}
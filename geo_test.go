@@ -0,0 +1,130 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGeoPoint(t *testing.T) {
+	ctx := context.Background()
+	oql := New(ObjectqlOptiosn{
+		IndexMode: IndexModeApply,
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "门店",
+		Api:  "store",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "位置",
+				Api:  "location",
+				Type: GeoPoint,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	diffs, err := oql.DiffIndexes(ctx)
+	if err != nil || len(diffs) != 0 {
+		t.Error("2dsphere 索引应该已经创建", err, diffs)
+		return
+	}
+	for _, doc := range []M{
+		{"name": "虹桥", "location": M{"lng": 121.3364, "lat": 31.1979}},
+		{"name": "陆家嘴", "location": []float64{121.5055, 31.2397}},
+		{"name": "北京", "location": M{"type": "Point", "coordinates": []float64{116.4074, 39.9042}}},
+		{"name": "未知"},
+	} {
+		_, err := oql.Insert(ctx, "store", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入门店失败", err)
+			return
+		}
+	}
+	_, err = oql.Insert(ctx, "store", InsertOptions{Doc: M{"name": "错误", "location": M{"lng": 200, "lat": 0}}})
+	if err == nil {
+		t.Error("超出范围的坐标不能保存")
+		return
+	}
+	// 人民广场附近 20km, 按距离排序
+	list, err := oql.FindList(ctx, "store", FindListOptions{
+		Filter: M{"location": M{
+			"$near":        M{"lng": 121.4737, "lat": 31.2304},
+			"$maxDistance": 20000,
+		}},
+		Fields: []string{"name", "location", "location__distance"},
+	})
+	if err != nil {
+		t.Error("附近查询失败", err)
+		return
+	}
+	if len(list) != 2 || list[0].String("name") != "陆家嘴" || list[1].String("name") != "虹桥" {
+		t.Error("附近查询结果错误", list)
+		return
+	}
+	distance := list[0].Float64("location__distance")
+	if distance < 3000 || distance > 3500 || list[0].Var("location").Float64("lng") != 121.5055 {
+		t.Error("距离或者坐标错误", list[0])
+		return
+	}
+	count, err := oql.Count(ctx, "store", CountOptions{
+		Filter: M{"location": M{
+			"$near":        M{"lng": 121.4737, "lat": 31.2304},
+			"$maxDistance": 5000,
+		}},
+	})
+	if err != nil || count != 1 {
+		t.Error("附近统计错误", err, count)
+		return
+	}
+	// 矩形范围
+	list, err = oql.FindList(ctx, "store", FindListOptions{
+		Filter: M{"location": M{
+			"$geoWithin": M{"$box": []any{[]any{121, 31}, []any{122, 32}}},
+		}},
+		Fields: []string{"name"},
+		Sort:   []string{"name"},
+	})
+	if err != nil || len(list) != 2 {
+		t.Error("范围查询错误", err, list)
+		return
+	}
+	// graphql 输入输出
+	res := oql.Do(ctx, `mutation {
+		store__insert(doc: { name: "静安寺", location: { lng: 121.4456, lat: 31.2235 } }) {
+			name
+			location { lng lat }
+		}
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 插入失败", res.Errors)
+		return
+	}
+	insert := NewVar(res.Data).Var("store__insert")
+	if insert.Var("location").Float64("lat") != 31.2235 {
+		t.Error("graphql 返回的坐标错误", insert)
+		return
+	}
+	res = oql.Do(ctx, `{
+		store__findList(filter: "{\"location\": {\"$near\": [121.4737, 31.2304], \"$maxDistance\": 5000}}") {
+			name
+			location__distance
+		}
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 附近查询失败", res.Errors)
+		return
+	}
+	items, _ := NewVar(res.Data).Any("store__findList").([]any)
+	if len(items) != 2 || NewVar(items[0]).String("name") != "静安寺" || NewVar(items[0]).Float64("location__distance") <= 0 {
+		t.Error("graphql 附近查询结果错误", items)
+	}
+}
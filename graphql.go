@@ -53,6 +53,31 @@ func (o *Objectql) initObjectGraphqlQuery(ctx context.Context, querys graphql.Fi
 		},
 	}
 
+	querys[object.Api+"__connection"] = &graphql.Field{
+		Type: o.getGraphqlObjectConnection(object),
+		Args: graphql.FieldConfigArgument{
+			"filter": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "过滤条件",
+			},
+			"sort": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.String),
+				Description: "排序",
+			},
+			"first": &graphql.ArgumentConfig{
+				Type:        graphql.Int,
+				Description: "返回数量",
+			},
+			"after": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "从这个游标之后开始查询",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlQueryConnectionResolver(p.Context, p, object)
+		},
+	}
+
 	querys[object.Api+"__aggregate"] = &graphql.Field{
 		Type: graphql.NewList(graphqlAny),
 		Args: graphql.FieldConfigArgument{
@@ -120,6 +145,27 @@ func (o *Objectql) initObjectGraphqlQuery(ctx context.Context, querys graphql.Fi
 		},
 	}
 
+	if object.History {
+		querys[object.Api+"__history"] = &graphql.Field{
+			Type: graphql.NewList(graphqlHistory),
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "对象id",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return o.graphqlQueryHistoryResolver(p.Context, p, object)
+			},
+		}
+	}
+
+	// 全文搜索
+	o.initObjectGraphqlSearch(querys, object)
+
+	// 选项字段的选项
+	o.initObjectGraphqlSelectOptions(querys, object)
+
 	// 自定义mutation
 	for _, handle := range object.Querys {
 		err := o.validateHandle(handle)
@@ -157,16 +203,16 @@ func (o *Objectql) graphqlQueryAggregateResolver(ctx context.Context, p graphql.
 	if err != nil {
 		return nil, err
 	}
-	cursor, err := o.getCollection(object.Api).Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
+	var stages []M
+	for _, stage := range pipeline {
+		stages = append(stages, stage)
 	}
-	var list []bson.M
-	err = cursor.All(ctx, &list)
+	// 只聚合当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, object)
 	if err != nil {
 		return nil, err
 	}
-	return list, nil
+	return o.mongoAggregate(ctx, object.Api, withTenantStage(stages, tenant))
 }
 
 func (o *Objectql) parseMongoAggregatePipeline(ctx context.Context, p graphql.ResolveParams) ([]bson.M, error) {
@@ -192,6 +238,10 @@ func (o *Objectql) graphqlQueryListResolver(ctx context.Context, p graphql.Resol
 	if err != nil {
 		return nil, err
 	}
+	ctx, err = o.withGraphqlRelatedListArgs(ctx, p, object, "")
+	if err != nil {
+		return nil, err
+	}
 	result, err := o.mongoFindAllEx(ctx, object.Api, *options)
 	if err != nil {
 		return nil, err
@@ -212,6 +262,10 @@ func (o *Objectql) graphqlQueryOneResolver(ctx context.Context, p graphql.Resolv
 	if err != nil {
 		return nil, err
 	}
+	ctx, err = o.withGraphqlRelatedListArgs(ctx, p, object, "")
+	if err != nil {
+		return nil, err
+	}
 	result, err := o.mongoFindOneEx(ctx, object.Api, *options)
 	if err != nil {
 		return nil, err
@@ -237,6 +291,10 @@ func (o *Objectql) graphqlQueryOneByIdResolver(ctx context.Context, p graphql.Re
 		return nil, err
 	}
 	fields := o.parseMongoQueryFields(p)
+	ctx, err = o.withGraphqlRelatedListArgs(ctx, p, object, "")
+	if err != nil {
+		return nil, err
+	}
 	result, err := o.mongoFindOneEx(ctx, object.Api, findOneExOptions{
 		Fields: fields,
 		Filter: M{
@@ -462,6 +520,16 @@ func preprocessMongoMap(data interface{}) (interface{}, error) {
 			list = append(list, r)
 		}
 		return list, nil
+	case []M:
+		var list A
+		for _, v := range n {
+			r, err := preprocessMongoMap(v)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, r)
+		}
+		return list, nil
 	default:
 		return data, nil
 	}
@@ -571,6 +639,55 @@ func (o *Objectql) initObjectGraphqlMutation(ctx context.Context, mutations grap
 			return o.graphqlMutationUpdateByIdResolver(p.Context, p, object)
 		},
 	}
+	if object.Versioned {
+		mutations[object.Api+"__updateById"].Args["__v"] = &graphql.ArgumentConfig{
+			Type:        graphql.Int,
+			Description: "期望的版本号",
+		}
+	}
+	// 批量新增
+	bulkResult := o.getGraphqlObjectBulkResult(object)
+	mutations[object.Api+"__insertMany"] = &graphql.Field{
+		Type: bulkResult,
+		Args: graphql.FieldConfigArgument{
+			"docs": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(form),
+				Description: "对象文档",
+			},
+			"skipInvalid": &graphql.ArgumentConfig{
+				Type:        graphql.Boolean,
+				Description: "跳过校验失败的行",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlMutationInsertManyResolver(p.Context, p, object)
+		},
+	}
+	// 按id批量修改
+	mutations[object.Api+"__updateMany"] = &graphql.Field{
+		Type: bulkResult,
+		Args: graphql.FieldConfigArgument{
+			"_ids": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.String),
+				Description: "对象id",
+			},
+			"doc": &graphql.ArgumentConfig{
+				Type:        form,
+				Description: "所有记录使用的对象文档",
+			},
+			"docs": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(form),
+				Description: "和_ids一一对应的对象文档",
+			},
+			"skipInvalid": &graphql.ArgumentConfig{
+				Type:        graphql.Boolean,
+				Description: "跳过校验失败的行",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlMutationUpdateManyResolver(p.Context, p, object)
+		},
+	}
 	// 触发字段改变，用于触发属性计算链路
 	mutations[object.Api+"__triggerChange"] = &graphql.Field{
 		Type: graphql.Boolean,
@@ -611,6 +728,8 @@ func (o *Objectql) initObjectGraphqlMutation(ctx context.Context, mutations grap
 			},
 		}
 	}
+	// 多对多关联
+	o.initObjectGraphqlLinkMutation(mutations, object)
 	// 批量删除
 	mutations[object.Api+"__delete"] = &graphql.Field{
 		Type: graphql.Boolean,
@@ -637,6 +756,33 @@ func (o *Objectql) initObjectGraphqlMutation(ctx context.Context, mutations grap
 			return o.graphqlMutationDeleteByIdResolver(p.Context, p, object)
 		},
 	}
+	// 回收站
+	if object.SoftDelete {
+		mutations[object.Api+"__restore"] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"_id": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "对象id",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return o.graphqlMutationRestoreResolver(p.Context, p, object)
+			},
+		}
+		mutations[object.Api+"__purge"] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"_id": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "对象id",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return o.graphqlMutationPurgeResolver(p.Context, p, object)
+			},
+		}
+	}
 	// 自定义mutation
 	for _, handle := range object.Mutations {
 		err := o.validateHandle(handle)
@@ -839,21 +985,15 @@ func (o *Objectql) getGraphqlReturnFromHandle(ctx context.Context, mutation *Han
 func (o *Objectql) getGrpahqlObjectMutationForm(object *Object) graphql.Input {
 	fields := graphql.InputObjectConfigFieldMap{}
 	for _, cur := range object.Fields {
-		if cur.Api == "_id" || cur.Api == "__aggregate" {
-			continue
-		}
-		// 定义resolve的为动态字段，不允许进行修改
-		if cur.Resolve != nil {
+		if !isFormField(cur) {
 			continue
 		}
-		//
-		switch cur.Type.(type) {
-		// case *ExpandType, *ExpandsType, *FormulaType, *AggregationType:
-		case *ExpandType, *ExpandsType:
-			continue
+		tpe := o.fieldTypeToInputGraphqlType(cur.Type)
+		if enum := o.getGraphqlSelectEnum(object, cur); enum != nil {
+			tpe = enum
 		}
 		fields[cur.Api] = &graphql.InputObjectFieldConfig{
-			Type: o.fieldTypeToInputGraphqlType(cur.Type),
+			Type: tpe,
 		}
 	}
 	return graphql.NewInputObject(graphql.InputObjectConfig{
@@ -862,6 +1002,23 @@ func (o *Objectql) getGrpahqlObjectMutationForm(object *Object) graphql.Input {
 	})
 }
 
+// 可以通过表单写入的字段
+func isFormField(field *Field) bool {
+	if field.Api == "_id" || field.Api == "__aggregate" || field.Api == "__v" || field.Api == tenantFieldApi {
+		return false
+	}
+	// 定义resolve的为动态字段，不允许进行修改
+	if field.Resolve != nil {
+		return false
+	}
+	switch field.Type.(type) {
+	// case *ExpandType, *ExpandsType, *FormulaType, *AggregationType:
+	case *ExpandType, *ExpandsType, *ManyToManyType, *RelatedListType:
+		return false
+	}
+	return true
+}
+
 func (o *Objectql) graphqlMutationInsertResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
 	args := formatNullValue(p.Args)
 	err := o.graphqlMutationInsertArgumentValidate(object, args)
@@ -912,48 +1069,11 @@ func (o *Objectql) graphqlMutationSaveResolver(ctx context.Context, p graphql.Re
 		}
 	}
 	doc := args["doc"].(map[string]interface{})
-
-	var updateId string
-	// 判断是否存在主键
-	primaryFields := object.getPrimaryFields()
-	if len(primaryFields) > 0 {
-		filter, err := o.getPrimaryFieldsFilter(doc, primaryFields)
-		if err != nil {
-			return nil, err
-		}
-		one, err := o.mongoFindOneEx(ctx, object.Api, findOneExOptions{
-			Fields: []string{"_id"},
-			Filter: filter,
-		})
-		if err != nil {
-			return nil, err
-		}
-		if one != nil {
-			updateId = gconv.String(one["_id"])
-		}
-	}
-	if len(updateId) > 0 {
-		// 数据更新
-		err = o.updateHandle(ctx, object.Api, updateId, doc, false)
-		if err != nil {
-			return nil, err
-		}
-		// 位置更新
-		if pos != nil {
-			err = o.moveHandle(ctx, object.Api, updateId, *pos)
-			if err != nil {
-				return nil, err
-			}
-		}
-		return o.graphqlMutationQueryOne(ctx, p, object, updateId)
-	} else {
-		// 数据新建
-		objectId, err := o.insertHandle(ctx, object.Api, doc, pos)
-		if err != nil {
-			return nil, err
-		}
-		return o.graphqlMutationQueryOne(ctx, p, object, objectId)
+	objectId, err := o.saveHandle(ctx, object.Api, doc, pos)
+	if err != nil {
+		return nil, err
 	}
+	return o.graphqlMutationQueryOne(ctx, p, object, objectId)
 }
 
 func (o *Objectql) graphqlMutationSaveArgumentValidate(object *Object, args map[string]interface{}) error {
@@ -996,24 +1116,7 @@ func (o *Objectql) graphqlMutationUpdateResolver(ctx context.Context, p graphql.
 		return nil, err
 	}
 	doc := formatNullValue(p.Args["doc"].(map[string]interface{}))
-	// 找出需要被修改的id数组
-	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
-		Fields: []string{"_id"},
-		Filter: filter,
-	})
-	if err != nil {
-		return nil, err
-	}
-	// 使用事务来进行操作
-	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
-		for _, item := range list {
-			err := o.updateHandleRaw(ctx, object.Api, gconv.String(item["_id"]), doc, false)
-			if err != nil {
-				return nil, err
-			}
-		}
-		return nil, nil
-	})
+	err = o.updateManyHandle(ctx, object.Api, filter, doc)
 	if err != nil {
 		return nil, err
 	}
@@ -1045,7 +1148,7 @@ func (o *Objectql) graphqlMutationUpdateByIdResolver(ctx context.Context, p grap
 		m, ok2 := p.Args["doc"].(map[string]interface{})
 		if ok2 {
 			m = formatNullValue(m)
-			err := o.updateHandle(ctx, object.Api, objectId, m, false)
+			err := o.updateHandle(ctx, object.Api, objectId, withExpectVersion(m, gconv.Int(p.Args["__v"])), false)
 			if err != nil {
 				return nil, err
 			}
@@ -1134,24 +1237,7 @@ func (o *Objectql) graphqlMutationDeleteResolver(ctx context.Context, p graphql.
 	if err != nil {
 		return false, err
 	}
-	// 查询出要被删除的数据
-	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
-		Fields: []string{"_id"},
-		Filter: filter,
-	})
-	if err != nil {
-		return false, err
-	}
-	// 使用事务来进行操作
-	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
-		for _, item := range list {
-			err := o.deleteHandleRaw(ctx, object.Api, gconv.String(item["_id"]))
-			if err != nil {
-				return false, err
-			}
-		}
-		return false, nil
-	})
+	err = o.deleteManyHandle(ctx, object.Api, filter)
 	if err != nil {
 		return false, err
 	}
@@ -1180,6 +1266,32 @@ func (o *Objectql) graphqlMutationDeleteArgumentValidate(object *Object, args ma
 	return nil
 }
 
+func (o *Objectql) graphqlMutationRestoreResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	args := formatNullValue(p.Args)
+	objectId := gconv.String(args["_id"])
+	if len(objectId) == 0 {
+		return false, fmt.Errorf(`mutation %s__restore method arg "_id" can't be empty`, object.Api)
+	}
+	err := o.restoreHandle(ctx, object.Api, objectId)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (o *Objectql) graphqlMutationPurgeResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	args := formatNullValue(p.Args)
+	objectId := gconv.String(args["_id"])
+	if len(objectId) == 0 {
+		return false, fmt.Errorf(`mutation %s__purge method arg "_id" can't be empty`, object.Api)
+	}
+	err := o.purgeHandle(ctx, object.Api, objectId)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (o *Objectql) getObjectBeforeValues(ctx context.Context, object *Object, id string) (beforeValues map[string]interface{}, err error) {
 	apis := getObjectRelationObjectApis(object)
 	if len(apis) > 0 {
@@ -1345,10 +1457,20 @@ func (o *Objectql) fieldTypeToInputGraphqlType(tpe Type) graphql.Output {
 		return graphql.Int
 	case *FloatType:
 		return graphql.Float
+	case *DecimalType:
+		return graphqlDecimal
 	case *StringType:
 		return graphql.String
 	case *DateTimeType, *DateType, *TimeType:
 		return graphql.DateTime
+	case *GeoPointType:
+		return graphqlGeoPointInput
+	case *FileType:
+		return graphqlFileInput
+	case *EmbeddedType:
+		return o.getGraphqlEmbeddedInput(n)
+	case *AnyType:
+		return graphqlAny
 	case *RelateType:
 		return graphql.String
 	case *ArrayType:
@@ -1370,16 +1492,30 @@ func (o *Objectql) getGraphqlFieldType(tpe Type) graphql.Output {
 		return graphql.Int
 	case *FloatType:
 		return graphql.Float
+	case *DecimalType:
+		return graphqlDecimal
 	case *StringType:
 		return graphql.String
 	case *DateTimeType, *DateType, *TimeType:
 		return graphql.DateTime
+	case *GeoPointType:
+		return graphqlGeoPoint
+	case *FileType:
+		return graphqlFile
+	case *EmbeddedType:
+		return o.getGraphqlEmbeddedObject(n)
+	case *AnyType:
+		return graphqlAny
 	case *RelateType:
 		return graphql.String
 	case *ExpandType:
 		return o.getGraphqlObject(n.ObjectApi)
 	case *ExpandsType:
 		return graphql.NewList(o.getGraphqlObject(n.ObjectApi))
+	case *ManyToManyType:
+		return graphql.NewList(o.getGraphqlObject(n.ObjectApi))
+	case *RelatedListType:
+		return graphql.NewList(o.getGraphqlObject(n.Object))
 	case *ObjectIDType:
 		return graphql.String
 	case *FormulaType:
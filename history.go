@@ -0,0 +1,338 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type HistoryKind = string
+
+const (
+	HistoryInsert  HistoryKind = "insert"
+	HistoryUpdate  HistoryKind = "update"
+	HistoryDelete  HistoryKind = "delete"
+	HistoryMove    HistoryKind = "move"
+	HistoryRestore HistoryKind = "restore" // 从回收站恢复
+)
+
+var graphqlHistoryChange = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlHistoryChange",
+	Fields: graphql.Fields{
+		"field":  &graphql.Field{Type: graphql.String},
+		"before": &graphql.Field{Type: graphqlAny},
+		"after":  &graphql.Field{Type: graphqlAny},
+	},
+})
+
+var graphqlHistory = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlHistory",
+	Fields: graphql.Fields{
+		"_id":        &graphql.Field{Type: graphql.String},
+		"version":    &graphql.Field{Type: graphql.Int},
+		"kind":       &graphql.Field{Type: graphql.String},
+		"operator":   &graphql.Field{Type: graphqlAny},
+		"createTime": &graphql.Field{Type: graphql.DateTime},
+		"changes":    &graphql.Field{Type: graphql.NewList(graphqlHistoryChange)},
+	},
+})
+
+// 历史记录存放在对象自己的集合中
+func getHistoryTable(object *Object) string {
+	return object.Api + "__history"
+}
+
+// FindHistory 查询记录的修改历史, 按版本从小到大排列
+func (o *Objectql) FindHistory(ctx context.Context, objectApi string, id string) ([]*Var, error) {
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.findHistoryHandle(ctx, object, id)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Var
+	for _, item := range list {
+		result = append(result, NewVar(item))
+	}
+	return result, nil
+}
+
+// RestoreVersion 把记录恢复到指定版本时的状态, 走正常的修改流程
+func (o *Objectql) RestoreVersion(ctx context.Context, objectApi string, id string, version int) error {
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return err
+	}
+	if len(id) == 0 {
+		return errors.New("id can't empty")
+	}
+	if !object.History {
+		return fmt.Errorf("object %s not enable history", object.Api)
+	}
+	list, err := o.findHistoryEntries(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// 从第一个版本开始重放到指定版本
+	var snapshot M
+	found := false
+	for _, item := range list {
+		if gconv.Int(item["version"]) > version {
+			break
+		}
+		found = gconv.Int(item["version"]) == version
+		if item["kind"] == HistoryDelete {
+			snapshot = nil
+			continue
+		}
+		if snapshot == nil {
+			snapshot = M{}
+		}
+		for _, c := range gconv.Interfaces(item["changes"]) {
+			change := c.(bson.M)
+			field := gconv.String(change["field"])
+			if isNull(change["after"]) {
+				delete(snapshot, field)
+			} else {
+				snapshot[field] = change["after"]
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("not found %s record %s version %d", object.Api, id, version)
+	}
+	if snapshot == nil {
+		return fmt.Errorf("%s record %s was deleted at version %d", object.Api, id, version)
+	}
+	current, err := o.queryHistorySnapshot(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("%s record %s not exists", object.Api, id)
+	}
+	// 只修改有差异的字段, 排序位置和拥有者不恢复
+	doc := M{}
+	for _, field := range object.Fields {
+		if !isHistoryField(field) || field.Api == "__index" || field.Api == "owner" {
+			continue
+		}
+		if reflect.DeepEqual(current[field.Api], snapshot[field.Api]) {
+			continue
+		}
+		value, err := o.formatValueWithFieldType(field.Type, removePrimitiveTypes(snapshot[field.Api]))
+		if err != nil {
+			return err
+		}
+		doc[field.Api] = value
+	}
+	if len(doc) == 0 {
+		return nil
+	}
+	return o.updateHandle(ctx, object.Api, id, doc, false)
+}
+
+func (o *Objectql) findHistoryHandle(ctx context.Context, object *Object, id string) ([]M, error) {
+	// 对象权限校验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.findHistoryEntries(ctx, object, id)
+	if err != nil {
+		return nil, err
+	}
+	var result []M
+	for _, item := range list {
+		var changes []M
+		for _, c := range gconv.Interfaces(item["changes"]) {
+			change := c.(bson.M)
+			fapi := gconv.String(change["field"])
+			field := FindFieldFromObject(object, fapi)
+			if field == nil {
+				continue
+			}
+			// 没有查询权限的字段不返回
+			has, err := o.hasObjectFieldPermission(ctx, object.Api, fapi, FieldQuery)
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				continue
+			}
+			before, err := o.formatValueWithFieldType(field.Type, removePrimitiveTypes(change["before"]))
+			if err != nil {
+				return nil, err
+			}
+			after, err := o.formatValueWithFieldType(field.Type, removePrimitiveTypes(change["after"]))
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, M{
+				"field":  fapi,
+				"before": before,
+				"after":  after,
+			})
+		}
+		result = append(result, M{
+			"_id":        gconv.String(item["recordId"]),
+			"version":    gconv.Int(item["version"]),
+			"kind":       gconv.String(item["kind"]),
+			"operator":   removePrimitiveTypes(item["operator"]),
+			"createTime": gconv.Time(item["createTime"]),
+			"changes":    changes,
+		})
+	}
+	return result, nil
+}
+
+func (o *Objectql) findHistoryEntries(ctx context.Context, object *Object, id string) ([]bson.M, error) {
+	if !object.History {
+		return nil, nil
+	}
+	// 只能查询当前租户的记录的历史
+	filter := M{"recordId": id}
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		filter[tenantFieldApi] = tenant[tenantFieldApi]
+	}
+	list, err := o.driver.Find(ctx, getHistoryTable(object), filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return gconv.Int(list[i]["version"]) < gconv.Int(list[j]["version"])
+	})
+	return list, nil
+}
+
+// 查询记录当前的数据, 用于修改后对比差异
+func (o *Objectql) queryHistorySnapshot(ctx context.Context, object *Object, id string) (bson.M, error) {
+	if !object.History {
+		return nil, nil
+	}
+	return o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+}
+
+// 对比修改前后的数据写入历史记录, 没有变化的不记录
+func (o *Objectql) writeHistory(ctx context.Context, object *Object, id string, kind HistoryKind, before bson.M) error {
+	if !object.History {
+		return nil
+	}
+	var after bson.M
+	if kind != HistoryDelete {
+		var err error
+		after, err = o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	var changes []M
+	for _, field := range object.Fields {
+		if !isHistoryField(field) {
+			continue
+		}
+		b, a := before[field.Api], after[field.Api]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		changes = append(changes, M{
+			"field":  field.Api,
+			"before": b,
+			"after":  a,
+		})
+	}
+	if len(changes) == 0 && kind != HistoryDelete {
+		return nil
+	}
+	entry := M{
+		"recordId":   id,
+		"kind":       kind,
+		"changes":    changes,
+		"createTime": time.Now(),
+	}
+	// 记录所属的租户, 删除后也能按租户查询
+	if object.Tenant && o.tenantMode == TenantField {
+		if after != nil {
+			entry[tenantFieldApi] = after[tenantFieldApi]
+		} else {
+			entry[tenantFieldApi] = before[tenantFieldApi]
+		}
+	}
+	if len(o.operatorObject) > 0 && o.getOperator != nil {
+		operator, err := o.getOperator(ctx)
+		if err != nil {
+			return err
+		}
+		entry["operator"] = operator
+	}
+	// recordId + version 有唯一索引, 并发写入的版本重复时报错
+	// 数据库事务中报错后事务已经失败, 只有 TransactionNone 模式可以重新获取版本
+	table := getHistoryTable(object)
+	var err error
+	for i := 0; ; i++ {
+		entry["version"], err = o.getNextHistoryVersion(ctx, table, id)
+		if err != nil {
+			return err
+		}
+		_, err = o.driver.Insert(ctx, table, entry)
+		if errors.Is(err, ErrDuplicateKey) && o.transactionMode == TransactionNone && i < 3 {
+			continue
+		}
+		return err
+	}
+}
+
+// 按版本倒序读取最后一条, 可以使用 recordId + version 索引
+func (o *Objectql) getNextHistoryVersion(ctx context.Context, table string, id string) (int, error) {
+	list, err := o.mongoAggregate(ctx, table, []M{
+		{"$match": M{"recordId": id}},
+		{"$sort": M{"version": -1}},
+		{"$limit": 1},
+		{"$project": M{"version": 1}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if one := readOneFromList(list); one != nil {
+		return gconv.Int(one["version"]) + 1, nil
+	}
+	return 1, nil
+}
+
+// 需要记录历史的字段, 计算字段和系统字段不记录
+func isHistoryField(field *Field) bool {
+	if field.Resolve != nil {
+		return false
+	}
+	switch field.Api {
+	case "_id", "createTime", "updateTime", "__v":
+		return false
+	}
+	switch field.Type.(type) {
+	case *FormulaType, *AggregationType, *ExpandType, *ExpandsType, *ManyToManyType, *RelatedListType:
+		return false
+	}
+	return true
+}
+
+func (o *Objectql) graphqlQueryHistoryResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	args := formatNullValue(p.Args)
+	objectId := gconv.String(args["id"])
+	if len(objectId) == 0 {
+		return nil, fmt.Errorf(`query %s__history method arg "id" can't be empty`, object.Api)
+	}
+	return o.findHistoryHandle(ctx, object, objectId)
+}
@@ -0,0 +1,216 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:    "员工",
+		Api:     "staff",
+		History: true,
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "年龄",
+				Api:  "age",
+				Type: Int,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	staff, err := oql.Insert(ctx, "staff", InsertOptions{
+		Doc:    M{"name": "老陈", "age": 50},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	id := staff.String("_id")
+	_, err = oql.UpdateById(ctx, "staff", UpdateByIdOptions{
+		ID:  id,
+		Doc: M{"name": "陈师傅"},
+	})
+	if err != nil {
+		t.Error("修改员工失败", err)
+		return
+	}
+	// 没有变化的修改不记录
+	_, err = oql.UpdateById(ctx, "staff", UpdateByIdOptions{
+		ID:  id,
+		Doc: M{"name": "陈师傅"},
+	})
+	if err != nil {
+		t.Error("修改员工失败", err)
+		return
+	}
+	_, err = oql.UpdateById(ctx, "staff", UpdateByIdOptions{
+		ID:  id,
+		Doc: M{"age": nil},
+	})
+	if err != nil {
+		t.Error("修改员工失败", err)
+		return
+	}
+	history, err := oql.FindHistory(ctx, "staff", id)
+	if err != nil {
+		t.Error("查询历史失败", err)
+		return
+	}
+	if len(history) != 3 {
+		t.Error("历史记录数量错误", len(history))
+		return
+	}
+	if history[0].String("kind") != HistoryInsert || len(history[0].Any("changes").([]M)) != 2 {
+		t.Error("新建历史记录错误", history[0].ToStrAnyMap())
+		return
+	}
+	changes := history[1].Any("changes").([]M)
+	if history[1].Int("version") != 2 || len(changes) != 1 || changes[0]["before"] != "老陈" || changes[0]["after"] != "陈师傅" {
+		t.Error("修改历史记录错误", history[1].ToStrAnyMap())
+		return
+	}
+
+	// 恢复到第一个版本
+	err = oql.RestoreVersion(ctx, "staff", id, 1)
+	if err != nil {
+		t.Error("恢复版本失败", err)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "staff", FindOneByIdOptions{ID: id, Fields: []string{"name", "age"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one.String("name") != "老陈" || one.Int("age") != 50 {
+		t.Error("恢复版本结果错误", one.ToStrAnyMap())
+		return
+	}
+	history, err = oql.FindHistory(ctx, "staff", id)
+	if err != nil {
+		t.Error("查询历史失败", err)
+		return
+	}
+	if len(history) != 4 || history[3].String("kind") != HistoryUpdate {
+		t.Error("恢复版本没有记录历史", len(history))
+		return
+	}
+	// graphql 查询
+	res := oql.Do(ctx, `{ staff__history(id: "`+id+`") { version kind } }`)
+	items, _ := NewVar(res.Data).Any("staff__history").([]any)
+	if res.HasErrors() || len(items) != 4 || NewVar(items[3]).Int("version") != 4 {
+		t.Error("graphql 查询历史错误", res.Errors, res.Data)
+		return
+	}
+
+	err = oql.DeleteById(ctx, "staff", DeleteByIdOptions{ID: id})
+	if err != nil {
+		t.Error("删除员工失败", err)
+		return
+	}
+	history, err = oql.FindHistory(ctx, "staff", id)
+	if err != nil {
+		t.Error("查询历史失败", err)
+		return
+	}
+	if len(history) != 5 || history[4].String("kind") != HistoryDelete {
+		t.Error("删除没有记录历史", len(history))
+		return
+	}
+	err = oql.RestoreVersion(ctx, "staff", id, 5)
+	if err == nil {
+		t.Error("已删除的版本不能恢复")
+	}
+}
+
+// 读不到最新版本的驱动, 模拟并发写入时读到了相同的版本
+type staleHistoryDriver struct {
+	*MemoryDriver
+	stale int
+}
+
+func (d *staleHistoryDriver) Aggregate(ctx context.Context, table string, pipeline []M) ([]M, error) {
+	if table == "staff__history" && d.stale > 0 {
+		d.stale--
+		return nil, nil
+	}
+	return d.MemoryDriver.Aggregate(ctx, table, pipeline)
+}
+
+func TestHistoryVersion(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []TransactionMode{TransactionNone, TransactionSession} {
+		driver := &staleHistoryDriver{MemoryDriver: NewMemoryDriver()}
+		oql := New(ObjectqlOptiosn{IndexMode: IndexModeApply, TransactionMode: mode})
+		oql.SetDriver(driver)
+		oql.AddObject(&Object{
+			Name:    "员工",
+			Api:     "staff",
+			History: true,
+			Fields: []*Field{
+				{
+					Name: "姓名",
+					Api:  "name",
+					Type: String,
+				},
+			},
+		})
+		err := oql.InitObjects(ctx)
+		if err != nil {
+			t.Error("初始化对象失败", err)
+			return
+		}
+		indexes, err := driver.ListIndexes(ctx, "staff__history")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		found := false
+		for _, index := range indexes {
+			found = found || index.Unique && index.Name == newIndexSpec([]string{"recordId", "version"}, true).Name
+		}
+		if !found {
+			t.Error("历史记录的版本应该有唯一索引", indexes)
+			return
+		}
+		staff, err := oql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "老陈"}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入员工失败", err)
+			return
+		}
+		id := staff.String("_id")
+		driver.stale = 1
+		_, err = oql.UpdateById(ctx, "staff", UpdateByIdOptions{ID: id, Doc: M{"name": "陈师傅"}})
+		// 数据库事务中版本重复时报错
+		if mode == TransactionSession {
+			if !errors.Is(err, ErrDuplicateKey) {
+				t.Error("事务中版本重复时应该报错", err)
+			}
+			continue
+		}
+		// 没有数据库事务时重新获取版本
+		if err != nil {
+			t.Error("修改员工失败", err)
+			return
+		}
+		list, err := oql.FindHistory(ctx, "staff", id)
+		if err != nil || len(list) != 2 || list[0].Int("version") != 1 || list[1].Int("version") != 2 {
+			t.Error("历史记录的版本错误", err, list)
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// objectql 创建的索引都带有这个前缀, 其他索引不会被修改
+const managedIndexPrefix = "oql_"
+
+type IndexMode int
+
+const (
+	IndexModeNone   IndexMode = iota // 不处理索引
+	IndexModeReport                  // 启动时只报告差异
+	IndexModeApply                   // 启动时创建缺失的索引并删除多余的索引
+)
+
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// 全文索引字段的权重
+	Weights map[string]int
+}
+
+type IndexDiff struct {
+	Object string
+	Create []IndexSpec
+	Drop   []IndexSpec
+}
+
+// IndexDriver 支持索引管理的驱动
+type IndexDriver interface {
+	ListIndexes(ctx context.Context, table string) ([]IndexSpec, error)
+	CreateIndex(ctx context.Context, table string, index IndexSpec) error
+	DropIndex(ctx context.Context, table string, name string) error
+}
+
+func (o *Objectql) SetIndexMode(mode IndexMode) {
+	o.indexMode = mode
+}
+
+// DiffIndexes 对比对象定义需要的索引和数据库中已有的索引
+func (o *Objectql) DiffIndexes(ctx context.Context) ([]*IndexDiff, error) {
+	driver, ok := o.driver.(IndexDriver)
+	if !ok {
+		return nil, fmt.Errorf("driver %T not support index manage", o.driver)
+	}
+	var result []*IndexDiff
+	for _, table := range o.getManagedIndexes() {
+		exists, err := driver.ListIndexes(ctx, table.name)
+		if err != nil {
+			return nil, err
+		}
+		diff := diffObjectIndexes(table.name, table.indexes, exists)
+		if len(diff.Create) > 0 || len(diff.Drop) > 0 {
+			result = append(result, diff)
+		}
+	}
+	return result, nil
+}
+
+type managedIndexes struct {
+	name    string
+	indexes []IndexSpec
+}
+
+// 对象的集合和回收站等内部集合需要的索引
+func (o *Objectql) getManagedIndexes() []managedIndexes {
+	var result []managedIndexes
+	var recycle []IndexSpec
+	for _, object := range o.list {
+		result = append(result, managedIndexes{name: object.Api, indexes: getObjectIndexes(object)})
+		// 历史记录按记录查询, 版本不能重复
+		if object.History {
+			result = append(result, managedIndexes{
+				name:    getHistoryTable(object),
+				indexes: []IndexSpec{newIndexSpec([]string{"recordId", "version"}, true)},
+			})
+		}
+		// 回收站中的记录引用的文件
+		for _, field := range object.Fields {
+			if isFileFieldType(field.Type) {
+				recycle = append(recycle, newIndexSpec([]string{"doc." + field.Api + ".id"}, false))
+			}
+		}
+	}
+	result = append(result, managedIndexes{name: recycleCollection, indexes: uniqueIndexSpecs(recycle)})
+	return result
+}
+
+// SyncIndexes 应用 DiffIndexes 的差异, 返回被应用的差异
+func (o *Objectql) SyncIndexes(ctx context.Context) ([]*IndexDiff, error) {
+	diffs, err := o.DiffIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	driver := o.driver.(IndexDriver)
+	for _, diff := range diffs {
+		// 先删除再创建, 同名索引修改定义时需要
+		for _, index := range diff.Drop {
+			err = driver.DropIndex(ctx, diff.Object, index.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, index := range diff.Create {
+			err = driver.CreateIndex(ctx, diff.Object, index)
+			if err != nil {
+				return nil, fmt.Errorf("create index %s.%s error: %s", diff.Object, index.Name, err.Error())
+			}
+		}
+	}
+	return diffs, nil
+}
+
+func (o *Objectql) initIndexes(ctx context.Context) error {
+	switch o.indexMode {
+	case IndexModeReport:
+		diffs, err := o.DiffIndexes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, diff := range diffs {
+			g.Log().Warning(ctx, "objectql index diff:", diff.String())
+		}
+	case IndexModeApply:
+		_, err := o.SyncIndexes(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *IndexDiff) String() string {
+	var arr []string
+	for _, index := range d.Create {
+		arr = append(arr, "+"+index.String())
+	}
+	for _, index := range d.Drop {
+		arr = append(arr, "-"+index.String())
+	}
+	return d.Object + ": " + strings.Join(arr, ", ")
+}
+
+func (i IndexSpec) String() string {
+	var keys []string
+	for _, e := range i.Keys {
+		keys = append(keys, fmt.Sprintf("%s:%v", e.Key, e.Value))
+	}
+	result := i.Name + "{" + strings.Join(keys, ",") + "}"
+	if i.Unique {
+		result += " unique"
+	}
+	if len(i.Weights) > 0 {
+		result += fmt.Sprintf(" weights%v", i.Weights)
+	}
+	return result
+}
+
+// 根据对象定义推导需要的索引
+func getObjectIndexes(object *Object) []IndexSpec {
+	var result []IndexSpec
+	// 主键
+	var primarys []string
+	for _, field := range object.getPrimaryFields() {
+		primarys = append(primarys, field.Api)
+	}
+	if len(primarys) > 0 {
+		// 租户对象的主键只在租户内唯一
+		if object.Tenant {
+			primarys = append([]string{tenantFieldApi}, primarys...)
+		}
+		result = append(result, newIndexSpec(primarys, true))
+	}
+	// 排序对象
+	if object.Index {
+		result = append(result, newIndexSpec(append(append([]string{}, object.IndexGroup...), "__index"), false))
+	}
+	// 关联字段, DeleteSync 也是通过关联字段查询
+	for _, field := range object.Fields {
+		if IsRelateType(field.Type) {
+			result = append(result, newIndexSpec([]string{field.Api}, false))
+		}
+	}
+	// 文件字段, 回收文件和下载鉴权时按文件 id 查询
+	for _, field := range object.Fields {
+		if isFileFieldType(field.Type) {
+			result = append(result, newIndexSpec([]string{field.Api + ".id"}, false))
+		}
+	}
+	// 地理位置
+	result = append(result, getGeoIndexes(object)...)
+	// 全文搜索, 每个集合只能有一个全文索引
+	if hasSearchableField(object) {
+		result = append(result, newTextIndexSpec(object))
+	}
+	return uniqueIndexSpecs(result)
+}
+
+// 去掉重复的索引
+func uniqueIndexSpecs(list []IndexSpec) []IndexSpec {
+	var unique []IndexSpec
+	for _, index := range list {
+		exist := false
+		for _, item := range unique {
+			if item.Name == index.Name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			unique = append(unique, index)
+		}
+	}
+	return unique
+}
+
+func newIndexSpec(fields []string, unique bool) IndexSpec {
+	keys := bson.D{}
+	var names []string
+	for _, f := range fields {
+		keys = append(keys, bson.E{Key: f, Value: 1})
+		names = append(names, f+"_1")
+	}
+	name := managedIndexPrefix + strings.Join(names, "_")
+	if unique {
+		name += "_unique"
+	}
+	return IndexSpec{
+		Name:   name,
+		Keys:   keys,
+		Unique: unique,
+	}
+}
+
+func diffObjectIndexes(object string, wants []IndexSpec, exists []IndexSpec) *IndexDiff {
+	diff := &IndexDiff{Object: object}
+	existMap := map[string]IndexSpec{}
+	for _, index := range exists {
+		existMap[index.Name] = index
+	}
+	wantMap := map[string]bool{}
+	for _, index := range wants {
+		wantMap[index.Name] = true
+		exist, ok := existMap[index.Name]
+		if !ok {
+			diff.Create = append(diff.Create, index)
+			continue
+		}
+		if !isSameIndex(exist, index) {
+			diff.Drop = append(diff.Drop, exist)
+			diff.Create = append(diff.Create, index)
+		}
+	}
+	for _, index := range exists {
+		if strings.HasPrefix(index.Name, managedIndexPrefix) && !wantMap[index.Name] {
+			diff.Drop = append(diff.Drop, index)
+		}
+	}
+	sort.SliceStable(diff.Drop, func(i, j int) bool {
+		return diff.Drop[i].Name < diff.Drop[j].Name
+	})
+	return diff
+}
+
+func isSameIndex(a, b IndexSpec) bool {
+	if a.Unique != b.Unique || len(a.Keys) != len(b.Keys) || len(a.Weights) != len(b.Weights) {
+		return false
+	}
+	for k, v := range a.Weights {
+		if b.Weights[k] != v {
+			return false
+		}
+	}
+	for i := range a.Keys {
+		if a.Keys[i].Key != b.Keys[i].Key || gconv.String(a.Keys[i].Value) != gconv.String(b.Keys[i].Value) {
+			return false
+		}
+	}
+	return true
+}
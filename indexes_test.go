@@ -0,0 +1,107 @@
+package objectql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSyncIndexes(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	oql := New()
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name:    "编号",
+				Api:     "code",
+				Type:    String,
+				Primary: true,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:       "学生",
+		Api:        "student",
+		Index:      true,
+		IndexGroup: []string{"class"},
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name:       "班级",
+				Api:        "class",
+				Type:       NewRelate("class"),
+				DeleteSync: true,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	// 无关的索引不会被删除, 过期的托管索引会被删除
+	err = driver.CreateIndex(ctx, "student", IndexSpec{Name: "name_1", Keys: bson.D{{Key: "name", Value: 1}}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = driver.CreateIndex(ctx, "student", IndexSpec{Name: "oql_age_1", Keys: bson.D{{Key: "age", Value: 1}}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	diffs, err := oql.DiffIndexes(ctx)
+	if err != nil {
+		t.Error("对比索引失败", err)
+		return
+	}
+	report := map[string]string{}
+	for _, diff := range diffs {
+		report[diff.Object] = diff.String()
+	}
+	if !strings.Contains(report["class"], "+oql_code_1_unique{code:1} unique") {
+		t.Error("缺少主键索引", report["class"])
+	}
+	for _, want := range []string{"+oql_class_1___index_1{class:1,__index:1}", "+oql_class_1{class:1}", "-oql_age_1{age:1}"} {
+		if !strings.Contains(report["student"], want) {
+			t.Error("学生索引差异不正确", want, report["student"])
+		}
+	}
+	if strings.Contains(report["student"], "-name_1") {
+		t.Error("不应该删除非托管的索引", report["student"])
+	}
+	_, err = oql.SyncIndexes(ctx)
+	if err != nil {
+		t.Error("同步索引失败", err)
+		return
+	}
+	diffs, err = oql.DiffIndexes(ctx)
+	if err != nil {
+		t.Error("对比索引失败", err)
+		return
+	}
+	if len(diffs) != 0 {
+		t.Error("同步后仍存在差异", diffs[0].String())
+		return
+	}
+	// 唯一索引生效
+	_, err = oql.Insert(ctx, "class", InsertOptions{Doc: map[string]any{"code": "c1"}})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	_, err = oql.Insert(ctx, "class", InsertOptions{Doc: map[string]any{"code": "c1"}})
+	if err == nil || !strings.Contains(err.Error(), "primary duplicate") {
+		t.Error("主键重复没有报错", err)
+	}
+}
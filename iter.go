@@ -0,0 +1,151 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+)
+
+// Iter 逐条读取查询结果, 使用完需要调用 Close
+type Iter struct {
+	ctx    context.Context
+	o      *Objectql
+	object *Object
+	fields []string
+	cursor Cursor
+	cur    *Var
+	err    error
+}
+
+// FindIter 流式查询, 字段权限和 expand 的行为和 FindList 一致
+func (o *Objectql) FindIter(ctx context.Context, objectApi string, options FindIterOptions) (*Iter, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := o.getFindAllPipeline(ctx, object, findAllExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+		Top:    options.Top,
+		Skip:   options.Skip,
+		Sort:   options.Sort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var cursor Cursor
+	if driver, ok := o.driver.(CursorDriver); ok {
+		cursor, err = driver.AggregateCursor(ctx, object.Api, pipeline, options.BatchSize)
+	} else {
+		var list []M
+		list, err = o.mongoAggregate(ctx, object.Api, pipeline)
+		cursor = &listCursor{list: list, index: -1}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Iter{
+		ctx:    ctx,
+		o:      o,
+		object: object,
+		fields: options.Fields,
+		cursor: cursor,
+	}, nil
+}
+
+// FindEach 逐条处理查询结果, fn 返回 ErrStopIteration 时提前结束
+func (o *Objectql) FindEach(ctx context.Context, objectApi string, options FindIterOptions, fn func(item *Var) error) error {
+	iter, err := o.FindIter(ctx, objectApi, options)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Next() {
+		err = fn(iter.Var())
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (it *Iter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.cursor.Next(it.ctx) {
+		it.err = it.cursor.Err()
+		it.cur = nil
+		return false
+	}
+	var item M
+	err := it.cursor.Decode(&item)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	list, err := it.o.formatFindAllResult(it.object, []M{item})
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.cur, it.err = it.o.queryResultToVar(it.ctx, it.object, list[0], it.fields)
+	return it.err == nil
+}
+
+// Var 当前的记录
+func (it *Iter) Var() *Var {
+	return it.cur
+}
+
+func (it *Iter) Err() error {
+	return it.err
+}
+
+func (it *Iter) Close() error {
+	return it.cursor.Close(it.ctx)
+}
+
+// 驱动不支持游标时使用的游标
+type listCursor struct {
+	list  []M
+	index int
+}
+
+func (c *listCursor) Next(ctx context.Context) bool {
+	if c.index+1 >= len(c.list) {
+		return false
+	}
+	c.index++
+	return true
+}
+
+func (c *listCursor) Decode(v interface{}) error {
+	p, ok := v.(*M)
+	if !ok {
+		return fmt.Errorf("listCursor can't decode to %T", v)
+	}
+	*p = c.list[c.index]
+	return nil
+}
+
+func (c *listCursor) Err() error {
+	return nil
+}
+
+func (c *listCursor) Close(ctx context.Context) error {
+	c.list = nil
+	return nil
+}
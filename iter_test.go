@@ -0,0 +1,117 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFindIter(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "分数",
+				Api:  "score",
+				Type: Int,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	class, err := oql.Insert(ctx, "class", InsertOptions{
+		Doc:    M{"name": "一班"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	for _, doc := range []M{
+		{"name": "张三", "score": 3},
+		{"name": "李四", "score": 1},
+		{"name": "王五", "score": 2},
+	} {
+		doc["class"] = class.String("_id")
+		_, err = oql.Insert(ctx, "student", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入学生失败", err)
+			return
+		}
+	}
+
+	iter, err := oql.FindIter(ctx, "student", FindIterOptions{
+		Fields:    []string{"name", "class__expand.name"},
+		Sort:      []string{"-score"},
+		BatchSize: 1,
+	})
+	if err != nil {
+		t.Error("查询失败", err)
+		return
+	}
+	var names []string
+	for iter.Next() {
+		item := iter.Var()
+		names = append(names, item.String("name"))
+		if item.Var("class__expand").String("name") != "一班" {
+			t.Error("关联查询结果错误", item.ToStrAnyMap())
+		}
+	}
+	if iter.Err() != nil {
+		t.Error("遍历失败", iter.Err())
+		return
+	}
+	iter.Close()
+	if strings.Join(names, ",") != "张三,王五,李四" {
+		t.Error("遍历结果错误", names)
+		return
+	}
+
+	// 提前结束
+	count := 0
+	err = oql.FindEach(ctx, "student", FindIterOptions{Fields: []string{"name"}}, func(item *Var) error {
+		count++
+		return ErrStopIteration
+	})
+	if err != nil || count != 1 {
+		t.Error("提前结束失败", err, count)
+		return
+	}
+	// 回调的错误原样返回
+	errBreak := errors.New("break")
+	err = oql.FindEach(ctx, "student", FindIterOptions{}, func(item *Var) error {
+		return errBreak
+	})
+	if err != errBreak {
+		t.Error("期望返回回调的错误", err)
+	}
+}
@@ -49,6 +49,16 @@ const (
 	kIndexMoveBefore
 	kIndexMoveAfter
 	kIndexChange
+
+	// BULK
+	kInsertManyBefore
+	kInsertManyAfter
+	kUpdateManyBefore
+	kUpdateManyAfter
+
+	// LINK
+	kLinkAdd
+	kLinkRemove
 )
 
 type InsertBeforeHandler = func(ctx context.Context, doc *Var) error
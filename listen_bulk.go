@@ -0,0 +1,89 @@
+package objectql
+
+import "context"
+
+// BULK
+// 批量接口中每条记录仍然会触发单条的事件, 批量事件在整批处理前后各触发一次
+
+type InsertManyBeforeHandler = func(ctx context.Context, docs []*Var) error
+type InsertManyAfterHandler = func(ctx context.Context, ids []string, docs []*Var) error
+type UpdateManyBeforeHandler = func(ctx context.Context, ids []string, docs []*Var) error
+type UpdateManyAfterHandler = func(ctx context.Context, ids []string, docs []*Var) error
+
+func (o *Objectql) ListenInsertManyBefore(table string, fn InsertManyBeforeHandler) {
+	o.listen(table, kInsertManyBefore, fn)
+}
+
+func (o *Objectql) ListenInsertManyAfter(table string, fn InsertManyAfterHandler) {
+	o.listen(table, kInsertManyAfter, fn)
+}
+
+func (o *Objectql) ListenUpdateManyBefore(table string, fn UpdateManyBeforeHandler) {
+	o.listen(table, kUpdateManyBefore, fn)
+}
+
+func (o *Objectql) ListenUpdateManyAfter(table string, fn UpdateManyAfterHandler) {
+	o.listen(table, kUpdateManyAfter, fn)
+}
+
+func (o *Objectql) UnListenInsertManyBefore(table string, fn InsertManyBeforeHandler) {
+	o.unListen(table, kInsertManyBefore, fn)
+}
+
+func (o *Objectql) UnListenInsertManyAfter(table string, fn InsertManyAfterHandler) {
+	o.unListen(table, kInsertManyAfter, fn)
+}
+
+func (o *Objectql) UnListenUpdateManyBefore(table string, fn UpdateManyBeforeHandler) {
+	o.unListen(table, kUpdateManyBefore, fn)
+}
+
+func (o *Objectql) UnListenUpdateManyAfter(table string, fn UpdateManyAfterHandler) {
+	o.unListen(table, kUpdateManyAfter, fn)
+}
+
+// TRIGGER
+
+func (o *Objectql) triggerInsertManyBefore(ctx context.Context, table string, docs []*Var) error {
+	ctx = o.WithRootPermission(ctx)
+	for _, handle := range o.getEventHanders(ctx, table, kInsertManyBefore) {
+		err := handle.(InsertManyBeforeHandler)(ctx, docs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) triggerInsertManyAfter(ctx context.Context, table string, ids []string, docs []*Var) error {
+	ctx = o.WithRootPermission(ctx)
+	for _, handle := range o.getEventHanders(ctx, table, kInsertManyAfter) {
+		err := handle.(InsertManyAfterHandler)(ctx, ids, docs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) triggerUpdateManyBefore(ctx context.Context, table string, ids []string, docs []*Var) error {
+	ctx = o.WithRootPermission(ctx)
+	for _, handle := range o.getEventHanders(ctx, table, kUpdateManyBefore) {
+		err := handle.(UpdateManyBeforeHandler)(ctx, ids, docs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) triggerUpdateManyAfter(ctx context.Context, table string, ids []string, docs []*Var) error {
+	ctx = o.WithRootPermission(ctx)
+	for _, handle := range o.getEventHanders(ctx, table, kUpdateManyAfter) {
+		err := handle.(UpdateManyAfterHandler)(ctx, ids, docs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -90,6 +90,8 @@ func isFieldValueEqual(tpe Type, v1 *Var, v2 *Var) (bool, error) {
 		return v1.ToInt() == v2.ToInt(), nil
 	case *FloatType:
 		return v1.ToFloat32() == v2.ToFloat32(), nil
+	case *DecimalType:
+		return isDecimalValueEqual(v1.ToAny(), v2.ToAny())
 	case *StringType:
 		return v1.ToString() == v2.ToString(), nil
 	case *BoolType:
@@ -98,6 +100,14 @@ func isFieldValueEqual(tpe Type, v1 *Var, v2 *Var) (bool, error) {
 		return v1.ToString() == v2.ToString(), nil
 	case *DateTimeType, *DateType, *TimeType:
 		return v1.ToTime().Equal(v2.ToTime()), nil
+	case *GeoPointType:
+		return v1.Float64("lng") == v2.Float64("lng") && v1.Float64("lat") == v2.Float64("lat"), nil
+	case *FileType:
+		return isFileValueEqual(v1, v2), nil
+	case *EmbeddedType:
+		return isEmbeddedValueEqual(n, v1, v2)
+	case *AnyType:
+		return isAnyValueEqual(v1.ToAny(), v2.ToAny())
 	case *ArrayType:
 		return isArrayFieldValueEqual(n.Type, v1, v2)
 	case *FormulaType:
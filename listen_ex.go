@@ -78,7 +78,10 @@ func (o *Objectql) triggerInsertAfterEx(ctx context.Context, table string, id st
 	ctx = o.WithRootPermission(ctx)
 	for _, handle := range o.getEventHanders(ctx, table, kInsertAfterEx) {
 		ins := handle.(*InsertAfterExHandler)
-		return ins.Handle(ctx, id, doc, entity)
+		err := ins.Handle(ctx, id, doc, entity)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -87,7 +90,10 @@ func (o *Objectql) triggerUpdateBeforeEx(ctx context.Context, table string, id s
 	ctx = o.WithRootPermission(ctx)
 	for _, handle := range o.getEventHanders(ctx, table, kUpdateBeforeEx) {
 		ins := handle.(*UpdateBeforeExHandler)
-		return ins.Handle(ctx, id, doc, entity)
+		err := ins.Handle(ctx, id, doc, entity)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -96,7 +102,10 @@ func (o *Objectql) triggerUpdateAfterEx(ctx context.Context, table string, id st
 	ctx = o.WithRootPermission(ctx)
 	for _, handle := range o.getEventHanders(ctx, table, kUpdateAfterEx) {
 		ins := handle.(*UpdateAfterExHandler)
-		return ins.Handle(ctx, id, doc, entity)
+		err := ins.Handle(ctx, id, doc, entity)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -105,7 +114,10 @@ func (o *Objectql) triggerDeleteBeforeEx(ctx context.Context, table string, id s
 	ctx = o.WithRootPermission(ctx)
 	for _, handle := range o.getEventHanders(ctx, table, kDeleteBeforeEx) {
 		ins := handle.(*DeleteBeforeExHandler)
-		return ins.Handle(ctx, id, entity)
+		err := ins.Handle(ctx, id, entity)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -114,7 +126,10 @@ func (o *Objectql) triggerDeleteAfterEx(ctx context.Context, table string, id st
 	ctx = o.WithRootPermission(ctx)
 	for _, handle := range o.getEventHanders(ctx, table, kDeleteAfterEx) {
 		ins := handle.(*DeleteAfterExHandler)
-		return ins.Handle(ctx, id, entity)
+		err := ins.Handle(ctx, id, entity)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -3,6 +3,7 @@ package objectql
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -163,3 +164,109 @@ func TestDeleteAfterEx(t *testing.T) {
 	// 	return
 	// }
 }
+
+func TestMultipleExHandlers(t *testing.T) {
+	ctx := context.Background()
+	objectql := New()
+	objectql.SetDriver(NewMemoryDriver())
+	objectql.AddObject(&Object{
+		Name: "员工",
+		Api:  "staff",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := objectql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	var calls []string
+	for _, name := range []string{"a", "b"} {
+		name := name
+		objectql.ListenInsertAfterEx("staff", &InsertAfterExHandler{
+			Fields: []string{"name"},
+			Handle: func(ctx context.Context, id string, doc *Var, entity *Var) error {
+				calls = append(calls, "insertAfter:"+name)
+				return nil
+			},
+		})
+		objectql.ListenUpdateBeforeEx("staff", &UpdateBeforeExHandler{
+			Fields: []string{"name"},
+			Handle: func(ctx context.Context, id string, doc *Var, entity *Var) error {
+				calls = append(calls, "updateBefore:"+name)
+				return nil
+			},
+		})
+		objectql.ListenUpdateAfterEx("staff", &UpdateAfterExHandler{
+			Fields: []string{"name"},
+			Handle: func(ctx context.Context, id string, doc *Var, entity *Var) error {
+				calls = append(calls, "updateAfter:"+name)
+				return nil
+			},
+		})
+		objectql.ListenDeleteBeforeEx("staff", &DeleteBeforeExHandler{
+			Fields: []string{"name"},
+			Handle: func(ctx context.Context, id string, entity *Var) error {
+				calls = append(calls, "deleteBefore:"+name)
+				return nil
+			},
+		})
+		objectql.ListenDeleteAfterEx("staff", &DeleteAfterExHandler{
+			Fields: []string{"name"},
+			Handle: func(ctx context.Context, id string, entity *Var) error {
+				calls = append(calls, "deleteAfter:"+name)
+				return nil
+			},
+		})
+	}
+	staff, err := objectql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "小龙"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	_, err = objectql.UpdateById(ctx, "staff", UpdateByIdOptions{ID: staff.String("_id"), Doc: M{"name": "小虎"}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	err = objectql.DeleteById(ctx, "staff", DeleteByIdOptions{ID: staff.String("_id")})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	except := []string{
+		"insertAfter:a", "insertAfter:b",
+		"updateBefore:a", "updateBefore:b",
+		"updateAfter:a", "updateAfter:b",
+		"deleteBefore:a", "deleteBefore:b",
+		"deleteAfter:a", "deleteAfter:b",
+	}
+	if strings.Join(calls, ",") != strings.Join(except, ",") {
+		t.Error("每个监听都应该被调用", calls)
+		return
+	}
+	// 前面的监听返回错误时不再调用后面的监听
+	calls = nil
+	objectql.ListenInsertAfterEx("staff", &InsertAfterExHandler{
+		Fields: []string{"name"},
+		Handle: func(ctx context.Context, id string, doc *Var, entity *Var) error {
+			return errors.New("禁止创建")
+		},
+	})
+	objectql.ListenInsertAfterEx("staff", &InsertAfterExHandler{
+		Fields: []string{"name"},
+		Handle: func(ctx context.Context, id string, doc *Var, entity *Var) error {
+			calls = append(calls, "insertAfter:c")
+			return nil
+		},
+	})
+	_, err = objectql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "小明"}})
+	if err == nil || err.Error() != "禁止创建" || len(calls) != 2 {
+		t.Error("except error '禁止创建'", err, calls)
+	}
+}
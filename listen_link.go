@@ -0,0 +1,42 @@
+package objectql
+
+import (
+	"context"
+)
+
+// LinkChangeHandler 多对多关联的增加和删除, Field 为空时监听对象的所有多对多字段
+type LinkChangeHandler struct {
+	Field  string
+	Handle func(ctx context.Context, id string, targetId string) error
+}
+
+func (o *Objectql) ListenLinkAdd(table string, handle *LinkChangeHandler) {
+	o.listen(table, kLinkAdd, handle)
+}
+
+func (o *Objectql) ListenLinkRemove(table string, handle *LinkChangeHandler) {
+	o.listen(table, kLinkRemove, handle)
+}
+
+func (o *Objectql) UnListenLinkAdd(table string, handle *LinkChangeHandler) {
+	o.unListen(table, kLinkAdd, handle)
+}
+
+func (o *Objectql) UnListenLinkRemove(table string, handle *LinkChangeHandler) {
+	o.unListen(table, kLinkRemove, handle)
+}
+
+func (o *Objectql) triggerLinkChange(ctx context.Context, kind eventKind, table string, fieldApi string, id string, targetId string) error {
+	ctx = o.WithRootPermission(ctx)
+	for _, handle := range o.getEventHanders(ctx, table, kind) {
+		ins := handle.(*LinkChangeHandler)
+		if len(ins.Field) > 0 && ins.Field != fieldApi {
+			continue
+		}
+		err := ins.Handle(ctx, id, targetId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
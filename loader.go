@@ -0,0 +1,132 @@
+package objectql
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// expand 批量加载 (DataLoader)
+// 数据源中没有 __expand 数据时(自定义 resolve 的字段或 handle 返回的记录), 逐行查询会产生 N+1 问题
+// resolver 只收集 _id 并返回 thunk, graphql 在同一层级的字段都执行完成后再执行 thunk,
+// 第一个 thunk 执行时对收集到的 _id 进行一次 $in 查询
+type expandLoaderKey struct{}
+
+type expandLoader struct {
+	mu      sync.Mutex
+	batches map[string]*expandBatch
+}
+
+type expandBatch struct {
+	key    string
+	object string
+	fields []string
+	ids    []primitive.ObjectID
+	once   sync.Once
+	docs   []M
+	err    error
+}
+
+// 每个请求使用独立的 loader, 查询使用请求的 ctx (权限, 租户, 事务)
+func withExpandLoader(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(expandLoaderKey{}).(*expandLoader); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, expandLoaderKey{}, &expandLoader{
+		batches: map[string]*expandBatch{},
+	})
+}
+
+func (o *Objectql) loadExpands(ctx context.Context, object string, fields []string, ids []primitive.ObjectID) func() ([]M, error) {
+	// 排序需要用到 _id
+	if lo.IndexOf(fields, "_id") == -1 {
+		fields = append(fields, "_id")
+	}
+	fields = lo.Uniq(fields)
+	sort.Strings(fields)
+	key := object + ":" + strings.Join(fields, ",")
+
+	var batch *expandBatch
+	loader, ok := ctx.Value(expandLoaderKey{}).(*expandLoader)
+	if ok {
+		loader.mu.Lock()
+		batch = loader.batches[key]
+		if batch == nil {
+			batch = &expandBatch{key: key, object: object, fields: fields}
+			loader.batches[key] = batch
+		}
+		batch.ids = append(batch.ids, ids...)
+		loader.mu.Unlock()
+	} else {
+		batch = &expandBatch{key: key, object: object, fields: fields, ids: ids}
+	}
+	return func() ([]M, error) {
+		batch.once.Do(func() {
+			o.runExpandBatch(ctx, loader, batch)
+		})
+		if batch.err != nil {
+			return nil, batch.err
+		}
+		var result []M
+		for _, doc := range batch.docs {
+			if lo.Contains(ids, toObjectId(doc["_id"])) {
+				result = append(result, doc)
+			}
+		}
+		return sortByObjectIDs(result, ids), nil
+	}
+}
+
+func (o *Objectql) runExpandBatch(ctx context.Context, loader *expandLoader, batch *expandBatch) {
+	// 开始查询后新收集的 _id 进入下一批
+	if loader != nil {
+		loader.mu.Lock()
+		if loader.batches[batch.key] == batch {
+			delete(loader.batches, batch.key)
+		}
+		loader.mu.Unlock()
+	}
+	ids := lo.Uniq(batch.ids)
+	if len(ids) == 0 {
+		return
+	}
+	batch.docs, batch.err = o.mongoFindAllEx(ctx, batch.object, findAllExOptions{
+		Filter: M{"_id": M{"$in": ids}},
+		Fields: batch.fields,
+	})
+}
+
+// 关联字段的值, 关联字段自定义了 resolve 时使用 resolve 的结果
+func (o *Objectql) getExpandSourceIds(field *Field, source M) ([]primitive.ObjectID, error) {
+	value := source[field.valueApi]
+	if relate := field.Parent.getField(field.valueApi); relate != nil && relate.Resolve != nil {
+		var err error
+		value, err = relate.Resolve(source)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var result []primitive.ObjectID
+	for _, item := range toExpandValues(value) {
+		if id := toObjectId(item); !id.IsZero() {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+func toExpandValues(value any) []any {
+	switch n := value.(type) {
+	case primitive.ObjectID, string:
+		return []any{n}
+	}
+	if isNull(value) {
+		return nil
+	}
+	return gconv.Interfaces(value)
+}
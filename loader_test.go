@@ -0,0 +1,151 @@
+package objectql
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 统计每张表的查询次数
+type countQueryDriver struct {
+	*MemoryDriver
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (d *countQueryDriver) count(table string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counts[table]++
+}
+
+func (d *countQueryDriver) Find(ctx context.Context, table string, filter M, projection M) ([]bson.M, error) {
+	d.count(table)
+	return d.MemoryDriver.Find(ctx, table, filter, projection)
+}
+
+func (d *countQueryDriver) Aggregate(ctx context.Context, table string, pipeline []M) ([]M, error) {
+	d.count(table)
+	return d.MemoryDriver.Aggregate(ctx, table, pipeline)
+}
+
+func TestExpandLoader(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	driver := &countQueryDriver{MemoryDriver: NewMemoryDriver(), counts: map[string]int{}}
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name: "部门",
+		Api:  "dept",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "员工",
+		Api:  "user",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "部门",
+				Api:  "dept",
+				Type: NewRelate("dept"),
+			},
+			{
+				Name: "协作部门",
+				Api:  "depts",
+				Type: NewArrayType(NewRelate("dept")),
+			},
+			// 动态计算的关联字段, 数据源中没有 __expand 数据
+			{
+				Name:   "上级部门",
+				Api:    "leaderDept",
+				Type:   NewRelate("dept"),
+				Fields: []string{"dept"},
+				Resolve: func(source map[string]any) (interface{}, error) {
+					return source["dept"], nil
+				},
+			},
+			{
+				Name:   "相关部门",
+				Api:    "relatedDepts",
+				Type:   NewArrayType(NewRelate("dept")),
+				Fields: []string{"depts"},
+				Resolve: func(source map[string]any) (interface{}, error) {
+					return source["depts"], nil
+				},
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	var deptIds []string
+	for _, name := range []string{"研发", "测试", "运维"} {
+		dept, err := oql.Insert(ctx, "dept", InsertOptions{Doc: M{"name": name}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入部门失败", err)
+			return
+		}
+		deptIds = append(deptIds, dept.String("_id"))
+	}
+	for i := 0; i < 6; i++ {
+		_, err := oql.Insert(ctx, "user", InsertOptions{Doc: M{
+			"name":  gconv.String(i),
+			"dept":  deptIds[i%3],
+			"depts": []string{deptIds[(i+2)%3], deptIds[i%3]},
+		}})
+		if err != nil {
+			t.Error("插入员工失败", err)
+			return
+		}
+	}
+	driver.counts = map[string]int{}
+	res := oql.Do(ctx, `{
+		user__findList {
+			name
+			leaderDept__expand { name }
+			relatedDepts__expands { _id name }
+		}
+	}`)
+	if res.HasErrors() {
+		t.Error("查询失败", res.Errors)
+		return
+	}
+	if driver.counts["dept"] != 1 {
+		t.Error("同一层级的部门应该只查询一次", driver.counts)
+	}
+	list, _ := res.Data.(map[string]any)["user__findList"].([]any)
+	if len(list) != 6 {
+		t.Error("查询结果数量错误", len(list))
+		return
+	}
+	names := []string{"研发", "测试", "运维"}
+	for _, raw := range list {
+		item := NewVar(raw)
+		i := item.Int("name")
+		if item.Var("leaderDept__expand").String("name") != names[i%3] {
+			t.Error("展开的部门错误", item)
+			return
+		}
+		// 保持原来的顺序
+		related, _ := item.Any("relatedDepts__expands").([]any)
+		if len(related) != 2 || NewVar(related[0]).String("_id") != deptIds[(i+2)%3] || NewVar(related[1]).String("_id") != deptIds[i%3] {
+			t.Error("展开的部门顺序错误", item)
+			return
+		}
+	}
+}
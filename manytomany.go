@@ -0,0 +1,510 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 多对多关联
+// ManyToManyType 的关联关系保存在中间对象中, 每条中间记录有两个 relate 字段, 分别关联两边的记录
+// 没有指定中间对象时生成 <对象>__<字段>, 两个字段都开启了 DeleteSync, 删除任意一边的记录都会删除关联
+// 查询时和 __expands 一样展开为关联对象的列表(tags.name), 设置 Reverse 后关联对象上也可以反向查询
+// 通过 AddLinks/RemoveLinks 或 <对象>__<字段>__add/remove 修改关联, 关联的增删可以用 ListenLinkAdd/ListenLinkRemove 监听
+// AggregationType 的 Relate 为多对多字段时经过中间对象统计
+
+// 解析后的中间对象, source 关联当前对象, target 关联目标对象
+type manyToManyLink struct {
+	through *Object
+	source  *Field
+	target  *Field
+}
+
+// 目标对象
+func (l *manyToManyLink) targetApi() string {
+	return l.target.Type.(*RelateType).ObjectApi
+}
+
+func (l *manyToManyLink) reverse() *manyToManyLink {
+	return &manyToManyLink{through: l.through, source: l.target, target: l.source}
+}
+
+// 生成中间对象和反向字段, 在 InitObjects 的最开始调用
+func (o *Objectql) initManyToManyFields() error {
+	for _, object := range append([]*Object{}, o.list...) {
+		for _, field := range append([]*Field{}, object.Fields...) {
+			n, ok := field.Type.(*ManyToManyType)
+			if !ok || n.link != nil {
+				continue
+			}
+			target := o.GetObject(n.ObjectApi)
+			if target == nil {
+				return fmt.Errorf("%s.%s many to many object %s not found", object.Api, field.Api, n.ObjectApi)
+			}
+			if len(n.Through) == 0 {
+				n.Through = object.Api + "__" + field.Api
+				n.SourceField, n.TargetField = "source", "target"
+				if o.GetObject(n.Through) == nil {
+					o.AddObject(newManyToManyThroughObject(object, field, target, n))
+					o.objectMap = nil
+				}
+			}
+			link, err := o.resolveManyToManyLink(object, field, n)
+			if err != nil {
+				return err
+			}
+			n.link = link
+			o.listenManyToManyLinks(object, field, link)
+			if len(n.Reverse) == 0 {
+				continue
+			}
+			if FindFieldFromObject(target, n.Reverse) != nil {
+				return fmt.Errorf("%s.%s many to many reverse field %s.%s already exists", object.Api, field.Api, target.Api, n.Reverse)
+			}
+			reverse := &Field{
+				Name: field.Name,
+				Api:  n.Reverse,
+				Type: &ManyToManyType{
+					ObjectApi:   object.Api,
+					Through:     n.Through,
+					SourceField: n.TargetField,
+					TargetField: n.SourceField,
+					link:        link.reverse(),
+				},
+			}
+			target.Fields = append(target.Fields, reverse)
+			o.listenManyToManyLinks(target, reverse, link.reverse())
+		}
+	}
+	return nil
+}
+
+func newManyToManyThroughObject(object *Object, field *Field, target *Object, n *ManyToManyType) *Object {
+	return &Object{
+		Name:   object.Name + field.Name,
+		Api:    n.Through,
+		Tenant: object.Tenant,
+		Fields: []*Field{
+			{
+				Name:       object.Name,
+				Api:        n.SourceField,
+				Type:       NewRelate(object.Api),
+				Primary:    true,
+				DeleteSync: true,
+			},
+			{
+				Name:       target.Name,
+				Api:        n.TargetField,
+				Type:       NewRelate(target.Api),
+				Primary:    true,
+				DeleteSync: true,
+			},
+		},
+	}
+}
+
+// 用户指定的中间对象没有设置字段时, 按照关联的对象查找
+func (o *Objectql) resolveManyToManyLink(object *Object, field *Field, n *ManyToManyType) (*manyToManyLink, error) {
+	through := o.GetObject(n.Through)
+	if through == nil {
+		return nil, fmt.Errorf("%s.%s many to many through object %s not found", object.Api, field.Api, n.Through)
+	}
+	find := func(api string, objectApi string, exclude string) (*Field, error) {
+		for _, f := range through.Fields {
+			relate, ok := f.Type.(*RelateType)
+			if !ok || relate.ObjectApi != objectApi || f.Api == exclude {
+				continue
+			}
+			if len(api) == 0 || f.Api == api {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("%s.%s many to many through object %s has no relate field to %s", object.Api, field.Api, through.Api, objectApi)
+	}
+	source, err := find(n.SourceField, object.Api, n.TargetField)
+	if err != nil {
+		return nil, err
+	}
+	target, err := find(n.TargetField, n.ObjectApi, source.Api)
+	if err != nil {
+		return nil, err
+	}
+	n.SourceField, n.TargetField = source.Api, target.Api
+	return &manyToManyLink{through: through, source: source, target: target}, nil
+}
+
+// 中间对象的增删转换为关联的增删事件
+func (o *Objectql) listenManyToManyLinks(object *Object, field *Field, link *manyToManyLink) {
+	fields := []string{link.source.Api, link.target.Api}
+	o.ListenInsertAfterEx(link.through.Api, &InsertAfterExHandler{
+		Fields: fields,
+		Handle: func(ctx context.Context, id string, doc *Var, cur *Var) error {
+			return o.triggerLinkChange(ctx, kLinkAdd, object.Api, field.Api, cur.String(link.source.Api), cur.String(link.target.Api))
+		},
+	})
+	o.ListenDeleteAfterEx(link.through.Api, &DeleteAfterExHandler{
+		Fields: fields,
+		Handle: func(ctx context.Context, id string, cur *Var) error {
+			return o.triggerLinkChange(ctx, kLinkRemove, object.Api, field.Api, cur.String(link.source.Api), cur.String(link.target.Api))
+		},
+	})
+}
+
+func getManyToManyLink(object *Object, fieldApi string) (*manyToManyLink, error) {
+	field := FindFieldFromObject(object, fieldApi)
+	if field == nil {
+		return nil, fmt.Errorf("not found field %s in object %s", fieldApi, object.Api)
+	}
+	n, ok := field.Type.(*ManyToManyType)
+	if !ok || n.link == nil {
+		return nil, fmt.Errorf("%s.%s is not many to many field", object.Api, fieldApi)
+	}
+	return n.link, nil
+}
+
+// 查询中间对象, 展开关联的记录
+func (o *Objectql) getManyToManyLookupStages(ctx context.Context, n *ManyToManyType, fieldsMap map[string]interface{}, parentKey string, key string) ([]map[string]interface{}, error) {
+	link := n.link
+	if link == nil {
+		return nil, fmt.Errorf("generateLookupStages error: many to many field %s not init", key)
+	}
+	linksKey := parentKey + key + "__links"
+	stages := []map[string]interface{}{
+		{
+			"$lookup": map[string]interface{}{
+				"from":         link.through.Api,
+				"localField":   parentKey + "_id",
+				"foreignField": link.source.Api,
+				"as":           linksKey,
+			},
+		},
+	}
+	pipeline := []map[string]interface{}{
+		{
+			"$match": M{
+				"$expr": M{
+					"$in": []any{"$_id", "$$ids"},
+				},
+			},
+		},
+	}
+	// 关联的对象只查询当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, o.GetObject(n.ObjectApi))
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$match": tenant,
+		})
+	}
+	if err := o.generateLookupStages(ctx, fieldsMap, n.ObjectApi, "", &pipeline); err != nil {
+		return nil, err
+	}
+	stages = append(stages, map[string]interface{}{
+		"$lookup": map[string]interface{}{
+			"from": n.ObjectApi,
+			"let": M{
+				"ids": M{
+					"$ifNull": []any{"$" + linksKey + "." + link.target.Api, []any{}},
+				},
+			},
+			"pipeline": pipeline,
+			"as":       parentKey + key,
+		},
+	})
+	return stages, nil
+}
+
+// AddLinks 增加多对多关联, 已经存在的关联会被忽略
+func (o *Objectql) AddLinks(ctx context.Context, objectApi string, options LinkOptions) error {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return err
+	}
+	if len(options.ID) == 0 {
+		return errors.New("id can't empty")
+	}
+	return o.addLinksHandle(ctx, object, options.Field, options.ID, options.IDs)
+}
+
+// RemoveLinks 删除多对多关联
+func (o *Objectql) RemoveLinks(ctx context.Context, objectApi string, options LinkOptions) error {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return err
+	}
+	if len(options.ID) == 0 {
+		return errors.New("id can't empty")
+	}
+	return o.removeLinksHandle(ctx, object, options.Field, options.ID, options.IDs)
+}
+
+func (o *Objectql) addLinksHandle(ctx context.Context, object *Object, fieldApi string, id string, ids []string) error {
+	link, err := getManyToManyLink(object, fieldApi)
+	if err != nil {
+		return err
+	}
+	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		exists, err := o.findLinkTargets(ctx, object, link, id, ids)
+		if err != nil {
+			return nil, err
+		}
+		// 关联的记录必须存在
+		targetIds, err := toObjectIds(lo.Uniq(ids))
+		if err != nil {
+			return nil, err
+		}
+		filter := M{"_id": M{"$in": targetIds}}
+		tenant, err := o.getTenantFilter(ctx, o.GetObject(link.targetApi()))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range tenant {
+			filter[k] = v
+		}
+		count, err := o.mongoCount(ctx, link.targetApi(), filter)
+		if err != nil {
+			return nil, err
+		}
+		if int(count) != len(targetIds) {
+			return nil, fmt.Errorf("%s.%s link target not found", object.Api, fieldApi)
+		}
+		// 中间对象由关联字段的权限控制
+		rctx := o.WithRootPermission(ctx)
+		for _, targetId := range lo.Uniq(ids) {
+			if exists[targetId] != "" {
+				continue
+			}
+			_, err = o.insertHandleRaw(rctx, link.through.Api, M{
+				link.source.Api: id,
+				link.target.Api: targetId,
+			}, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+func (o *Objectql) removeLinksHandle(ctx context.Context, object *Object, fieldApi string, id string, ids []string) error {
+	link, err := getManyToManyLink(object, fieldApi)
+	if err != nil {
+		return err
+	}
+	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		exists, err := o.findLinkTargets(ctx, object, link, id, ids)
+		if err != nil {
+			return nil, err
+		}
+		rctx := o.WithRootPermission(ctx)
+		for _, targetId := range lo.Uniq(ids) {
+			if exists[targetId] == "" {
+				continue
+			}
+			err = o.deleteHandleRaw(rctx, link.through.Api, exists[targetId])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// 校验权限和记录, 返回已经存在的关联 目标id => 中间记录id
+func (o *Objectql) findLinkTargets(ctx context.Context, object *Object, link *manyToManyLink, id string, ids []string) (map[string]string, error) {
+	err := o.checkObjectPermission(ctx, object.Api, ObjectUpdate)
+	if err != nil {
+		return nil, err
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := o.isTenantRecord(ctx, object, id)
+	if err != nil {
+		return nil, err
+	}
+	count, err := o.mongoCount(ctx, object.Api, bson.M{"_id": objectId})
+	if err != nil {
+		return nil, err
+	}
+	if !ok || count == 0 {
+		return nil, fmt.Errorf("%s record %s not exists", object.Api, id)
+	}
+	targetIds, err := toObjectIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.mongoFindAll(ctx, link.through.Api, bson.M{
+		link.source.Api: objectId,
+		link.target.Api: bson.M{"$in": targetIds},
+	}, "_id,"+link.target.Api)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for _, item := range list {
+		result[item[link.target.Api].(primitive.ObjectID).Hex()] = item["_id"].(primitive.ObjectID).Hex()
+	}
+	return result, nil
+}
+
+func toObjectIds(ids []string) ([]primitive.ObjectID, error) {
+	var result []primitive.ObjectID
+	for _, id := range ids {
+		objectId, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objectId)
+	}
+	return result, nil
+}
+
+// 多对多统计, 返回的中间对象 source 关联统计字段所在的对象, target 关联被统计的对象
+func (o *Objectql) getAggregationLink(object *Object, adata *AggregationType) *manyToManyLink {
+	if relate, err := FindFieldFromName(o.list, adata.Object, adata.Relate); err == nil {
+		if n, ok := relate.Type.(*ManyToManyType); ok && n.ObjectApi == object.Api && n.link != nil {
+			return n.link.reverse()
+		}
+		return nil
+	}
+	if field := FindFieldFromObject(object, adata.Relate); field != nil {
+		if n, ok := field.Type.(*ManyToManyType); ok && n.ObjectApi == adata.Object && n.link != nil {
+			return n.link
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) parseManyToManyAggregationField(object *Object, field *Field, link *manyToManyLink) error {
+	adata := field.Type.(*AggregationType)
+	adata.link = link
+	adata.resolved = link.target
+	// 关联的增删和修改
+	link.source.relations = append(link.source.relations, &relationFiledInfo{
+		ThroughField: link.source,
+		TargetField:  field,
+	})
+	link.target.relations = append(link.target.relations, &relationFiledInfo{
+		ThroughField: link.source,
+		TargetField:  field,
+	})
+	// 被统计的字段和条件相关的字段
+	apis := []string{adata.Field}
+	getMatchReferenceFields(&apis, adata.Filter)
+	for _, api := range apis {
+		if strings.Contains(api, ".") {
+			return fmt.Errorf("%s.%s aggregation filter can't contains expand(s) field", object.Api, field.Api)
+		}
+		ff, err := FindFieldFromName(o.list, adata.Object, api)
+		if err != nil {
+			return err
+		}
+		ff.relations = append(ff.relations, &relationFiledInfo{
+			ThroughField: link.target,
+			TargetField:  field,
+		})
+	}
+	return nil
+}
+
+// 被统计的记录修改后, 重新计算所有关联的记录
+func (o *Objectql) manyToManyAggregationHandler(ctx context.Context, id string, info *relationFiledInfo) error {
+	adata := info.TargetField.Type.(*AggregationType)
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	list, err := o.mongoFindAll(ctx, adata.link.through.Api, bson.M{adata.link.target.Api: objectId}, adata.link.source.Api)
+	if err != nil {
+		return err
+	}
+	for _, item := range list {
+		sourceId, ok := item[adata.link.source.Api].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		err = o.aggregateField(ctx, info.TargetField.Parent, sourceId.Hex(), info.TargetField)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 统计的记录范围: 通过中间对象关联的记录
+func (o *Objectql) getManyToManyAggregationMatch(ctx context.Context, adata *AggregationType, id primitive.ObjectID) (bson.M, error) {
+	list, err := o.mongoFindAll(ctx, adata.link.through.Api, bson.M{adata.link.source.Api: id}, adata.link.target.Api)
+	if err != nil {
+		return nil, err
+	}
+	ids := bson.A{}
+	for _, item := range list {
+		if !isNull(item[adata.link.target.Api]) {
+			ids = append(ids, item[adata.link.target.Api])
+		}
+	}
+	return bson.M{"_id": bson.M{"$in": ids}}, nil
+}
+
+func (o *Objectql) initObjectGraphqlLinkMutation(mutations graphql.Fields, object *Object) {
+	for _, field := range object.Fields {
+		if !IsManyToManyType(field.Type) {
+			continue
+		}
+		fieldApi := field.Api
+		args := graphql.FieldConfigArgument{
+			"_id": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "对象id",
+			},
+			"ids": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Description: "关联对象id",
+			},
+		}
+		mutations[object.Api+"__"+fieldApi+"__add"] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: args,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := o.addLinksHandle(p.Context, object, fieldApi, gconv.String(p.Args["_id"]), gconv.Strings(p.Args["ids"]))
+				return err == nil, err
+			},
+		}
+		mutations[object.Api+"__"+fieldApi+"__remove"] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: args,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				err := o.removeLinksHandle(p.Context, object, fieldApi, gconv.String(p.Args["_id"]), gconv.Strings(p.Args["ids"]))
+				return err == nil, err
+			},
+		}
+	}
+}
+
+func (o *Objectql) getManyToManyFieldType(objectApi string, fieldApi string) (*ManyToManyType, bool) {
+	object := o.GetObject(objectApi)
+	if object == nil {
+		return nil, false
+	}
+	field := FindFieldFromObject(object, fieldApi)
+	if field == nil {
+		return nil, false
+	}
+	n, ok := field.Type.(*ManyToManyType)
+	return n, ok
+}
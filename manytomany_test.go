@@ -0,0 +1,207 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManyToMany(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "文章",
+		Api:  "post",
+		Fields: []*Field{
+			{
+				Name: "标题",
+				Api:  "title",
+				Type: String,
+			},
+			{
+				Name: "阅读量",
+				Api:  "views",
+				Type: Int,
+			},
+			{
+				Name: "标签",
+				Api:  "tags",
+				Type: &ManyToManyType{
+					ObjectApi: "tag",
+					Reverse:   "posts",
+				},
+			},
+			{
+				Name: "标签权重",
+				Api:  "tagWeight",
+				Type: &AggregationType{
+					Object: "tag",
+					Relate: "tags",
+					Field:  "weight",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "标签",
+		Api:  "tag",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "权重",
+				Api:  "weight",
+				Type: Int,
+			},
+			{
+				Name: "总阅读量",
+				Api:  "totalViews",
+				Type: &AggregationType{
+					Object: "post",
+					Relate: "posts",
+					Field:  "views",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	if oql.GetObject("post__tags") == nil {
+		t.Error("应该生成中间对象")
+		return
+	}
+	var added, removed []string
+	oql.ListenLinkAdd("post", &LinkChangeHandler{
+		Field: "tags",
+		Handle: func(ctx context.Context, id string, targetId string) error {
+			added = append(added, id+":"+targetId)
+			return nil
+		},
+	})
+	oql.ListenLinkRemove("tag", &LinkChangeHandler{
+		Handle: func(ctx context.Context, id string, targetId string) error {
+			removed = append(removed, id+":"+targetId)
+			return nil
+		},
+	})
+	var tagIds []string
+	for _, doc := range []M{{"name": "go", "weight": 1}, {"name": "db", "weight": 2}, {"name": "web", "weight": 4}} {
+		tag, err := oql.Insert(ctx, "tag", InsertOptions{Doc: doc, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入标签失败", err)
+			return
+		}
+		tagIds = append(tagIds, tag.String("_id"))
+	}
+	post, err := oql.Insert(ctx, "post", InsertOptions{Doc: M{"title": "objectql", "views": 10}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入文章失败", err)
+		return
+	}
+	postId := post.String("_id")
+	_, err = oql.Insert(ctx, "post", InsertOptions{Doc: M{"title": "other", "tags": []string{tagIds[0]}}})
+	if err == nil {
+		t.Error("多对多字段不能直接写入")
+		return
+	}
+	err = oql.AddLinks(ctx, "post", LinkOptions{Field: "tags", ID: postId, IDs: []string{tagIds[0], tagIds[1], tagIds[0]}})
+	if err != nil {
+		t.Error("增加关联失败", err)
+		return
+	}
+	// 已经存在的关联会被忽略
+	err = oql.AddLinks(ctx, "post", LinkOptions{Field: "tags", ID: postId, IDs: []string{tagIds[1]}})
+	if err != nil || len(added) != 2 || added[0] != postId+":"+tagIds[0] {
+		t.Error("关联的增加事件错误", err, added)
+		return
+	}
+	err = oql.AddLinks(ctx, "post", LinkOptions{Field: "tags", ID: postId, IDs: []string{postId}})
+	if err == nil {
+		t.Error("关联不存在的记录应该失败")
+		return
+	}
+	post, err = oql.FindOneById(ctx, "post", FindOneByIdOptions{ID: postId, Fields: []string{"tags.name", "tagWeight"}})
+	if err != nil {
+		t.Error("查询文章失败", err)
+		return
+	}
+	tags, _ := post.Any("tags").([]any)
+	if len(tags) != 2 || NewVar(tags[0]).String("name") != "go" {
+		t.Error("多对多字段展开错误", post)
+		return
+	}
+	if post.Int("tagWeight") != 3 {
+		t.Error("经过中间对象统计错误", post)
+		return
+	}
+	// 被统计的记录修改后重新统计
+	_, err = oql.UpdateById(ctx, "tag", UpdateByIdOptions{ID: tagIds[1], Doc: M{"weight": 5}})
+	if err != nil {
+		t.Error("修改标签失败", err)
+		return
+	}
+	_, err = oql.UpdateById(ctx, "post", UpdateByIdOptions{ID: postId, Doc: M{"views": 20}})
+	if err != nil {
+		t.Error("修改文章失败", err)
+		return
+	}
+	tag, err := oql.FindOneById(ctx, "tag", FindOneByIdOptions{ID: tagIds[0], Fields: []string{"posts.title", "totalViews"}})
+	if err != nil {
+		t.Error("查询标签失败", err)
+		return
+	}
+	posts, _ := tag.Any("posts").([]any)
+	if len(posts) != 1 || NewVar(posts[0]).String("title") != "objectql" || tag.Int("totalViews") != 20 {
+		t.Error("反向查询错误", tag)
+		return
+	}
+	// 按关联对象的字段过滤
+	list, err := oql.FindList(ctx, "post", FindListOptions{Filter: M{"tags.name": "db"}, Fields: []string{"tagWeight"}})
+	if err != nil || len(list) != 1 || list[0].Int("tagWeight") != 6 {
+		t.Error("按多对多字段过滤错误", err, list)
+		return
+	}
+	// graphql
+	res := oql.Do(ctx, `mutation { post__tags__add(_id: "`+postId+`", ids: ["`+tagIds[2]+`"]) }`)
+	if res.HasErrors() {
+		t.Error("graphql 增加关联失败", res.Errors)
+		return
+	}
+	res = oql.Do(ctx, `mutation { post__tags__remove(_id: "`+postId+`", ids: ["`+tagIds[0]+`"]) }`)
+	if res.HasErrors() || len(removed) != 1 || removed[0] != tagIds[0]+":"+postId {
+		t.Error("graphql 删除关联失败", res.Errors, removed)
+		return
+	}
+	res = oql.Do(ctx, `{ post__findOneById(id: "`+postId+`") { tagWeight tags { name posts { title } } } }`)
+	post = NewVar(res.Data).Var("post__findOneById")
+	tags, _ = post.Any("tags").([]any)
+	if res.HasErrors() || len(tags) != 2 || post.Int("tagWeight") != 9 {
+		t.Error("graphql 查询多对多字段错误", res.Errors, res.Data)
+		return
+	}
+	// 删除标签时删除关联
+	err = oql.DeleteById(ctx, "tag", DeleteByIdOptions{ID: tagIds[2]})
+	if err != nil {
+		t.Error("删除标签失败", err)
+		return
+	}
+	count, err := oql.Count(ctx, "post__tags", CountOptions{})
+	if err != nil || count != 1 {
+		t.Error("删除记录后应该删除关联", err, count)
+		return
+	}
+	post, err = oql.FindOneById(ctx, "post", FindOneByIdOptions{ID: postId, Fields: []string{"tagWeight"}})
+	if err != nil || post.Int("tagWeight") != 5 {
+		t.Error("删除关联后重新统计错误", err, post)
+	}
+}
@@ -0,0 +1,601 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	schemaCollection      = "__objectql_schema"
+	migrationCollection   = "__objectql_migration"
+	migrationVersionIndex = "oql_version"
+)
+
+var errMigrationApplied = errors.New("migration already applied")
+
+type MigrationMode int
+
+const (
+	MigrationModeNone   MigrationMode = iota // 不处理迁移
+	MigrationModeDryRun                      // 启动时只报告待处理的变更
+	MigrationModeApply                       // 启动时执行迁移并保存结构快照
+)
+
+// Migration 一个版本的迁移, 按照 Version 从小到大执行且只会执行一次
+type Migration struct {
+	Version int
+	Name    string
+	Steps   []*MigrationStep
+}
+
+type MigrationStep struct {
+	Name string
+	Run  func(ctx context.Context, o *Objectql) error
+	// 处理的字段(<对象>.<字段>), 字段类型的修改和删除必须有迁移步骤处理
+	Fields []string
+}
+
+type SchemaChangeKind string
+
+const (
+	SchemaObjectAdd   SchemaChangeKind = "objectAdd"
+	SchemaFieldAdd    SchemaChangeKind = "fieldAdd"
+	SchemaFieldRemove SchemaChangeKind = "fieldRemove"
+	SchemaFieldType   SchemaChangeKind = "fieldType"
+)
+
+type SchemaChange struct {
+	Object string
+	Field  string
+	Kind   SchemaChangeKind
+	From   string
+	To     string
+}
+
+type MigrationReport struct {
+	Changes []*SchemaChange
+	Pending []*Migration
+	// 没有迁移步骤处理的字段类型修改和删除
+	Uncovered []*SchemaChange
+}
+
+func (o *Objectql) SetMigrationMode(mode MigrationMode) {
+	o.migrationMode = mode
+}
+
+func (o *Objectql) AddMigration(migration *Migration) {
+	o.migrations = append(o.migrations, migration)
+}
+
+// PendingMigrations 对比结构快照和待执行的迁移, 不修改数据库
+func (o *Objectql) PendingMigrations(ctx context.Context) (*MigrationReport, error) {
+	changes, err := o.diffSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := o.pendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	covered, err := o.getCoveredSchemaFields(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	return &MigrationReport{
+		Changes:   changes,
+		Pending:   pending,
+		Uncovered: getUncoveredSchemaChanges(changes, covered),
+	}, nil
+}
+
+// Migrate 执行待处理的迁移并保存最新的结构快照
+// 有迁移步骤没有处理的字段类型修改和删除时不执行, 避免快照接受了没有处理的数据
+func (o *Objectql) Migrate(ctx context.Context) (*MigrationReport, error) {
+	report, err := o.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Uncovered) > 0 {
+		var changes []string
+		for _, change := range report.Uncovered {
+			changes = append(changes, change.String())
+		}
+		return nil, fmt.Errorf("schema changes not covered by any migration: %s", strings.Join(changes, "; "))
+	}
+	err = o.ensureMigrationIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 结构快照和最后一个迁移在同一个事务中保存
+	saved := false
+	for i, migration := range report.Pending {
+		last := i == len(report.Pending)-1
+		_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+			err := o.runMigration(ctx, migration, report.Changes)
+			if err != nil || !last {
+				return nil, err
+			}
+			return nil, o.saveSchema(ctx)
+		})
+		// 其他实例已经执行了这个迁移
+		if errors.Is(err, errMigrationApplied) {
+			g.Log().Info(ctx, "objectql migration already applied:", migration.String())
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("migration %d(%s) error: %s", migration.Version, migration.Name, err.Error())
+		}
+		saved = last
+	}
+	if !saved {
+		err = o.saveSchema(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// MigrationHistory 已经执行过的迁移记录
+func (o *Objectql) MigrationHistory(ctx context.Context) ([]*Var, error) {
+	list, err := o.driver.Find(ctx, migrationCollection, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return gconv.Int(list[i]["version"]) < gconv.Int(list[j]["version"])
+	})
+	var result []*Var
+	for _, item := range list {
+		result = append(result, NewVar(removePrimitiveTypes(item)))
+	}
+	return result, nil
+}
+
+func (o *Objectql) initMigrations(ctx context.Context) error {
+	switch o.migrationMode {
+	case MigrationModeDryRun:
+		report, err := o.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, change := range report.Changes {
+			g.Log().Info(ctx, "objectql schema change:", change.String())
+		}
+		for _, migration := range report.Pending {
+			g.Log().Info(ctx, "objectql pending migration:", migration.String())
+		}
+		for _, change := range report.Uncovered {
+			g.Log().Warning(ctx, "objectql schema change not covered by any migration:", change.String())
+		}
+	case MigrationModeApply:
+		report, err := o.Migrate(ctx)
+		if err != nil {
+			return err
+		}
+		for _, change := range report.Changes {
+			g.Log().Info(ctx, "objectql schema change:", change.String())
+		}
+	}
+	return nil
+}
+
+// 迁移记录的版本唯一, 多个实例同时启动时只有一个能执行迁移
+func (o *Objectql) ensureMigrationIndex(ctx context.Context) error {
+	driver, ok := o.driver.(IndexDriver)
+	if !ok {
+		return nil
+	}
+	exists, err := driver.ListIndexes(ctx, migrationCollection)
+	if err != nil {
+		return err
+	}
+	for _, index := range exists {
+		if index.Name == migrationVersionIndex {
+			return nil
+		}
+	}
+	return driver.CreateIndex(ctx, migrationCollection, IndexSpec{
+		Name:   migrationVersionIndex,
+		Keys:   bson.D{{Key: "version", Value: 1}},
+		Unique: true,
+	})
+}
+
+// 迁移处理的字段, 包括待执行的迁移和快照保存之后已经执行的迁移
+// 迁移执行之后没有保存快照(例如进程退出)时, 已经执行的迁移仍然可以覆盖对应的变更
+func (o *Objectql) getCoveredSchemaFields(ctx context.Context, pending []*Migration) (map[string]bool, error) {
+	covered := map[string]bool{}
+	for _, migration := range pending {
+		for _, field := range migration.getFields() {
+			covered[field] = true
+		}
+	}
+	_, version, err := o.findSchemaSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err := o.driver.Find(ctx, migrationCollection, M{"version": M{"$gt": version}}, M{"version": 1, "fields": 1})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range history {
+		for _, field := range gconv.Strings(item["fields"]) {
+			covered[field] = true
+		}
+	}
+	return covered, nil
+}
+
+// 字段类型修改和删除需要迁移步骤处理, 新增的字段没有旧数据
+func getUncoveredSchemaChanges(changes []*SchemaChange, covered map[string]bool) []*SchemaChange {
+	var result []*SchemaChange
+	for _, change := range changes {
+		switch change.Kind {
+		case SchemaFieldType, SchemaFieldRemove:
+			if !covered[change.Object+"."+change.Field] {
+				result = append(result, change)
+			}
+		}
+	}
+	return result
+}
+
+func (o *Objectql) runMigration(ctx context.Context, migration *Migration, changes []*SchemaChange) error {
+	var steps []string
+	for _, step := range migration.Steps {
+		steps = append(steps, step.Name)
+	}
+	var changeStrs []string
+	for _, change := range changes {
+		changeStrs = append(changeStrs, change.String())
+	}
+	// 先写入迁移记录, 版本重复时不执行迁移步骤
+	_, err := o.driver.Insert(ctx, migrationCollection, M{
+		"version":    migration.Version,
+		"name":       migration.Name,
+		"steps":      steps,
+		"fields":     migration.getFields(),
+		"changes":    changeStrs,
+		"createTime": time.Now(),
+	})
+	if errors.Is(err, ErrDuplicateKey) {
+		return errMigrationApplied
+	}
+	if err != nil {
+		return err
+	}
+	for _, step := range migration.Steps {
+		err = step.Run(ctx, o)
+		if err != nil {
+			return fmt.Errorf("step %s error: %s", step.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) pendingMigrations(ctx context.Context) ([]*Migration, error) {
+	history, err := o.driver.Find(ctx, migrationCollection, nil, M{"version": 1})
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]bool{}
+	for _, item := range history {
+		applied[gconv.Int(item["version"])] = true
+	}
+	var result []*Migration
+	for _, migration := range o.migrations {
+		if !applied[migration.Version] {
+			result = append(result, migration)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	for i := 1; i < len(result); i++ {
+		if result[i].Version == result[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", result[i].Version)
+		}
+	}
+	return result, nil
+}
+
+// 结构快照和保存快照时的迁移版本
+func (o *Objectql) findSchemaSnapshots(ctx context.Context) (map[string]map[string]string, int, error) {
+	list, err := o.driver.Find(ctx, schemaCollection, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	snapshots := map[string]map[string]string{}
+	version := 0
+	for i, item := range list {
+		fields := map[string]string{}
+		for _, f := range gconv.Interfaces(item["fields"]) {
+			m := gconv.Map(f)
+			fields[gconv.String(m["api"])] = gconv.String(m["type"])
+		}
+		snapshots[gconv.String(item["object"])] = fields
+		if v := gconv.Int(item["version"]); i == 0 || v < version {
+			version = v
+		}
+	}
+	return snapshots, version, nil
+}
+
+func (o *Objectql) diffSchema(ctx context.Context) ([]*SchemaChange, error) {
+	snapshots, _, err := o.findSchemaSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []*SchemaChange
+	for _, object := range o.list {
+		before, ok := snapshots[object.Api]
+		if !ok {
+			result = append(result, &SchemaChange{Object: object.Api, Kind: SchemaObjectAdd})
+			continue
+		}
+		// 旧的快照中可能有系统字段和计算字段
+		for api := range before {
+			if field := FindFieldFromObject(object, api); isSystemSchemaField(api) || field != nil && !isSchemaField(field) {
+				delete(before, api)
+			}
+		}
+		after := getObjectSchemaFields(object)
+		for _, api := range sortedStrKeys(after) {
+			if tpe, ok := before[api]; !ok {
+				result = append(result, &SchemaChange{Object: object.Api, Field: api, Kind: SchemaFieldAdd, To: after[api]})
+			} else if tpe != after[api] {
+				result = append(result, &SchemaChange{Object: object.Api, Field: api, Kind: SchemaFieldType, From: tpe, To: after[api]})
+			}
+		}
+		for _, api := range sortedStrKeys(before) {
+			if _, ok := after[api]; !ok {
+				result = append(result, &SchemaChange{Object: object.Api, Field: api, Kind: SchemaFieldRemove, From: before[api]})
+			}
+		}
+	}
+	return result, nil
+}
+
+func (o *Objectql) saveSchema(ctx context.Context) error {
+	version := 0
+	for _, migration := range o.migrations {
+		if migration.Version > version {
+			version = migration.Version
+		}
+	}
+	for _, object := range o.list {
+		fields := getObjectSchemaFields(object)
+		var arr []M
+		for _, api := range sortedStrKeys(fields) {
+			arr = append(arr, M{"api": api, "type": fields[api]})
+		}
+		filter := M{"object": object.Api}
+		count, err := o.driver.Count(ctx, schemaCollection, filter)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			_, err = o.driver.Insert(ctx, schemaCollection, M{
+				"object":     object.Api,
+				"fields":     arr,
+				"version":    version,
+				"updateTime": time.Now(),
+			})
+		} else {
+			_, err = o.driver.UpdateMany(ctx, schemaCollection, filter, M{
+				"$set": M{
+					"fields":     arr,
+					"version":    version,
+					"updateTime": time.Now(),
+				},
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 需要迁移处理的字段及其类型, 系统字段和计算字段不需要迁移
+func getObjectSchemaFields(object *Object) map[string]string {
+	result := map[string]string{}
+	for _, field := range object.Fields {
+		if isSystemSchemaField(field.Api) || !isSchemaField(field) {
+			continue
+		}
+		result[field.Api] = getTypeSignature(field.Type)
+	}
+	return result
+}
+
+// 由对象的配置(Index, Versioned, Tenant 等)维护的字段
+func isSystemSchemaField(api string) bool {
+	switch api {
+	case "_id", "createTime", "updateTime", "owner", "__index", "__v", "__ev", tenantFieldApi:
+		return true
+	}
+	return false
+}
+
+// 公式和聚合字段的值会重新计算, 关联展开等字段不存储
+func isSchemaField(field *Field) bool {
+	if field.Resolve != nil {
+		return false
+	}
+	switch field.Type.(type) {
+	case *FormulaType, *AggregationType, *ExpandType, *ExpandsType, *ManyToManyType, *RelatedListType:
+		return false
+	}
+	return true
+}
+
+// 类型签名只关心数据在数据库中的存储形式
+func getTypeSignature(tpe Type) string {
+	switch n := tpe.(type) {
+	case *FormulaType:
+		return getTypeSignature(n.Type)
+	case *AggregationType:
+		return getTypeSignature(n.Type)
+	case *ArrayType:
+		return "Array<" + getTypeSignature(n.Type) + ">"
+	default:
+		return strings.TrimSuffix(reflect.TypeOf(tpe).Elem().Name(), "Type")
+	}
+}
+
+func sortedStrKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *SchemaChange) String() string {
+	switch c.Kind {
+	case SchemaObjectAdd:
+		return fmt.Sprintf("%s: new object", c.Object)
+	case SchemaFieldAdd:
+		return fmt.Sprintf("%s.%s: add %s", c.Object, c.Field, c.To)
+	case SchemaFieldRemove:
+		return fmt.Sprintf("%s.%s: remove %s", c.Object, c.Field, c.From)
+	default:
+		return fmt.Sprintf("%s.%s: %s -> %s", c.Object, c.Field, c.From, c.To)
+	}
+}
+
+func (m *Migration) getFields() []string {
+	var result []string
+	for _, step := range m.Steps {
+		result = append(result, step.Fields...)
+	}
+	return result
+}
+
+func (m *Migration) String() string {
+	var steps []string
+	for _, step := range m.Steps {
+		steps = append(steps, step.Name)
+	}
+	return fmt.Sprintf("%d(%s): %s", m.Version, m.Name, strings.Join(steps, ", "))
+}
+
+// STEPS
+
+// MigrateRenameField 字段改名
+func MigrateRenameField(object, from, to string) *MigrationStep {
+	return &MigrationStep{
+		Name:   fmt.Sprintf("rename %s.%s to %s", object, from, to),
+		Fields: []string{object + "." + from, object + "." + to},
+		Run: func(ctx context.Context, o *Objectql) error {
+			_, err := o.mongoUpdateMany(ctx, object, M{from: M{"$exists": true}}, M{
+				"$rename": M{from: to},
+			})
+			return err
+		},
+	}
+}
+
+// MigrateCoerceField 按照字段当前定义的类型转换已有的值
+func MigrateCoerceField(object, field string) *MigrationStep {
+	return &MigrationStep{
+		Name:   fmt.Sprintf("coerce %s.%s", object, field),
+		Fields: []string{object + "." + field},
+		Run: func(ctx context.Context, o *Objectql) error {
+			f, err := o.mustGetObjectField(object, field)
+			if err != nil {
+				return err
+			}
+			list, err := o.driver.Find(ctx, object, M{field: M{"$exists": true}}, M{field: 1})
+			if err != nil {
+				return err
+			}
+			for _, item := range list {
+				value := removePrimitiveTypes(item[field])
+				res, err := formatValueToDatabase(f.Type, value)
+				if err != nil {
+					return fmt.Errorf("coerce %v error: %s", item["_id"], err.Error())
+				}
+				if reflect.DeepEqual(res, value) {
+					continue
+				}
+				id, _ := item["_id"].(primitive.ObjectID)
+				_, err = o.mongoUpdateById(ctx, object, id.Hex(), bson.M{field: res})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// MigrateBackfillDefault 为没有值的记录填充默认值
+func MigrateBackfillDefault(object, field string, value interface{}) *MigrationStep {
+	return &MigrationStep{
+		Name:   fmt.Sprintf("backfill %s.%s", object, field),
+		Fields: []string{object + "." + field},
+		Run: func(ctx context.Context, o *Objectql) error {
+			f, err := o.mustGetObjectField(object, field)
+			if err != nil {
+				return err
+			}
+			res, err := formatValueToDatabase(f.Type, value)
+			if err != nil {
+				return err
+			}
+			_, err = o.mongoUpdateMany(ctx, object, M{field: M{"$exists": false}}, M{
+				"$set": M{field: res},
+			})
+			return err
+		},
+	}
+}
+
+// MigrateDropField 删除字段的数据
+func MigrateDropField(object, field string) *MigrationStep {
+	return &MigrationStep{
+		Name:   fmt.Sprintf("drop %s.%s", object, field),
+		Fields: []string{object + "." + field},
+		Run: func(ctx context.Context, o *Objectql) error {
+			_, err := o.mongoUpdateMany(ctx, object, M{field: M{"$exists": true}}, M{
+				"$unset": M{field: 1},
+			})
+			return err
+		},
+	}
+}
+
+// MigrateFunc 自定义的迁移步骤, fields 为处理的字段(<对象>.<字段>)
+func MigrateFunc(name string, fn func(ctx context.Context, o *Objectql) error, fields ...string) *MigrationStep {
+	return &MigrationStep{
+		Name:   name,
+		Run:    fn,
+		Fields: fields,
+	}
+}
+
+func (o *Objectql) mustGetObjectField(object, field string) (*Field, error) {
+	obj, err := o.MustGetObject(object)
+	if err != nil {
+		return nil, err
+	}
+	f := FindFieldFromObject(obj, field)
+	if f == nil {
+		return nil, fmt.Errorf("not found field '%s.%s'", object, field)
+	}
+	return f, nil
+}
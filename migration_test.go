@@ -0,0 +1,380 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	// 旧版本的结构和数据
+	_, err := driver.Insert(ctx, schemaCollection, M{
+		"object": "student",
+		"fields": []M{
+			{"api": "name", "type": "String"},
+			{"api": "age", "type": "Int"},
+			{"api": "nick", "type": "String"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = driver.Insert(ctx, "student", M{"name": "张三", "age": 18, "nick": "小张"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	oql := New(ObjectqlOptiosn{MigrationMode: MigrationModeDryRun})
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{Name: "姓名", Api: "name", Type: String},
+			{Name: "年龄", Api: "age", Type: Float},
+			{Name: "昵称", Api: "nickname", Type: String},
+			{Name: "年级", Api: "grade", Type: Int},
+		},
+	})
+	oql.AddMigration(&Migration{
+		Version: 1,
+		Name:    "学生字段调整",
+		Steps: []*MigrationStep{
+			MigrateRenameField("student", "nick", "nickname"),
+			MigrateCoerceField("student", "age"),
+			MigrateBackfillDefault("student", "grade", "1"),
+		},
+	})
+	err = oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+
+	report, err := oql.PendingMigrations(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	changes := map[string]bool{}
+	for _, change := range report.Changes {
+		changes[change.String()] = true
+	}
+	if !changes["student.age: Int -> Float"] || !changes["student.nick: remove String"] || !changes["student.nickname: add String"] || len(report.Pending) != 1 {
+		t.Error("待处理的变更错误", report.Changes, report.Pending)
+		return
+	}
+	// dry-run 不修改数据
+	one, err := driver.FindOne(ctx, "student", nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one["nick"] != "小张" || one["age"] != int32(18) {
+		t.Error("dry-run 修改了数据", one)
+		return
+	}
+
+	_, err = oql.Migrate(ctx)
+	if err != nil {
+		t.Error("迁移失败", err)
+		return
+	}
+	one, err = driver.FindOne(ctx, "student", nil, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one["nickname"] != "小张" || one["nick"] != nil || one["age"] != float64(18) || one["grade"] != int32(1) {
+		t.Error("迁移结果错误", one)
+		return
+	}
+	history, err := oql.MigrationHistory(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(history) != 1 || history[0].Int("version") != 1 {
+		t.Error("迁移记录错误", history)
+		return
+	}
+	report, err = oql.PendingMigrations(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(report.Changes) != 0 || len(report.Pending) != 0 {
+		t.Error("重复迁移", report.Changes, report.Pending)
+	}
+}
+
+func TestMigrateUncovered(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	_, err := driver.Insert(ctx, schemaCollection, M{
+		"object": "student",
+		"fields": []M{
+			{"api": "name", "type": "String"},
+			{"api": "age", "type": "Int"},
+			{"api": "nick", "type": "String"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	oql := New()
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{Name: "姓名", Api: "name", Type: String},
+			{Name: "年龄", Api: "age", Type: Float},
+		},
+	})
+	err = oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	report, err := oql.PendingMigrations(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(report.Uncovered) != 2 {
+		t.Error("没有迁移处理的变更错误", report.Uncovered)
+		return
+	}
+	_, err = oql.Migrate(ctx)
+	if err == nil {
+		t.Error("有没有迁移处理的变更时应该拒绝迁移")
+		return
+	}
+	// 快照没有被修改
+	report, err = oql.PendingMigrations(ctx)
+	if err != nil || len(report.Uncovered) != 2 {
+		t.Error("拒绝迁移后不能保存结构快照", err, report.Changes)
+		return
+	}
+	// 自定义步骤声明处理的字段
+	oql.AddMigration(&Migration{
+		Version: 1,
+		Name:    "调整年龄",
+		Steps: []*MigrationStep{
+			MigrateCoerceField("student", "age"),
+			MigrateFunc("archive nick", func(ctx context.Context, o *Objectql) error {
+				return nil
+			}, "student.nick"),
+		},
+	})
+	_, err = oql.Migrate(ctx)
+	if err != nil {
+		t.Error("迁移失败", err)
+	}
+}
+
+// 读不到迁移记录的驱动, 模拟多个实例同时启动时都认为迁移还没有执行
+type staleMigrationDriver struct {
+	*MemoryDriver
+}
+
+func (d *staleMigrationDriver) Find(ctx context.Context, table string, filter M, projection M) ([]bson.M, error) {
+	if table == migrationCollection {
+		return nil, nil
+	}
+	return d.MemoryDriver.Find(ctx, table, filter, projection)
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	count := 0
+	var instances []*Objectql
+	for _, d := range []Driver{driver, &staleMigrationDriver{MemoryDriver: driver}} {
+		oql := New()
+		oql.SetDriver(d)
+		oql.AddObject(&Object{
+			Name:   "学生",
+			Api:    "student",
+			Fields: []*Field{{Name: "姓名", Api: "name", Type: String}},
+		})
+		oql.AddMigration(&Migration{
+			Version: 1,
+			Name:    "初始化",
+			Steps: []*MigrationStep{
+				MigrateFunc("count", func(ctx context.Context, o *Objectql) error {
+					count++
+					return nil
+				}),
+			},
+		})
+		err := oql.InitObjects(ctx)
+		if err != nil {
+			t.Error("初始化对象失败", err)
+			return
+		}
+		instances = append(instances, oql)
+	}
+	for _, oql := range instances {
+		_, err := oql.Migrate(ctx)
+		if err != nil {
+			t.Error("迁移失败", err)
+			return
+		}
+	}
+	if count != 1 {
+		t.Error("多个实例同时启动时迁移只能执行一次", count)
+		return
+	}
+	indexes, err := driver.ListIndexes(ctx, migrationCollection)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	found := false
+	for _, index := range indexes {
+		if index.Name == migrationVersionIndex && index.Unique {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("迁移记录的版本应该有唯一索引", indexes)
+	}
+}
+
+// 迁移执行之后没有保存快照, 已经执行的迁移仍然覆盖对应的变更
+func TestMigrateRecovered(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	_, err := driver.Insert(ctx, schemaCollection, M{
+		"object": "student",
+		"fields": []M{
+			{"api": "name", "type": "String"},
+			{"api": "age", "type": "Int"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = driver.Insert(ctx, migrationCollection, M{
+		"version": 1,
+		"name":    "调整年龄",
+		"fields":  []string{"student.age"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	newObjectql := func(age Type) *Objectql {
+		oql := New()
+		oql.SetDriver(driver)
+		oql.AddObject(&Object{
+			Name: "学生",
+			Api:  "student",
+			Fields: []*Field{
+				{Name: "姓名", Api: "name", Type: String},
+				{Name: "年龄", Api: "age", Type: age},
+			},
+		})
+		oql.AddMigration(&Migration{
+			Version: 1,
+			Name:    "调整年龄",
+			Steps:   []*MigrationStep{MigrateCoerceField("student", "age")},
+		})
+		err := oql.InitObjects(ctx)
+		if err != nil {
+			t.Error("初始化对象失败", err)
+			return nil
+		}
+		return oql
+	}
+	oql := newObjectql(Float)
+	if oql == nil {
+		return
+	}
+	report, err := oql.PendingMigrations(ctx)
+	if err != nil || len(report.Pending) != 0 || len(report.Uncovered) != 0 {
+		t.Error("已经执行的迁移应该覆盖变更", err, report)
+		return
+	}
+	_, err = oql.Migrate(ctx)
+	if err != nil {
+		t.Error("迁移失败", err)
+		return
+	}
+	// 快照保存之后, 之前的迁移不再覆盖新的变更
+	oql = newObjectql(String)
+	if oql == nil {
+		return
+	}
+	report, err = oql.PendingMigrations(ctx)
+	if err != nil || len(report.Uncovered) != 1 {
+		t.Error("快照之前的迁移不应该覆盖新的变更", err, report)
+	}
+}
+
+// 系统字段和计算字段的变化不需要迁移
+func TestMigrateSystemFields(t *testing.T) {
+	ctx := context.Background()
+	driver := NewMemoryDriver()
+	// 旧的快照中有系统字段和计算字段
+	_, err := driver.Insert(ctx, schemaCollection, M{
+		"object": "student",
+		"fields": []M{
+			{"api": "_id", "type": "ObjectID"},
+			{"api": "name", "type": "String"},
+			{"api": "score", "type": "Int"},
+			{"api": "double", "type": "Int"},
+			{"api": "__index", "type": "Int"},
+			{"api": "__v", "type": "Int"},
+			{"api": "__tenant", "type": "String"},
+			{"api": "createTime", "type": "DateTime"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	oql := New()
+	oql.SetDriver(driver)
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{Name: "姓名", Api: "name", Type: String},
+			{Name: "分数", Api: "score", Type: Int},
+			{Name: "双倍", Api: "double", Type: &FormulaType{Formula: "score * 2", Type: Float}},
+		},
+	})
+	err = oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	report, err := oql.Migrate(ctx)
+	if err != nil || len(report.Changes) != 0 {
+		t.Error("系统字段和计算字段不需要迁移", err, report)
+		return
+	}
+	// 计算字段不保存到快照, 删除时也不需要迁移
+	one, err := driver.FindOne(ctx, schemaCollection, M{"object": "student"}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, f := range gconv.Maps(one["fields"]) {
+		if api := f["api"]; api != "name" && api != "score" {
+			t.Error("快照中不应该有系统字段和计算字段", one["fields"])
+			return
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/aundis/graphql"
 	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func (o *Objectql) insertHandle(ctx context.Context, api string, doc map[string]interface{}, pos *IndexPosition) (string, error) {
@@ -18,138 +19,231 @@ func (o *Objectql) insertHandle(ctx context.Context, api string, doc map[string]
 }
 
 func (o *Objectql) insertHandleRaw(ctx context.Context, api string, doc map[string]interface{}, pos *IndexPosition) (string, error) {
-	doc = copyStrAnyMap(doc)
 	object := FindObjectFromList(o.list, api)
 	if object == nil {
 		return "", ErrNotFoundObject
 	}
+	doc, err := o.insertPrepare(ctx, object, doc)
+	if err != nil {
+		return "", err
+	}
+	// 写索引位置
+	if object.Index {
+		err = o.initInsertRowIndex(ctx, object, doc, pos)
+		if err != nil {
+			return "", err
+		}
+	}
+	// 写入到数据库
+	objectIdStr, err := o.mongoInsert(ctx, api, doc)
+	if err != nil {
+		return "", err
+	}
+	err = o.insertLink(ctx, object, objectIdStr, doc)
+	if err != nil {
+		return "", err
+	}
+	err = o.insertFinish(ctx, object, objectIdStr, doc)
+	if err != nil {
+		return "", err
+	}
+	return objectIdStr, nil
+}
+
+// 写入数据库之前的处理, 返回格式化后的文档
+func (o *Objectql) insertPrepare(ctx context.Context, object *Object, doc map[string]interface{}) (map[string]interface{}, error) {
+	doc = copyStrAnyMap(doc)
 	// 对象权限校验
 	err := o.checkObjectPermission(ctx, object.Api, ObjectInsert)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// 设定默认值
 	o.initDefaultValues(object.Fields, doc)
 	// insertBefore 事件触发 (可以修改表单内容)
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerInsertBefore(ctx, api, NewVar(doc))
+		err = o.triggerInsertBefore(ctx, object.Api, NewVar(doc))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 	}
 	// 数据校验层
-	err = o.validateDocument(object, doc)
+	err = o.validateDocument(ctx, object, doc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// 字段权限校验
 	err = o.checkObjectFieldPermissionWithDocument(ctx, object, doc, FieldUpdate)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// 数据库修改
 	// 添加创建时间
 	doc["createTime"] = time.Now()
+	// 初始版本
+	if object.Versioned {
+		doc["__v"] = 1
+		doc["__ev"] = 1
+	}
 	// 添加拥有者
 	if len(o.operatorObject) > 0 && o.getOperator != nil {
 		owner, err := o.getOperator(ctx)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		doc["owner"] = owner
 	}
+	// 文件字段使用上传时记录的元数据
+	err = o.fillFileValues(ctx, object, doc)
+	if err != nil {
+		return nil, err
+	}
 	err = formatDocumentToDatabase(object.Fields, doc)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	// 写入当前租户
+	err = o.initTenantValue(ctx, object, doc)
+	if err != nil {
+		return nil, err
 	}
 	// check bool require
 	err = o.checkInsertFieldBoolRequires(object, doc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// check priamry require
 	err = o.checkInsertPrimaryFieldRequires(object, doc)
 	if err != nil {
-		return "", err
-	}
-	// 写索引位置
-	if object.Index {
-		err = o.initInsertRowIndex(ctx, object, doc, pos)
-		if err != nil {
-			return "", err
-		}
-	}
-	// 写入到数据库
-	objectIdStr, err := o.mongoInsert(ctx, api, doc)
-	if err != nil {
-		return "", err
+		return nil, err
 	}
-	// 数据联动
+	return doc, nil
+}
+
+// 写入数据库之后的数据联动
+func (o *Objectql) insertLink(ctx context.Context, object *Object, id string, doc map[string]interface{}) error {
 	for _, field := range object.Fields {
 		if _, ok := doc[field.Api]; ok {
-			err = o.onFieldChange(ctx, object, objectIdStr, field, nil)
+			err := o.onFieldChange(ctx, object, id, field, nil)
 			if err != nil {
-				return "", err
+				return err
 			}
 		}
 	}
 	// 触发 immediate 的公式字段
-	err = o.triggerImmediateFormulaFields(ctx, object, objectIdStr)
+	return o.triggerImmediateFormulaFields(ctx, object, id)
+}
+
+// 数据联动完成之后的校验和事件
+func (o *Objectql) insertFinish(ctx context.Context, object *Object, id string, doc map[string]interface{}) error {
+	// 历史记录
+	err := o.writeHistory(ctx, object, id, HistoryInsert, nil)
 	if err != nil {
-		return "", err
+		return err
 	}
 	// after 数据查询
 	var after *Var
 	if ctx.Value(blockEventsKey) != true {
-		after, _, err = o.queryEventObjectEntity(ctx, object, objectIdStr, doc, InsertAfter)
+		after, _, err = o.queryEventObjectEntity(ctx, object, id, doc, InsertAfter)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 	// priamry 校验
 	err = o.checkPrimaryDuplicate(ctx, object, after)
 	if err != nil {
-		return "", err
+		return err
 	}
 	// require 校验
 	err = o.checkInsertFieldFormulaOrHandledRequires(ctx, object, after)
 	if err != nil {
-		return "", err
+		return err
 	}
 	// validate 校验
 	err = o.checkFieldFormulaOrHandledValidates(ctx, object, doc, after)
 	if err != nil {
-		return "", err
+		return err
 	}
 	// insertAfter 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerInsertAfter(ctx, api, objectIdStr, NewVar(doc))
+		err = o.triggerInsertAfter(ctx, object.Api, id, NewVar(doc))
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 	// insertAfterEx 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerInsertAfterEx(ctx, api, objectIdStr, NewVar(doc), after)
+		err = o.triggerInsertAfterEx(ctx, object.Api, id, NewVar(doc), after)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 	// fieldChange 事件触发
 	if ctx.Value(blockEventsKey) != true {
 		err = o.triggerChange(ctx, object, NewVar(nil), after, InsertAfter)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 	// indexChange 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerIndexChange(ctx, object.Api, objectIdStr, NewVar(nil), after, InsertAfter)
+		err = o.triggerIndexChange(ctx, object.Api, id, NewVar(nil), after, InsertAfter)
+		if err != nil {
+			return err
+		}
+	}
+	// subscription 推送
+	if ctx.Value(blockEventsKey) != true {
+		err = o.publishChange(ctx, object, ChangeInsert, id, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 根据主键判断是新建还是修改
+func (o *Objectql) saveHandle(ctx context.Context, api string, doc map[string]interface{}, pos *IndexPosition) (string, error) {
+	object := FindObjectFromList(o.list, api)
+	if object == nil {
+		return "", ErrNotFoundObject
+	}
+	var updateId string
+	// 判断是否存在主键
+	primaryFields := object.getPrimaryFields()
+	if len(primaryFields) > 0 {
+		filter, err := o.getPrimaryFieldsFilter(doc, primaryFields)
+		if err != nil {
+			return "", err
+		}
+		one, err := o.mongoFindOneEx(ctx, object.Api, findOneExOptions{
+			Fields: []string{"_id"},
+			Filter: filter,
+		})
 		if err != nil {
 			return "", err
 		}
+		if one != nil {
+			updateId = gconv.String(one["_id"])
+		}
 	}
-	return objectIdStr, nil
+	if len(updateId) == 0 {
+		// 数据新建
+		return o.insertHandle(ctx, object.Api, doc, pos)
+	}
+	// 数据更新
+	err := o.updateHandle(ctx, object.Api, updateId, doc, false)
+	if err != nil {
+		return "", err
+	}
+	// 位置更新
+	if pos != nil {
+		err = o.moveHandle(ctx, object.Api, updateId, *pos)
+		if err != nil {
+			return "", err
+		}
+	}
+	return updateId, nil
 }
 
 func (o *Objectql) triggerImmediateFormulaFields(ctx context.Context, object *Object, id string) error {
@@ -261,14 +355,11 @@ func (o *Objectql) getMaxIndex(ctx context.Context, object *Object, group M) (in
 		},
 	})
 
-	cursor, err := o.getCollection(object.Api).Aggregate(ctx, pipeline)
-	if err != nil {
-		return 0, err
-	}
-	result, err := readOneFromCuresor(ctx, cursor)
+	list, err := o.mongoAggregate(ctx, object.Api, pipeline)
 	if err != nil {
 		return 0, err
 	}
+	result := readOneFromList(list)
 	// 解析最大索引值
 	var value int = 0
 	if result != nil {
@@ -296,25 +387,97 @@ func (o *Objectql) updateHandle(ctx context.Context, api string, id string, doc
 	return err
 }
 
+// 修改所有符合条件的记录
+func (o *Objectql) updateManyHandle(ctx context.Context, api string, filter M, doc map[string]interface{}) error {
+	// 找出需要被修改的id数组
+	list, err := o.mongoFindAllEx(ctx, api, findAllExOptions{
+		Fields: []string{"_id"},
+		Filter: filter,
+	})
+	if err != nil {
+		return err
+	}
+	// 使用事务来进行操作
+	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		for _, item := range list {
+			err := o.updateHandleRaw(ctx, api, gconv.String(item["_id"]), doc, false)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
 func (o *Objectql) updateHandleRaw(ctx context.Context, api string, id string, doc map[string]interface{}, permissionBlock bool) error {
-	doc = copyStrAnyMap(doc)
-	var err error
-	// var err error
 	object := FindObjectFromList(o.list, api)
 	if object == nil {
 		return ErrNotFoundObject
 	}
+	row, err := o.updatePrepare(ctx, object, id, doc, permissionBlock)
+	if err != nil {
+		return err
+	}
+	// TODO: 表示指定的ID记录不存在
+	if row == nil {
+		return nil
+	}
+	// 写入到数据库
+	var count int64
+	if object.Versioned {
+		// 计算字段的修改不算用户的修改
+		count, err = o.mongoUpdateByIdWithVersion(ctx, object, id, row.doc, row.expectVersion, !permissionBlock)
+	} else {
+		count, err = o.mongoUpdateById(ctx, api, id, row.doc)
+	}
+	if err != nil {
+		return err
+	}
+	// TODO: 表示指定的ID记录不存在
+	if count == 0 {
+		return nil
+	}
+	err = o.updateLink(ctx, object, row)
+	if err != nil {
+		return err
+	}
+	return o.updateFinish(ctx, object, row)
+}
+
+// 修改时在写入数据库前后传递的数据
+type updateRow struct {
+	id            string
+	doc           map[string]interface{}
+	expectVersion interface{}
+	before        *Var
+	beforeValues  map[string]interface{}
+	historyBefore bson.M
+	fileIds       []string
+}
+
+// 写入数据库之前的处理, 记录不存在时返回 nil
+func (o *Objectql) updatePrepare(ctx context.Context, object *Object, id string, doc map[string]interface{}, permissionBlock bool) (*updateRow, error) {
+	doc = copyStrAnyMap(doc)
+	// 期望的版本号不属于修改的内容
+	expectVersion := doc["__v"]
+	delete(doc, "__v")
+	// 其他租户的记录当作不存在
+	ok, err := o.isTenantRecord(ctx, object, id)
+	if err != nil || !ok {
+		return nil, err
+	}
 	// 对象权限校验
 	if !permissionBlock {
 		err = o.checkObjectPermission(ctx, object.Api, ObjectInsert)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// 数据校验
-	err = o.validateDocument(object, doc)
+	err = o.validateDocument(ctx, object, doc)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// before 值查询
 	var before *Var
@@ -322,79 +485,114 @@ func (o *Objectql) updateHandleRaw(ctx context.Context, api string, id string, d
 		var exists bool
 		before, exists, err = o.queryEventObjectEntity(ctx, object, id, doc, UpdateBefore)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		// TODO: 表示指定的ID记录不存在
 		if !exists {
-			return nil
+			return nil, nil
 		}
 	}
 	// updateBefore 事件触发 (可以修改表单内容)
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerUpdateBefore(ctx, api, id, NewVar(doc))
+		err = o.triggerUpdateBefore(ctx, object.Api, id, NewVar(doc))
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// updateBeforeEx 事件触发 (可以修改表单内容)
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerUpdateBeforeEx(ctx, api, id, NewVar(doc), before)
+		err = o.triggerUpdateBeforeEx(ctx, object.Api, id, NewVar(doc), before)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// 数据校验(数据可能被修改了,所以再校验一次)
-	err = o.validateDocument(object, doc)
+	err = o.validateDocument(ctx, object, doc)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// 字段权限校验
 	if !permissionBlock {
 		err = o.checkObjectFieldPermissionWithDocument(ctx, object, doc, FieldUpdate)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// 保存相关表的字段
 	beforeValues, err := o.getObjectBeforeValues(ctx, object, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// 添加修改时间
 	doc["updateTime"] = time.Now()
+	// 文件字段使用上传时记录的元数据
+	err = o.fillFileValues(ctx, object, doc)
+	if err != nil {
+		return nil, err
+	}
 	// 数据库修改
 	err = formatDocumentToDatabase(object.Fields, doc)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// check bool require
 	err = o.checkUpdateFieldBoolRequires(object, doc)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// check priamry require
 	err = o.checkUpdatePrimaryFieldBoolRequires(object, doc)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// 写入到数据库
-	count, err := o.mongoUpdateById(ctx, api, id, doc)
+	// 历史记录需要修改前的数据
+	historyBefore, err := o.queryHistorySnapshot(ctx, object, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// TODO: 表示指定的ID记录不存在
-	if count == 0 {
-		return nil
+	// 修改前引用的文件, 修改后不再引用的需要回收
+	fileIds, err := o.getUpdateFileIds(ctx, object, id, doc)
+	if err != nil {
+		return nil, err
+	}
+	return &updateRow{
+		id:            id,
+		doc:           doc,
+		expectVersion: expectVersion,
+		before:        before,
+		beforeValues:  beforeValues,
+		historyBefore: historyBefore,
+		fileIds:       fileIds,
+	}, nil
+}
+
+// 写入数据库之后的历史记录和数据联动
+func (o *Objectql) updateLink(ctx context.Context, object *Object, row *updateRow) error {
+	// 历史记录
+	err := o.writeHistory(ctx, object, row.id, HistoryUpdate, row.historyBefore)
+	if err != nil {
+		return err
 	}
 	// 数据联动
 	for _, field := range object.Fields {
-		if _, ok := doc[field.Api]; ok {
-			err = o.onFieldChange(ctx, object, id, field, beforeValues)
+		if _, ok := row.doc[field.Api]; ok {
+			err = o.onFieldChange(ctx, object, row.id, field, row.beforeValues)
 			if err != nil {
 				return err
 			}
 		}
 	}
+	return nil
+}
+
+// 数据联动完成之后的校验和事件
+func (o *Objectql) updateFinish(ctx context.Context, object *Object, row *updateRow) error {
+	id, doc := row.id, row.doc
+	// 回收被替换的文件
+	err := o.releaseUpdatedFiles(ctx, object, id, row.fileIds)
+	if err != nil {
+		return err
+	}
 	// after 值查询
 	var after *Var
 	if ctx.Value(blockEventsKey) != true {
@@ -419,27 +617,34 @@ func (o *Objectql) updateHandleRaw(ctx context.Context, api string, id string, d
 		return err
 	}
 	// updateable 校验
-	err = o.checkFieldFormulaOrHandledUpdateables(ctx, object, doc, after, before)
+	err = o.checkFieldFormulaOrHandledUpdateables(ctx, object, doc, after, row.before)
 	if err != nil {
 		return err
 	}
 	// updateAfter 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerUpdateAfter(ctx, api, id, NewVar(doc))
+		err = o.triggerUpdateAfter(ctx, object.Api, id, NewVar(doc))
 		if err != nil {
 			return err
 		}
 	}
 	// updateAfterEx 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerUpdateAfterEx(ctx, api, id, NewVar(doc), after)
+		err = o.triggerUpdateAfterEx(ctx, object.Api, id, NewVar(doc), after)
 		if err != nil {
 			return err
 		}
 	}
 	// fieldChange 事件触发
 	if ctx.Value(blockEventsKey) != true {
-		err = o.triggerChange(ctx, object, before, after, UpdateAfter)
+		err = o.triggerChange(ctx, object, row.before, after, UpdateAfter)
+		if err != nil {
+			return err
+		}
+	}
+	// subscription 推送
+	if ctx.Value(blockEventsKey) != true {
+		err = o.publishChange(ctx, object, ChangeUpdate, id, getChangedFields(object, doc), nil)
 		if err != nil {
 			return err
 		}
@@ -454,13 +659,41 @@ func (o *Objectql) deleteHandle(ctx context.Context, api string, id string) erro
 	return err
 }
 
+// 删除所有符合条件的记录
+func (o *Objectql) deleteManyHandle(ctx context.Context, api string, filter M) error {
+	// 查询出要被删除的数据
+	list, err := o.mongoFindAllEx(ctx, api, findAllExOptions{
+		Fields: []string{"_id"},
+		Filter: filter,
+	})
+	if err != nil {
+		return err
+	}
+	// 使用事务来进行操作
+	_, err = o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		for _, item := range list {
+			err := o.deleteHandleRaw(ctx, api, gconv.String(item["_id"]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
 func (o *Objectql) deleteHandleRaw(ctx context.Context, api string, id string) error {
 	object := FindObjectFromList(o.list, api)
 	if object == nil {
 		return ErrNotFoundObject
 	}
+	// 其他租户的记录当作不存在
+	ok, err := o.isTenantRecord(ctx, object, id)
+	if err != nil || !ok {
+		return err
+	}
 	// 对象权限校验
-	err := o.checkObjectPermission(ctx, object.Api, ObjectInsert)
+	err = o.checkObjectPermission(ctx, object.Api, ObjectInsert)
 	if err != nil {
 		return err
 	}
@@ -496,6 +729,26 @@ func (o *Objectql) deleteHandleRaw(ctx context.Context, api string, id string) e
 	if err != nil {
 		return err
 	}
+	// 软删除的记录先放入回收站
+	ctx, err = o.recycleRecord(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// 没有放入回收站的记录删除后回收文件
+	fileIds, err := o.getRecordFileIds(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// 历史记录需要删除前的数据
+	historyBefore, err := o.queryHistorySnapshot(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// subscription 需要在删除前匹配过滤条件
+	subscribers, err := o.getDeleteSubscribers(ctx, object, id)
+	if err != nil {
+		return err
+	}
 	// 数据库修改
 	count, err := o.mongoDeleteById(ctx, api, id)
 	if err != nil {
@@ -505,6 +758,12 @@ func (o *Objectql) deleteHandleRaw(ctx context.Context, api string, id string) e
 		// TODO: 表示指定的ID记录不存在
 		return nil
 	}
+	o.releaseFiles(ctx, fileIds)
+	// 历史记录
+	err = o.writeHistory(ctx, object, id, HistoryDelete, historyBefore)
+	if err != nil {
+		return err
+	}
 	// 数据联动
 	for _, field := range object.Fields {
 		err = o.onFieldChange(ctx, object, id, field, beforeValues)
@@ -540,6 +799,13 @@ func (o *Objectql) deleteHandleRaw(ctx context.Context, api string, id string) e
 			return err
 		}
 	}
+	// subscription 推送
+	if ctx.Value(blockEventsKey) != true {
+		err = o.publishChange(ctx, object, ChangeDelete, id, nil, subscribers)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -555,7 +821,11 @@ func (o *Objectql) moveHandleRaw(ctx context.Context, api string, id string, pos
 	if object == nil {
 		return ErrNotFoundObject
 	}
-	var err error
+	// 其他租户的记录当作不存在
+	ok, err := o.isTenantRecord(ctx, object, id)
+	if err != nil || !ok {
+		return err
+	}
 	// 查询出当前index和分组字段值
 	one, err := o.mongoFindOneById(ctx, object.Api, id, strings.Join(append(object.IndexGroup, "__index"), ","))
 	if err != nil {
@@ -607,8 +877,22 @@ func (o *Objectql) moveHandleRaw(ctx context.Context, api string, id string, pos
 	if err != nil {
 		return err
 	}
+	// 历史记录需要移动前的数据
+	historyBefore, err := o.queryHistorySnapshot(ctx, object, id)
+	if err != nil {
+		return err
+	}
 	// 修改数据库 2. 修改指定_id行位置修改为目标位置
-	_, err = o.mongoUpdateById(ctx, object.Api, id, M{"__index": realIndex})
+	if object.Versioned {
+		_, err = o.mongoUpdateByIdWithVersion(ctx, object, id, M{"__index": realIndex}, nil, true)
+	} else {
+		_, err = o.mongoUpdateById(ctx, object.Api, id, M{"__index": realIndex})
+	}
+	if err != nil {
+		return err
+	}
+	// 历史记录
+	err = o.writeHistory(ctx, object, id, HistoryMove, historyBefore)
 	if err != nil {
 		return err
 	}
@@ -634,6 +918,13 @@ func (o *Objectql) moveHandleRaw(ctx context.Context, api string, id string, pos
 			return err
 		}
 	}
+	// subscription 推送
+	if ctx.Value(blockEventsKey) != true {
+		err = o.publishChange(ctx, object, ChangeMove, id, []string{"__index"}, nil)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -677,10 +968,14 @@ func (o *Objectql) indexOffset(ctx context.Context, table string, group M, index
 		}
 	}
 
+	inc := M{
+		"__index": add,
+	}
+	if object := o.GetObject(table); object != nil && object.Versioned {
+		inc["__v"] = 1
+	}
 	_, err := o.mongoUpdateMany(ctx, table, filter, M{
-		"$inc": M{
-			"__index": add,
-		},
+		"$inc": inc,
 	})
 	if err != nil {
 		return err
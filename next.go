@@ -65,10 +65,19 @@ func (o *Objectql) runNextHandles(ctx context.Context) error {
 			return err
 		}
 	}
-	o.runAsyncNextHandles(o.getNextHandles(narr, nmap, true))
 	return nil
 }
 
+// 事务提交之后执行
+func (o *Objectql) runAsyncNext(ctx context.Context) {
+	narr := ctx.Value(nextArrayContextKey).(*garray.Array)
+	nmap := ctx.Value(nextMapContextKey).(*gmap.StrAnyMap)
+	handles := o.getNextHandles(narr, nmap, true)
+	if len(handles) > 0 {
+		o.runAsyncNextHandles(handles)
+	}
+}
+
 func (o *Objectql) runAsyncNextHandles(handles []*nextHandle) {
 	go func() {
 		ctx := gctx.New()
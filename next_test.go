@@ -146,3 +146,71 @@ func TestAsyncNext(t *testing.T) {
 		t.Error("except count = 1 but got", count)
 	}
 }
+
+// 提交失败的驱动
+type commitFailDriver struct {
+	*MemoryDriver
+}
+
+func (d *commitFailDriver) WithTransaction(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	_, err := d.MemoryDriver.WithTransaction(ctx, fn)
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("commit failed")
+}
+
+func TestAsyncNextAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	objectql := New()
+	driver := &commitFailDriver{MemoryDriver: NewMemoryDriver()}
+	objectql.SetDriver(driver)
+	objectql.AddObject(&Object{
+		Name: "员工",
+		Api:  "staff",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := objectql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	called := make(chan bool, 1)
+	objectql.ListenInsertAfter("staff", func(ctx context.Context, id string, doc *Var) error {
+		objectql.AsyncNext(ctx, func(ctx context.Context) error {
+			called <- true
+			return nil
+		})
+		return nil
+	})
+	// 事务提交失败时不执行
+	_, err = objectql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "小龙"}})
+	if err == nil || err.Error() != "commit failed" {
+		t.Error("except commit failed but got", err)
+		return
+	}
+	select {
+	case <-called:
+		t.Error("事务提交失败后不应该执行 AsyncNext")
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	// 提交成功后执行
+	objectql.SetDriver(driver.MemoryDriver)
+	_, err = objectql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "小龙"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Error("事务提交后应该执行 AsyncNext")
+	}
+}
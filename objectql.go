@@ -22,8 +22,6 @@ import (
 	"github.com/samber/lo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var blockEventsKey = "objectql_blockEventsKey"
@@ -31,6 +29,21 @@ var blockEventsKey = "objectql_blockEventsKey"
 type ObjectqlOptiosn struct {
 	OperatorObject string
 	GetOperator    func(ctx context.Context) (any, error)
+	IndexMode      IndexMode
+	MigrationMode  MigrationMode
+	GetTenant      func(ctx context.Context) (string, error)
+	TenantMode     TenantMode
+	// 单机的 mongod 设置为 TransactionNone
+	TransactionMode TransactionMode
+	// 开启了 Object.Cache 的对象使用的缓存, 例如 NewLRUCache(10000)
+	Cache Cache
+	// 记录每次数据库调用的管道, 耗时和文档数量
+	Profile QueryProfileHandler
+	// 超过阈值的数据库调用输出到 SlowQueryLogger, 默认使用 g.Log()
+	SlowQueryThreshold time.Duration
+	SlowQueryLogger    QueryLogger
+	// 文件字段的存储, 例如 NewLocalBlobStore(dir)
+	BlobStore BlobStore
 }
 
 func New(optinos ...ObjectqlOptiosn) *Objectql {
@@ -42,9 +55,27 @@ func New(optinos ...ObjectqlOptiosn) *Objectql {
 		gobjects:     gmap.NewStrAnyMap(true),
 		eventMap:     gmap.NewAnyAnyMap(true),
 		gstructTypes: gmap.NewStrAnyMap(true),
+		subscribers:  gmap.NewStrAnyMap(true),
 		// owner
 		operatorObject: option.OperatorObject,
 		getOperator:    option.GetOperator,
+		// index
+		indexMode: option.IndexMode,
+		// migration
+		migrationMode: option.MigrationMode,
+		// tenant
+		getTenantHandler: option.GetTenant,
+		tenantMode:       option.TenantMode,
+		// transaction
+		transactionMode: option.TransactionMode,
+		// cache
+		cache: option.Cache,
+		// profile
+		profileHandler:     option.Profile,
+		slowQueryThreshold: option.SlowQueryThreshold,
+		slowQueryLogger:    option.SlowQueryLogger,
+		// file
+		blobStore: option.BlobStore,
 		// formula
 		formulaCustomerFunction: map[string]interface{}{},
 		// mutex
@@ -58,11 +89,15 @@ type Objectql struct {
 	gschema    graphql.Schema
 	gquerys    graphql.Fields
 	gmutations graphql.Fields
+	// subscription
+	gsubscriptions graphql.Fields
+	subscribers    *gmap.StrAnyMap
 	// database
-	mongoDatebase          string
-	mongoClientOpts        *options.ClientOptions
-	mongoClient            *mongo.Client
-	mongoCollectionOptions *options.CollectionOptions
+	driver    Driver
+	indexMode IndexMode
+	// migration
+	migrationMode MigrationMode
+	migrations    []*Migration
 	// event
 	eventMap *gmap.AnyAnyMap
 	// permission
@@ -74,6 +109,20 @@ type Objectql struct {
 	// owner
 	operatorObject string
 	getOperator    func(ctx context.Context) (any, error)
+	// tenant
+	getTenantHandler func(ctx context.Context) (string, error)
+	tenantMode       TenantMode
+	// transaction
+	transactionMode TransactionMode
+	// cache
+	cache        Cache
+	cacheVersion int64
+	// profile
+	profileHandler     QueryProfileHandler
+	slowQueryThreshold time.Duration
+	slowQueryLogger    QueryLogger
+	// file
+	blobStore BlobStore
 	// formula
 	formulaCustomerFunction map[string]interface{}
 }
@@ -108,6 +157,7 @@ func (o *Objectql) AddObject(object *Object) {
 			expands = append(expands, &Field{
 				Api:      field.Api + "__expand",
 				valueApi: field.Api,
+				Fields:   field.Fields,
 				Type: &ExpandType{
 					ObjectApi: n.ObjectApi,
 					FieldApi:  field.Api,
@@ -119,6 +169,7 @@ func (o *Objectql) AddObject(object *Object) {
 				expands = append(expands, &Field{
 					Api:      field.Api + "__expands",
 					valueApi: field.Api,
+					Fields:   field.Fields,
 					Type: &ExpandsType{
 						ObjectApi: tpe.ObjectApi,
 						FieldApi:  field.Api,
@@ -128,6 +179,14 @@ func (o *Objectql) AddObject(object *Object) {
 		}
 	}
 	object.Fields = append(object.Fields, expands...)
+	// 内嵌文档的 graphql 类型名称
+	initEmbeddedTypeNames(object.Api, object.Fields)
+	// 地理位置的距离
+	for _, field := range object.Fields {
+		if IsGeoPointType(field.Type) {
+			object.Fields = append(object.Fields, newGeoDistanceField(field))
+		}
+	}
 	// 索引对象
 	if object.Index {
 		object.Fields = append(object.Fields, &Field{
@@ -136,6 +195,26 @@ func (o *Objectql) AddObject(object *Object) {
 			Api:  "__index",
 		})
 	}
+	// 租户
+	if object.Tenant {
+		object.Fields = append(object.Fields, &Field{
+			Type: String,
+			Name: "租户",
+			Api:  tenantFieldApi,
+		})
+		// 每个租户单独排序
+		if object.Index {
+			object.IndexGroup = append(object.IndexGroup, tenantFieldApi)
+		}
+	}
+	// 版本号
+	if object.Versioned {
+		object.Fields = append(object.Fields, &Field{
+			Type: Int,
+			Name: "版本",
+			Api:  "__v",
+		})
+	}
 	// 创建时间
 	object.Fields = append(object.Fields, &Field{
 		Type: DateTime,
@@ -177,10 +256,15 @@ func (o *Objectql) MustGetObject(api string) (*Object, error) {
 }
 
 func (o *Objectql) InitObjects(ctx context.Context) error {
+	// 多对多字段的中间对象和反向字段
+	err := o.initManyToManyFields()
+	if err != nil {
+		return err
+	}
 	// 初始化字段的parent
 	o.initFieldParent()
 	// 解析字段的引用关系
-	err := o.parseFields()
+	err = o.parseFields()
 	if err != nil {
 		return err
 	}
@@ -188,6 +272,7 @@ func (o *Objectql) InitObjects(ctx context.Context) error {
 	o.preInitObjects()
 	o.gquerys = graphql.Fields{}
 	o.gmutations = graphql.Fields{}
+	o.gsubscriptions = graphql.Fields{}
 	for _, v := range o.list {
 		// 初始化绑定对对象
 		err = o.bindObjectMethod(v, v.Bind)
@@ -196,6 +281,10 @@ func (o *Objectql) InitObjects(ctx context.Context) error {
 		}
 		// 初始化 immediate 的字段
 		v.immediateFormulaFields = o.getImmediateFormulaFields(v)
+		// 预先生成字段缓存, subscription 会在其他协程中查询
+		v.getField("_id")
+		v.getReoslveDependencyFields("_id")
+		v.getPrimaryFields()
 		// 初始化DeleteSync
 		err = o.initObjectDeleteSync(v)
 		if err != nil {
@@ -216,6 +305,11 @@ func (o *Objectql) InitObjects(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		// 初始化Graphql对象的subscription
+		err = o.initObjectGraphqlSubscription(ctx, o.gsubscriptions, v)
+		if err != nil {
+			return err
+		}
 	}
 	// 初始化Graphql Schema
 	o.gschema, err = graphql.NewSchema(graphql.SchemaConfig{
@@ -227,8 +321,21 @@ func (o *Objectql) InitObjects(ctx context.Context) error {
 			Name:   "Mutation",
 			Fields: o.gmutations,
 		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Subscription",
+			Fields: o.gsubscriptions,
+		}),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	// 迁移要在索引之前, 改名后的字段才能建立索引
+	err = o.initMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	// 初始化索引
+	return o.initIndexes(ctx)
 }
 
 func (o *Objectql) getImmediateFormulaFields(object *Object) []*Field {
@@ -281,12 +388,19 @@ func (o *Objectql) parseFields() (err error) {
 			if err != nil {
 				return err
 			}
+			// 内嵌文档的子字段
+			err = parseEmbeddedFields(field)
+			if err != nil {
+				return fmt.Errorf("parse field %s.%s error: %s", object.Api, field.Api, err.Error())
+			}
 			// 解析统计和公式字段
-			switch field.Type.(type) {
+			switch n := field.Type.(type) {
 			case *AggregationType:
 				err = o.parseAggregationField(object, field)
 			case *FormulaType:
 				err = o.parseFormulaField(object, field)
+			case *RelatedListType:
+				err = o.parseRelatedListField(object, field, n)
 			}
 			if err != nil {
 				return fmt.Errorf("parse field %s.%s error: %s", object.Api, field.Api, err.Error())
@@ -372,6 +486,10 @@ func (o *Objectql) parseFieldValidate(object *Object, field *Field) error {
 
 func (o *Objectql) parseAggregationField(object *Object, field *Field) error {
 	adata := field.Type.(*AggregationType)
+	// 经过中间对象统计
+	if link := o.getAggregationLink(object, adata); link != nil {
+		return o.parseManyToManyAggregationField(object, field, link)
+	}
 	// 解析引用的相关表字段
 	resolved, err := FindFieldFromName(o.list, adata.Object, adata.Relate)
 	if err != nil {
@@ -428,18 +546,29 @@ func (o *Objectql) parseFormulaField(object *Object, field *Field) error {
 	}
 	fdata.referenceFields = names
 	fdata.immediate = len(names) == 0
+	if decimalTypeOf(fdata.Type) != nil {
+		fdata.decimalExpr = parseDecimalExpr(fdata.Formula)
+	}
 
 	// 字段挂载
 	for _, name := range names {
 		arr := strings.Split(name, ".")
-		if len(arr) != 1 && len(arr) != 2 {
-			return fmt.Errorf("formual reference name dot len > 2")
-		}
 		// 找到引用的字段(在本对象找到引用类型的字段)
 		relatedField, err := FindFieldFromName(o.list, object.Api, removeFieldSuffix(arr[0]))
 		if err != nil {
 			return err
 		}
+		// 任意类型和内嵌文档的子路径依赖整个字段
+		if len(arr) > 1 && isValueFieldType(relatedField.Type) {
+			appendRelateionToField(relatedField, &relationFiledInfo{
+				ThroughField: nil,
+				TargetField:  field,
+			})
+			continue
+		}
+		if len(arr) != 1 && len(arr) != 2 {
+			return fmt.Errorf("formual reference name dot len > 2")
+		}
 
 		if len(arr) == 1 {
 			relatedField.relations = append(relatedField.relations, &relationFiledInfo{
@@ -523,9 +652,13 @@ func (o *Objectql) fullGraphqlObject(gobj *graphql.Object, object *Object) error
 		if isNull(tpe) {
 			return fmt.Errorf("can't resolve field '%s.%s' type", object.Api, cur.Api)
 		}
+		if enum := o.getGraphqlSelectEnum(object, cur); enum != nil {
+			tpe = enum
+		}
 		gobj.AddFieldConfig(cur.Api, &graphql.Field{
 			Name: cur.Api,
 			Type: tpe,
+			Args: getGraphqlRelatedListArgs(cur),
 			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
 				return o.graphqlFieldResolver(p.Context, p, cur)
 			},
@@ -556,6 +689,21 @@ func (o *Objectql) graphqlFieldResolver(ctx context.Context, p graphql.ResolvePa
 	if field.Resolve != nil {
 		return field.Resolve(source)
 	}
+	// 数据源中没有展开的数据时通过 loader 批量查询
+	if _, ok := source[field.Api]; !ok {
+		switch n := field.Type.(type) {
+		case *ExpandType, *ExpandsType:
+			objectIds, err := o.getExpandSourceIds(field, source)
+			if err != nil || len(objectIds) == 0 {
+				return nil, err
+			}
+			ctx = context.WithValue(ctx, graphqlResolveParamsKey, p)
+			if expand, ok := n.(*ExpandType); ok {
+				return o.expandFieldResolver(ctx, expand.ObjectApi, objectIds[0].Hex())
+			}
+			return o.expandsFieldResolver(ctx, n.(*ExpandsType).ObjectApi, objectIds)
+		}
+	}
 	return source[field.Api], nil
 
 	// // 格式化输出值
@@ -580,6 +728,8 @@ func (o *Objectql) fieldResolver(ctx context.Context, fieldType Type, value inte
 		return intOrNil(value), nil
 	case *FloatType:
 		return floatOrNil(value), nil
+	case *DecimalType:
+		return formatDecimalValueFromDatabase(n, value)
 	case *StringType:
 		return stringOrNil(value), nil
 	case *DateTimeType, *DateType, *TimeType:
@@ -636,37 +786,31 @@ func (o *Objectql) arrayFieldResolver(ctx context.Context, tpe *ArrayType, value
 
 func (o *Objectql) expandFieldResolver(ctx context.Context, objectApi string, objectId string) (interface{}, error) {
 	p := ctx.Value(graphqlResolveParamsKey).(graphql.ResolveParams)
-	selects := getGraphqlSelectFieldNames(p)
-	mgoSelects := stringArrayToMongodbSelects(selects)
-	results, err := o.mongoFindOne(ctx, objectApi, bson.M{"_id": ObjectIdFromHex(objectId)}, selectMapToQueryString(mgoSelects))
-	if err != nil {
-		return nil, err
-	}
-	return results, nil
+	load := o.loadExpands(ctx, objectApi, o.parseMongoQueryFields(p), []primitive.ObjectID{ObjectIdFromHex(objectId)})
+	return func() (interface{}, error) {
+		results, err := load()
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return results[0], nil
+	}, nil
 }
 
 func (o *Objectql) expandsFieldResolver(ctx context.Context, objectApi string, objectIds []primitive.ObjectID) (interface{}, error) {
 	p := ctx.Value(graphqlResolveParamsKey).(graphql.ResolveParams)
-	selects := getGraphqlSelectFieldNames(p)
-	// 确保_id加入到查询当中, 排序需要用到
-	if lo.IndexOf(selects, "_id") == -1 {
-		selects = append(selects, "_id")
-	}
-	mgoSelects := stringArrayToMongodbSelects(selects)
-	results, err := o.mongoFindAll(ctx, objectApi, bson.M{"_id": bson.M{"$in": objectIds}}, selectMapToQueryString(mgoSelects))
-	if err != nil {
-		return nil, err
-	}
-	// 这里要进行排序后再进行返回
-	return sortByObjectIDs(results, objectIds), nil
+	// 排序在 loader 中完成
+	load := o.loadExpands(ctx, objectApi, o.parseMongoQueryFields(p), objectIds)
+	return func() (interface{}, error) {
+		return load()
+	}, nil
 }
 
-func sortByObjectIDs(data []bson.M, order []primitive.ObjectID) []bson.M {
+func sortByObjectIDs(data []M, order []primitive.ObjectID) []M {
 	// 使用sort.Slice函数根据自定义比较函数对data进行排序
 	sort.Slice(data, func(i, j int) bool {
 		// 获取data中元素的_id字段值
-		idI := data[i]["_id"].(primitive.ObjectID)
-		idJ := data[j]["_id"].(primitive.ObjectID)
+		idI := toObjectId(data[i]["_id"])
+		idJ := toObjectId(data[j]["_id"])
 
 		// 获取_id字段值在order数组中的索引
 		indexI := lo.IndexOf(order, idI)
@@ -679,6 +823,18 @@ func sortByObjectIDs(data []bson.M, order []primitive.ObjectID) []bson.M {
 	return data
 }
 
+// 格式化后的数据 _id 为字符串
+func toObjectId(v any) primitive.ObjectID {
+	switch n := v.(type) {
+	case primitive.ObjectID:
+		return n
+	case string:
+		objectId, _ := primitive.ObjectIDFromHex(n)
+		return objectId
+	}
+	return primitive.NilObjectID
+}
+
 // 如果是 user__expand 会将 user 添加进去
 func stringArrayToMongodbSelects(arr []string) bson.M {
 	result := bson.M{}
@@ -716,7 +872,7 @@ func (o *Objectql) Do(ctx context.Context, request string) *graphql.Result {
 	return graphql.Do(graphql.Params{
 		Schema:        o.gschema,
 		RequestString: request,
-		Context:       ctx,
+		Context:       withExpandLoader(ctx),
 	})
 }
 
@@ -825,152 +981,111 @@ func writeGraphqlOutputFieldQueryString(buffer *bytes.Buffer, gtype graphql.Outp
 // 增删改查接口
 func (o *Objectql) Insert(ctx context.Context, objectApi string, options InsertOptions) (*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString("data: " + objectApi + "__insert(")
-	buffer.WriteString(" doc:")
-	text, err := o.docToGrpahqlArgumentText(objectApi, options.Doc)
+	err = o.checkInputDocument(object, options.Doc)
 	if err != nil {
 		return nil, err
 	}
-	buffer.WriteString(text)
-	if options.Index != nil {
-		buffer.WriteString(" index:")
-		buffer.WriteString(gconv.String(options.Index))
+	pos, err := newIndexPosition(options.Index, options.Dir, options.Absolute)
+	if err != nil {
+		return nil, err
 	}
-	if options.Dir != nil {
-		buffer.WriteString(" dir:")
-		buffer.WriteString(gconv.String(options.Dir))
+	objectId, err := o.insertHandle(ctx, object.Api, options.Doc, pos)
+	if err != nil {
+		return nil, err
 	}
-	buffer.WriteString(" absolute:")
-	buffer.WriteString(gconv.String(options.Absolute))
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarFromGraphqlResult(o.Do(ctx, buffer.String()))
+	return o.findOneVarById(ctx, object, objectId, options.Fields)
 }
 
 func (o *Objectql) Save(ctx context.Context, objectApi string, options SaveOptions) (*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString("data: " + objectApi + "__save(")
-	buffer.WriteString(" doc:")
-	text, err := o.docToGrpahqlArgumentText(objectApi, options.Doc)
+	err = o.checkInputDocument(object, options.Doc)
 	if err != nil {
 		return nil, err
 	}
-	buffer.WriteString(text)
-	if options.Index != nil {
-		buffer.WriteString(" index:")
-		buffer.WriteString(gconv.String(options.Index))
+	pos, err := newIndexPosition(options.Index, options.Dir, options.Absolute)
+	if err != nil {
+		return nil, err
 	}
-	if options.Dir != nil {
-		buffer.WriteString(" dir:")
-		buffer.WriteString(gconv.String(options.Dir))
+	objectId, err := o.saveHandle(ctx, object.Api, options.Doc, pos)
+	if err != nil {
+		return nil, err
 	}
-	buffer.WriteString(" absolute:")
-	buffer.WriteString(gconv.String(options.Absolute))
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarFromGraphqlResult(o.Do(ctx, buffer.String()))
+	return o.findOneVarById(ctx, object, objectId, options.Fields)
 }
 
 func (o *Objectql) Update(ctx context.Context, objectApi string, options UpdateOptions) ([]*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
 	if len(options.Filter) == 0 {
 		return nil, errors.New("filter can't empty")
 	}
-	filterStr, err := valueToJsonString(options.Filter)
+	filter, err := parseMongoFilterFromMap(options.Filter)
 	if err != nil {
 		return nil, err
 	}
-	docStr, err := o.docToGrpahqlArgumentText(objectApi, options.Doc)
+	err = o.checkInputDocument(object, options.Doc)
 	if err != nil {
 		return nil, err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString("data: " + objectApi + "__update(")
-	buffer.WriteString(" filter:")
-	buffer.WriteString(`"`)
-	buffer.WriteString(escapeString(filterStr))
-	buffer.WriteString(`"`)
-	buffer.WriteString(" doc:")
-	buffer.WriteString(docStr)
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarsFromGraphqlResult(o.Do(ctx, buffer.String()))
+	err = o.updateManyHandle(ctx, object.Api, filter, withExpectVersion(options.Doc, options.Version))
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.queryResultToVars(ctx, object, list, options.Fields)
 }
 
 func (o *Objectql) UpdateById(ctx context.Context, objectApi string, options UpdateByIdOptions) (*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
-	docStr, err := o.docToGrpahqlArgumentText(objectApi, options.Doc)
+	if len(options.ID) == 0 {
+		return nil, errors.New("id can't empty")
+	}
+	err = o.checkInputDocument(object, options.Doc)
 	if err != nil {
 		return nil, err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString("data: " + objectApi + "__updateById(")
-	buffer.WriteString(" _id:")
-	buffer.WriteString(`"` + options.ID + `"`)
-	buffer.WriteString(" doc:")
-	buffer.WriteString(docStr)
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarFromGraphqlResult(o.Do(ctx, buffer.String()))
+	err = o.updateHandle(ctx, object.Api, options.ID, withExpectVersion(options.Doc, options.Version), false)
+	if err != nil {
+		return nil, err
+	}
+	return o.findOneVarById(ctx, object, options.ID, options.Fields)
 }
 
 func (o *Objectql) Delete(ctx context.Context, objectApi string, options DeleteOptions) error {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return err
 	}
 	if len(options.Filter) == 0 {
 		return errors.New("filter can't empty")
 	}
-	filterStr, err := valueToJsonString(options.Filter)
+	filter, err := parseMongoFilterFromMap(options.Filter)
 	if err != nil {
 		return err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString(objectApi + "__delete")
-	buffer.WriteString("(filter:")
-	buffer.WriteString(`"`)
-	buffer.WriteString(escapeString(filterStr))
-	buffer.WriteString(`"`)
-	buffer.WriteString(")")
-	buffer.WriteString("}")
-	return getErrorFromGraphqlResult(o.Do(ctx, buffer.String()))
+	return o.deleteManyHandle(ctx, object.Api, filter)
 }
 
 func (o *Objectql) DeleteById(ctx context.Context, objectApi string, options DeleteByIdOptions) error {
@@ -982,126 +1097,81 @@ func (o *Objectql) DeleteById(ctx context.Context, objectApi string, options Del
 	if len(options.ID) == 0 {
 		return errors.New("id can't empty")
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString(object.Api + "__deleteById(")
-	buffer.WriteString(" _id:")
-	buffer.WriteString(`"` + options.ID + `"`)
-	buffer.WriteString(")")
-	buffer.WriteString("}")
-	return getErrorFromGraphqlResult(o.Do(ctx, buffer.String()))
+	return o.deleteHandle(ctx, object.Api, options.ID)
 }
 
 func (o *Objectql) FindList(ctx context.Context, objectApi string, options FindListOptions) ([]*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
-	var filterStr string
-	if len(options.Filter) > 0 {
-		filterStr, err = valueToJsonString(options.Filter)
-		if err != nil {
-			return nil, err
-		}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
 	}
-	// filters
-	var buffer bytes.Buffer
-	buffer.WriteString("query {")
-	buffer.WriteString("data: " + objectApi + "__findList")
-	if len(filterStr) > 0 || options.Skip != 0 || options.Top != 0 || len(options.Sort) > 0 {
-		buffer.WriteString("(")
-		if len(filterStr) > 0 {
-			buffer.WriteString(" filter:")
-			buffer.WriteString(`"`)
-			buffer.WriteString(escapeString(filterStr))
-			buffer.WriteString(`"`)
-		}
-		if options.Skip != 0 {
-			buffer.WriteString(" skip:")
-			buffer.WriteString(gconv.String(options.Skip))
-		}
-		if options.Top != 0 {
-			buffer.WriteString(" top:")
-			buffer.WriteString(gconv.String(options.Top))
-		}
-		if len(options.Sort) > 0 {
-			buffer.WriteString(" sort:")
-			buffer.WriteString(stringsToGraphqlQuery(options.Sort))
-		}
-		buffer.WriteString(")")
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
 	}
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarsFromGraphqlResult(o.Do(ctx, buffer.String()))
+	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+		Top:    options.Top,
+		Skip:   options.Skip,
+		Sort:   options.Sort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.queryResultToVars(ctx, object, list, options.Fields)
 }
 
 func (o *Objectql) FindOneById(ctx context.Context, objectApi string, options FindOneByIdOptions) (*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
 	if len(options.ID) == 0 {
 		return nil, errors.New("id can't empty")
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("query {")
-	buffer.WriteString("data: " + objectApi + "__findOneById(")
-	buffer.WriteString(" id:")
-	buffer.WriteString(`"`)
-	buffer.WriteString(escapeString(options.ID))
-	buffer.WriteString(`"`)
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarFromGraphqlResult(o.Do(ctx, buffer.String()))
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	return o.findOneVarById(ctx, object, options.ID, options.Fields)
 }
 
 func (o *Objectql) FindOne(ctx context.Context, objectApi string, options FindOneOptions) (*Var, error) {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return nil, err
 	}
 	if len(options.Filter) == 0 {
 		return nil, errors.New("filter can't empty")
 	}
-	filterStr, err := valueToJsonString(options.Filter)
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
 	if err != nil {
 		return nil, err
 	}
-	var buffer bytes.Buffer
-	buffer.WriteString("query {")
-	buffer.WriteString("data: " + objectApi + "__findOne(")
-	buffer.WriteString(" filter:")
-	buffer.WriteString(`"`)
-	buffer.WriteString(escapeString(filterStr))
-	buffer.WriteString(`"`)
-	if len(options.Sort) > 0 {
-		buffer.WriteString(" sort:")
-		buffer.WriteString(stringsToGraphqlQuery(options.Sort))
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
 	}
-	buffer.WriteString(")")
-	buffer.WriteString("{")
-	writeGraphqlQueyrFields(&buffer, options.Fields)
-	buffer.WriteString("}")
-	buffer.WriteString("}")
-	return getVarFromGraphqlResult(o.Do(ctx, buffer.String()))
-}
-
-func writeGraphqlQueyrFields(buffer *bytes.Buffer, fields []string) {
-	if len(fields) > 0 {
-		// buffer.WriteString(strings.Join(gconv.Strings(fields), ","))
-		buffer.WriteString(Strings2GraphqlFieldQuery(fields))
-	} else {
-		// buffer.WriteString(getObjectFieldsQueryString(object))
-		buffer.WriteString("_id")
+	one, err := o.mongoFindOneEx(ctx, object.Api, findOneExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+		Sort:   options.Sort,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return o.queryResultToVar(ctx, object, one, options.Fields)
 }
 
 func Strings2GraphqlFieldQuery(arr []string) string {
@@ -1150,25 +1220,23 @@ func (o *Objectql) Count(ctx context.Context, objectApi string, options CountOpt
 	if err != nil {
 		return 0, err
 	}
-	var filterStr string
-	if len(options.Filter) > 0 {
-		filterStr, err = valueToJsonString(options.Filter)
-		if err != nil {
-			return 0, err
-		}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return 0, err
 	}
-	// filters
-	var buffer bytes.Buffer
-	buffer.WriteString("query {")
-	buffer.WriteString("data: " + object.Api + "__count")
-	if len(filterStr) > 0 {
-		buffer.WriteString("(filter:")
-		buffer.WriteString(`"`)
-		buffer.WriteString(escapeString(filterStr))
-		buffer.WriteString(`")`)
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return 0, err
 	}
-	buffer.WriteString("}")
-	return getInt64FromGraphqlResult(o.Do(ctx, buffer.String()))
+	count, err := o.mongoCountEx(ctx, object.Api, countExOptions{
+		Fields: options.Fields,
+		Filter: filter,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(count), nil
 }
 
 func (o *Objectql) Aggregate(ctx context.Context, objectApi string, options AggregateOptions) ([]*Var, error) {
@@ -1198,27 +1266,164 @@ func (o *Objectql) Aggregate(ctx context.Context, objectApi string, options Aggr
 
 func (o *Objectql) Move(ctx context.Context, objectApi string, options MoveOptions) error {
 	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
-	_, err := o.MustGetObject(objectApi)
+	object, err := o.MustGetObject(objectApi)
 	if err != nil {
 		return err
 	}
-	// filters
-	var buffer bytes.Buffer
-	buffer.WriteString("mutation {")
-	buffer.WriteString("data: " + objectApi + "__move(")
-	buffer.WriteString(" _id:")
-	buffer.WriteString(`"`)
-	buffer.WriteString(escapeString(options.ID))
-	buffer.WriteString(`"`)
-	buffer.WriteString(" index:")
-	buffer.WriteString(gconv.String(options.Index))
-	buffer.WriteString(" dir:")
-	buffer.WriteString(gconv.String(options.Dir))
-	buffer.WriteString(" absolute:")
-	buffer.WriteString(gconv.String(options.Absolute))
-	buffer.WriteString(")")
-	buffer.WriteString("}")
-	return getErrorFromGraphqlResult(o.Do(ctx, buffer.String()))
+	if len(options.ID) == 0 {
+		return errors.New("id can't empty")
+	}
+	pos, err := newIndexPosition(options.Index, options.Dir, options.Absolute)
+	if err != nil {
+		return err
+	}
+	return o.moveHandle(ctx, object.Api, options.ID, *pos)
+}
+
+func newIndexPosition(index interface{}, dir interface{}, absolute bool) (*IndexPosition, error) {
+	if isNull(index) {
+		return nil, nil
+	}
+	pos := &IndexPosition{
+		Index:    gconv.Int(index),
+		Dir:      gconv.Int(dir),
+		Absolute: absolute,
+	}
+	if !(pos.Dir == 1 || pos.Dir == -1 || pos.Dir == 0) {
+		return nil, fmt.Errorf(`index position dir can't be %v`, dir)
+	}
+	return pos, nil
+}
+
+// 校验Go接口传入的文档, 规则与graphql的表单一致
+func (o *Objectql) checkInputDocument(object *Object, doc map[string]any) error {
+	for k := range doc {
+		field := FindFieldFromObject(object, k)
+		if field == nil {
+			return fmt.Errorf("can't found field '%s' from object '%s'", k, object.Api)
+		}
+		if !isFormField(field) {
+			return fmt.Errorf("field '%s.%s' can't be written", object.Api, k)
+		}
+	}
+	return nil
+}
+
+// 解析Go接口传入的过滤条件, 同样支持 $toId $toDate
+func parseMongoFilterFromMap(filter map[string]any) (M, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	result, err := preprocessMongoMap(M(filter))
+	if err != nil {
+		return nil, err
+	}
+	m, ok := result.(M)
+	if !ok {
+		return nil, fmt.Errorf("filter must be a document, got %T", result)
+	}
+	return m, nil
+}
+
+// 未指定字段时只返回_id
+func queryFieldsOrDefault(fields []string) []string {
+	if len(fields) == 0 {
+		return []string{"_id"}
+	}
+	return fields
+}
+
+func (o *Objectql) findOneVarById(ctx context.Context, object *Object, id string, fields []string) (*Var, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	one, err := o.mongoFindOneEx(ctx, object.Api, findOneExOptions{
+		Fields: queryFieldsOrDefault(fields),
+		Filter: M{
+			"_id": objectId,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.queryResultToVar(ctx, object, one, fields)
+}
+
+func (o *Objectql) queryResultToVar(ctx context.Context, object *Object, one M, fields []string) (*Var, error) {
+	if isNull(one) {
+		return nil, nil
+	}
+	result, err := o.pickQueryFields(ctx, object, one, mergeFields(queryFieldsOrDefault(fields)))
+	if err != nil {
+		return nil, err
+	}
+	return NewVar(result), nil
+}
+
+func (o *Objectql) queryResultToVars(ctx context.Context, object *Object, list []M, fields []string) ([]*Var, error) {
+	var result []*Var
+	for _, item := range list {
+		v, err := o.queryResultToVar(ctx, object, item, fields)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// 按照查询的字段裁剪结果, 与 graphqlFieldResolver 的行为保持一致
+// 没有字段查询权限的返回null, 自定义resolve的字段调用resolve获取
+func (o *Objectql) pickQueryFields(ctx context.Context, object *Object, source M, fieldsMap map[string]interface{}) (M, error) {
+	result := M{}
+	for api, sub := range fieldsMap {
+		field := FindFieldFromObject(object, api)
+		if field == nil {
+			return nil, fmt.Errorf("can't found field '%s' from object '%s'", api, object.Api)
+		}
+		if api != "_id" {
+			has, err := o.hasObjectFieldPermission(ctx, object.Api, api, FieldQuery)
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				result[api] = nil
+				continue
+			}
+		}
+		value := source[api]
+		if field.Resolve != nil {
+			var err error
+			value, err = field.Resolve(source)
+			if err != nil {
+				return nil, err
+			}
+		}
+		subFields, ok := sub.(map[string]interface{})
+		if ok && !isNull(value) {
+			var err error
+			switch n := field.Type.(type) {
+			case *ExpandType:
+				value, err = o.pickQueryFields(ctx, o.GetObject(n.ObjectApi), value.(M), subFields)
+			case *ExpandsType, *ManyToManyType, *RelatedListType:
+				var list []interface{}
+				for _, item := range value.(A) {
+					r, err := o.pickQueryFields(ctx, o.GetObject(getExpandObjectApi(n)), item.(M), subFields)
+					if err != nil {
+						return nil, err
+					}
+					list = append(list, r)
+				}
+				value = list
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[api] = value
+	}
+	return result, nil
 }
 
 func getVarsFromGraphqlResult(gr *graphql.Result) ([]*Var, error) {
@@ -1296,32 +1501,6 @@ func (o *Objectql) mapToGrpahqlFormat(doc map[string]any) (string, error) {
 	return buffer.String(), nil
 }
 
-func (o *Objectql) docToGrpahqlArgumentText(objectApi string, doc map[string]any) (string, error) {
-	object := FindObjectFromList(o.list, objectApi)
-	if object == nil {
-		return "", fmt.Errorf("can't found object '%s'", objectApi)
-	}
-	var buffer bytes.Buffer
-	buffer.WriteString("{")
-	for k, v := range doc {
-		field := FindFieldFromObject(object, k)
-		if field == nil {
-			return "", fmt.Errorf("can't found field '%s' from object '%s'", k, objectApi)
-		}
-
-		buffer.WriteString(k)
-		buffer.WriteString(":")
-
-		err := writeGraphqlArgumentValue(&buffer, v)
-		if err != nil {
-			return "", err
-		}
-		buffer.WriteString(` `) // 加个空格
-	}
-	buffer.WriteString("}")
-	return buffer.String(), nil
-}
-
 func writeGraphqlArgumentValue(buffer *bytes.Buffer, value interface{}) error {
 	if isNull(value) {
 		buffer.WriteString(`null`)
@@ -1423,11 +1602,3 @@ func escapeString(s string) string {
 	res := strconv.Quote(s)
 	return strings.Trim(res, `"`)
 }
-
-func stringsToGraphqlQuery(arr []string) string {
-	var list []string
-	for _, v := range arr {
-		list = append(list, `"`+v+`"`)
-	}
-	return "[" + strings.Join(list, ",") + "]"
-}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gogf/gf/v2/errors/gerror"
 	"github.com/gogf/gf/v2/os/gctx"
@@ -2271,3 +2272,147 @@ func TestSave(t *testing.T) {
 		return
 	}
 }
+
+func TestDirectCrud(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name:    "编号",
+				Api:     "code",
+				Type:    String,
+				Primary: true,
+			},
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "开学时间",
+				Api:  "startTime",
+				Type: DateTime,
+			},
+			{
+				Name:   "显示名称",
+				Api:    "label",
+				Type:   String,
+				Fields: []string{"code", "name"},
+				Resolve: func(m map[string]any) (interface{}, error) {
+					return gconv.String(m["code"]) + "-" + gconv.String(m["name"]), nil
+				},
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	startTime := time.Date(2023, 9, 1, 8, 0, 0, 0, time.Local)
+	res, err := oql.Insert(ctx, "class", InsertOptions{
+		Doc: map[string]any{
+			"code":      "c1",
+			"name":      "一班",
+			"startTime": startTime,
+		},
+		Fields: []string{"_id", "startTime", "label"},
+	})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	if !res.Time("startTime").Equal(startTime) {
+		t.Error("时间类型不正确", res.ToAny())
+		return
+	}
+	if res.String("label") != "c1-一班" {
+		t.Error("resolve字段不正确", res.ToAny())
+		return
+	}
+	if res.HasKey("name") {
+		t.Error("返回了未查询的字段", res.ToAny())
+		return
+	}
+	id := res.String("_id")
+	// 主键相同的记录会被修改
+	res, err = oql.Save(ctx, "class", SaveOptions{
+		Doc: map[string]any{
+			"code": "c1",
+			"name": "二班",
+		},
+		Fields: []string{"_id", "name"},
+	})
+	if err != nil {
+		t.Error("保存失败", err)
+		return
+	}
+	if res.String("_id") != id || res.String("name") != "二班" {
+		t.Error("保存结果不正确", res.ToAny())
+		return
+	}
+	list, err := oql.Update(ctx, "class", UpdateOptions{
+		Filter: map[string]any{"_id": map[string]any{"$toId": id}},
+		Doc:    map[string]any{"name": "三班"},
+		Fields: []string{"name"},
+	})
+	if err != nil {
+		t.Error("批量修改失败", err)
+		return
+	}
+	if len(list) != 1 || list[0].String("name") != "三班" {
+		t.Error("批量修改结果不正确", list)
+		return
+	}
+	_, err = oql.UpdateById(ctx, "class", UpdateByIdOptions{
+		ID:  id,
+		Doc: map[string]any{"label": "x"},
+	})
+	if err == nil {
+		t.Error("resolve字段不应该可以修改")
+		return
+	}
+	oql.SetObjectFieldPermissionCheckHandler(func(ctx context.Context, object, field string, kind PermissionKind) (bool, error) {
+		return field != "name", nil
+	})
+	one, err := oql.FindOne(ctx, "class", FindOneOptions{
+		Filter: map[string]any{"code": "c1"},
+		Fields: []string{"code", "name"},
+	})
+	if err != nil {
+		t.Error("查询失败", err)
+		return
+	}
+	if one.String("code") != "c1" || !one.IsNull("name") {
+		t.Error("字段权限不正确", one.ToAny())
+		return
+	}
+	count, err := oql.Count(ctx, "class", CountOptions{})
+	if err != nil {
+		t.Error("统计失败", err)
+		return
+	}
+	if count != 1 {
+		t.Error("统计数量不正确", count)
+		return
+	}
+	err = oql.Delete(ctx, "class", DeleteOptions{
+		Filter: map[string]any{"code": "c1"},
+	})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "class", FindOneByIdOptions{ID: id})
+	if err != nil {
+		t.Error("查询失败", err)
+		return
+	}
+	if one != nil {
+		t.Error("删除后仍能查询到数据", one.ToAny())
+	}
+}
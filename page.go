@@ -0,0 +1,396 @@
+package objectql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 未指定 first 时每页的数量
+const defaultPageSize = 20
+
+type Page struct {
+	Edges      []*PageEdge
+	PageInfo   PageInfo
+	TotalCount int
+}
+
+type PageEdge struct {
+	Cursor string
+	Node   *Var
+}
+
+type PageInfo struct {
+	HasNextPage bool
+	EndCursor   string
+}
+
+var graphqlPageInfo = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlPageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.Boolean},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+type findPageExOptions struct {
+	Fields     []string
+	Filter     M
+	Sort       []string
+	First      int
+	After      string
+	TotalCount bool
+}
+
+type findPageExResult struct {
+	List        []M
+	Cursors     []string
+	HasNextPage bool
+	TotalCount  int
+}
+
+// FindPage 基于游标的分页查询, 游标由排序字段和_id生成
+func (o *Objectql) FindPage(ctx context.Context, objectApi string, options FindPageOptions) (*Page, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	res, err := o.mongoFindPageEx(ctx, object, findPageExOptions{
+		Fields:     queryFieldsOrDefault(options.Fields),
+		Filter:     filter,
+		Sort:       options.Sort,
+		First:      options.First,
+		After:      options.After,
+		TotalCount: options.TotalCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{
+		PageInfo: PageInfo{
+			HasNextPage: res.HasNextPage,
+		},
+		TotalCount: res.TotalCount,
+	}
+	for i, item := range res.List {
+		node, err := o.queryResultToVar(ctx, object, item, options.Fields)
+		if err != nil {
+			return nil, err
+		}
+		page.Edges = append(page.Edges, &PageEdge{
+			Cursor: res.Cursors[i],
+			Node:   node,
+		})
+	}
+	if len(res.Cursors) > 0 {
+		page.PageInfo.EndCursor = res.Cursors[len(res.Cursors)-1]
+	}
+	return page, nil
+}
+
+// 游标条件合并到过滤条件的顶层 $and 中, $near 等只能在顶层的条件保持不变
+func andPageAfterFilter(filter M, after M) M {
+	if len(filter) == 0 {
+		return after
+	}
+	result := M{}
+	for k, v := range filter {
+		result[k] = v
+	}
+	switch and := result["$and"].(type) {
+	case nil:
+		result["$and"] = []any{after}
+	case []any:
+		result["$and"] = append(append([]any{}, and...), after)
+	case []M:
+		list := []any{after}
+		for _, item := range and {
+			list = append(list, item)
+		}
+		result["$and"] = list
+	default:
+		return M{"$and": []any{filter, after}}
+	}
+	return result
+}
+
+func (o *Objectql) mongoFindPageEx(ctx context.Context, object *Object, options findPageExOptions) (*findPageExResult, error) {
+	sort := getPageSort(options.Sort)
+	var sortStrs []string
+	var sortKeys []string
+	for _, e := range sort {
+		sortKeys = append(sortKeys, e.Key)
+		if e.Value == -1 {
+			sortStrs = append(sortStrs, "-"+e.Key)
+		} else {
+			sortStrs = append(sortStrs, "+"+e.Key)
+		}
+	}
+	filter := options.Filter
+	if len(options.After) > 0 {
+		values, err := decodePageCursor(options.After, sortStrs)
+		if err != nil {
+			return nil, err
+		}
+		filter = andPageAfterFilter(filter, getPageAfterFilter(sort, values))
+	}
+	first := options.First
+	if first <= 0 {
+		first = defaultPageSize
+	}
+	// 多查询一条用于判断是否还有下一页
+	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
+		Fields: append(append([]string{}, options.Fields...), sortKeys...),
+		Filter: filter,
+		Sort:   sortStrs,
+		Top:    first + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &findPageExResult{}
+	if len(list) > first {
+		list = list[:first]
+		result.HasNextPage = true
+	}
+	result.List = list
+	for _, item := range list {
+		var values []any
+		for _, key := range sortKeys {
+			value, err := o.getPageCursorValue(object, item, key)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		cursor, err := encodePageCursor(sortStrs, values)
+		if err != nil {
+			return nil, err
+		}
+		result.Cursors = append(result.Cursors, cursor)
+	}
+	if options.TotalCount {
+		result.TotalCount, err = o.mongoCountEx(ctx, object.Api, countExOptions{
+			Filter: options.Filter,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// 排序的最后总是_id, 保证顺序是唯一的
+func getPageSort(sort []string) bson.D {
+	result := convStrings2MongoSort(sort)
+	for _, e := range result {
+		if e.Key == "_id" {
+			return result
+		}
+	}
+	return append(result, bson.E{Key: "_id", Value: 1})
+}
+
+// 生成排在游标之后的过滤条件
+// (a > va) or (a = va and b > vb) or (a = va and b = vb and _id > vid)
+// 空值在升序时排在最前, 降序时排在最后
+func getPageAfterFilter(sort bson.D, values []any) M {
+	var or []any
+	for i, e := range sort {
+		eq := M{}
+		for j := 0; j < i; j++ {
+			eq[sort[j].Key] = values[j]
+		}
+		var conds []any
+		if e.Value == -1 {
+			if !isNull(values[i]) {
+				conds = append(conds, M{"$lt": values[i]}, nil)
+			}
+		} else {
+			if isNull(values[i]) {
+				conds = append(conds, M{"$ne": nil})
+			} else {
+				conds = append(conds, M{"$gt": values[i]})
+			}
+		}
+		for _, cond := range conds {
+			branch := M{}
+			for k, v := range eq {
+				branch[k] = v
+			}
+			branch[e.Key] = cond
+			or = append(or, branch)
+		}
+	}
+	if len(or) == 0 {
+		// 已经是最后一条
+		return M{"_id": M{"$exists": false}}
+	}
+	return M{"$or": or}
+}
+
+// 从查询结果中取出排序字段的值并转换为数据库中的类型
+func (o *Objectql) getPageCursorValue(object *Object, item M, key string) (any, error) {
+	parts := strings.Split(key, ".")
+	var value any = item
+	for _, part := range parts {
+		m, ok := value.(M)
+		if !ok {
+			value = nil
+			break
+		}
+		value = m[part]
+	}
+	if isNull(value) {
+		return nil, nil
+	}
+	field, err := o.getFieldByPath(object, parts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := field.Type.(*ObjectIDType); ok {
+		return primitive.ObjectIDFromHex(gconv.String(value))
+	}
+	return formatValueToDatabase(field.Type, value)
+}
+
+// 根据 a__expand.b 这样的路径查找字段
+func (o *Objectql) getFieldByPath(object *Object, parts []string) (*Field, error) {
+	for i, part := range parts {
+		field := FindFieldFromObject(object, part)
+		if field == nil {
+			return nil, fmt.Errorf("not found field %s in object %s", part, object.Api)
+		}
+		if i == len(parts)-1 {
+			return field, nil
+		}
+		expand, ok := field.Type.(*ExpandType)
+		if !ok {
+			return nil, fmt.Errorf("field %s.%s not expand", object.Api, part)
+		}
+		object = o.GetObject(expand.ObjectApi)
+		if object == nil {
+			return nil, fmt.Errorf("not found object %s", expand.ObjectApi)
+		}
+	}
+	return nil, errors.New("empty field path")
+}
+
+// 游标中保存了排序规则, 排序改变后旧的游标不能再使用
+func encodePageCursor(sort []string, values []any) (string, error) {
+	raw, err := bson.Marshal(bson.M{
+		"s": strings.Join(sort, ","),
+		"v": values,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodePageCursor(cursor string, sort []string) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", err.Error())
+	}
+	var m bson.M
+	err = bson.Unmarshal(raw, &m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", err.Error())
+	}
+	values, ok := m["v"].(primitive.A)
+	if !ok || m["s"] != strings.Join(sort, ",") || len(values) != len(sort) {
+		return nil, errors.New("invalid cursor: sort not match")
+	}
+	return values, nil
+}
+
+func (o *Objectql) getGraphqlObjectConnection(object *Object) *graphql.Object {
+	edge := graphql.NewObject(graphql.ObjectConfig{
+		Name: object.Api + "__edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.String},
+			"node":   &graphql.Field{Type: o.getGraphqlObject(object.Api)},
+		},
+	})
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: object.Api + "__connection",
+		Fields: graphql.Fields{
+			"edges":      &graphql.Field{Type: graphql.NewList(edge)},
+			"pageInfo":   &graphql.Field{Type: graphqlPageInfo},
+			"totalCount": &graphql.Field{Type: graphql.Int},
+		},
+	})
+}
+
+func (o *Objectql) graphqlQueryConnectionResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	// 对象权限检验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := o.parseMongoFindFilters(ctx, gconv.String(p.Args["filter"]))
+	if err != nil {
+		return nil, err
+	}
+	// 只查询 edges.node 中的字段
+	project := convertFieldASTsToMongoProject(p)
+	var fields []string
+	if edges, ok := project["edges"].(map[string]interface{}); ok {
+		if node, ok := edges["node"].(map[string]interface{}); ok {
+			convProjectToQueryFields("", node, &fields)
+		}
+	}
+	_, totalCount := project["totalCount"]
+	ctx, err = o.withGraphqlRelatedListArgs(ctx, p, object, "edges.node")
+	if err != nil {
+		return nil, err
+	}
+	res, err := o.mongoFindPageEx(ctx, object, findPageExOptions{
+		Fields:     append(fields, "_id"),
+		Filter:     filter,
+		Sort:       gconv.Strings(p.Args["sort"]),
+		First:      gconv.Int(p.Args["first"]),
+		After:      gconv.String(p.Args["after"]),
+		TotalCount: totalCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	edges := []M{}
+	for i, item := range res.List {
+		edges = append(edges, M{
+			"cursor": res.Cursors[i],
+			"node":   item,
+		})
+	}
+	endCursor := ""
+	if len(res.Cursors) > 0 {
+		endCursor = res.Cursors[len(res.Cursors)-1]
+	}
+	return M{
+		"edges": edges,
+		"pageInfo": M{
+			"hasNextPage": res.HasNextPage,
+			"endCursor":   endCursor,
+		},
+		"totalCount": res.TotalCount,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package objectql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+)
+
+func TestFindPage(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "分数",
+				Api:  "score",
+				Type: Int,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	class, err := oql.Insert(ctx, "class", InsertOptions{
+		Doc:    M{"name": "一班"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	for _, doc := range []M{
+		{"name": "张三", "score": 3},
+		{"name": "李四", "score": 1},
+		{"name": "王五", "score": 2},
+		{"name": "赵六", "score": 2},
+		{"name": "钱七"},
+	} {
+		doc["class"] = class.String("_id")
+		_, err = oql.Insert(ctx, "student", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入学生失败", err)
+			return
+		}
+	}
+
+	var names []string
+	after := ""
+	for i := 0; ; i++ {
+		page, err := oql.FindPage(ctx, "student", FindPageOptions{
+			Fields:     []string{"name", "class__expand.name"},
+			Sort:       []string{"-score"},
+			First:      2,
+			After:      after,
+			TotalCount: true,
+		})
+		if err != nil {
+			t.Error("分页查询失败", err)
+			return
+		}
+		if i == 0 && page.TotalCount != 5 {
+			t.Error("总数错误", page.TotalCount)
+			return
+		}
+		for _, edge := range page.Edges {
+			names = append(names, edge.Node.String("name"))
+			if edge.Node.Var("class__expand").String("name") != "一班" {
+				t.Error("关联查询结果错误", edge.Node.ToStrAnyMap())
+				return
+			}
+		}
+		// 翻页过程中新增的记录不影响后面的分页
+		if i == 0 {
+			_, err = oql.Insert(ctx, "student", InsertOptions{Doc: M{"name": "孙八", "score": 5}})
+			if err != nil {
+				t.Error("插入学生失败", err)
+				return
+			}
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		after = page.PageInfo.EndCursor
+	}
+	if strings.Join(names, ",") != "张三,王五,赵六,李四,钱七" {
+		t.Error("分页结果错误", names)
+		return
+	}
+
+	// 排序改变后游标失效
+	_, err = oql.FindPage(ctx, "student", FindPageOptions{
+		Sort:  []string{"name"},
+		After: after,
+	})
+	if err == nil {
+		t.Error("排序改变后游标应该失效")
+	}
+}
+
+// 附近查询翻页, 游标条件不能影响顶层的 $near
+func TestFindPageNear(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "门店",
+		Api:  "store",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "位置",
+				Api:  "location",
+				Type: GeoPoint,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	for _, doc := range []M{
+		{"name": "虹桥", "location": M{"lng": 121.3364, "lat": 31.1979}},
+		{"name": "陆家嘴", "location": M{"lng": 121.5055, "lat": 31.2397}},
+		{"name": "徐家汇", "location": M{"lng": 121.4365, "lat": 31.1885}},
+		{"name": "北京", "location": M{"lng": 116.4074, "lat": 39.9042}},
+	} {
+		_, err := oql.Insert(ctx, "store", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入门店失败", err)
+			return
+		}
+	}
+	var names []string
+	after := ""
+	for {
+		page, err := oql.FindPage(ctx, "store", FindPageOptions{
+			Filter: M{
+				"location": M{
+					"$near":        M{"lng": 121.4737, "lat": 31.2304},
+					"$maxDistance": 20000,
+				},
+				"$and": []any{M{"name": M{"$ne": "徐家汇"}}},
+			},
+			Fields: []string{"name"},
+			First:  1,
+			After:  after,
+		})
+		if err != nil {
+			t.Error("附近查询翻页失败", err)
+			return
+		}
+		for _, edge := range page.Edges {
+			names = append(names, edge.Node.String("name"))
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		after = page.PageInfo.EndCursor
+	}
+	if len(names) != 2 || !lo.Contains(names, "虹桥") || !lo.Contains(names, "陆家嘴") {
+		t.Error("附近查询翻页结果错误", names)
+	}
+}
@@ -44,6 +44,14 @@ func (o *Objectql) checkPrimaryDuplicate(ctx context.Context, object *Object, af
 			filter[f.Api] = mongoV
 		}
 	}
+	// 主键只在当前租户内唯一
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return err
+	}
+	if tenant != nil {
+		filter[tenantFieldApi] = tenant[tenantFieldApi]
+	}
 
 	count, err := o.mongoCount(ctx, object.Api, filter)
 	if err != nil {
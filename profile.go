@@ -0,0 +1,177 @@
+package objectql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// QueryProfile 一次数据库调用的记录, 驱动实现了 ProfileDriver 时每次调用都会记录
+type QueryProfile struct {
+	Operation string        `json:"operation"`
+	Table     string        `json:"table"`
+	Filter    M             `json:"filter,omitempty"`
+	Update    any           `json:"update,omitempty"`
+	Pipeline  []M           `json:"pipeline,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	// 返回或者写入的文档数量
+	Count int64 `json:"count"`
+	Err   error `json:"-"`
+}
+
+func (p *QueryProfile) String() string {
+	var query any
+	switch {
+	case p.Pipeline != nil:
+		query = p.Pipeline
+	case p.Update != nil:
+		query = M{"filter": p.Filter, "update": p.Update}
+	default:
+		query = p.Filter
+	}
+	raw, _ := json.Marshal(query)
+	result := fmt.Sprintf("%s %s %v %d docs %s", p.Operation, p.Table, p.Duration, p.Count, raw)
+	if p.Err != nil {
+		result += " error: " + p.Err.Error()
+	}
+	return result
+}
+
+type QueryProfileHandler func(ctx context.Context, profile *QueryProfile)
+
+type ProfileDriver interface {
+	SetProfileHandler(handler QueryProfileHandler)
+}
+
+// QueryLogger 慢查询日志, 默认使用 g.Log()
+type QueryLogger interface {
+	Warning(ctx context.Context, v ...interface{})
+}
+
+func (o *Objectql) bindProfileHandler() {
+	driver, ok := o.driver.(ProfileDriver)
+	if !ok || (o.profileHandler == nil && o.slowQueryThreshold <= 0) {
+		return
+	}
+	driver.SetProfileHandler(o.handleQueryProfile)
+}
+
+func (o *Objectql) handleQueryProfile(ctx context.Context, profile *QueryProfile) {
+	if o.profileHandler != nil {
+		o.profileHandler(ctx, profile)
+	}
+	if o.slowQueryThreshold > 0 && profile.Duration >= o.slowQueryThreshold {
+		var logger QueryLogger = g.Log()
+		if o.slowQueryLogger != nil {
+			logger = o.slowQueryLogger
+		}
+		logger.Warning(ctx, "objectql slow query:", profile.String())
+	}
+}
+
+// 驱动中调用完成后记录
+func profileQuery(ctx context.Context, handler QueryProfileHandler, profile *QueryProfile, start time.Time) {
+	if handler == nil {
+		return
+	}
+	profile.Duration = time.Since(start)
+	handler(ctx, profile)
+}
+
+// 单个文档的调用, 没有结果时为 0
+func profileCount(doc any) int64 {
+	if isNull(doc) {
+		return 0
+	}
+	return 1
+}
+
+// ExplainDriver 返回数据库对聚合管道的执行计划
+type ExplainDriver interface {
+	Explain(ctx context.Context, table string, pipeline []M) (M, error)
+}
+
+// ExplainResult FindList 生成的聚合管道和数据库的执行计划
+type ExplainResult struct {
+	Pipeline []M `json:"pipeline"`
+	// 驱动不支持 explain 时为空
+	Explain M `json:"explain"`
+}
+
+func (o *Objectql) Explain(ctx context.Context, objectApi string, options FindListOptions) (*ExplainResult, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	// 和 mongoFindAllEx 生成相同的管道
+	findOptions, _ := o.splitCacheExpands(object, findAllExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+		Top:    options.Top,
+		Skip:   options.Skip,
+		Sort:   options.Sort,
+	})
+	pipeline, err := o.getFindAllPipeline(ctx, object, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	result := &ExplainResult{Pipeline: pipeline}
+	if driver, ok := o.driver.(ExplainDriver); ok {
+		result.Explain, err = driver.Explain(ctx, object.Api, pipeline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// 游标在关闭时记录, 耗时包括读取的时间, 数量为读取的文档数量
+type profileCursor struct {
+	Cursor
+	ctx     context.Context
+	handler QueryProfileHandler
+	profile *QueryProfile
+	start   time.Time
+	closed  bool
+}
+
+func newProfileCursor(ctx context.Context, handler QueryProfileHandler, profile *QueryProfile, start time.Time, cursor Cursor) Cursor {
+	if handler == nil {
+		return cursor
+	}
+	return &profileCursor{Cursor: cursor, ctx: ctx, handler: handler, profile: profile, start: start}
+}
+
+func (c *profileCursor) Next(ctx context.Context) bool {
+	if c.Cursor.Next(ctx) {
+		c.profile.Count++
+		return true
+	}
+	return false
+}
+
+func (c *profileCursor) Close(ctx context.Context) error {
+	err := c.Cursor.Close(ctx)
+	if !c.closed {
+		c.closed = true
+		c.profile.Err = c.Cursor.Err()
+		if c.profile.Err == nil {
+			c.profile.Err = err
+		}
+		profileQuery(c.ctx, c.handler, c.profile, c.start)
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type profileTestLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *profileTestLogger) Warning(ctx context.Context, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprint(v...))
+}
+
+func TestQueryProfile(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var profiles []*QueryProfile
+	logger := &profileTestLogger{}
+	oql := New(ObjectqlOptiosn{
+		Profile: func(ctx context.Context, profile *QueryProfile) {
+			mu.Lock()
+			defer mu.Unlock()
+			profiles = append(profiles, profile)
+		},
+		SlowQueryThreshold: time.Nanosecond,
+		SlowQueryLogger:    logger,
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "部门",
+		Api:  "dept",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "员工",
+		Api:  "user",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "部门",
+				Api:  "dept",
+				Type: NewRelate("dept"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	dept, err := oql.Insert(ctx, "dept", InsertOptions{Doc: M{"name": "研发"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入部门失败", err)
+		return
+	}
+	_, err = oql.Insert(ctx, "user", InsertOptions{Doc: M{"name": "张三", "dept": dept.String("_id")}})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	mu.Lock()
+	profiles = nil
+	mu.Unlock()
+	options := FindListOptions{
+		Filter: M{"name": "张三"},
+		Fields: []string{"name", "dept__expand.name"},
+	}
+	list, err := oql.FindList(ctx, "user", options)
+	if err != nil || len(list) != 1 {
+		t.Error("查询失败", err, list)
+		return
+	}
+	mu.Lock()
+	var aggregate *QueryProfile
+	for _, profile := range profiles {
+		if profile.Operation == "aggregate" && profile.Table == "user" {
+			aggregate = profile
+		}
+	}
+	mu.Unlock()
+	if aggregate == nil || aggregate.Count != 1 || aggregate.Duration <= 0 || !strings.Contains(aggregate.String(), "$lookup") {
+		t.Error("应该记录查询的管道和文档数量", aggregate)
+		return
+	}
+	logger.mu.Lock()
+	logged := len(logger.logs) > 0 && strings.Contains(logger.logs[len(logger.logs)-1], "slow query")
+	logger.mu.Unlock()
+	if !logged {
+		t.Error("超过阈值的查询应该输出日志")
+		return
+	}
+	// 内存驱动不支持 explain, 只返回管道
+	explain, err := oql.Explain(ctx, "user", options)
+	if err != nil {
+		t.Error("explain 失败", err)
+		return
+	}
+	if explain.Explain != nil || fmt.Sprint(explain.Pipeline) != fmt.Sprint(aggregate.Pipeline) {
+		t.Error("explain 的管道应该和查询一致", explain.Pipeline, aggregate.Pipeline)
+	}
+}
+
+func TestQueryProfileCursor(t *testing.T) {
+	ctx := context.Background()
+	var profiles []*QueryProfile
+	handler := func(ctx context.Context, profile *QueryProfile) {
+		profiles = append(profiles, profile)
+	}
+	pipeline := []M{{"$match": M{"name": "研发"}}}
+	cursor := newProfileCursor(ctx, handler, &QueryProfile{Operation: "aggregateCursor", Table: "dept", Pipeline: pipeline}, time.Now(), &listCursor{
+		list:  []M{{"name": "研发"}, {"name": "研发"}, {"name": "研发"}},
+		index: -1,
+	})
+	for i := 0; i < 2 && cursor.Next(ctx); i++ {
+	}
+	if len(profiles) != 0 {
+		t.Error("游标关闭前不应该记录", profiles)
+		return
+	}
+	// 重复关闭只记录一次
+	cursor.Close(ctx)
+	cursor.Close(ctx)
+	if len(profiles) != 1 || profiles[0].Count != 2 || profiles[0].Operation != "aggregateCursor" || len(profiles[0].Pipeline) != 1 {
+		t.Error("游标的记录错误", profiles)
+		return
+	}
+	// 没有记录时不包装
+	if _, ok := newProfileCursor(ctx, nil, &QueryProfile{}, time.Now(), &listCursor{index: -1}).(*listCursor); !ok {
+		t.Error("没有记录时应该返回原来的游标")
+	}
+}
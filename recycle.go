@@ -0,0 +1,349 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 回收站, 软删除的记录连同级联删除的记录按批次存放在这里
+const recycleCollection = "__objectql_recycle"
+
+var recycleBatchKey = "objectql_recycleBatchKey"
+
+// 一次删除操作(包括 DeleteSync 级联)共用一个批次
+type recycleBatch struct {
+	id  string
+	seq int
+}
+
+// Restore 从回收站恢复记录, 同一批次删除的记录会一起恢复
+func (o *Objectql) Restore(ctx context.Context, objectApi string, options RestoreOptions) error {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return err
+	}
+	if len(options.ID) == 0 {
+		return errors.New("id can't empty")
+	}
+	return o.restoreHandle(ctx, object.Api, options.ID)
+}
+
+// Purge 从回收站彻底删除记录, 同一批次删除的记录会一起删除
+func (o *Objectql) Purge(ctx context.Context, objectApi string, options PurgeOptions) error {
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return err
+	}
+	if len(options.ID) == 0 {
+		return errors.New("id can't empty")
+	}
+	return o.purgeHandle(ctx, object.Api, options.ID)
+}
+
+// FindRecycleList 查询回收站中的记录, 最近删除的在前面
+func (o *Objectql) FindRecycleList(ctx context.Context, objectApi string, options FindRecycleListOptions) ([]*Var, error) {
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := o.getRecycleFilter(ctx, object, M{"object": object.Api})
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.driver.Find(ctx, recycleCollection, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return gconv.Time(list[i]["deleteTime"]).After(gconv.Time(list[j]["deleteTime"]))
+	})
+	if options.Skip > 0 {
+		if options.Skip >= len(list) {
+			list = nil
+		} else {
+			list = list[options.Skip:]
+		}
+	}
+	if options.Top > 0 && options.Top < len(list) {
+		list = list[:options.Top]
+	}
+	var result []*Var
+	for _, item := range list {
+		doc := removePrimitiveTypes(item["doc"]).(M)
+		err = o.formatValueWithObject(object, doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, NewVar(M{
+			"_id":        item["recordId"],
+			"batch":      item["batch"],
+			"operator":   removePrimitiveTypes(item["operator"]),
+			"deleteTime": gconv.Time(item["deleteTime"]),
+			"doc":        doc,
+		}))
+	}
+	return result, nil
+}
+
+// 删除前把记录放入回收站, 返回带有批次信息的上下文供级联删除使用
+func (o *Objectql) recycleRecord(ctx context.Context, object *Object, id string) (context.Context, error) {
+	batch, _ := ctx.Value(recycleBatchKey).(*recycleBatch)
+	if batch == nil {
+		if !object.SoftDelete {
+			return ctx, nil
+		}
+		batch = &recycleBatch{id: primitive.NewObjectID().Hex()}
+		ctx = context.WithValue(ctx, recycleBatchKey, batch)
+	}
+	doc, err := o.driver.FindOne(ctx, object.Api, M{"_id": ObjectIdFromHex(id)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return ctx, nil
+	}
+	entry := M{
+		"object":     object.Api,
+		"recordId":   id,
+		"batch":      batch.id,
+		"seq":        batch.seq,
+		"doc":        doc,
+		"deleteTime": time.Now(),
+	}
+	batch.seq++
+	if len(o.operatorObject) > 0 && o.getOperator != nil {
+		operator, err := o.getOperator(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entry["operator"] = operator
+	}
+	_, err = o.driver.Insert(ctx, recycleCollection, entry)
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (o *Objectql) restoreHandle(ctx context.Context, api string, id string) error {
+	_, err := o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, o.restoreHandleRaw(ctx, api, id)
+	})
+	return err
+}
+
+func (o *Objectql) restoreHandleRaw(ctx context.Context, api string, id string) error {
+	object := FindObjectFromList(o.list, api)
+	if object == nil {
+		return ErrNotFoundObject
+	}
+	// 对象权限校验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectInsert)
+	if err != nil {
+		return err
+	}
+	entries, err := o.findRecycleBatch(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// 级联删除的记录需要对应对象的新增权限, 没有权限时整批都不恢复
+	checked := map[string]bool{object.Api: true}
+	for _, entry := range entries {
+		api := gconv.String(entry["object"])
+		if checked[api] {
+			continue
+		}
+		err = o.checkObjectPermission(ctx, api, ObjectInsert)
+		if err != nil {
+			return err
+		}
+		checked[api] = true
+	}
+	// 按照删除的顺序恢复, 先恢复主记录再恢复级联删除的记录
+	for _, entry := range entries {
+		err = o.restoreRecord(ctx, entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) restoreRecord(ctx context.Context, entry bson.M) error {
+	object := FindObjectFromList(o.list, gconv.String(entry["object"]))
+	if object == nil {
+		return ErrNotFoundObject
+	}
+	id := gconv.String(entry["recordId"])
+	doc, ok := entry["doc"].(bson.M)
+	if !ok {
+		return fmt.Errorf("recycle record %s.%s is broken", object.Api, id)
+	}
+	// 排序对象放到末尾, 原来的位置可能已经被占用
+	if object.Index {
+		group := M{}
+		for _, fapi := range object.IndexGroup {
+			group[fapi] = doc[fapi]
+		}
+		max, err := o.getMaxIndex(ctx, object, group)
+		if err != nil {
+			return err
+		}
+		doc["__index"] = max + 1
+	}
+	// 写入到数据库
+	_, err := o.mongoInsert(ctx, object.Api, doc)
+	if err != nil {
+		return err
+	}
+	_, err = o.driver.DeleteById(ctx, recycleCollection, entry["_id"])
+	if err != nil {
+		return err
+	}
+	delete(doc, "_id")
+	// 数据联动
+	for _, field := range object.Fields {
+		if _, ok := doc[field.Api]; ok {
+			err = o.onFieldChange(ctx, object, id, field, nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// 触发 immediate 的公式字段
+	err = o.triggerImmediateFormulaFields(ctx, object, id)
+	if err != nil {
+		return err
+	}
+	// 历史记录
+	err = o.writeHistory(ctx, object, id, HistoryRestore, nil)
+	if err != nil {
+		return err
+	}
+	// after 数据查询
+	var after *Var
+	if ctx.Value(blockEventsKey) != true {
+		after, _, err = o.queryEventObjectEntity(ctx, object, id, doc, InsertAfter)
+		if err != nil {
+			return err
+		}
+	}
+	// priamry 校验
+	err = o.checkPrimaryDuplicate(ctx, object, after)
+	if err != nil {
+		return err
+	}
+	if ctx.Value(blockEventsKey) == true {
+		return nil
+	}
+	// insertAfter 事件触发
+	err = o.triggerInsertAfter(ctx, object.Api, id, NewVar(doc))
+	if err != nil {
+		return err
+	}
+	// insertAfterEx 事件触发
+	err = o.triggerInsertAfterEx(ctx, object.Api, id, NewVar(doc), after)
+	if err != nil {
+		return err
+	}
+	// fieldChange 事件触发
+	err = o.triggerChange(ctx, object, NewVar(nil), after, InsertAfter)
+	if err != nil {
+		return err
+	}
+	// indexChange 事件触发
+	err = o.triggerIndexChange(ctx, object.Api, id, NewVar(nil), after, InsertAfter)
+	if err != nil {
+		return err
+	}
+	// subscription 推送
+	return o.publishChange(ctx, object, ChangeInsert, id, nil, nil)
+}
+
+func (o *Objectql) purgeHandle(ctx context.Context, api string, id string) error {
+	_, err := o.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		object := FindObjectFromList(o.list, api)
+		if object == nil {
+			return nil, ErrNotFoundObject
+		}
+		// 对象权限校验
+		err := o.checkObjectPermission(ctx, object.Api, ObjectDelete)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := o.findRecycleBatch(ctx, object, id)
+		if err != nil {
+			return nil, err
+		}
+		var fileIds []string
+		for _, entry := range entries {
+			_, err = o.driver.DeleteById(ctx, recycleCollection, entry["_id"])
+			if err != nil {
+				return nil, err
+			}
+			fileIds = append(fileIds, o.getRecycleEntryFileIds(entry)...)
+		}
+		// 彻底删除后回收文件
+		o.releaseFiles(ctx, fileIds)
+		return nil, nil
+	})
+	return err
+}
+
+// 查询记录所在批次的全部记录, 按删除顺序排列
+func (o *Objectql) findRecycleBatch(ctx context.Context, object *Object, id string) ([]bson.M, error) {
+	filter, err := o.getRecycleFilter(ctx, object, M{"object": object.Api, "recordId": id})
+	if err != nil {
+		return nil, err
+	}
+	one, err := o.driver.FindOne(ctx, recycleCollection, filter, M{"batch": 1})
+	if err != nil {
+		return nil, err
+	}
+	if one == nil {
+		return nil, fmt.Errorf("not found %s record %s in recycle bin", object.Api, id)
+	}
+	// 系统任务删除的批次可能包含多个租户的记录, 只取当前租户的和不隔离的对象的记录
+	filter = M{"batch": one["batch"]}
+	if o.tenantMode == TenantField {
+		tenant, err := o.getTenant(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(tenant) > 0 {
+			filter["doc."+tenantFieldApi] = M{"$in": []any{tenant, nil}}
+		}
+	}
+	list, err := o.driver.Find(ctx, recycleCollection, filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return gconv.Int(list[i]["seq"]) < gconv.Int(list[j]["seq"])
+	})
+	return list, nil
+}
+
+// 回收站中只能看到当前租户删除的记录
+func (o *Objectql) getRecycleFilter(ctx context.Context, object *Object, filter M) (M, error) {
+	tenant, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		filter["doc."+tenantFieldApi] = tenant[tenantFieldApi]
+	}
+	return filter, nil
+}
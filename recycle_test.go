@@ -0,0 +1,298 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecycle(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "部门",
+		Api:  "department",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "员工数量",
+				Api:  "staffCount",
+				Type: &AggregationType{
+					Object: "staff",
+					Relate: "department",
+					Field:  "_id",
+					Type:   Int,
+					Kind:   Count,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:       "员工",
+		Api:        "staff",
+		SoftDelete: true,
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "部门",
+				Api:  "department",
+				Type: NewRelate("department"),
+			},
+			{
+				Name: "总收入",
+				Api:  "sumWages",
+				Type: &AggregationType{
+					Object: "dayWages",
+					Relate: "staff",
+					Field:  "wages",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "日工资",
+		Api:  "dayWages",
+		Fields: []*Field{
+			{
+				Name:       "员工",
+				Api:        "staff",
+				Type:       NewRelate("staff"),
+				DeleteSync: true,
+			},
+			{
+				Name: "工资",
+				Api:  "wages",
+				Type: Int,
+			},
+		},
+	})
+	inserted := 0
+	oql.ListenInsertAfter("staff", func(ctx context.Context, id string, doc *Var) error {
+		inserted++
+		return nil
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	department, err := oql.Insert(ctx, "department", InsertOptions{
+		Doc:    M{"name": "研发部"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入部门失败", err)
+		return
+	}
+	departmentId := department.String("_id")
+	staff, err := oql.Insert(ctx, "staff", InsertOptions{
+		Doc:    M{"name": "老陈", "department": departmentId},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	staffId := staff.String("_id")
+	var wagesId string
+	for _, wages := range []int{10, 20} {
+		res, err := oql.Insert(ctx, "dayWages", InsertOptions{
+			Doc:    M{"staff": staffId, "wages": wages},
+			Fields: []string{"_id"},
+		})
+		if err != nil {
+			t.Error("插入工资失败", err)
+			return
+		}
+		wagesId = res.String("_id")
+	}
+
+	// 软删除
+	err = oql.DeleteById(ctx, "staff", DeleteByIdOptions{ID: staffId})
+	if err != nil {
+		t.Error("删除员工失败", err)
+		return
+	}
+	count, err := oql.Count(ctx, "dayWages", CountOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if count != 0 {
+		t.Error("级联删除失败", count)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "department", FindOneByIdOptions{ID: departmentId, Fields: []string{"staffCount"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one.Int("staffCount") != 0 {
+		t.Error("删除后部门员工数量错误", one.Int("staffCount"))
+		return
+	}
+	recycles, err := oql.FindRecycleList(ctx, "dayWages", FindRecycleListOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(recycles) != 2 {
+		t.Error("级联删除的记录没有放入回收站", len(recycles))
+		return
+	}
+
+	// 恢复级联删除的记录会把整个批次恢复
+	err = oql.Restore(ctx, "dayWages", RestoreOptions{ID: wagesId})
+	if err != nil {
+		t.Error("恢复失败", err)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "staff", FindOneByIdOptions{ID: staffId, Fields: []string{"name", "sumWages"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one.String("name") != "老陈" || one.Int("sumWages") != 30 {
+		t.Error("恢复员工失败", one.ToStrAnyMap())
+		return
+	}
+	one, err = oql.FindOneById(ctx, "department", FindOneByIdOptions{ID: departmentId, Fields: []string{"staffCount"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one.Int("staffCount") != 1 {
+		t.Error("恢复后部门员工数量错误", one.Int("staffCount"))
+		return
+	}
+	if inserted != 2 {
+		t.Error("恢复时没有触发 insertAfter 事件", inserted)
+		return
+	}
+	recycles, err = oql.FindRecycleList(ctx, "staff", FindRecycleListOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(recycles) != 0 {
+		t.Error("回收站没有清空", len(recycles))
+		return
+	}
+
+	// 彻底删除
+	err = oql.DeleteById(ctx, "staff", DeleteByIdOptions{ID: staffId})
+	if err != nil {
+		t.Error("删除员工失败", err)
+		return
+	}
+	err = oql.Purge(ctx, "staff", PurgeOptions{ID: staffId})
+	if err != nil {
+		t.Error("彻底删除失败", err)
+		return
+	}
+	recycles, err = oql.FindRecycleList(ctx, "dayWages", FindRecycleListOptions{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(recycles) != 0 {
+		t.Error("级联删除的记录没有被彻底删除", len(recycles))
+		return
+	}
+	err = oql.Restore(ctx, "staff", RestoreOptions{ID: staffId})
+	if err == nil {
+		t.Error("彻底删除后不能恢复")
+	}
+}
+
+type recycleRoleKey struct{}
+
+// 恢复级联删除的记录需要对应对象的新增权限
+func TestRecyclePermission(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:       "员工",
+		Api:        "staff",
+		SoftDelete: true,
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "日工资",
+		Api:  "dayWages",
+		Fields: []*Field{
+			{
+				Name:       "员工",
+				Api:        "staff",
+				Type:       NewRelate("staff"),
+				DeleteSync: true,
+			},
+			{
+				Name: "工资",
+				Api:  "wages",
+				Type: Int,
+			},
+		},
+	})
+	// 人事没有新增日工资的权限
+	oql.SetObjectPermissionCheckHandler(func(ctx context.Context, object string, kind PermissionKind) (bool, error) {
+		return !(ctx.Value(recycleRoleKey{}) == "hr" && object == "dayWages" && kind == ObjectInsert), nil
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	staff, err := oql.Insert(ctx, "staff", InsertOptions{Doc: M{"name": "张三"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	staffId := staff.String("_id")
+	_, err = oql.Insert(ctx, "dayWages", InsertOptions{Doc: M{"staff": staffId, "wages": 100}})
+	if err != nil {
+		t.Error("插入日工资失败", err)
+		return
+	}
+	err = oql.DeleteById(ctx, "staff", DeleteByIdOptions{ID: staffId})
+	if err != nil {
+		t.Error("删除员工失败", err)
+		return
+	}
+	err = oql.Restore(context.WithValue(ctx, recycleRoleKey{}, "hr"), "staff", RestoreOptions{ID: staffId})
+	if err == nil {
+		t.Error("没有级联对象的新增权限时不能恢复")
+		return
+	}
+	count, err := oql.Count(ctx, "staff", CountOptions{})
+	if err != nil || count != 0 {
+		t.Error("恢复失败时不能恢复部分记录", err, count)
+		return
+	}
+	err = oql.Restore(ctx, "staff", RestoreOptions{ID: staffId})
+	if err != nil {
+		t.Error("恢复失败", err)
+		return
+	}
+	count, err = oql.Count(ctx, "dayWages", CountOptions{})
+	if err != nil || count != 1 {
+		t.Error("级联删除的记录没有恢复", err, count)
+	}
+}
@@ -0,0 +1,257 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aundis/graphql"
+	"github.com/aundis/graphql/language/ast"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 反向一对多
+// RelatedListType 列出 Object 中 Relate 字段指向当前记录的记录(订单的明细), 字段本身不保存值
+// 查询时通过 $lookup 的子管道展开, 可以继续展开子记录的字段(lines.product__expand.name)
+// graphql 中是一个带 filter/sort/top 参数的列表字段, 参数作为子管道的 $match/$sort/$limit
+
+// graphql 中反向列表字段的参数
+type relatedListArgs struct {
+	Filter M
+	Sort   []string
+	Top    int
+}
+
+// 查询的根对象和各个路径上的参数
+type relatedListQuery struct {
+	object string
+	args   map[string]*relatedListArgs
+}
+
+var relatedListArgsKey = &struct{}{}
+
+// 参数在 fieldsMap 中的 key, 字段名不能包含 $
+const relatedListArgsField = "$args"
+
+func (o *Objectql) parseRelatedListField(object *Object, field *Field, n *RelatedListType) error {
+	target := o.GetObject(n.Object)
+	if target == nil {
+		return fmt.Errorf("related list object %s not found", n.Object)
+	}
+	relate := FindFieldFromObject(target, n.Relate)
+	if relate == nil {
+		return fmt.Errorf("related list field %s.%s not found", n.Object, n.Relate)
+	}
+	if r, ok := relate.Type.(*RelateType); !ok || r.ObjectApi != object.Api {
+		return fmt.Errorf("related list field %s.%s not relate to %s", n.Object, n.Relate, object.Api)
+	}
+	return nil
+}
+
+func (o *Objectql) getRelatedListLookupStages(ctx context.Context, n *RelatedListType, fieldsMap map[string]interface{}, parentKey string, key string) ([]map[string]interface{}, error) {
+	pipeline := []map[string]interface{}{
+		{
+			"$match": M{
+				"$expr": M{
+					"$eq": []any{"$" + n.Relate, "$$id"},
+				},
+			},
+		},
+	}
+	// 关联的对象只查询当前租户的数据
+	tenant, err := o.getTenantFilter(ctx, o.GetObject(n.Object))
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$match": tenant,
+		})
+	}
+	args, _ := fieldsMap[relatedListArgsField].(*relatedListArgs)
+	if args == nil {
+		args = &relatedListArgs{}
+	}
+	// 过滤和排序中用到的 expand 也需要 $lookup
+	var fields []string
+	getMatchReferenceFields(&fields, args.Filter)
+	fields = append(fields, getSortReferenceFields(args.Sort)...)
+	convProjectToQueryFields("", fieldsMap, &fields)
+	err = o.generateLookupStages(ctx, mergeFields(o.trimValueFieldPaths(o.GetObject(n.Object), fields)), n.Object, "", &pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if len(args.Filter) > 0 {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$match": args.Filter,
+		})
+	}
+	if len(args.Sort) > 0 {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$sort": convStrings2MongoSort(args.Sort),
+		})
+	}
+	if args.Top > 0 {
+		pipeline = append(pipeline, map[string]interface{}{
+			"$limit": args.Top,
+		})
+	}
+	return []map[string]interface{}{
+		{
+			"$lookup": map[string]interface{}{
+				"from": n.Object,
+				"let": M{
+					"id": "$" + parentKey + "_id",
+				},
+				"pipeline": pipeline,
+				"as":       parentKey + key,
+			},
+		},
+	}, nil
+}
+
+func (o *Objectql) getRelatedListFieldType(objectApi string, fieldApi string) (*RelatedListType, bool) {
+	object := o.GetObject(objectApi)
+	if object == nil {
+		return nil, false
+	}
+	field := FindFieldFromObject(object, fieldApi)
+	if field == nil {
+		return nil, false
+	}
+	n, ok := field.Type.(*RelatedListType)
+	return n, ok
+}
+
+// 反向列表字段的参数, 其他字段没有参数
+func getGraphqlRelatedListArgs(field *Field) graphql.FieldConfigArgument {
+	if !IsRelatedListType(field.Type) {
+		return nil
+	}
+	return graphql.FieldConfigArgument{
+		"filter": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "过滤条件",
+		},
+		"top": &graphql.ArgumentConfig{
+			Type:        graphql.Int,
+			Description: "返回数量限制",
+		},
+		"sort": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(graphql.String),
+			Description: "排序",
+		},
+	}
+}
+
+// 把 graphql 请求中反向列表字段的参数放到 ctx 中, prefix 为根对象在返回值中的路径
+func (o *Objectql) withGraphqlRelatedListArgs(ctx context.Context, p graphql.ResolveParams, object *Object, prefix string) (context.Context, error) {
+	args := map[string]*relatedListArgs{}
+	seen := map[string]*relatedListArgs{}
+	for _, rootFieldAst := range p.Info.FieldASTs {
+		if rootFieldAst.Name.Value != p.Info.FieldName {
+			continue
+		}
+		err := o.collectRelatedListArgs(ctx, p, rootFieldAst, "", args, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(prefix) > 0 {
+		trimed := map[string]*relatedListArgs{}
+		for path, v := range args {
+			if strings.HasPrefix(path, prefix+".") {
+				trimed[strings.TrimPrefix(path, prefix+".")] = v
+			}
+		}
+		args = trimed
+	}
+	if len(args) == 0 {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, relatedListArgsKey, &relatedListQuery{object: object.Api, args: args}), nil
+}
+
+// 查询按字段名投影, 同一个字段的多个别名只能使用相同的参数
+func (o *Objectql) collectRelatedListArgs(ctx context.Context, p graphql.ResolveParams, fieldAST *ast.Field, path string, result map[string]*relatedListArgs, seen map[string]*relatedListArgs) error {
+	if fieldAST.SelectionSet == nil {
+		return nil
+	}
+	for _, selection := range fieldAST.SelectionSet.Selections {
+		nested, ok := selection.(*ast.Field)
+		if !ok {
+			continue
+		}
+		current := nested.Name.Value
+		if len(path) > 0 {
+			current = path + "." + current
+		}
+		args := &relatedListArgs{}
+		for _, arg := range nested.Arguments {
+			value := graphqlASTValue(arg.Value, p.Info.VariableValues)
+			if isNull(value) {
+				continue
+			}
+			switch arg.Name.Value {
+			case "filter":
+				filter, err := o.parseMongoFindFilters(ctx, gconv.String(value))
+				if err != nil {
+					return err
+				}
+				args.Filter = filter
+			case "sort":
+				args.Sort = gconv.Strings(value)
+			case "top":
+				args.Top = gconv.Int(value)
+			}
+		}
+		if prev, ok := seen[current]; ok && !reflect.DeepEqual(prev, args) {
+			return fmt.Errorf("field %s has conflicting arguments in aliases", current)
+		}
+		seen[current] = args
+		if len(nested.Arguments) > 0 {
+			result[current] = args
+		}
+		err := o.collectRelatedListArgs(ctx, p, nested, current, result, seen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func graphqlASTValue(value ast.Value, vars map[string]interface{}) interface{} {
+	switch n := value.(type) {
+	case *ast.Variable:
+		return vars[n.Name.Value]
+	case *ast.ListValue:
+		var list []interface{}
+		for _, item := range n.Values {
+			list = append(list, graphqlASTValue(item, vars))
+		}
+		return list
+	}
+	return value.GetValue()
+}
+
+// 把 ctx 中的参数放到对应路径的 fieldsMap 中
+func attachRelatedListArgs(ctx context.Context, object *Object, fieldsMap map[string]interface{}) {
+	query, ok := ctx.Value(relatedListArgsKey).(*relatedListQuery)
+	if !ok || query.object != object.Api {
+		return
+	}
+	for path, args := range query.args {
+		current := fieldsMap
+		for _, part := range strings.Split(path, ".") {
+			next, _ := current[part].(map[string]interface{})
+			current = next
+			if current == nil {
+				break
+			}
+		}
+		if current != nil {
+			current[relatedListArgsField] = args
+		}
+	}
+}
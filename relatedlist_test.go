@@ -0,0 +1,197 @@
+package objectql
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRelatedList(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "订单",
+		Api:  "order",
+		Fields: []*Field{
+			{
+				Name: "单号",
+				Api:  "no",
+				Type: String,
+			},
+			{
+				Name: "明细",
+				Api:  "lines",
+				Type: NewRelatedList("orderLine", "order"),
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "商品",
+		Api:  "product",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "订单明细",
+		Api:  "orderLine",
+		Fields: []*Field{
+			{
+				Name: "订单",
+				Api:  "order",
+				Type: NewRelate("order"),
+			},
+			{
+				Name: "商品",
+				Api:  "product",
+				Type: NewRelate("product"),
+			},
+			{
+				Name: "数量",
+				Api:  "qty",
+				Type: Int,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	var productIds []string
+	for _, name := range []string{"pen", "book"} {
+		product, err := oql.Insert(ctx, "product", InsertOptions{Doc: M{"name": name}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入商品失败", err)
+			return
+		}
+		productIds = append(productIds, product.String("_id"))
+	}
+	var orderIds []string
+	for _, no := range []string{"A001", "A002"} {
+		order, err := oql.Insert(ctx, "order", InsertOptions{Doc: M{"no": no}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入订单失败", err)
+			return
+		}
+		orderIds = append(orderIds, order.String("_id"))
+	}
+	for _, doc := range []M{
+		{"order": orderIds[0], "product": productIds[0], "qty": 1},
+		{"order": orderIds[0], "product": productIds[1], "qty": 3},
+		{"order": orderIds[1], "product": productIds[0], "qty": 10},
+	} {
+		_, err = oql.Insert(ctx, "orderLine", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入订单明细失败", err)
+			return
+		}
+	}
+	_, err = oql.Insert(ctx, "order", InsertOptions{Doc: M{"no": "A003", "lines": []any{}}})
+	if err == nil {
+		t.Error("反向列表字段不能直接写入")
+		return
+	}
+	order, err := oql.FindOneById(ctx, "order", FindOneByIdOptions{ID: orderIds[0], Fields: []string{"no", "lines.qty", "lines.product__expand.name"}})
+	if err != nil {
+		t.Error("查询订单失败", err)
+		return
+	}
+	lines, _ := order.Any("lines").([]any)
+	if len(lines) != 2 || NewVar(lines[1]).Int("qty") != 3 || NewVar(lines[1]).Var("product__expand").String("name") != "book" {
+		t.Error("反向列表字段展开错误", order)
+		return
+	}
+	// 没有子字段时查询子记录的全部字段
+	order, err = oql.FindOneById(ctx, "order", FindOneByIdOptions{ID: orderIds[1], Fields: []string{"lines"}})
+	lines, _ = order.Any("lines").([]any)
+	if err != nil || len(lines) != 1 || NewVar(lines[0]).Int("qty") != 10 {
+		t.Error("反向列表字段查询错误", err, order)
+		return
+	}
+	// 按子记录的字段过滤
+	list, err := oql.FindList(ctx, "order", FindListOptions{Filter: M{"lines.qty": M{"$gte": 10}}, Fields: []string{"no"}})
+	if err != nil || len(list) != 1 || list[0].String("no") != "A002" {
+		t.Error("按反向列表字段过滤错误", err, list)
+		return
+	}
+	// graphql 参数
+	res := oql.Do(ctx, `{ order__findList(sort: ["no"]) { no lines(sort: ["-qty"], top: 1) { qty product__expand { name } } } }`)
+	items, _ := NewVar(res.Data).Any("order__findList").([]any)
+	if res.HasErrors() || len(items) != 2 {
+		t.Error("graphql 查询反向列表字段错误", res.Errors, res.Data)
+		return
+	}
+	lines, _ = NewVar(items[0]).Any("lines").([]any)
+	if len(lines) != 1 || NewVar(lines[0]).Int("qty") != 3 || NewVar(lines[0]).Var("product__expand").String("name") != "book" {
+		t.Error("graphql 反向列表字段的参数错误", res.Data)
+		return
+	}
+	res = oql.Do(ctx, `{ order__findOneById(id: "`+orderIds[0]+`") { lines(filter: "{\"product__expand.name\": \"pen\"}") { qty } } }`)
+	lines, _ = NewVar(res.Data).Var("order__findOneById").Any("lines").([]any)
+	if res.HasErrors() || len(lines) != 1 || NewVar(lines[0]).Int("qty") != 1 {
+		t.Error("graphql 反向列表字段过滤错误", res.Errors, res.Data)
+		return
+	}
+	res = oql.Do(ctx, `{ order__connection(first: 10, sort: ["no"]) { edges { node { lines(filter: "{\"qty\": {\"$gt\": 1}}") { qty } } } } }`)
+	edges, _ := NewVar(res.Data).Var("order__connection").Any("edges").([]any)
+	if res.HasErrors() || len(edges) != 2 {
+		t.Error("graphql 分页查询反向列表字段错误", res.Errors, res.Data)
+		return
+	}
+	lines, _ = NewVar(edges[0]).Var("node").Any("lines").([]any)
+	if len(lines) != 1 || NewVar(lines[0]).Int("qty") != 3 {
+		t.Error("graphql 分页查询反向列表字段的参数错误", res.Data)
+		return
+	}
+	// 别名使用相同的参数
+	res = oql.Do(ctx, `{ order__findOneById(id: "`+orderIds[0]+`") { a: lines(top: 1) { qty } b: lines(top: 1) { product } } }`)
+	lines, _ = NewVar(res.Data).Var("order__findOneById").Any("b").([]any)
+	if res.HasErrors() || len(lines) != 1 || NewVar(lines[0]).String("product") != productIds[0] {
+		t.Error("graphql 反向列表字段别名查询错误", res.Errors, res.Data)
+		return
+	}
+	// 同一个字段的别名使用不同的参数时报错, 查询按字段名投影无法区分
+	res = oql.Do(ctx, `{ order__findOneById(id: "`+orderIds[0]+`") { a: lines(top: 1) { qty } b: lines { qty } } }`)
+	if !res.HasErrors() || !strings.Contains(res.Errors[0].Message, "conflicting arguments") {
+		t.Error("反向列表字段的别名参数冲突时应该报错", res.Errors, res.Data)
+		return
+	}
+	// 关联字段必须指向当前对象
+	oql = New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "订单",
+		Api:  "order",
+		Fields: []*Field{
+			{
+				Name: "明细",
+				Api:  "lines",
+				Type: NewRelatedList("orderLine", "product"),
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "商品",
+		Api:  "product",
+	})
+	oql.AddObject(&Object{
+		Name: "订单明细",
+		Api:  "orderLine",
+		Fields: []*Field{
+			{
+				Name: "商品",
+				Api:  "product",
+				Type: NewRelate("product"),
+			},
+		},
+	})
+	if err = oql.InitObjects(ctx); err == nil || !strings.Contains(err.Error(), "not relate to order") {
+		t.Error("关联字段没有指向当前对象时初始化应该失败", err)
+	}
+}
@@ -0,0 +1,156 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 全文搜索
+// Field.Searchable 的字段会加入对象的全文索引(需要 IndexModeApply 或者 SyncIndexes 创建)
+// 搜索时 $text 必须在管道的第一个 $match 中, 相关度保存在 searchScoreField 用于排序
+
+const searchScoreField = "__score"
+
+const textIndexName = managedIndexPrefix + "text"
+
+func hasSearchableField(object *Object) bool {
+	for _, field := range object.Fields {
+		if field.Searchable {
+			return true
+		}
+	}
+	return false
+}
+
+func newTextIndexSpec(object *Object) IndexSpec {
+	index := IndexSpec{
+		Name:    textIndexName,
+		Keys:    bson.D{},
+		Weights: map[string]int{},
+	}
+	for _, field := range object.Fields {
+		if !field.Searchable {
+			continue
+		}
+		weight := field.SearchWeight
+		if weight <= 0 {
+			weight = 1
+		}
+		index.Keys = append(index.Keys, bson.E{Key: field.Api, Value: "text"})
+		index.Weights[field.Api] = weight
+	}
+	sort.Slice(index.Keys, func(i, j int) bool {
+		return index.Keys[i].Key < index.Keys[j].Key
+	})
+	return index
+}
+
+func getSearchStages(text string, tenant M) []M {
+	match := M{"$text": M{"$search": text}}
+	for k, v := range tenant {
+		match[k] = v
+	}
+	return []M{
+		{"$match": match},
+		{"$addFields": M{searchScoreField: M{"$meta": "textScore"}}},
+	}
+}
+
+// 先按相关度排序
+func getSearchSort(sort []string) bson.D {
+	return append(bson.D{{Key: searchScoreField, Value: -1}}, convStrings2MongoSort(sort)...)
+}
+
+func (o *Objectql) Search(ctx context.Context, objectApi string, options SearchOptions) ([]*Var, error) {
+	ctx = context.WithValue(ctx, blockEventsKey, options.Direct)
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	if !hasSearchableField(object) {
+		return nil, fmt.Errorf("object '%s' has no searchable field", object.Api)
+	}
+	if len(options.Text) == 0 {
+		return nil, errors.New("search text can't empty")
+	}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseMongoFilterFromMap(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.mongoFindAllEx(ctx, object.Api, findAllExOptions{
+		Fields: queryFieldsOrDefault(options.Fields),
+		Filter: filter,
+		Top:    options.Top,
+		Skip:   options.Skip,
+		Search: options.Text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o.queryResultToVars(ctx, object, list, options.Fields)
+}
+
+func (o *Objectql) initObjectGraphqlSearch(querys graphql.Fields, object *Object) {
+	if !hasSearchableField(object) {
+		return
+	}
+	querys[object.Api+"__search"] = &graphql.Field{
+		Type: graphql.NewList(o.getGraphqlObject(object.Api)),
+		Args: graphql.FieldConfigArgument{
+			"text": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "搜索内容",
+			},
+			"filter": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "过滤条件",
+			},
+			"top": &graphql.ArgumentConfig{
+				Type:        graphql.Int,
+				Description: "返回数量限制",
+			},
+			"skip": &graphql.ArgumentConfig{
+				Type:        graphql.Int,
+				Description: "跳过指定数量的返回结果，用于分页",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlQuerySearchResolver(p.Context, p, object)
+		},
+	}
+}
+
+func (o *Objectql) graphqlQuerySearchResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	// 对象权限检验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	options, err := o.parseMongoFindOptions(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	options.Search = gconv.String(p.Args["text"])
+	if len(options.Search) == 0 {
+		return nil, errors.New("search text can't empty")
+	}
+	result, err := o.mongoFindAllEx(ctx, object.Api, *options)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	oql := New(ObjectqlOptiosn{
+		IndexMode: IndexModeApply,
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "分类",
+		Api:  "category",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "文章",
+		Api:  "article",
+		Fields: []*Field{
+			{
+				Name:         "标题",
+				Api:          "title",
+				Type:         String,
+				Searchable:   true,
+				SearchWeight: 10,
+			},
+			{
+				Name:       "内容",
+				Api:        "content",
+				Type:       String,
+				Searchable: true,
+			},
+			{
+				Name: "分类",
+				Api:  "category",
+				Type: NewRelate("category"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	diffs, err := oql.DiffIndexes(ctx)
+	if err != nil || len(diffs) != 0 {
+		t.Error("全文索引应该已经创建", err, diffs)
+		return
+	}
+	category, err := oql.Insert(ctx, "category", InsertOptions{Doc: M{"name": "数据库"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入分类失败", err)
+		return
+	}
+	for _, doc := range []M{
+		{"title": "其他", "content": "这里没有提到"},
+		{"title": "索引入门", "content": "mongodb 的索引"},
+		{"title": "事务", "content": "mongodb 事务需要副本集"},
+		{"title": "mongodb 全文搜索", "content": "使用全文索引"},
+	} {
+		doc["category"] = category.String("_id")
+		_, err := oql.Insert(ctx, "article", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入文章失败", err)
+			return
+		}
+	}
+	// 标题的权重更高
+	list, err := oql.Search(ctx, "article", SearchOptions{
+		Text:   "mongodb",
+		Fields: []string{"title", "category__expand.name"},
+	})
+	if err != nil {
+		t.Error("搜索失败", err)
+		return
+	}
+	if len(list) != 3 || list[0].String("title") != "mongodb 全文搜索" || list[0].Var("category__expand").String("name") != "数据库" {
+		t.Error("搜索结果错误", list)
+		return
+	}
+	list, err = oql.Search(ctx, "article", SearchOptions{
+		Text:   "mongodb",
+		Filter: M{"title": "事务"},
+		Fields: []string{"title"},
+	})
+	if err != nil || len(list) != 1 {
+		t.Error("搜索过滤条件错误", err, list)
+		return
+	}
+	res := oql.Do(ctx, `{ article__search(text: "索引", top: 1) { title } }`)
+	if res.HasErrors() {
+		t.Error("graphql 搜索失败", res.Errors)
+		return
+	}
+	result := NewVar(res.Data).Any("article__search")
+	items, _ := result.([]any)
+	if len(items) != 1 || NewVar(items[0]).String("title") != "索引入门" {
+		t.Error("graphql 搜索结果错误", result)
+		return
+	}
+	_, err = oql.Search(ctx, "category", SearchOptions{Text: "数据库"})
+	if err == nil {
+		t.Error("没有搜索字段的对象不能搜索")
+	}
+}
@@ -0,0 +1,228 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// 选项字段
+// Select 为固定选项, SelectFrom 从其他对象的数据中取值(同时设置时 Select 优先), 写入时值必须是其中之一
+// 字符串类型的固定选项的值都是合法的 graphql 名称时生成枚举类型, 不在选项中的历史数据返回 null
+
+var graphqlSelectOption = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ObjectqlSelectOption",
+	Fields: graphql.Fields{
+		"label": &graphql.Field{Type: graphql.String},
+		"value": &graphql.Field{Type: graphqlAny},
+	},
+})
+
+var graphqlNameRegexp = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+func isSelectField(field *Field) bool {
+	return len(field.Select) > 0 || field.SelectFrom != nil
+}
+
+func hasSelectField(object *Object) bool {
+	for _, field := range object.Fields {
+		if isSelectField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// 未指定时使用对象ID作为值, 值作为显示
+func getSelectFromFields(from *SelectValueFrom) (string, string) {
+	value := from.Value
+	if len(value) == 0 {
+		value = "_id"
+	}
+	label := from.Label
+	if len(label) == 0 {
+		label = value
+	}
+	return label, value
+}
+
+// 数组字段校验每一个元素
+func (o *Objectql) validateSelectValue(ctx context.Context, object *Object, field *Field, value interface{}) error {
+	if isNull(value) || !isSelectField(field) {
+		return nil
+	}
+	values := []interface{}{value}
+	if IsArrayType(field.Type) {
+		values = gconv.Interfaces(value)
+	}
+	for _, v := range values {
+		if isNull(v) {
+			continue
+		}
+		ok, err := o.isSelectValue(ctx, field, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("validateDocument %v not in select options of %s.%s", v, object.Api, field.Api)
+		}
+	}
+	return nil
+}
+
+func (o *Objectql) isSelectValue(ctx context.Context, field *Field, value interface{}) (bool, error) {
+	if len(field.Select) > 0 {
+		for _, option := range field.Select {
+			if gconv.String(option.Value) == gconv.String(value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	from, err := o.MustGetObject(field.SelectFrom.Object)
+	if err != nil {
+		return false, err
+	}
+	_, valueApi := getSelectFromFields(field.SelectFrom)
+	valueField := FindFieldFromObject(from, valueApi)
+	if valueField == nil {
+		return false, fmt.Errorf("can't found field '%s' from object '%s'", valueApi, from.Api)
+	}
+	var v interface{}
+	if IsObjectIDType(valueField.Type) {
+		v, err = formatRelateValueToDatebase(value)
+	} else {
+		v, err = formatValueToDatabase(valueField.Type, value)
+	}
+	// 无法转换的值肯定不在选项中
+	if err != nil {
+		return false, nil
+	}
+	count, err := o.mongoCountEx(ctx, from.Api, countExOptions{
+		Filter: M{valueField.Api: v},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindSelectOptions 查询选项字段的全部选项
+func (o *Objectql) FindSelectOptions(ctx context.Context, objectApi string, fieldApi string) ([]SelectOption, error) {
+	object, err := o.MustGetObject(objectApi)
+	if err != nil {
+		return nil, err
+	}
+	// 对象权限检验
+	err = o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	return o.findSelectOptionsHandle(ctx, object, fieldApi)
+}
+
+func (o *Objectql) findSelectOptionsHandle(ctx context.Context, object *Object, fieldApi string) ([]SelectOption, error) {
+	field := FindFieldFromObject(object, fieldApi)
+	if field == nil {
+		return nil, fmt.Errorf("can't found field '%s' from object '%s'", fieldApi, object.Api)
+	}
+	if !isSelectField(field) {
+		return nil, fmt.Errorf("field '%s.%s' is not a select field", object.Api, field.Api)
+	}
+	if len(field.Select) > 0 {
+		return append([]SelectOption{}, field.Select...), nil
+	}
+	// 数据来源对象的权限
+	err := o.checkObjectPermission(ctx, field.SelectFrom.Object, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	labelApi, valueApi := getSelectFromFields(field.SelectFrom)
+	list, err := o.mongoFindAllEx(ctx, field.SelectFrom.Object, findAllExOptions{
+		Fields: []string{labelApi, valueApi},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := []SelectOption{}
+	for _, item := range list {
+		result = append(result, SelectOption{
+			Label: gconv.String(item[labelApi]),
+			Value: item[valueApi],
+		})
+	}
+	return result, nil
+}
+
+// 固定选项的枚举类型, 不能生成时返回 nil
+func (o *Objectql) getGraphqlSelectEnum(object *Object, field *Field) graphql.Output {
+	if len(field.Select) == 0 {
+		return nil
+	}
+	elem := field.Type
+	if n, ok := elem.(*ArrayType); ok {
+		elem = n.Type
+	}
+	if !IsStringType(elem) {
+		return nil
+	}
+	if field.selectEnum == nil {
+		values := graphql.EnumValueConfigMap{}
+		for _, option := range field.Select {
+			name := gconv.String(option.Value)
+			if !graphqlNameRegexp.MatchString(name) {
+				return nil
+			}
+			values[name] = &graphql.EnumValueConfig{
+				Value:       name,
+				Description: option.Label,
+			}
+		}
+		field.selectEnum = graphql.NewEnum(graphql.EnumConfig{
+			Name:   object.Api + "__" + field.Api + "__enum",
+			Values: values,
+		})
+	}
+	if IsArrayType(field.Type) {
+		return graphql.NewList(field.selectEnum)
+	}
+	return field.selectEnum
+}
+
+func (o *Objectql) initObjectGraphqlSelectOptions(querys graphql.Fields, object *Object) {
+	if !hasSelectField(object) {
+		return
+	}
+	querys[object.Api+"__selectOptions"] = &graphql.Field{
+		Type: graphql.NewList(graphqlSelectOption),
+		Args: graphql.FieldConfigArgument{
+			"field": &graphql.ArgumentConfig{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "选项字段",
+			},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlQuerySelectOptionsResolver(p.Context, p, object)
+		},
+	}
+}
+
+func (o *Objectql) graphqlQuerySelectOptionsResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	// 对象权限检验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	list, err := o.findSelectOptionsHandle(ctx, object, gconv.String(p.Args["field"]))
+	if err != nil {
+		return nil, err
+	}
+	var result []interface{}
+	for _, option := range list {
+		result = append(result, M{"label": option.Label, "value": option.Value})
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package objectql
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSelectOptions(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "部门",
+		Api:  "dept",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "编码",
+				Api:  "code",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "员工",
+		Api:  "user",
+		Fields: []*Field{
+			{
+				Name: "性别",
+				Api:  "gender",
+				Type: String,
+				Select: []SelectOption{
+					{Label: "男", Value: "male"},
+					{Label: "女", Value: "female"},
+				},
+			},
+			{
+				Name: "标签",
+				Api:  "tags",
+				Type: NewArrayType(String),
+				Select: []SelectOption{
+					{Label: "新人", Value: "new"},
+					{Label: "骨干", Value: "core"},
+				},
+			},
+			{
+				Name: "部门编码",
+				Api:  "deptCode",
+				Type: String,
+				SelectFrom: &SelectValueFrom{
+					Object: "dept",
+					Label:  "name",
+					Value:  "code",
+				},
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	for _, doc := range []M{{"name": "研发", "code": "rd"}, {"name": "测试", "code": "qa"}} {
+		_, err := oql.Insert(ctx, "dept", InsertOptions{Doc: doc})
+		if err != nil {
+			t.Error("插入部门失败", err)
+			return
+		}
+	}
+	for _, doc := range []M{
+		{"gender": "unknown"},
+		{"tags": []string{"new", "old"}},
+		{"deptCode": "ops"},
+	} {
+		_, err := oql.Insert(ctx, "user", InsertOptions{Doc: doc})
+		if err == nil {
+			t.Error("不在选项中的值不能保存", doc)
+			return
+		}
+	}
+	user, err := oql.Insert(ctx, "user", InsertOptions{
+		Doc:    M{"gender": "male", "tags": []string{"new", "core"}, "deptCode": "rd"},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	_, err = oql.UpdateById(ctx, "user", UpdateByIdOptions{ID: user.String("_id"), Doc: M{"deptCode": "ops"}})
+	if err == nil {
+		t.Error("修改时也要校验选项")
+		return
+	}
+	options, err := oql.FindSelectOptions(ctx, "user", "deptCode")
+	if err != nil || len(options) != 2 || options[0].Label != "研发" || options[0].Value != "rd" {
+		t.Error("查询数据来源的选项错误", err, options)
+		return
+	}
+	_, err = oql.FindSelectOptions(ctx, "dept", "name")
+	if err == nil {
+		t.Error("不是选项字段不能查询选项")
+		return
+	}
+	// graphql 枚举
+	res := oql.Do(ctx, `mutation {
+		user__insert(doc: { gender: female, tags: [core], deptCode: "qa" }) { gender tags }
+	}`)
+	if res.HasErrors() {
+		t.Error("graphql 插入失败", res.Errors)
+		return
+	}
+	if NewVar(res.Data).Var("user__insert").String("gender") != "female" {
+		t.Error("graphql 返回的枚举值错误", res.Data)
+		return
+	}
+	res = oql.Do(ctx, `mutation { user__insert(doc: { gender: other }) { gender } }`)
+	if !res.HasErrors() {
+		t.Error("graphql 枚举应该拒绝不在选项中的值")
+		return
+	}
+	res = oql.Do(ctx, `{ user__selectOptions(field: "gender") { label value } }`)
+	items, _ := NewVar(res.Data).Any("user__selectOptions").([]any)
+	if res.HasErrors() || len(items) != 2 || NewVar(items[1]).String("label") != "女" || NewVar(items[1]).String("value") != "female" {
+		t.Error("graphql 查询选项错误", res.Errors, res.Data)
+	}
+}
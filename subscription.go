@@ -0,0 +1,308 @@
+package objectql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/container/garray"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 订阅的变更类型
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+	ChangeMove   = "move"
+)
+
+// 订阅者, ctx 结束或者消费太慢(缓冲区满)时取消订阅
+// 推送前使用订阅者的 ctx 重新查询记录, 租户隔离和字段权限按订阅者计算
+type subscriber struct {
+	ctx    context.Context
+	object *Object
+	filter M
+	watch  []string
+	fields []string
+	mu     sync.RWMutex
+	closed bool
+	ch     chan interface{}
+}
+
+// 一次变更, 工作单元成功之后推送
+type changeEvent struct {
+	object  *Object
+	kind    string
+	id      string
+	changed []string
+	// 删除前满足过滤条件的订阅者
+	matched map[*subscriber]bool
+}
+
+// Subscribe 执行 graphql subscription, ctx 结束或者消费太慢时取消订阅并关闭返回的 channel
+func (o *Objectql) Subscribe(ctx context.Context, request string, variables ...map[string]any) chan *graphql.Result {
+	var values map[string]any
+	if len(variables) > 0 {
+		values = variables[0]
+	}
+	return graphql.Subscribe(graphql.Params{
+		Schema:         o.gschema,
+		RequestString:  request,
+		VariableValues: values,
+		Context:        withExpandLoader(ctx),
+	})
+}
+
+func (o *Objectql) initObjectGraphqlSubscription(ctx context.Context, subscriptions graphql.Fields, object *Object) error {
+	subscriptions[object.Api+"__changed"] = &graphql.Field{
+		Type: o.getGraphqlObjectChange(object),
+		Args: graphql.FieldConfigArgument{
+			"filter": &graphql.ArgumentConfig{
+				Type:        graphql.String,
+				Description: "过滤条件",
+			},
+			"fields": &graphql.ArgumentConfig{
+				Type:        graphql.NewList(graphql.String),
+				Description: "只在这些字段修改时推送",
+			},
+		},
+		Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+			return o.graphqlSubscriptionChangedResolver(p.Context, p, object)
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return p.Source, nil
+		},
+	}
+	return nil
+}
+
+func (o *Objectql) getGraphqlObjectChange(object *Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: object.Api + "__change",
+		Fields: graphql.Fields{
+			"kind":    &graphql.Field{Type: graphql.String, Description: "insert/update/delete/move"},
+			"_id":     &graphql.Field{Type: graphql.String},
+			"changed": &graphql.Field{Type: graphql.NewList(graphql.String), Description: "修改的字段"},
+			"doc":     &graphql.Field{Type: o.getGraphqlObject(object.Api), Description: "修改后的数据, 删除时为null"},
+		},
+	})
+}
+
+func (o *Objectql) graphqlSubscriptionChangedResolver(ctx context.Context, p graphql.ResolveParams, object *Object) (interface{}, error) {
+	// 对象权限检验
+	err := o.checkObjectPermission(ctx, object.Api, ObjectQuery)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := o.parseMongoFindFilters(ctx, gconv.String(p.Args["filter"]))
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	if project, ok := convertFieldASTsToMongoProject(p)["doc"].(map[string]interface{}); ok {
+		convProjectToQueryFields("", project, &fields)
+	}
+	s := &subscriber{
+		ctx:    ctx,
+		object: object,
+		filter: filter,
+		watch:  gconv.Strings(p.Args["fields"]),
+		fields: fields,
+		ch:     make(chan interface{}, 16),
+	}
+	o.addSubscriber(s)
+	go func() {
+		<-ctx.Done()
+		o.removeSubscriber(s)
+	}()
+	return s.ch, nil
+}
+
+func (o *Objectql) addSubscriber(s *subscriber) {
+	array := o.subscribers.GetOrSetFuncLock(s.object.Api, func() interface{} {
+		return garray.NewArray(true)
+	}).(*garray.Array)
+	array.Append(s)
+}
+
+// ctx 结束或者推送溢出时取消订阅, 可以重复调用
+func (o *Objectql) removeSubscriber(s *subscriber) {
+	if array, ok := o.subscribers.Get(s.object.Api).(*garray.Array); ok {
+		array.RemoveValue(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+}
+
+func (o *Objectql) getSubscribers(api string) []*subscriber {
+	array, ok := o.subscribers.Get(api).(*garray.Array)
+	if !ok {
+		return nil
+	}
+	var result []*subscriber
+	for _, item := range array.Slice() {
+		result = append(result, item.(*subscriber))
+	}
+	return result
+}
+
+// 不阻塞推送, 缓冲区满时返回 false
+func (s *subscriber) send(payload M) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return true
+	}
+	select {
+	case s.ch <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// 删除后记录已经查询不到, 删除前使用每个订阅者的 ctx 查询记录是否满足过滤条件
+// 过滤条件和查询一样支持 expand, 相关列表等, 租户隔离按订阅者计算
+func (o *Objectql) getDeleteSubscribers(ctx context.Context, object *Object, id string) (map[*subscriber]bool, error) {
+	subscribers := o.getSubscribers(object.Api)
+	if ctx.Value(blockEventsKey) == true || len(subscribers) == 0 {
+		return nil, nil
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	result := map[*subscriber]bool{}
+	for _, s := range subscribers {
+		if s.ctx.Err() != nil {
+			continue
+		}
+		filter := M{"_id": objectId}
+		if len(s.filter) > 0 {
+			filter = M{"$and": []any{filter, s.filter}}
+		}
+		one, err := o.mongoFindOneEx(s.ctx, object.Api, findOneExOptions{
+			Fields: []string{"_id"},
+			Filter: filter,
+		})
+		// 订阅者的过滤条件出错不影响删除
+		if err != nil {
+			g.Log().Error(ctx, "match subscriber filter error:", err)
+			continue
+		}
+		result[s] = one != nil
+	}
+	return result, nil
+}
+
+// 记录变更, 在 AsyncNext 中推送, 工作单元失败时不会推送
+func (o *Objectql) publishChange(ctx context.Context, object *Object, kind string, id string, changed []string, matched map[*subscriber]bool) error {
+	if len(o.getSubscribers(object.Api)) == 0 {
+		return nil
+	}
+	event := &changeEvent{
+		object:  object,
+		kind:    kind,
+		id:      id,
+		changed: changed,
+		matched: matched,
+	}
+	o.AsyncNext(ctx, func(ctx context.Context) error {
+		for _, s := range o.getSubscribers(object.Api) {
+			err := o.dispatchChange(s, event)
+			if err != nil {
+				g.Log().Error(ctx, "dispatch change error:", err)
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+// 修改的字段中的对象字段, updateTime 每次都会修改不算在内
+func getChangedFields(object *Object, doc map[string]interface{}) []string {
+	var result []string
+	for _, field := range object.Fields {
+		if !isFormField(field) || field.Api == "updateTime" {
+			continue
+		}
+		if _, ok := doc[field.Api]; ok {
+			result = append(result, field.Api)
+		}
+	}
+	return result
+}
+
+func (o *Objectql) dispatchChange(s *subscriber, event *changeEvent) error {
+	if s.ctx.Err() != nil {
+		return nil
+	}
+	// 只关注部分字段的修改
+	if len(s.watch) > 0 && (event.kind == ChangeUpdate || event.kind == ChangeMove) {
+		hit := false
+		for _, field := range event.changed {
+			hit = hit || garray.NewStrArrayFrom(s.watch).Contains(field)
+		}
+		if !hit {
+			return nil
+		}
+	}
+	// 没有权限的字段不推送
+	var changed []string
+	for _, field := range event.changed {
+		has, err := o.hasObjectFieldPermission(s.ctx, event.object.Api, field, FieldQuery)
+		if err != nil {
+			return err
+		}
+		if has {
+			changed = append(changed, field)
+		}
+	}
+	var doc interface{}
+	if event.kind == ChangeDelete {
+		if !event.matched[s] {
+			return nil
+		}
+	} else {
+		objectId, err := primitive.ObjectIDFromHex(event.id)
+		if err != nil {
+			return err
+		}
+		filter := M{"_id": objectId}
+		if len(s.filter) > 0 {
+			filter = M{"$and": []any{filter, s.filter}}
+		}
+		result, err := o.mongoFindOneEx(s.ctx, event.object.Api, findOneExOptions{
+			Fields: queryFieldsOrDefault(s.fields),
+			Filter: filter,
+		})
+		if err != nil {
+			return err
+		}
+		// 不满足过滤条件或者不属于订阅者的租户
+		if result == nil {
+			return nil
+		}
+		doc = result
+	}
+	ok := s.send(M{
+		"kind":    event.kind,
+		"_id":     event.id,
+		"changed": changed,
+		"doc":     doc,
+	})
+	// 订阅者消费太慢时关闭订阅, 丢弃事件会让客户端的数据不一致, 关闭后由客户端重新订阅
+	if !ok {
+		g.Log().Warning(s.ctx, "objectql subscriber of", event.object.Api, "is too slow, closed")
+		o.removeSubscriber(s)
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aundis/graphql"
+	"github.com/gorilla/websocket"
+)
+
+type subscriptionRoleKey struct{}
+
+func TestSubscription(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "年级",
+				Api:  "grade",
+				Type: String,
+			},
+			{
+				Name: "分数",
+				Api:  "score",
+				Type: Int,
+			},
+		},
+	})
+	// 访客没有分数字段的权限
+	oql.SetObjectFieldPermissionCheckHandler(func(ctx context.Context, object string, field string, kind PermissionKind) (bool, error) {
+		return !(ctx.Value(subscriptionRoleKey{}) == "guest" && field == "score"), nil
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	recv := func(ch chan *graphql.Result) *Var {
+		select {
+		case result, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if result.HasErrors() {
+				t.Error("订阅返回错误", result.Errors)
+				return nil
+			}
+			return NewVar(result.Data).Var("student__changed")
+		case <-time.After(200 * time.Millisecond):
+			return nil
+		}
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	all := oql.Subscribe(subCtx, `subscription {
+		student__changed(filter: "{\"grade\": \"一年级\"}") { kind _id changed doc { name score } }
+	}`)
+	guestCtx, guestCancel := context.WithCancel(context.WithValue(ctx, subscriptionRoleKey{}, "guest"))
+	defer guestCancel()
+	guest := oql.Subscribe(guestCtx, `subscription {
+		student__changed(fields: ["name", "score"]) { kind changed doc { name score } }
+	}`)
+	// 等待订阅注册
+	if !waitSubscribers(oql, "student", 2) {
+		t.Error("订阅没有注册")
+		return
+	}
+
+	student, err := oql.Insert(ctx, "student", InsertOptions{
+		Doc:    M{"name": "张三", "grade": "一年级", "score": 90},
+		Fields: []string{"_id"},
+	})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	id := student.String("_id")
+	change := recv(all)
+	if change == nil || change.String("kind") != ChangeInsert || change.String("_id") != id || change.Var("doc").Int("score") != 90 {
+		t.Error("插入推送错误", change)
+		return
+	}
+	change = recv(guest)
+	if change == nil || change.Var("doc").String("name") != "张三" || !change.Var("doc").Var("score").IsNil() {
+		t.Error("访客不应该看到分数", change)
+		return
+	}
+	// 不满足过滤条件
+	_, err = oql.Insert(ctx, "student", InsertOptions{Doc: M{"name": "李四", "grade": "二年级"}})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	if change = recv(all); change != nil {
+		t.Error("不满足过滤条件不应该推送", change)
+		return
+	}
+	if change = recv(guest); change == nil || change.Var("doc").String("name") != "李四" {
+		t.Error("插入推送错误", change)
+		return
+	}
+	// 修改
+	_, err = oql.UpdateById(ctx, "student", UpdateByIdOptions{ID: id, Doc: M{"score": 95}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	change = recv(all)
+	if change == nil || change.String("kind") != ChangeUpdate || change.Var("doc").Int("score") != 95 ||
+		len(change.Strings("changed")) != 1 || change.Strings("changed")[0] != "score" {
+		t.Error("修改推送错误", change)
+		return
+	}
+	change = recv(guest)
+	if change == nil || len(change.Strings("changed")) != 0 {
+		t.Error("访客不应该看到分数的修改", change)
+		return
+	}
+	// 只关注部分字段
+	_, err = oql.UpdateById(ctx, "student", UpdateByIdOptions{ID: id, Doc: M{"grade": "一年级"}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	if recv(all) == nil {
+		t.Error("修改推送错误")
+		return
+	}
+	if change = recv(guest); change != nil {
+		t.Error("没有修改关注的字段不应该推送", change)
+		return
+	}
+	// 工作单元失败时不推送
+	_, err = oql.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		_, err := oql.UpdateById(ctx, "student", UpdateByIdOptions{ID: id, Doc: M{"score": 0}})
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("回滚")
+	})
+	if err == nil {
+		t.Error("期望事务失败")
+		return
+	}
+	if change = recv(all); change != nil {
+		t.Error("事务失败不应该推送", change)
+		return
+	}
+	recv(guest)
+	// 删除
+	err = oql.DeleteById(ctx, "student", DeleteByIdOptions{ID: id})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	change = recv(all)
+	if change == nil || change.String("kind") != ChangeDelete || change.String("_id") != id || !change.Var("doc").IsNil() {
+		t.Error("删除推送错误", change)
+		return
+	}
+	// 取消订阅后关闭 channel
+	cancel()
+	select {
+	case <-all:
+	case <-time.After(time.Second):
+		t.Error("取消订阅后应该关闭 channel")
+	}
+}
+
+// 消费太慢的订阅者被关闭, 不影响其他订阅者
+func TestSubscriptionStalled(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stalled := oql.Subscribe(subCtx, `subscription { student__changed { _id } }`)
+	active := oql.Subscribe(subCtx, `subscription { student__changed { _id } }`)
+	if !waitSubscribers(oql, "student", 2) {
+		t.Error("订阅没有注册")
+		return
+	}
+	for i := 0; i < 40; i++ {
+		_, err = oql.Insert(ctx, "student", InsertOptions{Doc: M{"name": "张三"}})
+		if err != nil {
+			t.Error("插入失败", err)
+			return
+		}
+		select {
+		case <-active:
+		case <-time.After(time.Second):
+			t.Error("其他订阅者没有收到推送", i)
+			return
+		}
+	}
+	// 推送在提交后的协程中执行, 发给其他订阅者的推送可能还没有执行完
+	for i := 0; i < 100 && len(oql.getSubscribers("student")) != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := len(oql.getSubscribers("student")); count != 1 {
+		t.Error("消费太慢的订阅者应该被关闭", count)
+		return
+	}
+	// 缓冲区中的推送读完后 channel 关闭
+	received := 0
+	for {
+		select {
+		case _, ok := <-stalled:
+			if !ok {
+				if received == 0 || received >= 40 {
+					t.Error("消费太慢的订阅者收到的推送数量错误", received)
+				}
+				return
+			}
+			received++
+		case <-time.After(time.Second):
+			t.Error("消费太慢的订阅者应该关闭 channel")
+			return
+		}
+	}
+}
+
+// 删除时的过滤条件和查询一样支持 expand
+func TestSubscriptionDelete(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "班级",
+		Api:  "class",
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	var ids []string
+	for _, name := range []string{"一班", "二班"} {
+		class, err := oql.Insert(ctx, "class", InsertOptions{Doc: M{"name": name}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入班级失败", err)
+			return
+		}
+		student, err := oql.Insert(ctx, "student", InsertOptions{Doc: M{"name": "张三", "class": class.String("_id")}, Fields: []string{"_id"}})
+		if err != nil {
+			t.Error("插入学生失败", err)
+			return
+		}
+		ids = append(ids, student.String("_id"))
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := oql.Subscribe(subCtx, `subscription {
+		student__changed(filter: "{\"class__expand.name\": \"一班\"}") { kind _id }
+	}`)
+	if !waitSubscribers(oql, "student", 1) {
+		t.Error("订阅没有注册")
+		return
+	}
+	for _, id := range ids {
+		err = oql.DeleteById(ctx, "student", DeleteByIdOptions{ID: id})
+		if err != nil {
+			t.Error("删除失败", err)
+			return
+		}
+	}
+	select {
+	case result := <-ch:
+		change := NewVar(result.Data).Var("student__changed")
+		if result.HasErrors() || change.String("kind") != ChangeDelete || change.String("_id") != ids[0] {
+			t.Error("删除推送错误", result.Errors, result.Data)
+			return
+		}
+	case <-time.After(time.Second):
+		t.Error("满足过滤条件的删除应该推送")
+		return
+	}
+	select {
+	case result := <-ch:
+		t.Error("不满足过滤条件的删除不应该推送", result.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSubscriptionWebsocket(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name: "学生",
+		Api:  "student",
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	server := httptest.NewServer(oql.SubscriptionHandler())
+	defer server.Close()
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Error("连接失败", err)
+		return
+	}
+	defer conn.Close()
+	read := func() M {
+		var msg M
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			t.Error("读取消息失败", err)
+		}
+		return msg
+	}
+	conn.WriteJSON(M{"type": "connection_init"})
+	if msg := read(); msg["type"] != "connection_ack" {
+		t.Error("期望 connection_ack", msg)
+		return
+	}
+	conn.WriteJSON(M{
+		"id":      "1",
+		"type":    "subscribe",
+		"payload": M{"query": "subscription { student__changed { kind doc { name } } }"},
+	})
+	if !waitSubscribers(oql, "student", 1) {
+		t.Error("订阅没有注册")
+		return
+	}
+	_, err = oql.Insert(ctx, "student", InsertOptions{Doc: M{"name": "张三"}})
+	if err != nil {
+		t.Error("插入失败", err)
+		return
+	}
+	msg := NewVar(read())
+	change := msg.Var("payload").Var("data").Var("student__changed")
+	if msg.String("type") != "next" || msg.String("id") != "1" || change.Var("doc").String("name") != "张三" {
+		t.Error("推送消息错误", msg)
+		return
+	}
+	conn.WriteJSON(M{"id": "1", "type": "complete"})
+	conn.WriteJSON(M{"type": "ping"})
+	if msg := read(); msg["type"] != "pong" {
+		t.Error("期望 pong", msg)
+	}
+}
+
+// 订阅在 graphql 的协程中注册, 等待注册完成再修改数据
+func waitSubscribers(oql *Objectql, api string, count int) bool {
+	for i := 0; i < 100; i++ {
+		if len(oql.getSubscribers(api)) >= count {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package objectql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/aundis/graphql"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gorilla/websocket"
+)
+
+// graphql over websocket
+// graphql-transport-ws 为 graphql-ws 库使用的新协议
+// graphql-ws 为 subscriptions-transport-ws 使用的旧协议
+const (
+	wsProtocolTransport = "graphql-transport-ws"
+	wsProtocolLegacy    = "graphql-ws"
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsSubscribePayload struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// 返回后关闭连接
+type wsCloseError struct {
+	code int
+	text string
+}
+
+func (e *wsCloseError) Error() string {
+	return e.text
+}
+
+type wsConnection struct {
+	o       *Objectql
+	conn    *websocket.Conn
+	legacy  bool
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	ctx     context.Context
+	cancels map[string]context.CancelFunc
+}
+
+// SubscriptionHandler 返回处理 graphql subscription 的 websocket handler, 可以挂载到 net/http
+func (o *Objectql) SubscriptionHandler(options ...SubscriptionHandlerOptions) http.Handler {
+	option := SubscriptionHandlerOptions{}
+	if len(options) > 0 {
+		option = options[0]
+	}
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{wsProtocolTransport, wsProtocolLegacy},
+		CheckOrigin:  option.CheckOrigin,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		c := &wsConnection{
+			o:       o,
+			conn:    conn,
+			legacy:  conn.Subprotocol() == wsProtocolLegacy,
+			cancels: map[string]context.CancelFunc{},
+		}
+		err = c.serve(ctx, r, option)
+		var closeErr *wsCloseError
+		if errors.As(err, &closeErr) {
+			err = c.close(closeErr.code, closeErr.text)
+		}
+		if err != nil {
+			g.Log().Error(ctx, "graphql websocket error:", err)
+		}
+	})
+}
+
+func (c *wsConnection) serve(ctx context.Context, r *http.Request, option SubscriptionHandlerOptions) error {
+	for {
+		var msg wsMessage
+		err := c.conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		switch msg.Type {
+		case "connection_init":
+			if c.ctx != nil {
+				return &wsCloseError{4429, "Too many initialisation requests"}
+			}
+			var payload M
+			if len(msg.Payload) > 0 {
+				_ = json.Unmarshal(msg.Payload, &payload)
+			}
+			c.ctx = ctx
+			if option.Context != nil {
+				c.ctx, err = option.Context(ctx, r, payload)
+				if err != nil {
+					return &wsCloseError{4403, err.Error()}
+				}
+			}
+			err = c.write(wsMessage{Type: "connection_ack"})
+		case "ping":
+			err = c.write(wsMessage{Type: "pong"})
+		case "pong":
+		case "subscribe", "start":
+			if c.ctx == nil {
+				return &wsCloseError{4401, "Unauthorized"}
+			}
+			err = c.subscribe(msg)
+		case "complete", "stop":
+			c.unsubscribe(msg.ID)
+		case "connection_terminate":
+			return nil
+		default:
+			return &wsCloseError{4400, "Unknown message type " + msg.Type}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *wsConnection) subscribe(msg wsMessage) error {
+	var payload wsSubscribePayload
+	err := json.Unmarshal(msg.Payload, &payload)
+	if err != nil {
+		return &wsCloseError{4400, "Invalid subscribe payload"}
+	}
+	c.mu.Lock()
+	if _, ok := c.cancels[msg.ID]; ok {
+		c.mu.Unlock()
+		return &wsCloseError{4409, "Subscriber for " + msg.ID + " already exists"}
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.cancels[msg.ID] = cancel
+	c.mu.Unlock()
+
+	results := graphql.Subscribe(graphql.Params{
+		Schema:         c.o.gschema,
+		RequestString:  payload.Query,
+		VariableValues: payload.Variables,
+		OperationName:  payload.OperationName,
+		Context:        withExpandLoader(ctx),
+	})
+	go func() {
+		for result := range results {
+			err := c.writeResult(msg.ID, result)
+			if err != nil {
+				cancel()
+			}
+		}
+		// 客户端主动取消时不需要发送 complete
+		c.mu.Lock()
+		_, ok := c.cancels[msg.ID]
+		delete(c.cancels, msg.ID)
+		c.mu.Unlock()
+		cancel()
+		if ok {
+			_ = c.write(wsMessage{ID: msg.ID, Type: "complete"})
+		}
+	}()
+	return nil
+}
+
+func (c *wsConnection) unsubscribe(id string) {
+	c.mu.Lock()
+	cancel, ok := c.cancels[id]
+	delete(c.cancels, id)
+	c.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (c *wsConnection) writeResult(id string, result *graphql.Result) error {
+	// 没有数据只有错误时按 error 消息返回
+	if result.Data == nil && result.HasErrors() {
+		payload, err := json.Marshal(result.Errors)
+		if err != nil {
+			return err
+		}
+		return c.write(wsMessage{ID: id, Type: "error", Payload: payload})
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	tpe := "next"
+	if c.legacy {
+		tpe = "data"
+	}
+	return c.write(wsMessage{ID: id, Type: tpe, Payload: payload})
+}
+
+func (c *wsConnection) write(msg wsMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *wsConnection) close(code int, text string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+}
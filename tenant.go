@@ -0,0 +1,184 @@
+package objectql
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 多租户
+// TenantField    开启了 Tenant 的对象在同一个库中通过 __tenant 字段隔离
+// TenantDatabase 每个租户使用单独的数据库, 只支持 MongoDriver, 租户只能包含字母, 数字, _ 和 -
+// TenantDatabase 模式下新租户需要调用 InitTenant 执行迁移和建立索引
+// GetTenant 返回空字符串时不做隔离, 例如系统任务, 需要拒绝访问时返回错误
+type TenantMode int
+
+const (
+	TenantField TenantMode = iota
+	TenantDatabase
+)
+
+const tenantFieldApi = "__tenant"
+
+// MongoDB 数据库名称最多 63 个字节
+const maxDatabaseNameLength = 63
+
+func (o *Objectql) getTenant(ctx context.Context) (string, error) {
+	if o.getTenantHandler == nil {
+		return "", nil
+	}
+	return o.getTenantHandler(ctx)
+}
+
+// 对象需要隔离时返回租户的过滤条件, 否则返回 nil
+func (o *Objectql) getTenantFilter(ctx context.Context, object *Object) (M, error) {
+	if object == nil || !object.Tenant || o.tenantMode != TenantField {
+		return nil, nil
+	}
+	tenant, err := o.getTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant) == 0 {
+		return nil, nil
+	}
+	return M{tenantFieldApi: tenant}, nil
+}
+
+// 新增的文档写入当前租户
+func (o *Objectql) initTenantValue(ctx context.Context, object *Object, doc map[string]interface{}) error {
+	filter, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return err
+	}
+	if filter != nil {
+		doc[tenantFieldApi] = filter[tenantFieldApi]
+	}
+	return nil
+}
+
+// 判断记录是否属于当前租户, 不属于时当作记录不存在
+func (o *Objectql) isTenantRecord(ctx context.Context, object *Object, id string) (bool, error) {
+	filter, err := o.getTenantFilter(ctx, object)
+	if err != nil {
+		return false, err
+	}
+	if filter == nil {
+		return true, nil
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false, err
+	}
+	filter["_id"] = objectId
+	count, err := o.mongoCount(ctx, object.Api, filter)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func andTenantFilter(filter M, tenant M) M {
+	if tenant == nil {
+		return filter
+	}
+	if len(filter) == 0 {
+		return tenant
+	}
+	return M{"$and": []any{tenant, filter}}
+}
+
+// 在聚合管道最前面加上租户过滤, $geoNear 和 $text 必须在第一个阶段
+func withTenantStage(pipeline []M, tenant M) []M {
+	if tenant == nil {
+		return pipeline
+	}
+	if len(pipeline) > 0 {
+		first := M{}
+		for k, v := range pipeline[0] {
+			first[k] = v
+		}
+		if geoNear, ok := first["$geoNear"].(map[string]any); ok {
+			stage := M{}
+			for k, v := range geoNear {
+				stage[k] = v
+			}
+			query, _ := stage["query"].(map[string]any)
+			stage["query"] = andTenantFilter(query, tenant)
+			first["$geoNear"] = stage
+			return append([]M{first}, pipeline[1:]...)
+		}
+		if match, ok := first["$match"].(map[string]any); ok {
+			first["$match"] = andTenantFilter(match, tenant)
+			return append([]M{first}, pipeline[1:]...)
+		}
+	}
+	return append([]M{{"$match": tenant}}, pipeline...)
+}
+
+// 按租户选择数据库
+func (o *Objectql) bindTenantDatabase() {
+	driver, ok := o.driver.(*MongoDriver)
+	if !ok || o.tenantMode != TenantDatabase {
+		return
+	}
+	driver.SetDatabaseResolver(func(ctx context.Context) (string, error) {
+		tenant, err := o.getTenant(ctx)
+		if err != nil || len(tenant) == 0 {
+			return "", err
+		}
+		return getTenantDatabase(driver.database, tenant)
+	})
+}
+
+// InitTenant 在租户的数据库中执行迁移和建立索引, 只对 TenantDatabase 模式生效
+// InitObjects 只初始化默认的数据库, 新租户开通或者升级之后需要对每个租户调用
+func (o *Objectql) InitTenant(ctx context.Context) error {
+	if o.tenantMode != TenantDatabase {
+		return nil
+	}
+	tenant, err := o.getTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if len(tenant) == 0 {
+		return fmt.Errorf("%w: empty tenant", ErrInvalidTenant)
+	}
+	if driver, ok := o.driver.(*MongoDriver); ok {
+		_, err = getTenantDatabase(driver.database, tenant)
+	} else {
+		err = validateTenant(tenant)
+	}
+	if err != nil {
+		return err
+	}
+	// 迁移要在索引之前, 改名后的字段才能建立索引
+	err = o.initMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	return o.initIndexes(ctx)
+}
+
+func getTenantDatabase(database, tenant string) (string, error) {
+	err := validateTenant(tenant)
+	if err != nil {
+		return "", err
+	}
+	name := database + "_" + tenant
+	if len(name) > maxDatabaseNameLength {
+		return "", fmt.Errorf("%w %q: database name %s is too long", ErrInvalidTenant, tenant, name)
+	}
+	return name, nil
+}
+
+// 租户作为数据库名称的一部分, 不能包含 / \ . 空格 " $ 等字符
+func validateTenant(tenant string) error {
+	for _, c := range tenant {
+		if c != '_' && c != '-' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return fmt.Errorf("%w %q: only letters, digits, _ and - are allowed", ErrInvalidTenant, tenant)
+		}
+	}
+	return nil
+}
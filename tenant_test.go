@@ -0,0 +1,463 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func TestTenant(t *testing.T) {
+	ctx := context.Background()
+	oql := New(ObjectqlOptiosn{
+		GetTenant: func(ctx context.Context) (string, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant, nil
+		},
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:   "班级",
+		Api:    "class",
+		Tenant: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:   "学生",
+		Api:    "student",
+		Tenant: true,
+		Index:  true,
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "班级",
+				Api:  "class",
+				Type: NewRelate("class"),
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	ctxA := context.WithValue(ctx, tenantKey{}, "a")
+	ctxB := context.WithValue(ctx, tenantKey{}, "b")
+	classA, err := oql.Insert(ctxA, "class", InsertOptions{Doc: M{"name": "A班"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	classB, err := oql.Insert(ctxB, "class", InsertOptions{Doc: M{"name": "B班"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	studentA, err := oql.Insert(ctxA, "student", InsertOptions{
+		Doc:    M{"name": "张三", "class": classA.String("_id")},
+		Fields: []string{"_id", "__index", "__tenant"},
+	})
+	if err != nil {
+		t.Error("插入学生失败", err)
+		return
+	}
+	if studentA.String("__tenant") != "a" || studentA.Int("__index") != 1 {
+		t.Error("租户字段错误", studentA.ToStrAnyMap())
+		return
+	}
+	// 关联到其他租户的记录查询不到
+	studentB, err := oql.Insert(ctxB, "student", InsertOptions{
+		Doc:    M{"name": "李四", "class": classA.String("_id")},
+		Fields: []string{"_id", "__index", "class__expand.name"},
+	})
+	if err != nil {
+		t.Error("插入学生失败", err)
+		return
+	}
+	if studentB.Int("__index") != 1 || studentB.Var("class__expand").String("name") != "" {
+		t.Error("不应该查询到其他租户的数据", studentB.ToStrAnyMap())
+		return
+	}
+	// 查询
+	list, err := oql.FindList(ctxB, "class", FindListOptions{Fields: []string{"name"}})
+	if err != nil || len(list) != 1 || list[0].String("name") != "B班" {
+		t.Error("查询结果错误", err, list)
+		return
+	}
+	count, err := oql.Count(ctxB, "student", CountOptions{})
+	if err != nil || count != 1 {
+		t.Error("统计结果错误", err, count)
+		return
+	}
+	one, err := oql.FindOneById(ctxB, "student", FindOneByIdOptions{ID: studentA.String("_id")})
+	if err != nil || one != nil {
+		t.Error("不应该查询到其他租户的数据", err, one)
+		return
+	}
+	// 修改和删除其他租户的数据不生效
+	_, err = oql.UpdateById(ctxB, "class", UpdateByIdOptions{ID: classA.String("_id"), Doc: M{"name": "改名"}})
+	if err != nil {
+		t.Error("修改失败", err)
+		return
+	}
+	err = oql.Delete(ctxB, "student", DeleteOptions{Filter: M{"name": "张三"}})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	err = oql.DeleteById(ctxB, "class", DeleteByIdOptions{ID: classA.String("_id")})
+	if err != nil {
+		t.Error("删除失败", err)
+		return
+	}
+	one, err = oql.FindOneById(ctxA, "student", FindOneByIdOptions{
+		ID:     studentA.String("_id"),
+		Fields: []string{"class__expand.name"},
+	})
+	if err != nil || one.Var("class__expand").String("name") != "A班" {
+		t.Error("其他租户的修改不应该生效", err, one)
+		return
+	}
+	// 没有租户时不隔离
+	count, err = oql.Count(ctx, "class", CountOptions{})
+	if err != nil || count != 2 {
+		t.Error("统计结果错误", err, count)
+		return
+	}
+	_, err = oql.UpdateById(ctxB, "class", UpdateByIdOptions{ID: classB.String("_id"), Doc: M{"name": "B2班"}})
+	if err != nil {
+		t.Error("修改失败", err)
+	}
+}
+
+func TestTenantPrimary(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []IndexMode{IndexModeNone, IndexModeApply} {
+		oql := New(ObjectqlOptiosn{
+			IndexMode: mode,
+			GetTenant: func(ctx context.Context) (string, error) {
+				tenant, _ := ctx.Value(tenantKey{}).(string)
+				return tenant, nil
+			},
+		})
+		oql.SetDriver(NewMemoryDriver())
+		oql.AddObject(&Object{
+			Name:   "班级",
+			Api:    "class",
+			Tenant: true,
+			Fields: []*Field{
+				{
+					Name:    "编号",
+					Api:     "code",
+					Type:    String,
+					Primary: true,
+				},
+			},
+		})
+		err := oql.InitObjects(ctx)
+		if err != nil {
+			t.Error("初始化对象失败", err)
+			return
+		}
+		ctxA := context.WithValue(ctx, tenantKey{}, "a")
+		ctxB := context.WithValue(ctx, tenantKey{}, "b")
+		// 不同租户可以使用相同的主键
+		_, err = oql.Insert(ctxA, "class", InsertOptions{Doc: M{"code": "c1"}})
+		if err != nil {
+			t.Error("插入班级失败", err)
+			return
+		}
+		_, err = oql.Insert(ctxB, "class", InsertOptions{Doc: M{"code": "c1"}})
+		if err != nil {
+			t.Error("不同租户的主键不应该冲突", mode, err)
+			return
+		}
+		// 同一个租户内主键冲突
+		_, err = oql.Insert(ctxB, "class", InsertOptions{Doc: M{"code": "c1"}})
+		if err == nil || !strings.Contains(err.Error(), "object class primary duplicate") {
+			t.Error("同一个租户内的主键应该冲突", mode, err)
+			return
+		}
+	}
+}
+
+func newTenantTestObjectql() *Objectql {
+	oql := New(ObjectqlOptiosn{
+		GetTenant: func(ctx context.Context) (string, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant, nil
+		},
+	})
+	oql.SetDriver(NewMemoryDriver())
+	return oql
+}
+
+func TestTenantAggregate(t *testing.T) {
+	ctx := context.Background()
+	oql := newTenantTestObjectql()
+	oql.AddObject(&Object{
+		Name:   "班级",
+		Api:    "class",
+		Tenant: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	ctxA := context.WithValue(ctx, tenantKey{}, "a")
+	ctxB := context.WithValue(ctx, tenantKey{}, "b")
+	for _, c := range []context.Context{ctxA, ctxA, ctxB} {
+		_, err = oql.Insert(c, "class", InsertOptions{Doc: M{"name": "一班"}})
+		if err != nil {
+			t.Error("插入班级失败", err)
+			return
+		}
+	}
+	list, err := oql.Aggregate(ctxB, "class", AggregateOptions{Pipeline: []map[string]any{
+		{"$group": M{"_id": nil, "count": M{"$sum": 1}}},
+	}})
+	if err != nil || len(list) != 1 || list[0].Int("count") != 1 {
+		t.Error("聚合不应该包含其他租户的数据", err, list)
+		return
+	}
+	// 第一个阶段是 $match 时合并租户条件
+	list, err = oql.Aggregate(ctxA, "class", AggregateOptions{Pipeline: []map[string]any{
+		{"$match": M{"name": "一班"}},
+		{"$group": M{"_id": nil, "count": M{"$sum": 1}}},
+	}})
+	if err != nil || len(list) != 1 || list[0].Int("count") != 2 {
+		t.Error("聚合不应该包含其他租户的数据", err, list)
+		return
+	}
+	res := oql.Do(ctxB, `{ class__aggregate(pipeline: "[{\"$group\": {\"_id\": null, \"count\": {\"$sum\": 1}}}]") }`)
+	items, _ := NewVar(res.Data).Any("class__aggregate").([]any)
+	if res.HasErrors() || len(items) != 1 || NewVar(items[0]).Int("count") != 1 {
+		t.Error("graphql 聚合不应该包含其他租户的数据", res.Errors, res.Data)
+		return
+	}
+}
+
+func TestTenantHistory(t *testing.T) {
+	ctx := context.Background()
+	oql := newTenantTestObjectql()
+	oql.AddObject(&Object{
+		Name:    "班级",
+		Api:     "class",
+		Tenant:  true,
+		History: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	ctxA := context.WithValue(ctx, tenantKey{}, "a")
+	ctxB := context.WithValue(ctx, tenantKey{}, "b")
+	class, err := oql.Insert(ctxA, "class", InsertOptions{Doc: M{"name": "一班"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入班级失败", err)
+		return
+	}
+	id := class.String("_id")
+	_, err = oql.UpdateById(ctxA, "class", UpdateByIdOptions{ID: id, Doc: M{"name": "二班"}})
+	if err != nil {
+		t.Error("修改班级失败", err)
+		return
+	}
+	list, err := oql.FindHistory(ctxA, "class", id)
+	if err != nil || len(list) != 2 {
+		t.Error("查询历史记录失败", err, list)
+		return
+	}
+	list, err = oql.FindHistory(ctxB, "class", id)
+	if err != nil || len(list) != 0 {
+		t.Error("不应该查询到其他租户的历史记录", err, list)
+		return
+	}
+	if err = oql.RestoreVersion(ctxB, "class", id, 1); err == nil {
+		t.Error("不应该恢复其他租户的记录")
+		return
+	}
+	// 删除后仍然按租户隔离
+	err = oql.DeleteById(ctxA, "class", DeleteByIdOptions{ID: id})
+	if err != nil {
+		t.Error("删除班级失败", err)
+		return
+	}
+	list, err = oql.FindHistory(ctxA, "class", id)
+	if err != nil || len(list) != 3 {
+		t.Error("查询历史记录失败", err, list)
+		return
+	}
+	list, err = oql.FindHistory(ctxB, "class", id)
+	if err != nil || len(list) != 0 {
+		t.Error("不应该查询到其他租户的历史记录", err, list)
+	}
+}
+
+func TestTenantRecycle(t *testing.T) {
+	ctx := context.Background()
+	oql := newTenantTestObjectql()
+	oql.AddObject(&Object{
+		Name:       "分类",
+		Api:        "category",
+		SoftDelete: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name:   "商品",
+		Api:    "product",
+		Tenant: true,
+		Fields: []*Field{
+			{
+				Name: "名称",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name:       "分类",
+				Api:        "category",
+				Type:       NewRelate("category"),
+				DeleteSync: true,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	ctxA := context.WithValue(ctx, tenantKey{}, "a")
+	ctxB := context.WithValue(ctx, tenantKey{}, "b")
+	category, err := oql.Insert(ctx, "category", InsertOptions{Doc: M{"name": "文具"}, Fields: []string{"_id"}})
+	if err != nil {
+		t.Error("插入分类失败", err)
+		return
+	}
+	id := category.String("_id")
+	for _, c := range []context.Context{ctxA, ctxB} {
+		_, err = oql.Insert(c, "product", InsertOptions{Doc: M{"name": "笔", "category": id}})
+		if err != nil {
+			t.Error("插入商品失败", err)
+			return
+		}
+	}
+	// 系统任务删除, 同一个批次中包含两个租户的商品
+	err = oql.DeleteById(ctx, "category", DeleteByIdOptions{ID: id})
+	if err != nil {
+		t.Error("删除分类失败", err)
+		return
+	}
+	err = oql.Restore(ctxA, "category", RestoreOptions{ID: id})
+	if err != nil {
+		t.Error("恢复分类失败", err)
+		return
+	}
+	count, err := oql.Count(ctx, "product", CountOptions{})
+	if err != nil || count != 1 {
+		t.Error("不应该恢复其他租户的记录", err, count)
+		return
+	}
+	list, err := oql.FindRecycleList(ctxB, "product", FindRecycleListOptions{})
+	if err != nil || len(list) != 1 {
+		t.Error("其他租户的记录应该留在回收站", err, list)
+	}
+}
+
+func TestTenantDatabase(t *testing.T) {
+	name, err := getTenantDatabase("app", "t-1_A")
+	if err != nil || name != "app_t-1_A" {
+		t.Error("租户数据库名称错误", name, err)
+		return
+	}
+	for _, tenant := range []string{"a/b", "a\\b", "a.b", "a b", "a\"b", "a$b", "租户", strings.Repeat("a", 60)} {
+		if _, err := getTenantDatabase("app", tenant); !errors.Is(err, ErrInvalidTenant) {
+			t.Error("非法的租户应该报错", tenant, err)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	count := 0
+	oql := New(ObjectqlOptiosn{
+		TenantMode:    TenantDatabase,
+		MigrationMode: MigrationModeApply,
+		GetTenant: func(ctx context.Context) (string, error) {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant, nil
+		},
+	})
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:   "班级",
+		Api:    "class",
+		Fields: []*Field{{Name: "名称", Api: "name", Type: String}},
+	})
+	oql.AddMigration(&Migration{
+		Version: 1,
+		Name:    "初始化",
+		Steps: []*MigrationStep{
+			MigrateFunc("count", func(ctx context.Context, o *Objectql) error {
+				count++
+				return nil
+			}),
+		},
+	})
+	err = oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	if err = oql.InitTenant(ctx); !errors.Is(err, ErrInvalidTenant) {
+		t.Error("没有租户时应该报错", err)
+		return
+	}
+	if err = oql.InitTenant(context.WithValue(ctx, tenantKey{}, "a.b")); !errors.Is(err, ErrInvalidTenant) {
+		t.Error("非法的租户应该报错", err)
+		return
+	}
+	// 内存驱动只有一个数据库, 换成空的驱动模拟新租户的数据库
+	oql.SetDriver(NewMemoryDriver())
+	err = oql.InitTenant(context.WithValue(ctx, tenantKey{}, "t1"))
+	if err != nil {
+		t.Error("初始化租户失败", err)
+		return
+	}
+	history, err := oql.MigrationHistory(ctx)
+	if err != nil || len(history) != 1 || count != 2 {
+		t.Error("初始化租户应该执行迁移", err, history, count)
+	}
+}
@@ -2,6 +2,7 @@ package objectql
 
 import (
 	"context"
+	"net/http"
 	"reflect"
 
 	"github.com/aundis/formula"
@@ -21,6 +22,11 @@ type Object struct {
 	hasPrimary             interface{}
 	Index                  bool
 	IndexGroup             []string
+	SoftDelete             bool // 删除的记录放入回收站, 可以恢复
+	History                bool // 记录每次修改的历史, 可以恢复到指定版本
+	Versioned              bool // 乐观锁, 每次写入都会增加 __v
+	Tenant                 bool // 按租户隔离数据, 见 ObjectqlOptiosn.GetTenant
+	Cache                  bool // 按 _id 缓存记录, 见 ObjectqlOptiosn.Cache
 	immediateFormulaFields []*Field
 	fieldMapCache          map[string]*Field
 	fieldDependencyCache   map[string][]string
@@ -90,6 +96,8 @@ type Field struct {
 	Updateable    any
 	UpdateableMsg string
 	DeleteSync    bool
+	Searchable    bool
+	SearchWeight  int // 全文搜索的权重, 默认为 1
 	Type          Type
 	Name          string
 	Api           string
@@ -102,6 +110,7 @@ type Field struct {
 	Resolve       func(map[string]any) (interface{}, error)
 
 	valueApi                   string
+	selectEnum                 *graphql.Enum // 固定选项生成的枚举类型
 	relations                  []*relationFiledInfo
 	requireSourceCode          *formula.SourceCode // 公式计算是否必填
 	requireSourceCodeFields    []string            // 公式计算中需要的字段
@@ -159,6 +168,8 @@ type DateTimeType struct{}
 type DateType struct{}
 type TimeType struct{}
 type AnyType struct{}
+type GeoPointType struct{}
+type FileType struct{}
 
 func (t *ObjectIDType) aType() {}
 func (t *IntType) aType()      {}
@@ -169,6 +180,8 @@ func (t *DateTimeType) aType() {}
 func (t *DateType) aType()     {}
 func (t *TimeType) aType()     {}
 func (t *AnyType) aType()      {}
+func (t *GeoPointType) aType() {}
+func (t *FileType) aType()     {}
 
 var ObjectID = &ObjectIDType{}
 var Int = &IntType{}
@@ -179,6 +192,8 @@ var DateTime = &DateTimeType{}
 var Date = &DateType{}
 var Time = &TimeType{}
 var Any = &AnyType{}
+var GeoPoint = &GeoPointType{}
+var File = &FileType{}
 
 type ExpandType struct {
 	ObjectApi string
@@ -204,13 +219,70 @@ func NewRelate(api string) *RelateType {
 
 func (t *RelateType) aType() {}
 
+// DecimalType 精确小数, Precision 为总位数(最多 34 位), Scale 为小数位数
+type DecimalType struct {
+	Precision int
+	Scale     int
+}
+
+func NewDecimal(precision int, scale int) *DecimalType {
+	return &DecimalType{Precision: precision, Scale: scale}
+}
+
+func (t *DecimalType) aType() {}
+
+// EmbeddedType 内嵌文档, 可以用 NewArrayType 组成数组
+type EmbeddedType struct {
+	Fields []*Field
+
+	name    string // graphql 类型名称
+	gobject *graphql.Object
+	ginput  *graphql.InputObject
+}
+
+func NewEmbedded(fields ...*Field) *EmbeddedType {
+	return &EmbeddedType{Fields: fields}
+}
+
+func (t *EmbeddedType) aType() {}
+
+// ManyToManyType 多对多关联, 关联关系保存在中间对象中, 字段本身不保存值
+type ManyToManyType struct {
+	ObjectApi   string
+	Through     string // 中间对象, 为空时生成 <对象>__<字段>
+	SourceField string // 中间对象中关联当前对象的字段
+	TargetField string // 中间对象中关联 ObjectApi 的字段
+	Reverse     string // 在关联对象上生成的反向字段
+
+	link *manyToManyLink
+}
+
+func NewManyToMany(api string) *ManyToManyType {
+	return &ManyToManyType{ObjectApi: api}
+}
+
+func (t *ManyToManyType) aType() {}
+
+// RelatedListType 反向一对多, 列出 Object 中 Relate 字段指向当前记录的记录, 字段本身不保存值
+type RelatedListType struct {
+	Object string
+	Relate string
+}
+
+func NewRelatedList(object string, relate string) *RelatedListType {
+	return &RelatedListType{Object: object, Relate: relate}
+}
+
+func (t *RelatedListType) aType() {}
+
 type FormulaType struct {
 	Formula string
 	Type    Type
 
 	immediate       bool
 	sourceCode      *formula.SourceCode
-	referenceFields []string // 公式引用到的字段
+	referenceFields []string     // 公式引用到的字段
+	decimalExpr     *decimalExpr // 小数类型的四则运算公式, 使用 big.Rat 精确计算
 }
 
 func (t *FormulaType) aType() {}
@@ -243,6 +315,7 @@ type AggregationType struct {
 	Kind     AggregationKind
 	Filter   M
 	resolved *Field
+	link     *manyToManyLink // Relate 为多对多字段时经过中间对象统计
 }
 
 func (t *AggregationType) aType() {}
@@ -354,6 +427,15 @@ type FindOneOptions struct {
 	Direct bool           `json:"direct"`
 }
 
+type SearchOptions struct {
+	Text   string         `json:"text"`
+	Filter map[string]any `json:"filter"`
+	Top    int            `json:"top"`
+	Skip   int            `json:"skip"`
+	Fields []string       `json:"fields"`
+	Direct bool           `json:"direct"`
+}
+
 type FindListOptions struct {
 	Filter map[string]any `json:"filter"`
 	Top    int            `json:"top"`
@@ -376,6 +458,39 @@ type MoveOptions struct {
 	Direct   bool   `json:"direct"`
 }
 
+type SubscriptionHandlerOptions struct {
+	// 根据 connection_init 的 payload 生成订阅使用的 ctx, 用于鉴权和租户, 返回错误时关闭连接
+	Context     func(ctx context.Context, r *http.Request, payload M) (context.Context, error)
+	CheckOrigin func(r *http.Request) bool
+}
+
+type FileHandlerOptions struct {
+	// 根据请求生成上传下载使用的 ctx, 用于鉴权和租户, 返回错误时响应 403
+	Context func(ctx context.Context, r *http.Request) (context.Context, error)
+	// 上传文件的最大字节数, 默认 32MB
+	MaxSize int64
+}
+
+type FindIterOptions struct {
+	Filter    map[string]any `json:"filter"`
+	Top       int            `json:"top"`
+	Skip      int            `json:"skip"`
+	Sort      []string       `json:"sort"`
+	Fields    []string       `json:"fields"`
+	BatchSize int            `json:"batchSize"` // 每次从数据库读取的数量
+	Direct    bool           `json:"direct"`
+}
+
+type FindPageOptions struct {
+	Filter     map[string]any `json:"filter"`
+	Fields     []string       `json:"fields"`
+	Sort       []string       `json:"sort"`
+	First      int            `json:"first"`
+	After      string         `json:"after"`
+	TotalCount bool           `json:"totalCount"`
+	Direct     bool           `json:"direct"`
+}
+
 type CountOptions struct {
 	Filter map[string]any `json:"filter"`
 	Fields []string       `json:"fields"`
@@ -401,17 +516,35 @@ type SaveOptions struct {
 }
 
 type UpdateByIdOptions struct {
-	ID     string         `json:"id"`
-	Doc    map[string]any `json:"doc"`
-	Fields []string       `json:"fields"`
-	Direct bool           `json:"direct"`
+	ID      string         `json:"id"`
+	Doc     map[string]any `json:"doc"`
+	Fields  []string       `json:"fields"`
+	Direct  bool           `json:"direct"`
+	Version int            `json:"version"` // 期望的 __v, 0 表示不校验
 }
 
 type UpdateOptions struct {
-	Filter map[string]any `json:"filter"`
-	Doc    map[string]any `json:"doc"`
-	Fields []string       `json:"fields"`
-	Direct bool           `json:"direct"`
+	Filter  map[string]any `json:"filter"`
+	Doc     map[string]any `json:"doc"`
+	Fields  []string       `json:"fields"`
+	Direct  bool           `json:"direct"`
+	Version int            `json:"version"` // 期望的 __v, 0 表示不校验
+}
+
+type InsertManyOptions struct {
+	Docs        []map[string]any `json:"docs"`
+	Fields      []string         `json:"fields"`
+	SkipInvalid bool             `json:"skipInvalid"` // 跳过校验失败的行, 否则任意一行失败全部不写入
+	Direct      bool             `json:"direct"`
+}
+
+type UpdateManyOptions struct {
+	IDs         []string         `json:"ids"`
+	Doc         map[string]any   `json:"doc"`  // 所有记录使用同一个文档
+	Docs        []map[string]any `json:"docs"` // 和 IDs 一一对应
+	Fields      []string         `json:"fields"`
+	SkipInvalid bool             `json:"skipInvalid"` // 跳过校验失败的行, 否则任意一行失败全部不写入
+	Direct      bool             `json:"direct"`
 }
 
 type DeleteByIdOptions struct {
@@ -419,11 +552,32 @@ type DeleteByIdOptions struct {
 	Direct bool   `json:"direct"`
 }
 
+type LinkOptions struct {
+	Field  string   `json:"field"`
+	ID     string   `json:"id"`
+	IDs    []string `json:"ids"`
+	Direct bool     `json:"direct"`
+}
+
 type DeleteOptions struct {
 	Filter map[string]any `json:"filter"`
 	Direct bool           `json:"direct"`
 }
 
+type RestoreOptions struct {
+	ID     string `json:"id"`
+	Direct bool   `json:"direct"`
+}
+
+type PurgeOptions struct {
+	ID string `json:"id"`
+}
+
+type FindRecycleListOptions struct {
+	Top  int `json:"top"`
+	Skip int `json:"skip"`
+}
+
 var graphqlAny = graphql.NewScalar(graphql.ScalarConfig{
 	Name:        "any",
 	Description: "interface{}",
@@ -437,7 +591,7 @@ var graphqlAny = graphql.NewScalar(graphql.ScalarConfig{
 		return value
 	},
 	ParseLiteral: func(valueAST ast.Value) interface{} {
-		return nil
+		return parseGraphqlAnyLiteral(valueAST)
 	},
 })
 
@@ -23,7 +23,11 @@ func FindObjectFromList(list []*Object, api string) *Object {
 }
 
 func FindFieldFromObject(object *Object, api string) *Field {
-	for _, field := range object.Fields {
+	return FindFieldFromFields(object.Fields, api)
+}
+
+func FindFieldFromFields(fields []*Field, api string) *Field {
+	for _, field := range fields {
 		if field.Api == api {
 			return field
 		}
@@ -86,6 +90,41 @@ func IsFloatType(tpe Type) bool {
 	return ok
 }
 
+func IsAnyType(tpe Type) bool {
+	_, ok := tpe.(*AnyType)
+	return ok
+}
+
+func IsEmbeddedType(tpe Type) bool {
+	_, ok := tpe.(*EmbeddedType)
+	return ok
+}
+
+func IsDecimalType(tpe Type) bool {
+	_, ok := tpe.(*DecimalType)
+	return ok
+}
+
+func IsManyToManyType(tpe Type) bool {
+	_, ok := tpe.(*ManyToManyType)
+	return ok
+}
+
+func IsRelatedListType(tpe Type) bool {
+	_, ok := tpe.(*RelatedListType)
+	return ok
+}
+
+func IsFileType(tpe Type) bool {
+	_, ok := tpe.(*FileType)
+	return ok
+}
+
+func IsGeoPointType(tpe Type) bool {
+	_, ok := tpe.(*GeoPointType)
+	return ok
+}
+
 func IsDateTimeType(tpe Type) bool {
 	_, ok := tpe.(*DateTimeType)
 	return ok
@@ -1,11 +1,12 @@
 package objectql
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
 
-func (o *Objectql) validateDocument(object *Object, doc map[string]interface{}) error {
+func (o *Objectql) validateDocument(ctx context.Context, object *Object, doc map[string]interface{}) error {
 	exist := map[string]bool{}
 	for k := range doc {
 		exist[k] = false
@@ -13,14 +14,30 @@ func (o *Objectql) validateDocument(object *Object, doc map[string]interface{})
 	for _, field := range object.Fields {
 		if v, ok := doc[field.Api]; ok {
 			exist[field.Api] = true
-			if !o.validateAssignable(field, v) {
-				return fmt.Errorf("validateDocument %T not assign to %s.%s", v, object.Api, field.Api)
+			if err := o.validateFieldValue(ctx, object, field, v); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+func (o *Objectql) validateFieldValue(ctx context.Context, object *Object, field *Field, v interface{}) error {
+	if !o.validateAssignable(field, v) {
+		return fmt.Errorf("validateDocument %T not assign to %s.%s", v, object.Api, field.Api)
+	}
+	// 选项字段的值必须在选项中
+	if err := o.validateSelectValue(ctx, object, field, v); err != nil {
+		return err
+	}
+	// 文件必须已经上传
+	if err := o.validateFileValue(ctx, object, field, v); err != nil {
+		return err
+	}
+	// 内嵌文档校验子字段
+	return o.validateEmbeddedValue(ctx, object, field, v)
+}
+
 // TODO: 可以支持字段自定义校验(扩展校验这一层要先通过)
 func (o *Objectql) validateAssignable(field *Field, value interface{}) bool {
 	// TODO: 允许所有字段为空
@@ -34,6 +51,8 @@ func (o *Objectql) validateAssignable(field *Field, value interface{}) bool {
 			return isIntLike(value)
 		case *FloatType:
 			return isFloatLike(value)
+		case *DecimalType:
+			return isDecimalLike(value)
 		case *StringType:
 			return isStringLick(value)
 		case *BoolType:
@@ -46,10 +65,22 @@ func (o *Objectql) validateAssignable(field *Field, value interface{}) bool {
 	}
 
 	switch n := field.Type.(type) {
-	case *IntType, *FloatType, *StringType, *BoolType, *DateTimeType:
+	case *IntType, *FloatType, *DecimalType, *StringType, *BoolType, *DateTimeType:
 		return simple(field.Type, value)
 	case *RelateType:
 		return value == nil || isStringLick(value)
+	case *GeoPointType:
+		return isGeoPointLike(value)
+	case *FileType:
+		return isFileLike(value)
+	case *EmbeddedType:
+		return isEmbeddedLike(value)
+	case *ManyToManyType:
+		// 关联关系通过 AddLinks/RemoveLinks 修改
+		return false
+	case *RelatedListType:
+		// 通过子记录的关联字段修改
+		return false
 	case *FormulaType:
 		return simple(n.Type, value)
 	case *AggregationType:
@@ -0,0 +1,79 @@
+package objectql
+
+import (
+	"context"
+
+	"github.com/gogf/gf/v2/util/gconv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 乐观锁
+// __v  每次写入都会加一
+// __ev 最后一次用户修改时的 __v, 计算字段的修改不会改变它
+// 期望的版本号不小于 __ev 就不算冲突, 这样公式和聚合字段的重新计算不会让用户的修改失败
+
+// 把期望的版本号放到文档中传给 updateHandleRaw
+func withExpectVersion(doc map[string]any, version int) map[string]any {
+	if version <= 0 {
+		return doc
+	}
+	doc = copyStrAnyMap(doc)
+	doc["__v"] = version
+	return doc
+}
+
+func (o *Objectql) mongoUpdateByIdWithVersion(ctx context.Context, object *Object, id string, doc bson.M, expect interface{}, edit bool) (int64, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+	current, err := o.driver.FindOne(ctx, object.Api, M{"_id": objectId}, M{"__v": 1, "__ev": 1})
+	if err != nil {
+		return 0, err
+	}
+	if current == nil {
+		return 0, nil
+	}
+	version := gconv.Int(current["__v"])
+	if !isNull(expect) && gconv.Int(expect) < gconv.Int(current["__ev"]) {
+		return 0, &VersionConflictError{Object: object.Api, ID: id, Expected: gconv.Int(expect), Actual: version}
+	}
+	// 分离出$set 和 $unset 不修改原有map
+	set := bson.M{}
+	unset := bson.M{}
+	for k, v := range doc {
+		if isNull(v) {
+			unset[k] = 1
+		} else {
+			set[k] = v
+		}
+	}
+	set["__v"] = version + 1
+	if edit {
+		set["__ev"] = version + 1
+	}
+	// 带上读取到的版本号, 期间被其他人修改时不会匹配
+	modified, err := o.driver.UpdateMany(ctx, object.Api, M{"_id": objectId, "__v": current["__v"]}, bson.M{
+		"$set":   set,
+		"$unset": unset,
+	})
+	if err != nil {
+		return 0, convDuplicateKeyError(object.Api, err)
+	}
+	if modified == 0 {
+		latest, err := o.driver.FindOne(ctx, object.Api, M{"_id": objectId}, M{"__v": 1})
+		if err != nil {
+			return 0, err
+		}
+		if latest == nil {
+			return 0, nil
+		}
+		return 0, &VersionConflictError{Object: object.Api, ID: id, Expected: version, Actual: gconv.Int(latest["__v"])}
+	}
+	err = o.invalidateCache(ctx, object.Api, id)
+	if err != nil {
+		return 0, err
+	}
+	return modified, nil
+}
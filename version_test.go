@@ -0,0 +1,132 @@
+package objectql
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	oql := New()
+	oql.SetDriver(NewMemoryDriver())
+	oql.AddObject(&Object{
+		Name:      "员工",
+		Api:       "staff",
+		Versioned: true,
+		Fields: []*Field{
+			{
+				Name: "姓名",
+				Api:  "name",
+				Type: String,
+			},
+			{
+				Name: "总收入",
+				Api:  "sumWages",
+				Type: &AggregationType{
+					Object: "dayWages",
+					Relate: "staff",
+					Field:  "wages",
+					Type:   Int,
+					Kind:   Sum,
+				},
+			},
+		},
+	})
+	oql.AddObject(&Object{
+		Name: "日工资",
+		Api:  "dayWages",
+		Fields: []*Field{
+			{
+				Name: "员工",
+				Api:  "staff",
+				Type: NewRelate("staff"),
+			},
+			{
+				Name: "工资",
+				Api:  "wages",
+				Type: Int,
+			},
+		},
+	})
+	err := oql.InitObjects(ctx)
+	if err != nil {
+		t.Error("初始化对象失败", err)
+		return
+	}
+	staff, err := oql.Insert(ctx, "staff", InsertOptions{
+		Doc:    M{"name": "老陈"},
+		Fields: []string{"_id", "__v"},
+	})
+	if err != nil {
+		t.Error("插入员工失败", err)
+		return
+	}
+	id := staff.String("_id")
+	if staff.Int("__v") != 1 {
+		t.Error("初始版本错误", staff.Int("__v"))
+		return
+	}
+	// 聚合字段的重新计算会增加版本号
+	_, err = oql.Insert(ctx, "dayWages", InsertOptions{
+		Doc: M{"staff": id, "wages": 10},
+	})
+	if err != nil {
+		t.Error("插入工资失败", err)
+		return
+	}
+	one, err := oql.FindOneById(ctx, "staff", FindOneByIdOptions{ID: id, Fields: []string{"__v", "sumWages"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	version := one.Int("__v")
+	if version < 2 || one.Int("sumWages") != 10 {
+		t.Error("聚合字段修改后版本错误", one.ToStrAnyMap())
+		return
+	}
+	// 但是不会和用户的修改冲突
+	res, err := oql.UpdateById(ctx, "staff", UpdateByIdOptions{
+		ID:      id,
+		Doc:     M{"name": "陈师傅"},
+		Fields:  []string{"__v"},
+		Version: 1,
+	})
+	if err != nil {
+		t.Error("修改员工失败", err)
+		return
+	}
+	if res.Int("__v") != version+1 {
+		t.Error("修改后版本错误", res.Int("__v"))
+		return
+	}
+	version = res.Int("__v")
+	// 使用过期的版本修改
+	_, err = oql.UpdateById(ctx, "staff", UpdateByIdOptions{
+		ID:      id,
+		Doc:     M{"name": "老陈"},
+		Version: version - 1,
+	})
+	var conflict *VersionConflictError
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &conflict) || conflict.Actual != version {
+		t.Error("期望版本冲突", err)
+		return
+	}
+	one, err = oql.FindOneById(ctx, "staff", FindOneByIdOptions{ID: id, Fields: []string{"name"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if one.String("name") != "陈师傅" {
+		t.Error("冲突的修改不应该生效", one.String("name"))
+		return
+	}
+	_, err = oql.Update(ctx, "staff", UpdateOptions{
+		Filter:  M{"_id": M{"$toId": id}},
+		Doc:     M{"name": "老陈"},
+		Version: version,
+	})
+	if err != nil {
+		t.Error("修改员工失败", err)
+	}
+}